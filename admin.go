@@ -0,0 +1,258 @@
+package main
+
+import (
+	acs "bkr-acs/agreementCommonSubset"
+	aba "bkr-acs/asynchronousBinaryAgreement"
+	brb "bkr-acs/byzantineReliableBroadcast"
+	ct "bkr-acs/coinTosser"
+	on "bkr-acs/overlayNetwork"
+	"bkr-acs/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/magiconair/properties"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"sync"
+	"time"
+)
+
+var errNotInitialized = errors.New("channel is not initialized yet")
+
+// adminServer exposes the state of a running node through a local HTTP API.
+// The channels are registered as they are created, so the peers can be inspected while the node is still waiting to join.
+// A nil *adminServer is valid and ignores the registrations.
+type adminServer struct {
+	node     *on.Node
+	props    *properties.Properties
+	timeout  time.Duration
+	lock     sync.RWMutex
+	brb      *brb.BRBChannel
+	aba      *aba.AbaChannel
+	bkr      *acs.BKRChannel
+	queries  map[string]chan struct{}
+	listener net.Listener
+	server   *http.Server
+}
+
+func newAdminServer(address string, node *on.Node, props *properties.Properties, timeout time.Duration) (*adminServer, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("unable to listen on admin address: %v", err)
+	}
+	s := &adminServer{
+		node:     node,
+		props:    props,
+		timeout:  timeout,
+		queries:  make(map[string]chan struct{}),
+		listener: listener,
+	}
+	for _, name := range []string{"brb", "aba", "ct", "bkr"} {
+		s.queries[name] = make(chan struct{}, 1)
+	}
+	s.server = &http.Server{Handler: s.routes()}
+	go func() {
+		if err := s.server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("admin server stopped", "error", err)
+		}
+	}()
+	logger.Info("admin server listening", "address", listener.Addr())
+	return s, nil
+}
+
+func (s *adminServer) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /peers", s.handlePeers)
+	mux.HandleFunc("GET /config", s.handleConfig)
+	mux.HandleFunc("GET /brb", s.handleBRB)
+	mux.HandleFunc("GET /aba", s.handleABA)
+	mux.HandleFunc("GET /ct", s.handleCT)
+	mux.HandleFunc("GET /bkr", s.handleBKR)
+	mux.HandleFunc("GET /log/levels", s.handleGetLogLevels)
+	mux.HandleFunc("PUT /log/levels", s.handleSetLogLevels)
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+func (s *adminServer) setBRB(channel *brb.BRBChannel) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.brb = channel
+}
+
+func (s *adminServer) setABA(channel *aba.AbaChannel) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.aba = channel
+}
+
+func (s *adminServer) setBKR(channel *acs.BKRChannel) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.bkr = channel
+}
+
+func (s *adminServer) addr() net.Addr {
+	return s.listener.Addr()
+}
+
+func (s *adminServer) close() error {
+	if s == nil {
+		return nil
+	}
+	return s.server.Close()
+}
+
+func (s *adminServer) handlePeers(w http.ResponseWriter, _ *http.Request) {
+	id, err := s.node.GetId()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, map[string]any{
+		"id":      id,
+		"address": s.node.Address(),
+		"peers":   s.node.Peers(),
+	})
+}
+
+func (s *adminServer) handleConfig(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, s.props.Map())
+}
+
+func (s *adminServer) handleBRB(w http.ResponseWriter, _ *http.Request) {
+	s.lock.RLock()
+	channel := s.brb
+	s.lock.RUnlock()
+	respond(w, s.timeout, s.queries["brb"], func() (brb.BRBState, error) {
+		if channel == nil {
+			return brb.BRBState{}, errNotInitialized
+		}
+		return channel.State(), nil
+	})
+}
+
+func (s *adminServer) handleABA(w http.ResponseWriter, _ *http.Request) {
+	s.lock.RLock()
+	channel := s.aba
+	s.lock.RUnlock()
+	respond(w, s.timeout, s.queries["aba"], func() (aba.AbaState, error) {
+		if channel == nil {
+			return aba.AbaState{}, errNotInitialized
+		}
+		return channel.State(), nil
+	})
+}
+
+func (s *adminServer) handleCT(w http.ResponseWriter, _ *http.Request) {
+	s.lock.RLock()
+	channel := s.aba
+	s.lock.RUnlock()
+	respond(w, s.timeout, s.queries["ct"], func() (ct.CTState, error) {
+		if channel == nil {
+			return ct.CTState{}, errNotInitialized
+		}
+		return channel.CoinState()
+	})
+}
+
+func (s *adminServer) handleBKR(w http.ResponseWriter, _ *http.Request) {
+	s.lock.RLock()
+	channel := s.bkr
+	s.lock.RUnlock()
+	respond(w, s.timeout, s.queries["bkr"], func() (acs.BKRState, error) {
+		if channel == nil {
+			return acs.BKRState{}, errNotInitialized
+		}
+		return channel.State(), nil
+	})
+}
+
+func (s *adminServer) handleGetLogLevels(w http.ResponseWriter, _ *http.Request) {
+	levels := utils.ComponentLevels()
+	named := make(map[string]string, len(levels))
+	for component, level := range levels {
+		named[component] = level.String()
+	}
+	writeJSON(w, named)
+}
+
+// handleSetLogLevels changes the level of the components in the request body, which has the same format as the -log_levels flag.
+func (s *adminServer) handleSetLogLevels(w http.ResponseWriter, r *http.Request) {
+	var spec string
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("unable to decode log levels: %v", err))
+		return
+	}
+	levels, err := utils.ParseComponentLevels(spec)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	for component, level := range levels {
+		utils.SetComponentLevel(component, level)
+	}
+	s.handleGetLogLevels(w, r)
+}
+
+// respond writes the result of query, or an error if the channel does not answer within the timeout.
+// A channel that does not answer is most likely blocked, which is itself useful to know when diagnosing a stuck node.
+// The query holds the slot until the channel answers, so the requests to a blocked channel fail instead of piling up queries.
+func respond[T any](w http.ResponseWriter, timeout time.Duration, slot chan struct{}, query func() (T, error)) {
+	type result struct {
+		val T
+		err error
+	}
+	select {
+	case slot <- struct{}{}:
+	default:
+		writeError(w, http.StatusServiceUnavailable, fmt.Errorf("previous query to the channel has not been answered yet"))
+		return
+	}
+	res := make(chan result, 1)
+	go func() {
+		defer func() { <-slot }()
+		val, err := query()
+		res <- result{val, err}
+	}()
+	select {
+	case r := <-res:
+		if r.err != nil {
+			writeError(w, http.StatusServiceUnavailable, r.err)
+		} else {
+			writeJSON(w, r.val)
+		}
+	case <-time.After(timeout):
+		writeError(w, http.StatusServiceUnavailable, fmt.Errorf("channel did not answer within %v", timeout))
+	}
+}
+
+func writeJSON(w http.ResponseWriter, val any) {
+	writeStatusJSON(w, http.StatusOK, val)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeStatusJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeStatusJSON(w http.ResponseWriter, status int, val any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(val); err != nil {
+		logger.Warn("unable to write http response", "error", err)
+	}
+}
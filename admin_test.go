@@ -0,0 +1,85 @@
+package main
+
+import (
+	brb "bkr-acs/byzantineReliableBroadcast"
+	on "bkr-acs/overlayNetwork"
+	"bkr-acs/utils"
+	"encoding/json"
+	"fmt"
+	"github.com/magiconair/properties"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdminShouldReportNodeState(t *testing.T) {
+	node, err := on.NewOfflineNode(utils.DefaultLogger())
+	assert.NoError(t, err)
+	props := properties.LoadMap(map[string]string{"num_nodes": "4", "faulty": "1"})
+	admin, err := newAdminServer("localhost:0", node, props, time.Second)
+	assert.NoError(t, err)
+	defer admin.close()
+	url := fmt.Sprintf("http://%s", admin.addr())
+	config := make(map[string]string)
+	assert.Equal(t, http.StatusOK, getJSON(t, url+"/config", &config))
+	assert.Equal(t, "4", config["num_nodes"])
+	peers := make(map[string]any)
+	assert.Equal(t, http.StatusOK, getJSON(t, url+"/peers", &peers))
+	assert.Empty(t, peers["peers"])
+	assert.Equal(t, http.StatusServiceUnavailable, getJSON(t, url+"/brb", &map[string]any{}))
+	brbChannel := brb.NewBRBChannel(4, 1, on.NewBEBChannel(node, 'b'), node.Logger())
+	defer brbChannel.Close()
+	admin.setBRB(brbChannel)
+	state := brb.BRBState{}
+	assert.Equal(t, http.StatusOK, getJSON(t, url+"/brb", &state))
+	assert.Empty(t, state.Live)
+	assert.Equal(t, http.StatusServiceUnavailable, getJSON(t, url+"/aba", &map[string]any{}))
+}
+
+func TestAdminShouldChangeLogLevels(t *testing.T) {
+	node, err := on.NewOfflineNode(utils.DefaultLogger())
+	assert.NoError(t, err)
+	admin, err := newAdminServer("localhost:0", node, properties.NewProperties(), time.Second)
+	assert.NoError(t, err)
+	defer admin.close()
+	url := fmt.Sprintf("http://%s/log/levels", admin.addr())
+	req, err := http.NewRequest(http.MethodPut, url, strings.NewReader(`"Admin Test=debug"`))
+	assert.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	levels := make(map[string]string)
+	assert.Equal(t, http.StatusOK, getJSON(t, url, &levels))
+	assert.Equal(t, "DEBUG", levels["Admin Test"])
+}
+
+func TestAdminShouldKeepOneQueryPerBlockedChannel(t *testing.T) {
+	slot, blocked := make(chan struct{}, 1), make(chan struct{})
+	query := func() (int, error) {
+		<-blocked
+		return 0, nil
+	}
+	first, second := httptest.NewRecorder(), httptest.NewRecorder()
+	respond(first, 10*time.Millisecond, slot, query)
+	respond(second, time.Second, slot, query)
+	assert.Equal(t, http.StatusServiceUnavailable, first.Code)
+	assert.Equal(t, http.StatusServiceUnavailable, second.Code)
+	assert.Contains(t, second.Body.String(), "not been answered")
+	close(blocked)
+	assert.Eventually(t, func() bool { return len(slot) == 0 }, time.Second, time.Millisecond)
+	answered := httptest.NewRecorder()
+	respond(answered, time.Second, slot, func() (int, error) { return 1, nil })
+	assert.Equal(t, http.StatusOK, answered.Code)
+}
+
+func getJSON(t *testing.T, url string, val any) int {
+	resp, err := http.Get(url)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(val))
+	return resp.StatusCode
+}
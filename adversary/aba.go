@@ -0,0 +1,74 @@
+package adversary
+
+import (
+	"encoding/binary"
+	"github.com/google/uuid"
+	"time"
+)
+
+// Codes of the messages of asynchronousBinaryAgreement.
+const (
+	abaEcho byte = 'a' + iota
+	abaVote
+	abaBind
+)
+
+// abaBot is the value a node binds to when it saw both values.
+const abaBot byte = 2
+
+// abaKindOffset is the position of the kind of an agreement message, which follows the id of the instance.
+const abaKindOffset = len(uuid.UUID{})
+
+// abaMsgLen is the length of an agreement message: the id of the instance, the kind, the round and the value.
+const abaMsgLen = abaKindOffset + 4
+
+// SplitVotes makes a node echo and vote the opposite of its values to the peers in split.
+func SplitVotes(code byte, split Partition) Strategy {
+	return Strategy{Code: code, Rewrite: func(frame []byte, to uuid.UUID, send func([]byte)) {
+		if !split(to) {
+			send(frame)
+			return
+		}
+		send(forgeABAFrame(frame, func(msg []byte) {
+			if msg[abaKindOffset] == abaEcho || msg[abaKindOffset] == abaVote {
+				msg[abaMsgLen-1] = 1 - msg[abaMsgLen-1]
+			}
+		}))
+	}}
+}
+
+// BindToBot makes a node bind to bot in every round, whatever it saw.
+func BindToBot(code byte) Strategy {
+	return Strategy{Code: code, Rewrite: func(frame []byte, _ uuid.UUID, send func([]byte)) {
+		send(forgeABAFrame(frame, func(msg []byte) {
+			if msg[abaKindOffset] == abaBind {
+				msg[abaMsgLen-1] = abaBot
+			}
+		}))
+	}}
+}
+
+// forgeABAFrame applies forge to each message of a copy of a frame, which holds a little endian count followed by
+// the messages. Frames that do not have this layout are returned unchanged.
+func forgeABAFrame(frame []byte, forge func(msg []byte)) []byte {
+	if len(frame) < 2 || len(frame) != 2+int(binary.LittleEndian.Uint16(frame))*abaMsgLen {
+		return frame
+	}
+	forged := append([]byte{}, frame...)
+	for offset := 2; offset < len(forged); offset += abaMsgLen {
+		forge(forged[offset : offset+abaMsgLen])
+	}
+	return forged
+}
+
+// LateTermination makes a node send its termination messages only after the delay.
+func LateTermination(code byte, delay time.Duration) Strategy {
+	return Delay(code, delay)
+}
+
+// Delay holds back every message of a channel for the given duration.
+func Delay(code byte, delay time.Duration) Strategy {
+	return Strategy{Code: code, Rewrite: func(msg []byte, _ uuid.UUID, send func([]byte)) {
+		time.AfterFunc(delay, func() { send(msg) })
+	}}
+}
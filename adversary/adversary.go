@@ -0,0 +1,71 @@
+// Package adversary makes nodes of a test cluster Byzantine by rewriting the messages they send.
+// A Byzantine node runs the same channels as the correct ones, and its strategies forge, drop, repeat or delay
+// the messages of each layer on their way to its peers, so they depend on the wire format of the layer they target.
+package adversary
+
+import (
+	on "bkr-acs/overlayNetwork"
+	"fmt"
+	"github.com/google/uuid"
+)
+
+// Strategy rewrites the messages a Byzantine node sends on the channel with the given listen code.
+// Rewrite receives messages without the listen code, and send adds it back.
+type Strategy struct {
+	Code    byte
+	Rewrite func(msg []byte, to uuid.UUID, send func([]byte))
+}
+
+// Partition tells whether a peer belongs to the group a strategy treats differently from the rest.
+type Partition func(to uuid.UUID) bool
+
+// Among is the partition of the given peers.
+func Among(ids []uuid.UUID) Partition {
+	members := make(map[uuid.UUID]bool, len(ids))
+	for _, id := range ids {
+		members[id] = true
+	}
+	return func(to uuid.UUID) bool { return members[to] }
+}
+
+// SecondHalf is the partition of the second half of the given peers.
+func SecondHalf(ids []uuid.UUID) Partition {
+	return Among(ids[len(ids)/2:])
+}
+
+// Corrupt makes node run the strategies on the messages it sends to its peers. It must be called before the node joins.
+// Strategies for the same channel are chained in the given order, and the messages of other channels are left untouched.
+func Corrupt(node *on.Node, strategies ...Strategy) {
+	node.Intercept(func(msg []byte, to uuid.UUID, send func([]byte)) {
+		rewrite(strategies, msg, to, send)
+	})
+}
+
+func rewrite(strategies []Strategy, msg []byte, to uuid.UUID, send func([]byte)) {
+	if len(strategies) == 0 || len(msg) == 0 {
+		send(msg)
+		return
+	}
+	strategy, rest := strategies[0], strategies[1:]
+	if msg[0] != strategy.Code {
+		rewrite(rest, msg, to, send)
+		return
+	}
+	strategy.Rewrite(msg[1:], to, func(rewritten []byte) {
+		rewrite(rest, append([]byte{strategy.Code}, rewritten...), to, send)
+	})
+}
+
+// Place corrupts the last count nodes of a cluster tolerating f faults with the strategies built for each of them.
+// It must be called before the nodes join.
+func Place(nodes []*on.Node, f, count uint, strategies func(node *on.Node) []Strategy) error {
+	if count > f {
+		return fmt.Errorf("unable to place %d byzantine nodes in a cluster tolerating %d", count, f)
+	} else if count > uint(len(nodes)) {
+		return fmt.Errorf("unable to place %d byzantine nodes in a cluster of %d", count, len(nodes))
+	}
+	for _, node := range nodes[uint(len(nodes))-count:] {
+		Corrupt(node, strategies(node)...)
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package adversary
+
+import (
+	acs "bkr-acs/agreementCommonSubset"
+	aba "bkr-acs/asynchronousBinaryAgreement"
+	brb "bkr-acs/byzantineReliableBroadcast"
+	ct "bkr-acs/coinTosser"
+	on "bkr-acs/overlayNetwork"
+	"bkr-acs/utils"
+	va "bkr-acs/validatedAgreement"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"slices"
+	"testing"
+	"time"
+)
+
+const (
+	n = uint(4)
+	f = uint(1)
+)
+
+// cluster creates n nodes, the last f of which run the strategies built from the ids of the correct nodes.
+func cluster(t *testing.T, strategies func(correct []uuid.UUID) []Strategy) ([]*on.Node, []uuid.UUID) {
+	nodes := lo.Map(lo.Range(int(n)), func(i int, _ int) *on.Node {
+		return on.GetTestNode(t, fmt.Sprintf("localhost:%d", 6000+i), "localhost:6000")
+	})
+	ids := lo.Map(nodes, func(node *on.Node, _ int) uuid.UUID {
+		id, err := node.GetId()
+		assert.NoError(t, err)
+		return id
+	})
+	assert.NoError(t, Place(nodes, f, f, func(*on.Node) []Strategy { return strategies(ids[:n-f]) }))
+	return nodes, ids
+}
+
+func closeNodes(t *testing.T, nodes []*on.Node) {
+	assert.True(t, lo.EveryBy(nodes, func(node *on.Node) bool { return node.Close() == nil }))
+}
+
+func TestPlaceShouldRejectMoreThanFNodes(t *testing.T) {
+	assert.Error(t, Place(make([]*on.Node, 4), 1, 2, func(*on.Node) []Strategy { return nil }))
+}
+
+func TestCorrectNodesShouldAgreeDespiteEquivocatingSender(t *testing.T) {
+	nodes, _ := cluster(t, func(correct []uuid.UUID) []Strategy {
+		return []Strategy{EquivocatingSender('b', Among(correct[:1]), func([]byte) []byte { return []byte("forged") })}
+	})
+	channels := lo.Map(nodes, func(node *on.Node, _ int) *brb.BRBChannel {
+		return brb.NewBRBChannel(n, f, on.NewBEBChannel(node, 'b'), node.Logger())
+	})
+	on.InitializeNodes(t, nodes)
+	_, err := channels[n-1].BRBroadcast([]byte("original"))
+	assert.NoError(t, err)
+	outputs := lo.Map(channels[:n-f], func(c *brb.BRBChannel, _ int) string { return string((<-c.BrbDeliver).Content) })
+	assert.Equal(t, []string{"original", "original", "original"}, outputs)
+	closeNodes(t, nodes)
+}
+
+func TestCorrectNodesShouldDeliverDespiteSelectiveEcho(t *testing.T) {
+	nodes, _ := cluster(t, func(correct []uuid.UUID) []Strategy {
+		return []Strategy{SelectiveEcho('b', Among(correct[:1]))}
+	})
+	channels := lo.Map(nodes, func(node *on.Node, _ int) *brb.BRBChannel {
+		return brb.NewBRBChannel(n, f, on.NewBEBChannel(node, 'b'), node.Logger())
+	})
+	on.InitializeNodes(t, nodes)
+	_, err := channels[0].BRBroadcast([]byte("hello"))
+	assert.NoError(t, err)
+	for _, c := range channels[:n-f] {
+		assert.Equal(t, []byte("hello"), (<-c.BrbDeliver).Content)
+	}
+	closeNodes(t, nodes)
+}
+
+func TestCoinShouldBeTossedDespiteByzantineShares(t *testing.T) {
+	for name, strategy := range map[string]Strategy{
+		"invalid proofs":   InvalidProofs('c'),
+		"withheld shares":  WithheldShares('c'),
+		"duplicate shares": DuplicateShares('c'),
+	} {
+		t.Run(name, func(t *testing.T) {
+			nodes, _ := cluster(t, func([]uuid.UUID) []Strategy { return []Strategy{strategy} })
+			ssChans := lo.Map(nodes, func(node *on.Node, _ int) *on.SSChannel { return on.NewSSChannel(node, 's') })
+			bebChans := lo.Map(nodes, func(node *on.Node, _ int) *on.BEBChannel { return on.NewBEBChannel(node, 'c') })
+			on.InitializeNodes(t, nodes)
+			ctChannels := lo.ZipBy2(ssChans, bebChans, func(ss *on.SSChannel, beb *on.BEBChannel) *ct.CTChannel {
+				c, err := ct.NewCoinTosserChannel(ss, beb, 2*f, utils.DefaultLogger())
+				assert.NoError(t, err)
+				return c
+			})
+			assert.NoError(t, ct.DealSecret(ssChans[0], ct.NewScalar(42), 2*f))
+			outputChans := lo.Map(ctChannels, func(*ct.CTChannel, int) chan bool { return make(chan bool, 1) })
+			for i, c := range ctChannels {
+				c.TossCoin([]byte("test"), outputChans[i])
+			}
+			outcomes := lo.Map(outputChans[:n-f], func(oc chan bool, _ int) bool { return <-oc })
+			assert.True(t, lo.EveryBy(outcomes, func(outcome bool) bool { return outcome == outcomes[0] }))
+			for _, c := range ctChannels {
+				c.Close()
+			}
+			closeNodes(t, nodes)
+		})
+	}
+}
+
+func getAbaChannels(t *testing.T, nodes []*on.Node) []*aba.AbaChannel {
+	dealSSs := lo.Map(nodes, func(node *on.Node, _ int) *on.SSChannel { return on.NewSSChannel(node, 'd') })
+	ctBebs := lo.Map(nodes, func(node *on.Node, _ int) *on.BEBChannel { return on.NewBEBChannel(node, 'c') })
+	mBebs := lo.Map(nodes, func(node *on.Node, _ int) *on.BEBChannel { return on.NewBEBChannel(node, 'm') })
+	tBebs := lo.Map(nodes, func(node *on.Node, _ int) *on.BEBChannel { return on.NewBEBChannel(node, 't') })
+	on.InitializeNodes(t, nodes)
+	assert.NoError(t, ct.DealSecret(dealSSs[0], ct.NewScalar(42), 2*f))
+	return lo.ZipBy4(dealSSs, ctBebs, mBebs, tBebs, func(dealSS *on.SSChannel, ctBeb, mBeb, tBeb *on.BEBChannel) *aba.AbaChannel {
+		c, err := aba.NewAbaChannel(n, f, dealSS, ctBeb, mBeb, tBeb, dealSS.Logger())
+		assert.NoError(t, err)
+		return c
+	})
+}
+
+func TestAgreementShouldDecideDespiteByzantineVotes(t *testing.T) {
+	nodes, _ := cluster(t, func(correct []uuid.UUID) []Strategy {
+		return []Strategy{SplitVotes('m', SecondHalf(correct)), BindToBot('m'), LateTermination('t', 100*time.Millisecond)}
+	})
+	channels := getAbaChannels(t, nodes)
+	id := uuid.New()
+	instances := lo.Map(channels, func(c *aba.AbaChannel, _ int) *aba.AbaInstance { return c.NewAbaInstance(id) })
+	for i, instance := range instances {
+		assert.NoError(t, instance.Propose(byte(i%2)))
+	}
+	decisions := lo.Map(instances[:n-f], func(instance *aba.AbaInstance, _ int) byte { return instance.GetOutput() })
+	assert.True(t, lo.EveryBy(decisions, func(decision byte) bool { return decision == decisions[0] }))
+	for _, c := range channels {
+		c.Close()
+	}
+	closeNodes(t, nodes)
+}
+
+func TestSubsetShouldAgreeDespiteByzantineProposers(t *testing.T) {
+	for name, strategies := range map[string]func(correct []uuid.UUID) []Strategy{
+		"withheld proposals": func([]uuid.UUID) []Strategy { return []Strategy{WithheldProposals('z')} },
+		"split proposals": func(correct []uuid.UUID) []Strategy {
+			return []Strategy{SplitProposals('z', SecondHalf(correct), func([]byte) []byte { return []byte("forged") })}
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			nodes, ids := cluster(t, strategies)
+			brbChans := lo.Map(nodes, func(node *on.Node, _ int) *brb.BRBChannel {
+				return brb.NewBRBChannel(n, f, on.NewBEBChannel(node, 'z'), node.Logger())
+			})
+			abaChans := getAbaChannels(t, nodes)
+			bkrChans := lo.ZipBy2(abaChans, brbChans, func(a *aba.AbaChannel, b *brb.BRBChannel) *acs.BKRChannel {
+				return acs.NewBKRChannel(f, a, b, ids, utils.DefaultLogger())
+			})
+			id := uuid.New()
+			listeners := lo.Map(bkrChans, func(c *acs.BKRChannel, i int) chan [][]byte {
+				listener, err := c.Propose(id, []byte(fmt.Sprintf("proposal %d", i)))
+				assert.NoError(t, err)
+				return listener
+			})
+			outputs := lo.Map(listeners[:n-f], func(l chan [][]byte, _ int) [][]byte { return <-l })
+			assert.GreaterOrEqual(t, len(outputs[0]), int(n-f))
+			assert.True(t, lo.EveryBy(outputs, func(output [][]byte) bool {
+				return slices.EqualFunc(output, outputs[0], func(a, b []byte) bool { return slices.Equal(a, b) })
+			}))
+			closeNodes(t, nodes)
+		})
+	}
+}
+
+func TestValidatedAgreementShouldDecideOneValueDespiteResequencedProposals(t *testing.T) {
+	nodes, ids := cluster(t, func([]uuid.UUID) []Strategy {
+		return []Strategy{ResequencedSender('v', func(seq uint64) uint64 { return seq + 1 }, func([]byte) []byte { return []byte("forged") }, 100*time.Millisecond)}
+	})
+	brbChans := lo.Map(nodes, func(node *on.Node, _ int) *brb.BRBChannel {
+		return brb.NewBRBChannel(n, f, on.NewBEBChannel(node, 'v'), node.Logger())
+	})
+	dealSSs := lo.Map(nodes, func(node *on.Node, _ int) *on.SSChannel { return on.NewSSChannel(node, 'd') })
+	ctBebs := lo.Map(nodes, func(node *on.Node, _ int) *on.BEBChannel { return on.NewBEBChannel(node, 'c') })
+	mBebs := lo.Map(nodes, func(node *on.Node, _ int) *on.BEBChannel { return on.NewBEBChannel(node, 'm') })
+	tBebs := lo.Map(nodes, func(node *on.Node, _ int) *on.BEBChannel { return on.NewBEBChannel(node, 't') })
+	on.InitializeNodes(t, nodes)
+	ctChans := lo.ZipBy2(dealSSs, ctBebs, func(dealSS *on.SSChannel, ctBeb *on.BEBChannel) *ct.CTChannel {
+		c, err := ct.NewCoinTosserChannel(dealSS, ctBeb, 2*f, utils.DefaultLogger())
+		assert.NoError(t, err)
+		return c
+	})
+	assert.NoError(t, ct.DealSecret(dealSSs[0], ct.NewScalar(42), 2*f))
+	channels := lo.Map(nodes, func(node *on.Node, i int) *va.MVBAChannel {
+		abaChan := aba.NewAbaChannelWithCoinTosser(n, f, ctChans[i], mBebs[i], tBebs[i], node.Logger())
+		return va.NewMVBAChannel(n, f, abaChan, ctChans[i], brbChans[i], ids, func(uuid.UUID, []byte) bool { return true }, node.Logger())
+	})
+	// The coin of the dealt secret elects the byzantine node as the leader of the first round of this instance, so the
+	// correct nodes would decide the forged proposal if they took it for the proposal of the instance.
+	id := utils.NewInstanceId(0, []byte("d"))
+	outputs := lo.Map(channels, func(c *va.MVBAChannel, i int) chan []byte {
+		output, err := c.Propose(id, []byte(fmt.Sprintf("proposal %d", i)))
+		assert.NoError(t, err)
+		return output
+	})
+	decisions := lo.Map(outputs[:n-f], func(output chan []byte, _ int) string { return string(<-output) })
+	assert.True(t, lo.EveryBy(decisions, func(decision string) bool { return decision == decisions[0] }))
+	assert.NotEqual(t, "forged", decisions[0])
+	for _, c := range channels {
+		c.Close()
+	}
+	closeNodes(t, nodes)
+}
+
+func TestForgedFramesShouldKeepTheirLayout(t *testing.T) {
+	id := uuid.New()
+	frame := append([]byte{2, 0}, append(append(id[:], abaEcho, 0, 0, 1), append(id[:], abaBind, 0, 0, 1)...)...)
+	forged := forgeABAFrame(frame, func(msg []byte) { msg[abaMsgLen-1] = abaBot })
+	assert.Equal(t, abaBot, forged[2+abaMsgLen-1])
+	assert.Equal(t, abaBot, forged[2+2*abaMsgLen-1])
+	assert.Equal(t, byte(1), frame[2+abaMsgLen-1])
+	assert.Equal(t, frame[:len(frame)-1], forgeABAFrame(frame[:len(frame)-1], func(msg []byte) { msg[0] = 0 }))
+}
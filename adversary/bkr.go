@@ -0,0 +1,19 @@
+package adversary
+
+import "github.com/google/uuid"
+
+// WithheldProposals makes a node keep its BKR proposals to itself, while it still takes part in the broadcasts of others.
+// The code is the listen code of the reliable broadcast channel of BKR.
+func WithheldProposals(code byte) Strategy {
+	return Strategy{Code: code, Rewrite: func(msg []byte, _ uuid.UUID, send func([]byte)) {
+		if len(msg) > 0 && msg[0] == brbSend {
+			return
+		}
+		send(msg)
+	}}
+}
+
+// SplitProposals makes a node propose forge(proposal) to the peers in split and its proposal to the others.
+func SplitProposals(code byte, split Partition, forge func(proposal []byte) []byte) Strategy {
+	return EquivocatingSender(code, split, forge)
+}
@@ -0,0 +1,84 @@
+package adversary
+
+import (
+	"encoding/binary"
+	"github.com/google/uuid"
+	"time"
+)
+
+// Codes of the messages of byzantineReliableBroadcast.
+const (
+	brbSend byte = 'a' + iota
+	brbEcho
+	brbReady
+)
+
+// EquivocatingSender makes the broadcasts of a node carry forge(payload) instead of their payload to the peers in split.
+// The forged sends keep the instance of the original, so correct nodes see two payloads in the same broadcast.
+// It applies to the Bracha and digest broadcasts, whose sends carry the whole payload.
+func EquivocatingSender(code byte, split Partition, forge func(payload []byte) []byte) Strategy {
+	return Strategy{Code: code, Rewrite: func(msg []byte, to uuid.UUID, send func([]byte)) {
+		if !split(to) || len(msg) == 0 || msg[0] != brbSend {
+			send(msg)
+			return
+		}
+		header, tag, payload, ok := splitBRBSend(msg)
+		if !ok {
+			send(msg)
+			return
+		}
+		forged := binary.LittleEndian.AppendUint16(append([]byte{}, header...), uint16(len(tag)))
+		forged = append(forged, tag...)
+		send(append(forged, forge(payload)...))
+	}}
+}
+
+// ResequencedSender makes each broadcast of a node come with a copy that carries forge(payload) under the same tag and
+// the sequence given by resequence. The copy is sent right away and the original only after the delay, so correct nodes
+// deliver two broadcasts of the same tag, the forged one first.
+func ResequencedSender(code byte, resequence func(seq uint64) uint64, forge func(payload []byte) []byte, delay time.Duration) Strategy {
+	return Strategy{Code: code, Rewrite: func(msg []byte, to uuid.UUID, send func([]byte)) {
+		if len(msg) == 0 || msg[0] != brbSend {
+			send(msg)
+			return
+		}
+		header, tag, payload, ok := splitBRBSend(msg)
+		if !ok {
+			send(msg)
+			return
+		}
+		seqAt := len(header) - 8
+		copied := binary.LittleEndian.AppendUint64(append([]byte{}, header[:seqAt]...), resequence(binary.LittleEndian.Uint64(header[seqAt:])))
+		copied = append(binary.LittleEndian.AppendUint16(copied, uint16(len(tag))), tag...)
+		send(append(copied, forge(payload)...))
+		time.AfterFunc(delay, func() { send(msg) })
+	}}
+}
+
+// SelectiveEcho makes a node echo only to the peers in receivers.
+func SelectiveEcho(code byte, receivers Partition) Strategy {
+	return Strategy{Code: code, Rewrite: func(msg []byte, to uuid.UUID, send func([]byte)) {
+		if len(msg) > 0 && msg[0] == brbEcho && !receivers(to) {
+			return
+		}
+		send(msg)
+	}}
+}
+
+// splitBRBSend separates a send into its header, which identifies the instance, and the tag and payload it carries.
+func splitBRBSend(msg []byte) (header, tag, payload []byte, ok bool) {
+	if len(msg) < 3 {
+		return nil, nil, nil, false
+	}
+	idTagLen := int(binary.LittleEndian.Uint16(msg[1:]))
+	headerLen := 3 + idTagLen + 8
+	if len(msg) < headerLen+2 {
+		return nil, nil, nil, false
+	}
+	header, sealed := msg[:headerLen], msg[headerLen:]
+	tagLen := int(binary.LittleEndian.Uint16(sealed))
+	if len(sealed) < 2+tagLen {
+		return nil, nil, nil, false
+	}
+	return header, sealed[2 : 2+tagLen], sealed[2+tagLen:], true
+}
@@ -0,0 +1,37 @@
+package adversary
+
+import "github.com/google/uuid"
+
+// ctProofLen is the length of the end of the DLEQ proof of a coin share: its second commitment and its response, of 32 bytes each.
+const ctProofLen = 64
+
+// InvalidProofs makes the coin shares of a node carry a proof that does not verify, by changing its second commitment.
+func InvalidProofs(code byte) Strategy {
+	return Strategy{Code: code, Rewrite: func(msg []byte, _ uuid.UUID, send func([]byte)) {
+		if len(msg) < len(uuid.UUID{})+ctProofLen {
+			send(msg)
+			return
+		}
+		forged := append([]byte{}, msg...)
+		forged[len(forged)-ctProofLen] ^= 1
+		send(forged)
+	}}
+}
+
+// WithheldShares makes a node keep its coin shares to itself.
+func WithheldShares(code byte) Strategy {
+	return Drop(code)
+}
+
+// DuplicateShares makes a node send each of its coin shares twice.
+func DuplicateShares(code byte) Strategy {
+	return Strategy{Code: code, Rewrite: func(msg []byte, _ uuid.UUID, send func([]byte)) {
+		send(msg)
+		send(msg)
+	}}
+}
+
+// Drop discards every message of a channel.
+func Drop(code byte) Strategy {
+	return Strategy{Code: code, Rewrite: func([]byte, uuid.UUID, func([]byte)) {}}
+}
@@ -2,7 +2,9 @@ package agreementCommonSubset
 
 import (
 	aba "bkr-acs/asynchronousBinaryAgreement"
+	"bkr-acs/transcript"
 	"bkr-acs/utils"
+	"encoding/hex"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/samber/lo"
@@ -10,8 +12,6 @@ import (
 	"log/slog"
 )
 
-var bkrLogger = utils.GetLogger("BKR Instance", slog.LevelWarn)
-
 const (
 	accept = 1
 	reject = 0
@@ -24,18 +24,24 @@ type bkr struct {
 	resultsChan chan lo.Tuple2[mo.Option[[]byte], uint]
 	results     [][]byte
 	output      chan [][]byte
+	recorder    *transcript.Recorder
+	onOutput    func(id uuid.UUID, output [][]byte)
+	logger      *slog.Logger
 }
 
-func newBKR(id uuid.UUID, f uint, proposers []uuid.UUID, abaChan *aba.AbaChannel) *bkr {
-	bkrLogger.Info("initializing bkr", "id", id, "f", f, "proposers", proposers)
+func newBKR(id uuid.UUID, f uint, proposers []uuid.UUID, abaChan *aba.AbaChannel, recorder *transcript.Recorder, onOutput func(uuid.UUID, [][]byte), logger *slog.Logger) *bkr {
 	b := &bkr{
 		id:          id,
 		f:           f,
-		acceptors:   computeAcceptors(id, proposers, abaChan),
+		acceptors:   computeAcceptors(id, proposers, abaChan, logger),
 		resultsChan: make(chan lo.Tuple2[mo.Option[[]byte], uint], len(proposers)),
 		results:     make([][]byte, len(proposers)),
 		output:      make(chan [][]byte, 1),
+		recorder:    recorder,
+		onOutput:    onOutput,
+		logger:      utils.ComponentLogger(logger, "BKR Instance", slog.LevelWarn),
 	}
+	b.logger.Info("initializing bkr", "id", id, "f", f, "proposers", proposers)
 	go b.processResponses()
 	for i, acceptor := range b.acceptors {
 		go b.waitAcceptorResponse(acceptor, uint(i))
@@ -43,10 +49,10 @@ func newBKR(id uuid.UUID, f uint, proposers []uuid.UUID, abaChan *aba.AbaChannel
 	return b
 }
 
-func computeAcceptors(bkrId uuid.UUID, proposers []uuid.UUID, abaChan *aba.AbaChannel) []*proposalAcceptor {
+func computeAcceptors(bkrId uuid.UUID, proposers []uuid.UUID, abaChan *aba.AbaChannel, logger *slog.Logger) []*proposalAcceptor {
 	return lo.Map(proposers, func(proposer uuid.UUID, _ int) *proposalAcceptor {
-		abaId := utils.BytesToUUID(append(bkrId[:], proposer[:]...))
-		return newProposalAcceptor(abaId, proposer, abaChan)
+		abaId := utils.DeriveInstanceId(bkrId, proposer[:])
+		return newProposalAcceptor(abaId, bkrId, proposer, abaChan, logger)
 	})
 }
 
@@ -59,31 +65,43 @@ func (b *bkr) processResponses() {
 	for i := uint(0); i < uint(len(b.acceptors)); i++ {
 		response := <-b.resultsChan
 		proposal, idx := response.Unpack()
-		bkrLogger.Info("processing response", "proposal", proposal.OrEmpty(), "idx", idx)
+		b.logger.Info("processing response", "proposal", proposal.OrEmpty(), "idx", idx)
 		b.results[idx] = proposal.OrEmpty()
 		if proposal.IsPresent() && len(b.getAccepted()) == len(b.acceptors)-int(b.f) {
-			bkrLogger.Info("trying to reject unresponding proposals")
+			b.logger.Info("trying to reject unresponding proposals")
 			for i, a := range b.acceptors {
 				if !a.hasProposed() {
-					bkrLogger.Debug("rejecting proposal", "idx", i)
+					b.logger.Debug("rejecting proposal", "idx", i)
 					if err := a.rejectProposal(); err != nil {
-						bkrLogger.Warn("unable to reject proposal", "idx", i, "error", err)
+						b.logger.Warn("unable to reject proposal", "idx", i, "error", err)
 					}
 				}
 			}
 		}
 	}
 	accepted := b.getAccepted()
-	bkrLogger.Info("outputting accepted proposals", "accepted", accepted)
+	b.logger.Info("outputting accepted proposals", "accepted", accepted)
+	b.recordOutput(accepted)
+	if b.onOutput != nil {
+		b.onOutput(b.id, accepted)
+	}
 	b.output <- accepted
 }
 
+func (b *bkr) recordOutput(accepted [][]byte) {
+	fields := map[string]string{"instance": b.id.String(), "accepted": fmt.Sprint(len(accepted))}
+	for i, proposal := range accepted {
+		fields[fmt.Sprintf("proposal%d", i)] = hex.EncodeToString(proposal)
+	}
+	b.recorder.RecordDecision("bkr", fields)
+}
+
 func (b *bkr) getAccepted() [][]byte {
 	return lo.Filter(b.results, func(r []byte, _ int) bool { return r != nil })
 }
 
 func (b *bkr) receiveInput(input []byte, proposer uuid.UUID) error {
-	bkrLogger.Debug("receiving input", "input", string(input), "proposer", proposer)
+	b.logger.Debug("receiving input", "input", string(input), "proposer", proposer)
 	acceptor, err := b.getAcceptor(proposer)
 	if err != nil {
 		return fmt.Errorf("unable to find acceptor for proposer %s", proposer)
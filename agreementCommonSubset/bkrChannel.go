@@ -3,34 +3,25 @@ package agreementCommonSubset
 import (
 	aba "bkr-acs/asynchronousBinaryAgreement"
 	brb "bkr-acs/byzantineReliableBroadcast"
+	dc "bkr-acs/decisionCertificate"
 	"bkr-acs/utils"
 	"fmt"
 	"github.com/google/uuid"
 	"log/slog"
 	"sync"
-	"unsafe"
 )
 
-var bkrChannelLogger = utils.GetLogger("BKR Channel", slog.LevelWarn)
-
-type bkrProposalMsg struct {
-	bkrId    uuid.UUID
-	proposal []byte
-}
-
-func (m *bkrProposalMsg) marshal() []byte {
-	return append(m.bkrId[:], m.proposal...)
+// BKRObserver is notified of the output of every instance, including the ones this node did not propose to.
+// It is called from the instance's goroutine and must not block.
+type BKRObserver interface {
+	DeliverOutput(id uuid.UUID, output [][]byte)
 }
 
-func (m *bkrProposalMsg) unmarshal(data []byte) error {
-	idSize := unsafe.Sizeof(uuid.UUID{})
-	if len(data) < int(idSize) {
-		return fmt.Errorf("data is too short to unmarshal, expected at least %d bytes, got %d", idSize, len(data))
-	}
-	m.bkrId = uuid.UUID(data[:idSize])
-	m.proposal = data[idSize:]
-	return nil
-}
+// Validator tells whether a proposal of an instance may be accepted, once the proposer is known from its broadcast.
+// It may take time to answer, such as until this node received what the proposal refers to, and the proposal is only
+// voted for once it answers true. It must eventually answer true at every correct node for the proposals that it
+// answers true for at some correct node, or the instances that accept them do not output.
+type Validator func(id, proposer uuid.UUID, proposal []byte) <-chan bool
 
 type BKRChannel struct {
 	f             uint
@@ -39,13 +30,21 @@ type BKRChannel struct {
 	participants  []uuid.UUID
 	instanceLock  sync.Mutex
 	instances     map[uuid.UUID]*bkr
+	observersLock sync.RWMutex
+	observers     []BKRObserver
 	finished      map[uuid.UUID]bool
+	watermark     uint64
+	policy        utils.AdmissionPolicy
+	certs         *dc.CertificateChannel
+	validator     Validator
 	commands      chan func() error
 	closeChan     chan struct{}
 	closeListener chan struct{}
+	closed        chan struct{}
+	logger        *slog.Logger
 }
 
-func NewBKRChannel(f uint, abaChannel *aba.AbaChannel, brbChannel *brb.BRBChannel, participants []uuid.UUID) *BKRChannel {
+func NewBKRChannel(f uint, abaChannel *aba.AbaChannel, brbChannel *brb.BRBChannel, participants []uuid.UUID, logger *slog.Logger) *BKRChannel {
 	c := &BKRChannel{
 		f:             f,
 		abaChannel:    abaChannel,
@@ -53,49 +52,162 @@ func NewBKRChannel(f uint, abaChannel *aba.AbaChannel, brbChannel *brb.BRBChanne
 		participants:  participants,
 		instanceLock:  sync.Mutex{},
 		instances:     make(map[uuid.UUID]*bkr),
+		observers:     make([]BKRObserver, 0),
 		finished:      make(map[uuid.UUID]bool),
 		commands:      make(chan func() error),
 		closeChan:     make(chan struct{}, 1),
 		closeListener: make(chan struct{}, 1),
+		closed:        make(chan struct{}),
+		logger:        utils.ComponentLogger(logger, "BKR Channel", slog.LevelWarn),
 	}
-	bkrChannelLogger.Info("initializing channel", "f", f, "participants", participants)
+	c.logger.Info("initializing channel", "f", f, "participants", participants)
 	go c.listenBroadcasts()
 	go c.invoker()
 	return c
 }
 
+// Propose submits this node's proposal to the instance with the given id.
+// The sequence carried by the id, as built by utils.NewInstanceId, determines when the instance is collected.
 func (c *BKRChannel) Propose(id uuid.UUID, proposal []byte) (chan [][]byte, error) {
-	msg := &bkrProposalMsg{bkrId: id, proposal: proposal}
-	data := msg.marshal()
-	bkrChannelLogger.Debug("broadcasting proposal", "id", id, "proposal", string(proposal))
-	if err := c.brbChannel.BRBroadcast(data); err != nil {
+	if c.isCollected(id) {
+		return nil, fmt.Errorf("bkr instance %s is below the low watermark", id)
+	} else if !c.inWindow(id) {
+		return nil, fmt.Errorf("bkr instance %s is beyond the admission window", id)
+	}
+	c.logger.Debug("broadcasting proposal", "id", id, "proposal", string(proposal))
+	if _, err := c.brbChannel.BRBroadcastWithTag(utils.InstanceSequence(id), id[:], proposal); err != nil {
 		return nil, fmt.Errorf("unable to broadcast message: %w", err)
 	}
 	return c.getInstance(id).output, nil
 }
 
+// SetLowWatermark drops the state of the instances with a sequence below seq, along with the state of their broadcasts and agreements.
+// Proposals to these instances are rejected from then on, and the instances that have not output are abandoned.
+func (c *BKRChannel) SetLowWatermark(seq uint64) {
+	c.instanceLock.Lock()
+	if seq > c.watermark {
+		c.logger.Debug("raising low watermark", "from", c.watermark, "to", seq)
+		c.watermark = seq
+		for id := range c.instances {
+			if utils.InstanceSequence(id) < seq {
+				delete(c.instances, id)
+				delete(c.finished, id)
+			}
+		}
+	}
+	certs := c.certs
+	c.instanceLock.Unlock()
+	if certs != nil {
+		certs.SetLowWatermark(seq)
+	}
+	c.brbChannel.SetLowWatermark(seq)
+	c.abaChannel.SetLowWatermark(seq)
+}
+
+// LowWatermark returns the sequence below which the instances have been collected.
+func (c *BKRChannel) LowWatermark() uint64 {
+	c.instanceLock.Lock()
+	defer c.instanceLock.Unlock()
+	return c.watermark
+}
+
+// SetAdmissionPolicy limits the broadcasts, agreements and coins that peers can create on this node.
+// Proposals to instances beyond the window are rejected, since the nodes applying the same policy would ignore them.
+func (c *BKRChannel) SetAdmissionPolicy(policy utils.AdmissionPolicy) {
+	c.instanceLock.Lock()
+	c.policy = policy
+	certs := c.certs
+	c.instanceLock.Unlock()
+	c.brbChannel.SetAdmissionPolicy(policy)
+	c.abaChannel.SetAdmissionPolicy(policy)
+	if certs != nil {
+		certs.SetAdmissionPolicy(policy)
+	}
+}
+
+// SetValidator makes the channel vote for the proposals that validator accepts, instead of every proposal it receives.
+// It must be set before the channel receives proposals.
+func (c *BKRChannel) SetValidator(validator Validator) {
+	c.instanceLock.Lock()
+	defer c.instanceLock.Unlock()
+	c.validator = validator
+}
+
+func (c *BKRChannel) isCollected(id uuid.UUID) bool {
+	c.instanceLock.Lock()
+	defer c.instanceLock.Unlock()
+	return utils.InstanceSequence(id) < c.watermark
+}
+
+func (c *BKRChannel) inWindow(id uuid.UUID) bool {
+	c.instanceLock.Lock()
+	defer c.instanceLock.Unlock()
+	return c.policy.Window == 0 || utils.InstanceSequence(id)-c.watermark < c.policy.Window
+}
+
+func (c *BKRChannel) isFinished(id uuid.UUID) bool {
+	c.instanceLock.Lock()
+	defer c.instanceLock.Unlock()
+	return c.finished[id]
+}
+
+func (c *BKRChannel) finishInstance(id uuid.UUID, output [][]byte) {
+	c.instanceLock.Lock()
+	if utils.InstanceSequence(id) >= c.watermark {
+		c.finished[id] = true
+	}
+	c.instanceLock.Unlock()
+	c.certifyOutput(id, output)
+	c.deliverOutput(id, output)
+}
+
+func (c *BKRChannel) AttachObserver(observer BKRObserver) {
+	c.observersLock.Lock()
+	defer c.observersLock.Unlock()
+	c.observers = append(c.observers, observer)
+}
+
+func (c *BKRChannel) deliverOutput(id uuid.UUID, output [][]byte) {
+	c.observersLock.RLock()
+	defer c.observersLock.RUnlock()
+	for _, observer := range c.observers {
+		observer.DeliverOutput(id, output)
+	}
+}
+
 func (c *BKRChannel) listenBroadcasts() {
 	for {
 		select {
 		case msg := <-c.brbChannel.BrbDeliver:
 			if err := c.processBroadcast(msg); err != nil {
-				bkrChannelLogger.Warn("unable to process broadcast message", "sender", msg.Sender, "error", err)
+				c.logger.Warn("unable to process broadcast message", "sender", msg.Sender, "error", err)
 			}
 		case <-c.closeListener:
-			bkrChannelLogger.Info("closing listener")
+			c.logger.Info("closing listener")
 			return
 		}
 	}
 }
 
 func (c *BKRChannel) processBroadcast(msg brb.BRBMsg) error {
-	bkrMsg := &bkrProposalMsg{}
-	if err := bkrMsg.unmarshal(msg.Content); err != nil {
-		return fmt.Errorf("unable to unmarshal message: %w", err)
+	if len(msg.Tag) != len(uuid.UUID{}) {
+		return fmt.Errorf("tag of %d bytes is not the id of an instance", len(msg.Tag))
+	}
+	bkrId := uuid.UUID(msg.Tag)
+	if seq := utils.InstanceSequence(msg.Id); utils.InstanceSequence(bkrId) != seq {
+		return fmt.Errorf("proposal to bkr instance %s broadcast with sequence %d", bkrId, seq)
+	} else if c.isCollected(bkrId) {
+		c.logger.Debug("received proposal to collected instance", "id", bkrId, "sender", msg.Sender)
+		return nil
+	} else if !c.inWindow(bkrId) {
+		return fmt.Errorf("proposal to bkr instance %s beyond the admission window", bkrId)
 	}
 	go func() {
+		if !c.validate(bkrId, msg) {
+			return
+		}
 		c.commands <- func() error {
-			if err := c.submitProposal(bkrMsg.bkrId, bkrMsg.proposal, msg.Sender); err != nil {
+			if err := c.submitProposal(bkrId, msg.Content, msg.Sender); err != nil {
 				return fmt.Errorf("unable to submit proposal: %w", err)
 			}
 			return nil
@@ -104,9 +216,29 @@ func (c *BKRChannel) processBroadcast(msg brb.BRBMsg) error {
 	return nil
 }
 
+func (c *BKRChannel) validate(bkrId uuid.UUID, msg brb.BRBMsg) bool {
+	c.instanceLock.Lock()
+	validator := c.validator
+	c.instanceLock.Unlock()
+	if validator == nil {
+		return true
+	}
+	select {
+	case valid := <-validator(bkrId, msg.Sender, msg.Content):
+		if !valid {
+			c.logger.Warn("discarding invalid proposal", "id", bkrId, "sender", msg.Sender)
+		}
+		return valid
+	case <-c.closed:
+		return false
+	}
+}
+
 func (c *BKRChannel) submitProposal(bkrId uuid.UUID, proposal []byte, sender uuid.UUID) error {
-	bkrChannelLogger.Debug("submitting proposal", "id", bkrId, "proposal", string(proposal), "sender", sender)
-	if c.finished[bkrId] {
+	c.logger.Debug("submitting proposal", "id", bkrId, "proposal", string(proposal), "sender", sender)
+	if c.isCollected(bkrId) {
+		return fmt.Errorf("bkr instance %s is below the low watermark", bkrId)
+	} else if c.isFinished(bkrId) {
 		return fmt.Errorf("bkr instance %s is already finished", bkrId)
 	} else if err := c.getInstance(bkrId).receiveInput(proposal, sender); err != nil {
 		return fmt.Errorf("unable to submit proposal to bkrInstance: %w", err)
@@ -115,22 +247,14 @@ func (c *BKRChannel) submitProposal(bkrId uuid.UUID, proposal []byte, sender uui
 }
 
 func (c *BKRChannel) getInstance(bkrId uuid.UUID) *bkr {
-	bkrInstance := c.instances[bkrId]
-	if bkrInstance == nil {
-		bkrInstance = c.createNewInstance(bkrId)
-	}
-	return bkrInstance
-}
-
-func (c *BKRChannel) createNewInstance(bkrId uuid.UUID) *bkr {
-	bkrChannelLogger.Debug("creating new bkr instance", "id", bkrId)
 	c.instanceLock.Lock()
 	defer c.instanceLock.Unlock()
 	bkrInstance := c.instances[bkrId]
 	if bkrInstance != nil {
 		return bkrInstance
 	}
-	bkrInstance = newBKR(bkrId, c.f, c.participants, c.abaChannel)
+	c.logger.Debug("creating new bkr instance", "id", bkrId)
+	bkrInstance = newBKR(bkrId, c.f, c.participants, c.abaChannel, c.brbChannel.Transcript(), c.finishInstance, c.logger)
 	c.instances[bkrId] = bkrInstance
 	return bkrInstance
 }
@@ -140,16 +264,17 @@ func (c *BKRChannel) invoker() {
 		select {
 		case cmd := <-c.commands:
 			if err := cmd(); err != nil {
-				bkrChannelLogger.Warn("unable to execute command", "error", err)
+				c.logger.Warn("unable to execute command", "error", err)
 			}
 		case <-c.closeChan:
-			bkrChannelLogger.Info("closing invoker")
+			c.logger.Info("closing invoker")
 			return
 		}
 	}
 }
 
 func (c *BKRChannel) Close() {
-	bkrChannelLogger.Info("sending signal to close invoker")
+	c.logger.Info("sending signal to close invoker")
+	close(c.closed)
 	c.closeChan <- struct{}{}
 }
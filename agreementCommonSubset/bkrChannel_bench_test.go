@@ -0,0 +1,260 @@
+package agreementCommonSubset
+
+import (
+	aba "bkr-acs/asynchronousBinaryAgreement"
+	brb "bkr-acs/byzantineReliableBroadcast"
+	on "bkr-acs/overlayNetwork"
+	"crypto/rand"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	benchNodes       = flag.String("bench_nodes", "4,7,10,16,31", "comma separated list of network sizes run by BenchmarkBKRChannel")
+	benchSizes       = flag.String("bench_sizes", "64,1024,16384", "comma separated list of proposal sizes in bytes run by BenchmarkBKRChannel")
+	benchConcurrency = flag.Int("bench_concurrency", 4, "number of ACS instances BenchmarkBKRChannel keeps in flight")
+	benchBRB         = flag.String("bench_brb", "bracha", "reliable broadcast disseminating the proposals (bracha, digest or avid)")
+	benchABA         = flag.String("bench_aba", "mmr", "binary agreement deciding the proposals (mmr, mmr_internal or benor)")
+	benchSharedCoin  = flag.Bool("bench_shared_coin", false, "whether the binary agreements of an ACS instance share one coin per round")
+	benchFastPath    = flag.Bool("bench_fast_path", false, "whether the binary agreements decide unanimous accepts on the fast path")
+	benchCSV         = flag.String("bench_csv", "", "pathname of the CSV report of BenchmarkBKRChannel (stdout if empty)")
+)
+
+// quietLogger keeps the warnings of thousands of instances out of the benchmark output.
+var quietLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// benchPort is the first port of the next stack, so that stacks never reuse the ports of closed ones.
+var benchPort = 20000
+
+// benchResult is one row of the CSV report, taken from the last run of a sub-benchmark.
+type benchResult struct {
+	n, f, size, concurrency, instances int
+	decisionsPerSec                    float64
+	p50, p99                           time.Duration
+	bytesPerInstance, roundsPerAba     float64
+}
+
+var benchHeader = []string{"n", "f", "size", "concurrency", "instances", "decisions_per_sec", "p50_ms", "p99_ms", "wire_bytes_per_instance", "aba_rounds_per_instance"}
+
+func (r benchResult) record() []string {
+	return []string{
+		strconv.Itoa(r.n), strconv.Itoa(r.f), strconv.Itoa(r.size), strconv.Itoa(r.concurrency), strconv.Itoa(r.instances),
+		strconv.FormatFloat(r.decisionsPerSec, 'f', 3, 64),
+		strconv.FormatFloat(float64(r.p50.Microseconds())/1000, 'f', 3, 64),
+		strconv.FormatFloat(float64(r.p99.Microseconds())/1000, 'f', 3, 64),
+		strconv.FormatFloat(r.bytesPerInstance, 'f', 0, 64),
+		strconv.FormatFloat(r.roundsPerAba, 'f', 3, 64),
+	}
+}
+
+// BenchmarkBKRChannel runs full stacks over loopback TLS and measures ACS throughput and latency.
+// Each operation is an ACS instance to which every node proposes, and it completes when every node has output.
+// Large networks take several seconds per instance, so a fixed count such as -benchtime=20x is advised.
+func BenchmarkBKRChannel(b *testing.B) {
+	results := make([]benchResult, 0)
+	for _, n := range parseBenchList(b, *benchNodes) {
+		for _, size := range parseBenchList(b, *benchSizes) {
+			var last benchResult
+			ok := b.Run(fmt.Sprintf("n=%d/size=%d", n, size), func(b *testing.B) {
+				last = benchmarkBKRChannel(b, n, size, max(*benchConcurrency, 1))
+			})
+			if ok {
+				results = append(results, last)
+			}
+		}
+	}
+	if err := writeBenchCSV(results); err != nil {
+		b.Fatalf("unable to write report: %v", err)
+	}
+}
+
+func benchmarkBKRChannel(b *testing.B, n, size, concurrency int) benchResult {
+	f := (n - 1) / 3
+	if *benchABA == "benor" {
+		f = (n - 1) / 5
+	}
+	nodes, bkrChans, abaChans := newBenchStack(b, uint(n), uint(f))
+	defer closeBenchStack(b, nodes)
+	trafficBefore := totalBytesSent(nodes)
+	roundsBefore, decidedBefore := totalRounds(abaChans)
+	latencies := make([]time.Duration, b.N)
+	semaphore := make(chan struct{}, concurrency)
+	wg := sync.WaitGroup{}
+	b.ResetTimer()
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		semaphore <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			latencies[i] = runBenchInstance(b, bkrChans, size)
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	b.StopTimer()
+	roundsAfter, decidedAfter := totalRounds(abaChans)
+	slices.Sort(latencies)
+	res := benchResult{
+		n:                n,
+		f:                f,
+		size:             size,
+		concurrency:      concurrency,
+		instances:        b.N,
+		decisionsPerSec:  float64(b.N) / elapsed.Seconds(),
+		p50:              latencies[b.N/2],
+		p99:              latencies[min(b.N*99/100, b.N-1)],
+		bytesPerInstance: float64(totalBytesSent(nodes)-trafficBefore) / float64(b.N),
+	}
+	if decidedAfter > decidedBefore {
+		res.roundsPerAba = float64(roundsAfter-roundsBefore) / float64(decidedAfter-decidedBefore)
+	}
+	b.ReportMetric(res.decisionsPerSec, "decisions/s")
+	b.ReportMetric(float64(res.p50.Microseconds())/1000, "p50-ms")
+	b.ReportMetric(float64(res.p99.Microseconds())/1000, "p99-ms")
+	b.ReportMetric(res.bytesPerInstance, "wire-B/op")
+	b.ReportMetric(res.roundsPerAba, "aba-rounds")
+	return res
+}
+
+// runBenchInstance proposes a random payload at every node and returns the time until the last node outputs.
+func runBenchInstance(b *testing.B, bkrChans []*BKRChannel, size int) time.Duration {
+	id := uuid.New()
+	start := time.Now()
+	outputs := make([]chan [][]byte, len(bkrChans))
+	wg := sync.WaitGroup{}
+	for i, bkrChan := range bkrChans {
+		proposal := make([]byte, size)
+		_, _ = rand.Read(proposal)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			output, err := bkrChan.Propose(id, proposal)
+			assert.NoError(b, err)
+			outputs[i] = output
+		}()
+	}
+	wg.Wait()
+	for _, output := range outputs {
+		if output != nil {
+			<-output
+		}
+	}
+	return time.Since(start)
+}
+
+func newBenchStack(b *testing.B, n, f uint) ([]*on.Node, []*BKRChannel, []*aba.AbaChannel) {
+	contact := fmt.Sprintf("localhost:%d", benchPort)
+	nodes := lo.Map(lo.Range(int(n)), func(i int, _ int) *on.Node {
+		node, err := on.NewNode(fmt.Sprintf("localhost:%d", benchPort+i), contact, quietLogger)
+		assert.NoError(b, err)
+		return node
+	})
+	benchPort += int(n)
+	proposers := lo.Map(nodes, func(node *on.Node, _ int) uuid.UUID {
+		id, err := node.GetId()
+		assert.NoError(b, err)
+		return id
+	})
+	brbChans := lo.Map(nodes, func(node *on.Node, _ int) *brb.BRBChannel {
+		switch *benchBRB {
+		case "digest":
+			return brb.NewDigestBRBChannel(n, f, on.NewBEBChannel(node, 'z'), node.Logger())
+		case "avid":
+			c, err := brb.NewAVIDChannel(n, f, on.NewBEBChannel(node, 'z'), node.Logger())
+			assert.NoError(b, err)
+			return c
+		default:
+			return brb.NewBRBChannel(n, f, on.NewBEBChannel(node, 'z'), node.Logger())
+		}
+	})
+	abaChans := getAbachans(b, n, f, nodes)
+	for _, abaChan := range abaChans {
+		assert.NoError(b, abaChan.SetAlgorithm(benchAlgorithm()))
+		if *benchSharedCoin {
+			abaChan.EnableSharedCoins()
+		}
+		if *benchFastPath {
+			abaChan.EnableFastPath()
+		}
+	}
+	bkrChans := lo.ZipBy2(abaChans, brbChans, func(a *aba.AbaChannel, brbChan *brb.BRBChannel) *BKRChannel {
+		return NewBKRChannel(f, a, brbChan, proposers, quietLogger)
+	})
+	return nodes, bkrChans, abaChans
+}
+
+func benchAlgorithm() aba.Algorithm {
+	switch *benchABA {
+	case "mmr_internal":
+		return aba.InternalValidityMMR()
+	case "benor":
+		return aba.BenOr()
+	default:
+		return aba.MMR()
+	}
+}
+
+func closeBenchStack(b *testing.B, nodes []*on.Node) {
+	for _, node := range nodes {
+		assert.NoError(b, node.Close())
+	}
+}
+
+func totalBytesSent(nodes []*on.Node) uint64 {
+	return lo.SumBy(nodes, func(node *on.Node) uint64 { return node.Traffic().BytesSent })
+}
+
+func totalRounds(abaChans []*aba.AbaChannel) (uint64, uint64) {
+	states := lo.Map(abaChans, func(c *aba.AbaChannel, _ int) aba.AbaState { return c.State() })
+	rounds := lo.SumBy(states, func(s aba.AbaState) uint64 { return s.DecisionRounds })
+	decided := lo.SumBy(states, func(s aba.AbaState) uint64 { return s.Decided })
+	return rounds, decided
+}
+
+func parseBenchList(b *testing.B, list string) []int {
+	return lo.Map(strings.Split(list, ","), func(s string, _ int) int {
+		val, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			b.Fatalf("invalid benchmark parameter %q: %v", s, err)
+		}
+		return val
+	})
+}
+
+func writeBenchCSV(results []benchResult) error {
+	var out io.Writer = os.Stdout
+	if *benchCSV != "" {
+		file, err := os.Create(*benchCSV)
+		if err != nil {
+			return fmt.Errorf("unable to create report file: %v", err)
+		}
+		defer file.Close()
+		out = file
+	}
+	writer := csv.NewWriter(out)
+	if err := writer.Write(benchHeader); err != nil {
+		return fmt.Errorf("unable to write header: %v", err)
+	}
+	for _, r := range results {
+		if err := writer.Write(r.record()); err != nil {
+			return fmt.Errorf("unable to write result: %v", err)
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
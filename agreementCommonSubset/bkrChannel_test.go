@@ -3,7 +3,9 @@ package agreementCommonSubset
 import (
 	aba "bkr-acs/asynchronousBinaryAgreement"
 	brb "bkr-acs/byzantineReliableBroadcast"
+	dc "bkr-acs/decisionCertificate"
 	on "bkr-acs/overlayNetwork"
+	"bkr-acs/utils"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/samber/lo"
@@ -19,9 +21,9 @@ func TestChannelShouldAcceptOwnProposal(t *testing.T) {
 	proposer, err := node.GetId()
 	assert.NoError(t, err)
 	bebChan := on.NewBEBChannel(node, 'z')
-	brbChan := brb.NewBRBChannel(1, 0, bebChan)
+	brbChan := brb.NewBRBChannel(1, 0, bebChan, node.Logger())
 	abaChan := getAbachans(t, 1, 0, []*on.Node{node})[0]
-	bkrChan := NewBKRChannel(0, abaChan, brbChan, []uuid.UUID{proposer})
+	bkrChan := NewBKRChannel(0, abaChan, brbChan, []uuid.UUID{proposer}, node.Logger())
 	id := uuid.New()
 	getListener := make(chan chan [][]byte, 1)
 	go func() {
@@ -36,17 +38,196 @@ func TestChannelShouldAcceptOwnProposal(t *testing.T) {
 	assert.NoError(t, node.Close())
 }
 
+type outputCollector struct {
+	outputs chan lo.Tuple2[uuid.UUID, [][]byte]
+}
+
+func (o *outputCollector) DeliverOutput(id uuid.UUID, output [][]byte) {
+	o.outputs <- lo.T2(id, output)
+}
+
+func TestChannelShouldNotifyObservers(t *testing.T) {
+	node := on.GetTestNode(t, "localhost:6000", "localhost:6000")
+	proposer, err := node.GetId()
+	assert.NoError(t, err)
+	bebChan := on.NewBEBChannel(node, 'z')
+	brbChan := brb.NewBRBChannel(1, 0, bebChan, node.Logger())
+	abaChan := getAbachans(t, 1, 0, []*on.Node{node})[0]
+	bkrChan := NewBKRChannel(0, abaChan, brbChan, []uuid.UUID{proposer}, node.Logger())
+	observer := &outputCollector{outputs: make(chan lo.Tuple2[uuid.UUID, [][]byte], 1)}
+	bkrChan.AttachObserver(observer)
+	id := uuid.New()
+	go func() {
+		_, err := bkrChan.Propose(id, []byte("Hello World"))
+		assert.NoError(t, err)
+	}()
+	deliveredId, output := (<-observer.outputs).Unpack()
+	assert.Equal(t, id, deliveredId)
+	assert.Equal(t, [][]byte{[]byte("Hello World")}, output)
+	assert.NoError(t, node.Close())
+}
+
+func TestChannelShouldRejectProposalsBeyondAdmissionWindow(t *testing.T) {
+	node := on.GetTestNode(t, "localhost:6000", "localhost:6000")
+	proposer, err := node.GetId()
+	assert.NoError(t, err)
+	bebChan := on.NewBEBChannel(node, 'z')
+	brbChan := brb.NewBRBChannel(1, 0, bebChan, node.Logger())
+	abaChan := getAbachans(t, 1, 0, []*on.Node{node})[0]
+	bkrChan := NewBKRChannel(0, abaChan, brbChan, []uuid.UUID{proposer}, node.Logger())
+	bkrChan.SetAdmissionPolicy(utils.AdmissionPolicy{Window: 4})
+	bkrChan.SetLowWatermark(10)
+	_, err = bkrChan.Propose(uuid.New(), []byte("random id"))
+	assert.Error(t, err)
+	_, err = bkrChan.Propose(utils.NewInstanceId(14, []byte("bkr")), []byte("beyond the window"))
+	assert.Error(t, err)
+	_, err = bkrChan.Propose(utils.NewInstanceId(9, []byte("bkr")), []byte("collected"))
+	assert.Error(t, err)
+	output, err := bkrChan.Propose(utils.NewInstanceId(13, []byte("bkr")), []byte("in the window"))
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("in the window")}, <-output)
+	bkrChan.Close()
+	assert.NoError(t, node.Close())
+}
+
+func TestChannelShouldIgnoreProposalsBroadcastWithOtherSequences(t *testing.T) {
+	node := on.GetTestNode(t, "localhost:6000", "localhost:6000")
+	proposer, err := node.GetId()
+	assert.NoError(t, err)
+	bebChan := on.NewBEBChannel(node, 'z')
+	brbChan := brb.NewBRBChannel(1, 0, bebChan, node.Logger())
+	abaChan := getAbachans(t, 1, 0, []*on.Node{node})[0]
+	bkrChan := NewBKRChannel(0, abaChan, brbChan, []uuid.UUID{proposer}, node.Logger())
+	bkrChan.SetAdmissionPolicy(utils.AdmissionPolicy{Window: 4})
+	brbChan.SetAdmissionPolicy(utils.AdmissionPolicy{})
+	observer := &outputCollector{outputs: make(chan lo.Tuple2[uuid.UUID, [][]byte], 1)}
+	bkrChan.AttachObserver(observer)
+	mismatched, beyond, valid := utils.NewInstanceId(1, []byte("bkr")), utils.NewInstanceId(20, []byte("bkr")), utils.NewInstanceId(2, []byte("bkr"))
+	_, err = brbChan.BRBroadcastWithTag(3, mismatched[:], []byte("other sequence"))
+	assert.NoError(t, err)
+	_, err = brbChan.BRBroadcastWithTag(20, beyond[:], []byte("beyond the window"))
+	assert.NoError(t, err)
+	_, err = brbChan.BRBroadcastWithTag(2, valid[:], []byte("valid"))
+	assert.NoError(t, err)
+	deliveredId, output := (<-observer.outputs).Unpack()
+	assert.Equal(t, valid, deliveredId)
+	assert.Equal(t, [][]byte{[]byte("valid")}, output)
+	assert.Never(t, func() bool {
+		bkrChan.instanceLock.Lock()
+		defer bkrChan.instanceLock.Unlock()
+		return len(bkrChan.instances) != 1
+	}, 100*time.Millisecond, 10*time.Millisecond)
+	bkrChan.Close()
+	assert.NoError(t, node.Close())
+}
+
 func TestChannelShouldAgreeProposalsNoFaults(t *testing.T) {
-	testChannelShouldAgreeProposals(t, 10, 0, 300)
+	testChannelShouldAgreeProposals(t, 10, 0, 300, false)
+}
+
+func TestChannelShouldAgreeProposalsWithSharedCoins(t *testing.T) {
+	testChannelShouldAgreeProposals(t, 4, 1, 300, true)
 }
 
 func TestChannelShouldAgreeProposalMaxFaults(t *testing.T) {
 	f := uint(3)
 	n := 3*f + 1
-	testChannelShouldAgreeProposals(t, n, f, 300)
+	testChannelShouldAgreeProposals(t, n, f, 300, false)
+}
+
+func TestChannelShouldCertifyOutputs(t *testing.T) {
+	n, f := uint(4), uint(1)
+	nodes := lo.Map(lo.Range(int(n)), func(_ int, i int) *on.Node {
+		return on.GetTestNode(t, fmt.Sprintf("localhost:%d", 6000+i), "localhost:6000")
+	})
+	proposers := lo.Map(nodes, func(n *on.Node, _ int) uuid.UUID {
+		id, err := n.GetId()
+		assert.NoError(t, err)
+		return id
+	})
+	brbChans := lo.Map(nodes, func(node *on.Node, _ int) *brb.BRBChannel {
+		return brb.NewBRBChannel(n, f, on.NewBEBChannel(node, 'z'), node.Logger())
+	})
+	certChans := lo.Map(nodes, func(node *on.Node, _ int) *dc.CertificateChannel {
+		certs, err := dc.NewCertificateChannel(n, f, node, on.NewBEBChannel(node, 'x'), node.Logger())
+		assert.NoError(t, err)
+		return certs
+	})
+	abaChans := getAbachans(t, n, f, nodes)
+	bkrChans := lo.Map(abaChans, func(a *aba.AbaChannel, i int) *BKRChannel {
+		b := NewBKRChannel(f, a, brbChans[i], proposers, nodes[i].Logger())
+		b.EnableCertificates(certChans[i])
+		return b
+	})
+	id := uuid.New()
+	outputListeners := lo.Map(bkrChans, func(b *BKRChannel, i int) chan [][]byte {
+		output, err := b.Propose(id, []byte(fmt.Sprintf("Hello World %d", i)))
+		assert.NoError(t, err)
+		return output
+	})
+	for i, listener := range outputListeners {
+		output := <-listener
+		sub, err := bkrChans[i].Certificate(id)
+		assert.NoError(t, err)
+		cert := <-sub
+		assert.NoError(t, VerifyOutput(cert, id, output, proposers, n, f))
+		assert.Error(t, VerifyOutput(cert, id, output[1:], proposers, n, f))
+	}
+	for _, certs := range certChans {
+		certs.Close()
+	}
+	assert.True(t, lo.EveryBy(nodes, func(n *on.Node) bool { return n.Close() == nil }))
+}
+
+func TestChannelShouldOnlyAcceptValidatedProposals(t *testing.T) {
+	n, f := uint(4), uint(1)
+	nodes := lo.Map(lo.Range(int(n)), func(_ int, i int) *on.Node {
+		return on.GetTestNode(t, fmt.Sprintf("localhost:%d", 6000+i), "localhost:6000")
+	})
+	proposers := lo.Map(nodes, func(n *on.Node, _ int) uuid.UUID {
+		id, err := n.GetId()
+		assert.NoError(t, err)
+		return id
+	})
+	brbChans := lo.Map(nodes, func(node *on.Node, _ int) *brb.BRBChannel {
+		return brb.NewBRBChannel(n, f, on.NewBEBChannel(node, 'z'), node.Logger())
+	})
+	abaChans := getAbachans(t, n, f, nodes)
+	validator := func(_, proposer uuid.UUID, proposal []byte) <-chan bool {
+		res := make(chan bool, 1)
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			res <- string(proposal) == fmt.Sprintf("from %s", proposer)
+		}()
+		return res
+	}
+	bkrChans := lo.Map(abaChans, func(a *aba.AbaChannel, i int) *BKRChannel {
+		b := NewBKRChannel(f, a, brbChans[i], proposers, nodes[i].Logger())
+		b.SetValidator(validator)
+		return b
+	})
+	id := uuid.New()
+	outputListeners := lo.Map(bkrChans, func(b *BKRChannel, i int) chan [][]byte {
+		proposal := fmt.Sprintf("from %s", proposers[i])
+		if i == int(n-1) {
+			proposal = fmt.Sprintf("from %s", proposers[0])
+		}
+		output, err := b.Propose(id, []byte(proposal))
+		assert.NoError(t, err)
+		return output
+	})
+	results := lo.Map(outputListeners, func(o chan [][]byte, _ int) [][]byte { return <-o })
+	expected := lo.Map(proposers[:n-1], func(proposer uuid.UUID, _ int) string { return fmt.Sprintf("from %s", proposer) })
+	for _, result := range results {
+		assert.ElementsMatch(t, expected, lo.Map(result, func(proposal []byte, _ int) string { return string(proposal) }))
+	}
+	for _, b := range bkrChans {
+		b.Close()
+	}
+	assert.True(t, lo.EveryBy(nodes, func(n *on.Node) bool { return n.Close() == nil }))
 }
 
-func testChannelShouldAgreeProposals(t *testing.T, n, f uint, maxDelay uint) {
+func testChannelShouldAgreeProposals(t *testing.T, n, f uint, maxDelay uint, sharedCoins bool) {
 	nodes := lo.Map(lo.Range(int(n)), func(_ int, i int) *on.Node {
 		address := fmt.Sprintf("localhost:%d", 6000+i)
 		return on.GetTestNode(t, address, "localhost:6000")
@@ -60,11 +241,14 @@ func testChannelShouldAgreeProposals(t *testing.T, n, f uint, maxDelay uint) {
 		return on.NewBEBChannel(n, 'z')
 	})
 	brbChans := lo.Map(bebChans, func(b *on.BEBChannel, _ int) *brb.BRBChannel {
-		return brb.NewBRBChannel(n, f, b)
+		return brb.NewBRBChannel(n, f, b, utils.DefaultLogger())
 	})
 	abaChans := getAbachans(t, n, f, nodes)
 	bkrChans := lo.ZipBy2(abaChans, brbChans, func(a *aba.AbaChannel, b *brb.BRBChannel) *BKRChannel {
-		return NewBKRChannel(f, a, b, proposers)
+		if sharedCoins {
+			a.EnableSharedCoins()
+		}
+		return NewBKRChannel(f, a, b, proposers, utils.DefaultLogger())
 	})
 	id := uuid.New()
 	getListeners := lo.Map(bkrChans, func(b *BKRChannel, _ int) chan chan [][]byte {
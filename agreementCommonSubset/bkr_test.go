@@ -4,6 +4,7 @@ import (
 	aba "bkr-acs/asynchronousBinaryAgreement"
 	ct "bkr-acs/coinTosser"
 	on "bkr-acs/overlayNetwork"
+	"bkr-acs/utils"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/samber/lo"
@@ -72,7 +73,7 @@ func testShouldOutputProposals(t *testing.T, n, f uint, receiveInput func(instan
 	id := uuid.New()
 	proposers := lo.Map(nodes, func(node *on.Node, _ int) uuid.UUID { return uuid.New() })
 	bkrInstances := lo.Map(abachans, func(abachan *aba.AbaChannel, _ int) *bkr {
-		return newBKR(id, f, proposers, abachan)
+		return newBKR(id, f, proposers, abachan, nil, nil, utils.DefaultLogger())
 	})
 	for _, bkr := range bkrInstances {
 		for i, participant := range proposers {
@@ -87,7 +88,7 @@ func testShouldOutputProposals(t *testing.T, n, f uint, receiveInput func(instan
 	assert.True(t, lo.EveryBy(nodes, func(node *on.Node) bool { return node.Close() == nil }))
 }
 
-func getAbachans(t *testing.T, n uint, f uint, nodes []*on.Node) []*aba.AbaChannel {
+func getAbachans(t testing.TB, n uint, f uint, nodes []*on.Node) []*aba.AbaChannel {
 	dealSSs := lo.Map(nodes, func(node *on.Node, _ int) *on.SSChannel { return on.NewSSChannel(node, 'd') })
 	ctBebs := lo.Map(nodes, func(node *on.Node, _ int) *on.BEBChannel { return on.NewBEBChannel(node, 'c') })
 	mBebs := lo.Map(nodes, func(node *on.Node, _ int) *on.BEBChannel { return on.NewBEBChannel(node, 'm') })
@@ -95,7 +96,7 @@ func getAbachans(t *testing.T, n uint, f uint, nodes []*on.Node) []*aba.AbaChann
 	on.InitializeNodes(t, nodes)
 	assert.NoError(t, ct.DealSecret(dealSSs[0], ct.NewScalar(42), 2*f))
 	abachans := lo.ZipBy4(dealSSs, ctBebs, mBebs, tBebs, func(dealSS *on.SSChannel, ctBeb, mBeb, tBeb *on.BEBChannel) *aba.AbaChannel {
-		abachan, err := aba.NewAbaChannel(n, f, dealSS, ctBeb, mBeb, tBeb)
+		abachan, err := aba.NewAbaChannel(n, f, dealSS, ctBeb, mBeb, tBeb, dealSS.Logger())
 		assert.NoError(t, err)
 		return abachan
 	})
@@ -0,0 +1,69 @@
+package agreementCommonSubset
+
+import (
+	dc "bkr-acs/decisionCertificate"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"github.com/google/uuid"
+)
+
+// OutputDigest is the value signed by the nodes for the output of an instance: the hash of its proposals, in order and
+// each prefixed by its length.
+func OutputDigest(output [][]byte) []byte {
+	hash := sha256.New()
+	for _, proposal := range output {
+		_ = binary.Write(hash, binary.LittleEndian, uint64(len(proposal)))
+		hash.Write(proposal)
+	}
+	return hash.Sum(nil)
+}
+
+// VerifyOutput checks that the certificate proves that the instance of a channel of n nodes, f of which may be faulty,
+// output the given proposals.
+func VerifyOutput(cert *dc.Certificate, id uuid.UUID, output [][]byte, participants []uuid.UUID, n, f uint) error {
+	if cert.Instance != id {
+		return fmt.Errorf("certificate of instance %s does not certify instance %s", cert.Instance, id)
+	} else if !bytes.Equal(cert.Value, OutputDigest(output)) {
+		return fmt.Errorf("certificate does not certify the output")
+	} else if err := cert.Verify(participants, n, f); err != nil {
+		return fmt.Errorf("invalid certificate: %v", err)
+	}
+	return nil
+}
+
+// EnableCertificates makes every node sign the outputs of the instances that output from then on, so that each output
+// gets a certificate of n-f signatures that third parties can check with VerifyOutput.
+// Every node of the channel must enable it, since the certificates need the signatures of n-f nodes.
+func (c *BKRChannel) EnableCertificates(certs *dc.CertificateChannel) {
+	c.instanceLock.Lock()
+	c.certs = certs
+	policy := c.policy
+	c.instanceLock.Unlock()
+	certs.SetAdmissionPolicy(policy)
+}
+
+// Certificate returns a channel that receives the certificate of the output of an instance once it is complete,
+// and is closed if the instance is collected before.
+func (c *BKRChannel) Certificate(id uuid.UUID) (<-chan *dc.Certificate, error) {
+	c.instanceLock.Lock()
+	certs := c.certs
+	c.instanceLock.Unlock()
+	if certs == nil {
+		return nil, fmt.Errorf("outputs are not certified")
+	}
+	return certs.Certificate(id)
+}
+
+// certifyOutput signs the output of an instance, unless certificates are disabled.
+func (c *BKRChannel) certifyOutput(id uuid.UUID, output [][]byte) {
+	c.instanceLock.Lock()
+	certs := c.certs
+	c.instanceLock.Unlock()
+	if certs == nil {
+		return
+	} else if err := certs.Certify(id, OutputDigest(output)); err != nil {
+		c.logger.Warn("unable to certify output", "id", id, "error", err)
+	}
+}
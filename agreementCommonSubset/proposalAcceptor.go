@@ -10,8 +10,6 @@ import (
 	"sync"
 )
 
-var proposalLogger = utils.GetLogger("Proposal Acceptor", slog.LevelWarn)
-
 type proposalAcceptor struct {
 	proposer  uuid.UUID
 	aba       *aba.AbaInstance
@@ -19,22 +17,26 @@ type proposalAcceptor struct {
 	inputLock sync.Mutex
 	inputChan chan []byte
 	proposed  bool
+	decision  mo.Option[byte]
 	output    chan mo.Option[[]byte]
+	logger    *slog.Logger
 }
 
-func newProposalAcceptor(abaId uuid.UUID, proposer uuid.UUID, abaChan *aba.AbaChannel) *proposalAcceptor {
-	abaInstance := abaChan.NewAbaInstance(abaId)
+func newProposalAcceptor(abaId, bkrId uuid.UUID, proposer uuid.UUID, abaChan *aba.AbaChannel, logger *slog.Logger) *proposalAcceptor {
+	abaInstance := abaChan.NewSiblingAbaInstance(abaId, bkrId)
 	p := &proposalAcceptor{
 		proposer:  proposer,
 		aba:       abaInstance,
 		input:     mo.None[[]byte](),
 		inputLock: sync.Mutex{},
 		proposed:  false,
+		decision:  mo.None[byte](),
 		inputChan: make(chan []byte, 1),
 		output:    make(chan mo.Option[[]byte], 1),
+		logger:    utils.ComponentLogger(logger, "Proposal Acceptor", slog.LevelWarn),
 	}
 	go p.waitResponse()
-	proposalLogger.Info("new proposal acceptor created", "instance", abaId, "proposer", proposer)
+	p.logger.Info("new proposal acceptor created", "instance", abaId, "proposer", proposer)
 	return p
 }
 
@@ -44,7 +46,7 @@ func (p *proposalAcceptor) submitInput(input []byte) error {
 	if p.input.IsPresent() {
 		return fmt.Errorf("input already submitted")
 	}
-	proposalLogger.Info("submitting input", "proposer", p.proposer, "input", string(input))
+	p.logger.Info("submitting input", "proposer", p.proposer, "input", string(input))
 	p.input = mo.Some(input)
 	p.inputChan <- input
 	if !p.proposed {
@@ -62,7 +64,7 @@ func (p *proposalAcceptor) rejectProposal() error {
 	if p.input.IsPresent() {
 		return fmt.Errorf("input already submitted")
 	}
-	proposalLogger.Info("rejecting proposal", "proposer", p.proposer)
+	p.logger.Info("rejecting proposal", "proposer", p.proposer)
 	if !p.proposed {
 		p.proposed = true
 		if err := p.aba.Propose(reject); err != nil {
@@ -78,15 +80,31 @@ func (p *proposalAcceptor) hasProposed() bool {
 	return p.proposed
 }
 
+func (p *proposalAcceptor) state() AcceptorState {
+	p.inputLock.Lock()
+	defer p.inputLock.Unlock()
+	decision, decided := p.decision.Get()
+	return AcceptorState{
+		Proposer:    p.proposer,
+		HasProposal: p.input.IsPresent(),
+		Proposed:    p.proposed,
+		Decided:     decided,
+		Accepted:    decided && decision == accept,
+	}
+}
+
 func (p *proposalAcceptor) waitResponse() {
 	res := p.aba.GetOutput()
-	proposalLogger.Info("received decision", "proposer", p.proposer, "decision", res)
+	p.logger.Info("received decision", "proposer", p.proposer, "decision", res)
+	p.inputLock.Lock()
+	p.decision = mo.Some(res)
+	p.inputLock.Unlock()
 	if res == accept {
 		acceptedProposal := <-p.inputChan
-		proposalLogger.Info("accepted proposal", "proposer", p.proposer, "proposal", string(acceptedProposal))
+		p.logger.Info("accepted proposal", "proposer", p.proposer, "proposal", string(acceptedProposal))
 		p.output <- mo.Some(acceptedProposal)
 	} else {
-		proposalLogger.Info("rejected proposal")
+		p.logger.Info("rejected proposal")
 		p.output <- mo.None[[]byte]()
 	}
 }
@@ -0,0 +1,46 @@
+package agreementCommonSubset
+
+import (
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+)
+
+// AcceptorState is the progress of the ABA instance deciding whether the proposal of a participant is accepted.
+type AcceptorState struct {
+	Proposer    uuid.UUID `json:"proposer"`
+	HasProposal bool      `json:"hasProposal"`
+	Proposed    bool      `json:"proposed"`
+	Decided     bool      `json:"decided"`
+	Accepted    bool      `json:"accepted"`
+}
+
+type BKRInstanceState struct {
+	Id        uuid.UUID       `json:"id"`
+	Acceptors []AcceptorState `json:"acceptors"`
+}
+
+// BKRState is a snapshot of the instances of the channel that have not been collected by the low watermark.
+// An instance is finished once every one of its acceptors has decided.
+type BKRState struct {
+	Live      []BKRInstanceState `json:"live"`
+	Finished  []uuid.UUID        `json:"finished"`
+	Watermark uint64             `json:"watermark"`
+}
+
+// State returns a snapshot of the instances of the channel.
+func (c *BKRChannel) State() BKRState {
+	c.instanceLock.Lock()
+	instances := lo.Entries(c.instances)
+	watermark := c.watermark
+	c.instanceLock.Unlock()
+	state := BKRState{Live: make([]BKRInstanceState, 0), Finished: make([]uuid.UUID, 0), Watermark: watermark}
+	for _, entry := range instances {
+		acceptors := lo.Map(entry.Value.acceptors, func(a *proposalAcceptor, _ int) AcceptorState { return a.state() })
+		if lo.EveryBy(acceptors, func(a AcceptorState) bool { return a.Decided }) {
+			state.Finished = append(state.Finished, entry.Key)
+		} else {
+			state.Live = append(state.Live, BKRInstanceState{Id: entry.Key, Acceptors: acceptors})
+		}
+	}
+	return state
+}
@@ -2,6 +2,7 @@ package asynchronousBinaryAgreement
 
 import (
 	ct "bkr-acs/coinTosser"
+	dc "bkr-acs/decisionCertificate"
 	on "bkr-acs/overlayNetwork"
 	"bkr-acs/utils"
 	"fmt"
@@ -9,15 +10,16 @@ import (
 	"log/slog"
 )
 
-var abaChannelLogger = utils.GetLogger("ABA Channel", slog.LevelWarn)
-
 type AbaInstance struct {
-	abaNetworkedInstance
-	output chan byte
+	process   Process
+	net       *Network
+	output    chan byte
+	collected chan struct{}
+	certs     *dc.CertificateChannel
 }
 
 func (a *AbaInstance) Propose(est byte) error {
-	if err := a.propose(est); err != nil {
+	if err := a.process.Propose(est); err != nil {
 		return fmt.Errorf("unable to propose initial estimate: %w", err)
 	}
 	return nil
@@ -27,50 +29,156 @@ func (a *AbaInstance) GetOutput() byte {
 	return <-a.output
 }
 
+// GetCertificate waits for the certificate of the decision of the instance, which fails if the channel does not
+// certify decisions or the instance is collected first.
+func (a *AbaInstance) GetCertificate() (*dc.Certificate, error) {
+	if a.certs == nil {
+		return nil, fmt.Errorf("decisions are not certified")
+	}
+	sub, err := a.certs.Certificate(a.net.Id)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get certificate: %w", err)
+	}
+	cert, ok := <-sub
+	if !ok {
+		return nil, fmt.Errorf("instance collected before its decision was certified")
+	}
+	return cert, nil
+}
+
 type AbaChannel struct {
 	n             uint
 	f             uint
 	instances     map[uuid.UUID]*AbaInstance
 	finished      map[uuid.UUID]bool
-	ctChannel     *ct.CTChannel
+	watermark     uint64
+	admission     *utils.Admission
+	decided       uint64
+	decisionRound uint64
+	algorithm     Algorithm
+	coins         *coinCache
+	fastPath      bool
+	certs         *dc.CertificateChannel
+	coin          ct.Coin
 	termidware    *terminationMiddleware
 	middleware    *abaMiddleware
 	commands      chan func() error
 	listenerClose chan struct{}
 	invokerClose  chan struct{}
+	logger        *slog.Logger
 }
 
-func NewAbaChannel(n, f uint, dealSS *on.SSChannel, ctBeb, mBeb, tBeb *on.BEBChannel) (*AbaChannel, error) {
-	ctChannel, err := ct.NewCoinTosserChannel(dealSS, ctBeb, 2*f)
+func NewAbaChannel(n, f uint, dealSS *on.SSChannel, ctBeb, mBeb, tBeb *on.BEBChannel, logger *slog.Logger) (*AbaChannel, error) {
+	ctChannel, err := ct.NewCoinTosserChannel(dealSS, ctBeb, 2*f, logger)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create coin tosser channel: %w", err)
 	}
+	return NewAbaChannelWithCoinTosser(n, f, ctChannel, mBeb, tBeb, logger), nil
+}
+
+// NewAbaChannelWithCoinTosser creates a channel using a coin tosser that was already created, such as one loaded from an offline deal.
+// The coin tosser must use threshold 2f.
+func NewAbaChannelWithCoinTosser(n, f uint, ctChannel *ct.CTChannel, mBeb, tBeb *on.BEBChannel, logger *slog.Logger) *AbaChannel {
+	return newAbaChannel(n, f, ctChannel, MMR(), mBeb, tBeb, logger)
+}
+
+// NewAbaChannelWithCoin creates a channel whose instances run algorithm with any coin, such as a local or a beacon coin.
+// It fails if the algorithm cannot run with the coin.
+func NewAbaChannelWithCoin(n, f uint, coin ct.Coin, algorithm Algorithm, mBeb, tBeb *on.BEBChannel, logger *slog.Logger) (*AbaChannel, error) {
+	if err := algorithm.Check(n, f, coin); err != nil {
+		return nil, fmt.Errorf("unable to use algorithm: %v", err)
+	}
+	return newAbaChannel(n, f, coin, algorithm, mBeb, tBeb, logger), nil
+}
+
+func newAbaChannel(n, f uint, coin ct.Coin, algorithm Algorithm, mBeb, tBeb *on.BEBChannel, logger *slog.Logger) *AbaChannel {
 	c := &AbaChannel{
 		n:             n,
 		f:             f,
 		instances:     make(map[uuid.UUID]*AbaInstance),
 		finished:      make(map[uuid.UUID]bool),
-		ctChannel:     ctChannel,
-		termidware:    newTerminationMiddleware(tBeb),
-		middleware:    newABAMiddleware(mBeb),
+		admission:     utils.NewAdmission(),
+		algorithm:     algorithm,
+		coin:          coin,
+		termidware:    newTerminationMiddleware(tBeb, logger),
+		middleware:    newABAMiddleware(mBeb, logger),
 		commands:      make(chan func() error),
 		listenerClose: make(chan struct{}, 1),
 		invokerClose:  make(chan struct{}, 1),
+		logger:        utils.ComponentLogger(logger, "ABA Channel", slog.LevelWarn),
 	}
 	go c.invoker()
 	go c.listener()
-	abaChannelLogger.Info("initialized aba channel", "n", n, "f", f)
-	return c, nil
+	c.logger.Info("initialized aba channel", "n", n, "f", f)
+	return c
+}
+
+// SetAlgorithm selects the algorithm run by the instances created from then on. Every node of the channel must select the same one.
+func (c *AbaChannel) SetAlgorithm(algorithm Algorithm) error {
+	if err := algorithm.Check(c.n, c.f, c.coin); err != nil {
+		return fmt.Errorf("unable to set algorithm: %v", err)
+	}
+	c.commands <- func() error {
+		c.algorithm = algorithm
+		return nil
+	}
+	return nil
+}
+
+// EnableSharedCoins makes the instances created with NewSiblingAbaInstance for the same parent toss a single coin per round,
+// instead of one each. Every node of the channel must enable it, before creating any instance.
+// Instances created by the messages of peers toss no coin until this node creates them, since only then it knows their parent.
+// Sharing coins cuts the work of the coin tosser by the number of siblings, but the coin of a round is known once any
+// sibling tossed it, so an adversary that controls the network can use it against the siblings that did not reach that round.
+func (c *AbaChannel) EnableSharedCoins() {
+	c.commands <- func() error {
+		c.coins = newCoinCache(c.coin)
+		return nil
+	}
+}
+
+// EnableFastPath makes the MMR instances, with either validity, created from then on decide 1 as soon as n-f nodes vote for 1 in the
+// first round, two communication steps after proposing, and fall back to the usual rounds otherwise.
+// The coin of the first round is then fixed to 1 instead of tossed. Every node of the channel must enable it.
+func (c *AbaChannel) EnableFastPath() {
+	c.commands <- func() error {
+		c.fastPath = true
+		return nil
+	}
+}
+
+// EnableCertificates makes every node sign the decisions of the instances created from then on, so that each decision
+// gets a certificate of n-f signatures that third parties can check with VerifyDecision.
+// The certificate channel may be shared with other protocols, as long as their instance ids differ.
+func (c *AbaChannel) EnableCertificates(certs *dc.CertificateChannel) {
+	c.commands <- func() error {
+		c.certs = certs
+		return nil
+	}
 }
 
 func (c *AbaChannel) NewAbaInstance(instanceId uuid.UUID) *AbaInstance {
+	return c.newLocalInstance(instanceId, instanceId)
+}
+
+// NewSiblingAbaInstance creates an instance on behalf of parent, such as one of the ABA instances of a BKR instance.
+// With shared coins, it tosses the coins of the group of parent, seeded with an id derived from parent and the round.
+func (c *AbaChannel) NewSiblingAbaInstance(instanceId, parent uuid.UUID) *AbaInstance {
+	return c.newLocalInstance(instanceId, utils.DeriveInstanceId(parent, []byte("coin")))
+}
+
+func (c *AbaChannel) newLocalInstance(instanceId, coinGroup uuid.UUID) *AbaInstance {
 	res := make(chan *AbaInstance, 1)
 	c.commands <- func() error {
 		if instance, err := c.getInstance(instanceId); err != nil {
 			res <- nil
 			return fmt.Errorf("unable to get aba inner: %w", err)
+		} else if err := instance.net.joinCoinGroup(coinGroup); err != nil {
+			res <- nil
+			return fmt.Errorf("unable to join coin group: %w", err)
 		} else {
-			abaChannelLogger.Debug("outputting aba instance", "id", instanceId)
+			c.logger.Debug("outputting aba instance", "id", instanceId)
+			c.admission.Release(instanceId)
 			res <- instance
 		}
 		return nil
@@ -90,59 +198,98 @@ func (c *AbaChannel) listener() {
 				return c.processMiddlewareMsg(abamsg)
 			}
 		case <-c.listenerClose:
-			abaChannelLogger.Info("closing listener")
+			c.logger.Info("closing listener")
 			return
 		}
 	}
 }
 
 func (c *AbaChannel) processTermMsg(term *terminationMsg) error {
-	aba, err := c.getInstance(term.instance)
+	aba, err := c.getPeerInstance(term.instance, term.sender)
 	if err != nil {
 		return fmt.Errorf("unable to process termination message: unable to get aba inner: %w", err)
+	} else if aba == nil {
+		return nil
 	}
 	go func() {
-		err := aba.submitDecision(term.decision, term.sender)
+		err := aba.process.SubmitDecision(term.decision, term.sender)
 		if err != nil {
-			abaChannelLogger.Warn("unable to submit decision", "instanceId", term.instance, "decision", term.decision, "error", err)
+			c.logger.Warn("unable to submit decision", "instanceId", term.instance, "decision", term.decision, "error", err)
 		}
 	}()
 	return nil
 }
 
 func (c *AbaChannel) processMiddlewareMsg(msg *abaMsg) error {
-	aba, err := c.getInstance(msg.instance)
+	aba, err := c.getPeerInstance(msg.instance, msg.sender)
 	if err != nil {
 		return fmt.Errorf("unable to process aba control message: unable to get aba inner: %w", err)
+	} else if aba == nil {
+		return nil
 	}
-	switch msg.kind {
-	case echo:
-		go func() {
-			err := aba.submitEcho(msg.val, msg.sender, msg.round)
-			if err != nil {
-				abaChannelLogger.Warn("unable to submit bVal", "instanceId", msg.instance, "round", msg.round, "error", err)
-			}
-		}()
-	case vote:
-		go func() {
-			err := aba.submitVote(msg.val, msg.sender, msg.round)
-			if err != nil {
-				abaChannelLogger.Warn("unable to submit vote", "instanceId", msg.instance, "round", msg.round, "error", err)
+	go func() {
+		err := aba.process.Submit(Message{Kind: msg.kind, Round: msg.round, Val: msg.val, Sender: msg.sender})
+		if err != nil {
+			c.logger.Warn("unable to submit message", "instanceId", msg.instance, "kind", msg.kind, "round", msg.round, "error", err)
+		}
+	}()
+	return nil
+}
+
+// SetLowWatermark drops the state of the instances with a sequence below seq, and of the coins they tossed.
+// Messages of these instances are rejected from then on, and the instances that have not terminated are abandoned.
+func (c *AbaChannel) SetLowWatermark(seq uint64) {
+	c.commands <- func() error {
+		if seq <= c.watermark {
+			return nil
+		}
+		c.logger.Debug("raising low watermark", "from", c.watermark, "to", seq)
+		c.watermark = seq
+		c.admission.Collect(seq)
+		if c.coins != nil {
+			c.coins.collect(seq)
+		}
+		if c.certs != nil {
+			go c.certs.SetLowWatermark(seq)
+		}
+		for id := range c.finished {
+			if c.isCollected(id) {
+				delete(c.finished, id)
 			}
-		}()
-	case bind:
-		go func() {
-			err := aba.submitBind(msg.val, msg.sender, msg.round)
-			if err != nil {
-				abaChannelLogger.Warn("unable to submit bind", "instanceId", msg.instance, "round", msg.round, "error", err)
+		}
+		for id, instance := range c.instances {
+			if c.isCollected(id) {
+				delete(c.instances, id)
+				close(instance.collected)
+				go instance.process.Close()
 			}
-		}()
+		}
+		return nil
 	}
-	return nil
+	c.coin.SetLowWatermark(seq)
+}
+
+// SetAdmissionPolicy limits the instances that peers can create in this channel and in its coin tosser.
+// Messages of instances that are not admitted are dropped, so the limits must leave room for the instances correct peers run concurrently.
+func (c *AbaChannel) SetAdmissionPolicy(policy utils.AdmissionPolicy) {
+	c.commands <- func() error {
+		c.admission.SetPolicy(policy)
+		if c.certs != nil {
+			go c.certs.SetAdmissionPolicy(policy)
+		}
+		return nil
+	}
+	c.coin.SetAdmissionPolicy(policy)
+}
+
+func (c *AbaChannel) isCollected(id uuid.UUID) bool {
+	return utils.InstanceSequence(id) < c.watermark
 }
 
 func (c *AbaChannel) getInstance(id uuid.UUID) (*AbaInstance, error) {
-	if c.finished[id] {
+	if c.isCollected(id) {
+		return nil, fmt.Errorf("requested instance was collected")
+	} else if c.finished[id] {
 		return nil, fmt.Errorf("requested instance is already finished")
 	}
 	instance := c.instances[id]
@@ -152,38 +299,81 @@ func (c *AbaChannel) getInstance(id uuid.UUID) (*AbaInstance, error) {
 	return instance, nil
 }
 
+// getPeerInstance returns the instance named by a message of sender, or nil if sender may not create it.
+func (c *AbaChannel) getPeerInstance(id, sender uuid.UUID) (*AbaInstance, error) {
+	if c.instances[id] == nil && !c.isCollected(id) && !c.finished[id] && !c.admission.Admit(id, sender, c.watermark) {
+		c.logger.Debug("rejected message from unadmitted instance", "id", id, "from", sender)
+		return nil, nil
+	}
+	return c.getInstance(id)
+}
+
 func (c *AbaChannel) newAbaInstance(id uuid.UUID) *AbaInstance {
-	abaNetworked := newAbaNetworkedInstance(id, c.n, c.f, c.middleware, c.termidware, c.ctChannel)
+	net := newNetwork(id, c.n, c.f, c.middleware, c.termidware, c.coin, c.logger)
+	net.fastPath = c.fastPath
+	collected := make(chan struct{})
+	if c.coins != nil {
+		net.awaitCoinGroup(c.coins, collected)
+	}
 	wrapper := &AbaInstance{
-		abaNetworkedInstance: abaNetworked,
-		output:               make(chan byte, 1),
+		process:   c.algorithm.Start(net),
+		net:       net,
+		output:    make(chan byte, 1),
+		collected: collected,
+		certs:     c.certs,
 	}
 	c.instances[id] = wrapper
 	go c.handleAsyncResultDelivery(id, wrapper)
-	abaChannelLogger.Debug("created new aba instance", "id", id)
+	c.logger.Debug("created new aba instance", "id", id)
 	return wrapper
 }
 
 func (c *AbaChannel) handleAsyncResultDelivery(id uuid.UUID, aba *AbaInstance) {
-	finalDecision := <-aba.decisionChan
-	abaChannelLogger.Debug("outputting decision for aba instance", "id", id, "decision", finalDecision)
+	var finalDecision byte
+	select {
+	case finalDecision = <-aba.process.Decision():
+	case <-aba.collected:
+		c.logger.Debug("aba instance collected before deciding", "id", id)
+		return
+	}
+	c.logger.Debug("outputting decision for aba instance", "id", id, "decision", finalDecision)
+	c.middleware.beb.Transcript().RecordDecision("aba", map[string]string{"instance": id.String(), "decision": fmt.Sprint(finalDecision)})
+	round, _ := aba.process.State()
+	c.commands <- func() error {
+		c.decided++
+		c.decisionRound += uint64(round) + 1
+		return nil
+	}
 	aba.output <- finalDecision
-	<-aba.terminatedChan
-	abaChannelLogger.Info("closing aba instance", "id", id)
+	if aba.certs != nil {
+		if err := aba.certs.Certify(id, decisionValue(finalDecision)); err != nil {
+			c.logger.Warn("unable to certify decision", "id", id, "error", err)
+		}
+	}
+	select {
+	case <-aba.process.Terminated():
+	case <-aba.collected:
+		c.logger.Debug("aba instance collected before terminating", "id", id)
+		return
+	}
+	c.logger.Info("closing aba instance", "id", id)
 	c.commands <- func() error {
 		return c.closeWrappedInstance(id)
 	}
 }
 
 func (c *AbaChannel) closeWrappedInstance(id uuid.UUID) error {
-	if c.finished[id] {
+	if c.isCollected(id) {
+		return nil
+	} else if c.finished[id] {
 		return fmt.Errorf("inner already closed")
 	} else if instance := c.instances[id]; instance == nil {
 		return fmt.Errorf("inner does not exist")
 	} else {
 		c.finished[id] = true
-		c.instances[id] = nil
-		instance.close()
+		c.admission.Release(id)
+		delete(c.instances, id)
+		instance.process.Close()
 	}
 	return nil
 }
@@ -193,17 +383,17 @@ func (c *AbaChannel) invoker() {
 		select {
 		case cmd := <-c.commands:
 			if err := cmd(); err != nil {
-				abaChannelLogger.Warn("error executing command", "error", err)
+				c.logger.Warn("error executing command", "error", err)
 			}
 		case <-c.invokerClose:
-			abaChannelLogger.Info("closing invoker")
+			c.logger.Info("closing invoker")
 			return
 		}
 	}
 }
 
 func (c *AbaChannel) Close() {
-	abaChannelLogger.Info("signaling close of listener and invoker")
+	c.logger.Info("signaling close of listener and invoker")
 	c.listenerClose <- struct{}{}
 	c.invokerClose <- struct{}{}
 }
@@ -2,7 +2,9 @@ package asynchronousBinaryAgreement
 
 import (
 	ct "bkr-acs/coinTosser"
+	dc "bkr-acs/decisionCertificate"
 	on "bkr-acs/overlayNetwork"
+	"bkr-acs/utils"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/samber/lo"
@@ -25,7 +27,165 @@ func TestAbaChannelShouldDecideMultipleWithFaults(t *testing.T) {
 	testAbaChannelShouldDecideMultiple(t, n, f)
 }
 
+func TestAbaChannelWithInternalValidityMMRShouldDecide(t *testing.T) {
+	abachans, nodes := makeAbaChannels(t, 4, 1, InternalValidityMMR())
+	testAbaChannelsShouldDecide(t, abachans, nodes, func(int) byte { return byte(rand.IntN(2)) })
+}
+
+func TestAbaChannelWithBenOrShouldDecide(t *testing.T) {
+	abachans, nodes := makeAbaChannelsWithCoin(t, 6, 1, BenOr(), func(int, *on.BEBChannel) ct.Coin { return ct.NewLocalCoin() })
+	testAbaChannelsShouldDecide(t, abachans, nodes, func(int) byte { return byte(rand.IntN(2)) })
+}
+
+func TestAbaChannelWithBenOrShouldDecideWithCommonCoin(t *testing.T) {
+	abachans, nodes := makeAbaChannels(t, 6, 1, BenOr())
+	testAbaChannelsShouldDecide(t, abachans, nodes, func(int) byte { return byte(rand.IntN(2)) })
+}
+
+func TestAbaChannelWithBenOrShouldDecideUnanimousProposal(t *testing.T) {
+	abachans, nodes := makeAbaChannelsWithCoin(t, 6, 1, BenOr(), func(int, *on.BEBChannel) ct.Coin { return ct.NewLocalCoin() })
+	decisions := testAbaChannelsShouldDecide(t, abachans, nodes, func(int) byte { return 1 })
+	assert.Equal(t, byte(1), decisions[0])
+}
+
+func TestAbaChannelShouldRejectAlgorithmNotToleratingFaults(t *testing.T) {
+	abachans, nodes := makeAbaChannels(t, 4, 1, MMR())
+	assert.Error(t, abachans[0].SetAlgorithm(BenOr()))
+	assert.NoError(t, abachans[0].SetAlgorithm(InternalValidityMMR()))
+	for _, abachan := range abachans {
+		abachan.Close()
+	}
+	assert.True(t, lo.EveryBy(nodes, func(node *on.Node) bool { return node.Close() == nil }))
+}
+
+func TestAbaChannelShouldRejectLocalCoinForMMR(t *testing.T) {
+	node := on.GetTestNode(t, "localhost:6000", "localhost:6000")
+	mBeb, tBeb := on.NewBEBChannel(node, 'm'), on.NewBEBChannel(node, 't')
+	for _, algorithm := range []Algorithm{MMR(), InternalValidityMMR()} {
+		_, err := NewAbaChannelWithCoin(4, 1, ct.NewLocalCoin(), algorithm, mBeb, tBeb, node.Logger())
+		assert.Error(t, err)
+	}
+	assert.NoError(t, node.Close())
+}
+
+func TestAbaChannelShouldDecideWithBLSCoin(t *testing.T) {
+	deals, err := ct.DealBLSOffline(2, 4)
+	assert.NoError(t, err)
+	abachans, nodes := makeAbaChannelsWithCoin(t, 4, 1, MMR(), func(i int, ctBeb *on.BEBChannel) ct.Coin {
+		coin, err := ct.NewBLSCoinChannel(deals[i], ctBeb, utils.DefaultLogger())
+		assert.NoError(t, err)
+		return coin
+	})
+	testAbaChannelsShouldDecide(t, abachans, nodes, func(i int) byte { return byte(i % 2) })
+}
+
+func TestAbaChannelShouldDecideWithBeaconCoin(t *testing.T) {
+	abachans, nodes := makeAbaChannelsWithCoin(t, 4, 1, MMR(), func(int, *on.BEBChannel) ct.Coin {
+		return ct.NewBeaconCoin(ct.NewHashBeacon([]byte("key")), utils.DefaultLogger())
+	})
+	testAbaChannelsShouldDecide(t, abachans, nodes, func(i int) byte { return byte(i % 2) })
+}
+
+func TestAbaChannelShouldDecideUnanimousProposalOnFastPath(t *testing.T) {
+	abachans, nodes := makeAbaChannels(t, 4, 1, MMR())
+	for _, abachan := range abachans {
+		abachan.EnableFastPath()
+	}
+	decisions := testAbaChannelsShouldDecide(t, abachans, nodes, func(int) byte { return 1 })
+	assert.Equal(t, byte(1), decisions[0])
+	coins, err := abachans[0].CoinState()
+	assert.NoError(t, err)
+	assert.Empty(t, coins.Live)
+	assert.Empty(t, coins.Finished)
+}
+
+func TestAbaChannelShouldFallBackFromFastPath(t *testing.T) {
+	for _, algorithm := range []Algorithm{MMR(), InternalValidityMMR()} {
+		abachans, nodes := makeAbaChannels(t, 4, 1, algorithm)
+		for _, abachan := range abachans {
+			abachan.EnableFastPath()
+		}
+		testAbaChannelsShouldDecide(t, abachans, nodes, func(i int) byte { return byte(i % 2) })
+		abachans, nodes = makeAbaChannels(t, 4, 1, algorithm)
+		for _, abachan := range abachans {
+			abachan.EnableFastPath()
+		}
+		decisions := testAbaChannelsShouldDecide(t, abachans, nodes, func(int) byte { return 0 })
+		assert.Equal(t, byte(0), decisions[0])
+	}
+}
+
+func TestAbaChannelSiblingsShouldShareCoins(t *testing.T) {
+	abachans, nodes := makeAbaChannels(t, 4, 1, MMR())
+	for _, abachan := range abachans {
+		abachan.EnableSharedCoins()
+	}
+	parent := uuid.New()
+	ids := lo.Times(4, func(i int) uuid.UUID { return utils.DeriveInstanceId(parent, []byte{byte(i)}) })
+	instances := lo.Map(abachans, func(abachan *AbaChannel, _ int) []*AbaInstance {
+		return lo.Map(ids, func(id uuid.UUID, _ int) *AbaInstance { return abachan.NewSiblingAbaInstance(id, parent) })
+	})
+	for i, siblings := range instances {
+		for _, instance := range siblings {
+			assert.NoError(t, instance.Propose(byte(i%2)))
+		}
+	}
+	for j := range ids {
+		decisions := lo.Map(instances, func(siblings []*AbaInstance, _ int) byte { return siblings[j].GetOutput() })
+		assert.True(t, lo.EveryBy(decisions, func(decision byte) bool { return decision == decisions[0] }))
+	}
+	rounds := lo.Map(abachans[0].State().Live, func(s AbaInstanceState, _ int) uint16 { return s.Round })
+	coins, err := abachans[0].CoinState()
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, len(coins.Live)+len(coins.Finished), int(lo.Max(rounds))+1)
+	assert.Nil(t, abachans[0].NewSiblingAbaInstance(ids[0], uuid.New()))
+	for _, abachan := range abachans {
+		abachan.Close()
+	}
+	assert.True(t, lo.EveryBy(nodes, func(node *on.Node) bool { return node.Close() == nil }))
+}
+
+func TestAbaChannelShouldCertifyDecisions(t *testing.T) {
+	abachans, nodes := makeAbaChannels(t, 4, 1, MMR())
+	certChans := lo.Map(nodes, func(node *on.Node, _ int) *dc.CertificateChannel {
+		certs, err := dc.NewCertificateChannel(4, 1, node, on.NewBEBChannel(node, 'x'), node.Logger())
+		assert.NoError(t, err)
+		return certs
+	})
+	for i, abachan := range abachans {
+		abachan.EnableCertificates(certChans[i])
+	}
+	participants := lo.Map(nodes, func(node *on.Node, _ int) uuid.UUID {
+		id, err := node.GetId()
+		assert.NoError(t, err)
+		return id
+	})
+	id := uuid.New()
+	instances := lo.Map(abachans, func(abachan *AbaChannel, _ int) *AbaInstance { return abachan.NewAbaInstance(id) })
+	for i, instance := range instances {
+		assert.NoError(t, instance.Propose(byte(i%2)))
+	}
+	for _, instance := range instances {
+		decision := instance.GetOutput()
+		cert, err := instance.GetCertificate()
+		assert.NoError(t, err)
+		assert.NoError(t, VerifyDecision(cert, id, decision, participants, 4, 1))
+		assert.Error(t, VerifyDecision(cert, id, 1-decision, participants, 4, 1))
+		assert.Error(t, VerifyDecision(cert, uuid.New(), decision, participants, 4, 1))
+	}
+	for i, abachan := range abachans {
+		abachan.Close()
+		certChans[i].Close()
+	}
+	assert.True(t, lo.EveryBy(nodes, func(node *on.Node) bool { return node.Close() == nil }))
+}
+
 func testAbaChannelShouldDecideMultiple(t *testing.T, n, f uint) {
+	abachans, nodes := makeAbaChannels(t, n, f, MMR())
+	testAbaChannelsShouldDecide(t, abachans, nodes, func(int) byte { return byte(rand.IntN(2)) })
+}
+
+func makeAbaChannels(t *testing.T, n, f uint, algorithm Algorithm) ([]*AbaChannel, []*on.Node) {
 	nodes := lo.Map(lo.Range(int(n)), func(i int, _ int) *on.Node {
 		address := fmt.Sprintf("localhost:%d", 6000+i)
 		return on.GetTestNode(t, address, "localhost:6000")
@@ -37,14 +197,36 @@ func testAbaChannelShouldDecideMultiple(t *testing.T, n, f uint) {
 	on.InitializeNodes(t, nodes)
 	assert.NoError(t, ct.DealSecret(dealSSs[0], ct.NewScalar(42), 2*f))
 	abachans := lo.ZipBy4(dealSSs, ctBebs, mBebs, tBebs, func(dealSS *on.SSChannel, ctBeb, mBeb, tBeb *on.BEBChannel) *AbaChannel {
-		abachan, err := NewAbaChannel(n, f, dealSS, ctBeb, mBeb, tBeb)
+		abachan, err := NewAbaChannel(n, f, dealSS, ctBeb, mBeb, tBeb, dealSS.Logger())
+		assert.NoError(t, err)
+		assert.NoError(t, abachan.SetAlgorithm(algorithm))
+		return abachan
+	})
+	return abachans, nodes
+}
+
+func makeAbaChannelsWithCoin(t *testing.T, n, f uint, algorithm Algorithm, newCoin func(int, *on.BEBChannel) ct.Coin) ([]*AbaChannel, []*on.Node) {
+	nodes := lo.Map(lo.Range(int(n)), func(i int, _ int) *on.Node {
+		address := fmt.Sprintf("localhost:%d", 6000+i)
+		return on.GetTestNode(t, address, "localhost:6000")
+	})
+	ctBebs := lo.Map(nodes, func(node *on.Node, _ int) *on.BEBChannel { return on.NewBEBChannel(node, 'c') })
+	mBebs := lo.Map(nodes, func(node *on.Node, _ int) *on.BEBChannel { return on.NewBEBChannel(node, 'm') })
+	tBebs := lo.Map(nodes, func(node *on.Node, _ int) *on.BEBChannel { return on.NewBEBChannel(node, 't') })
+	on.InitializeNodes(t, nodes)
+	abachans := lo.Map(nodes, func(node *on.Node, i int) *AbaChannel {
+		abachan, err := NewAbaChannelWithCoin(n, f, newCoin(i, ctBebs[i]), algorithm, mBebs[i], tBebs[i], node.Logger())
 		assert.NoError(t, err)
 		return abachan
 	})
+	return abachans, nodes
+}
+
+func testAbaChannelsShouldDecide(t *testing.T, abachans []*AbaChannel, nodes []*on.Node, proposal func(int) byte) []byte {
 	id := uuid.New()
 	abaInstances := lo.Map(abachans, func(abachan *AbaChannel, _ int) *AbaInstance { return abachan.NewAbaInstance(id) })
-	for _, instance := range abaInstances {
-		assert.NoError(t, instance.Propose(byte(rand.IntN(2))))
+	for i, instance := range abaInstances {
+		assert.NoError(t, instance.Propose(proposal(i)))
 	}
 	decisions := lo.Map(abaInstances, func(instance *AbaInstance, _ int) byte { return instance.GetOutput() })
 	firstDecision := decisions[0]
@@ -53,4 +235,5 @@ func testAbaChannelShouldDecideMultiple(t *testing.T, n, f uint) {
 		abachan.Close()
 	}
 	assert.True(t, lo.EveryBy(nodes, func(node *on.Node) bool { return node.Close() == nil }))
+	return decisions
 }
@@ -12,38 +12,79 @@ import (
 	"log/slog"
 )
 
-var abaMiddlewareLogger = utils.GetLogger("ABA Middleware", slog.LevelWarn)
-
-type middlewareCode byte
+// MsgKind is the kind of a message exchanged by the instances of an algorithm.
+type MsgKind byte
 
 const (
-	echo middlewareCode = 'a' + iota
+	echo MsgKind = 'a' + iota
 	vote
 	bind
 )
 
+// Echo, Vote and Bind are the kinds of message the middleware carries. Algorithms other than MMR give them their own meaning.
+const (
+	Echo = echo
+	Vote = vote
+	Bind = bind
+)
+
+func (c MsgKind) String() string {
+	switch c {
+	case echo:
+		return "echo"
+	case vote:
+		return "vote"
+	case bind:
+		return "bind"
+	default:
+		return fmt.Sprintf("unknown(%d)", byte(c))
+	}
+}
+
 type abaMsg struct {
 	sender   uuid.UUID
 	instance uuid.UUID
-	kind     middlewareCode
+	kind     MsgKind
 	round    uint16
 	val      byte
 }
 
+func (m *abaMsg) fields() map[string]string {
+	return map[string]string{
+		"instance": m.instance.String(),
+		"kind":     m.kind.String(),
+		"round":    fmt.Sprint(m.round),
+		"val":      fmt.Sprint(m.val),
+	}
+}
+
+// maxBatch is the largest number of messages sent in a single frame.
+const maxBatch = 1024
+
+// abaMiddleware sends the messages of every instance of a channel and receives those of the peers.
+// Messages queued while a frame is being sent are gathered into the next frame, so the instances of an ACS, which move
+// through their rounds together, share frames instead of sending one each.
 type abaMiddleware struct {
-	beb       *on.BEBChannel
-	output    chan *abaMsg
-	closeChan chan struct{}
+	beb        *on.BEBChannel
+	output     chan *abaMsg
+	queue      chan *abaMsg
+	closeChan  chan struct{}
+	senderStop chan struct{}
+	logger     *slog.Logger
 }
 
-func newABAMiddleware(beb *on.BEBChannel) *abaMiddleware {
+func newABAMiddleware(beb *on.BEBChannel, logger *slog.Logger) *abaMiddleware {
 	m := &abaMiddleware{
-		beb:       beb,
-		output:    make(chan *abaMsg),
-		closeChan: make(chan struct{}),
+		beb:        beb,
+		output:     make(chan *abaMsg),
+		queue:      make(chan *abaMsg, maxBatch),
+		closeChan:  make(chan struct{}),
+		senderStop: make(chan struct{}),
+		logger:     utils.ComponentLogger(logger, "ABA Middleware", slog.LevelWarn),
 	}
 	go m.bebDeliver()
-	abaMiddlewareLogger.Info("new abaMiddleware created")
+	go m.sender()
+	m.logger.Info("new abaMiddleware created")
 	return m
 }
 
@@ -53,29 +94,56 @@ func (m *abaMiddleware) bebDeliver() {
 		case bebMsg := <-m.beb.GetBEBChan():
 			m.processMsg(bebMsg)
 		case <-m.closeChan:
-			abaChannelLogger.Info("closing listener")
+			m.logger.Info("closing listener")
 			return
 		}
 	}
 }
 
 func (m *abaMiddleware) processMsg(bebMsg on.BEBMsg) {
-	if amsg, err := m.parseMsg(bebMsg.Content, bebMsg.Sender); err != nil {
-		abaMiddlewareLogger.Warn("unable to processMsg message during beb delivery", "error", err)
+	if batch, err := m.parseBatch(bebMsg.Content, bebMsg.Sender); err != nil {
+		m.logger.Warn("unable to processMsg message during beb delivery", "error", err)
 	} else {
-		abaMiddlewareLogger.Debug("received message", "sender", amsg.sender, "type", amsg.kind, "instance", amsg.instance, "val", amsg.val)
-		go func() { m.output <- amsg }()
+		for _, amsg := range batch {
+			m.logger.Debug("received message", "sender", amsg.sender, "type", amsg.kind, "instance", amsg.instance, "val", amsg.val)
+			go func() { m.output <- amsg }()
+		}
 	}
 }
 
-func (m *abaMiddleware) parseMsg(msg []byte, sender *ecdsa.PublicKey) (*abaMsg, error) {
-	tm := &abaMsg{}
+// parseBatch splits a frame into its messages. A frame with a malformed message is dropped as a whole.
+func (m *abaMiddleware) parseBatch(frame []byte, sender *ecdsa.PublicKey) ([]*abaMsg, error) {
 	senderId, err := utils.PkToUUID(sender)
 	if err != nil {
 		return nil, fmt.Errorf("unable to convert sender public key to uuid: %v", err)
 	}
-	tm.sender = senderId
-	reader := bytes.NewReader(msg)
+	reader := bytes.NewReader(frame)
+	var count uint16
+	if err := binary.Read(reader, binary.LittleEndian, &count); err != nil {
+		return nil, fmt.Errorf("unable to read batch size: %v", err)
+	} else if count == 0 || count > maxBatch {
+		return nil, fmt.Errorf("invalid batch size %d", count)
+	}
+	batch := make([]*abaMsg, 0, count)
+	for i := 0; i < int(count); i++ {
+		amsg, err := parseMsg(reader)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse message %d of batch: %v", i, err)
+		}
+		amsg.sender = senderId
+		batch = append(batch, amsg)
+	}
+	if reader.Len() > 0 {
+		return nil, fmt.Errorf("%d trailing bytes after batch", reader.Len())
+	}
+	for _, amsg := range batch {
+		m.beb.Transcript().RecordInbound("aba", senderId, amsg.fields())
+	}
+	return batch, nil
+}
+
+func parseMsg(reader *bytes.Reader) (*abaMsg, error) {
+	tm := &abaMsg{}
 	if id, err := utils.ExtractIdFromMessage(reader); err != nil {
 		return nil, fmt.Errorf("unable to extract inner id from message: %v", err)
 	} else {
@@ -84,7 +152,7 @@ func (m *abaMiddleware) parseMsg(msg []byte, sender *ecdsa.PublicKey) (*abaMsg,
 	if kindByte, err := reader.ReadByte(); err != nil {
 		return nil, fmt.Errorf("unable to read kind from message: %v", err)
 	} else {
-		tm.kind = middlewareCode(kindByte)
+		tm.kind = MsgKind(kindByte)
 	}
 	if err := binary.Read(reader, binary.LittleEndian, &tm.round); err != nil {
 		return nil, fmt.Errorf("unable to read round from message: %v", err)
@@ -106,29 +174,81 @@ func (m *abaMiddleware) broadcastBind(instance uuid.UUID, round uint16, val byte
 	return m.broadcastMsg(instance, bind, round, val)
 }
 
-func (m *abaMiddleware) broadcastMsg(instance uuid.UUID, kind middlewareCode, round uint16, val byte) error {
-	abaMiddlewareLogger.Debug("broadcasting message", "instance", instance, "kind", kind, "round", round, "val", val)
+// broadcastMsg queues a message for the next frame. Errors sending the frame are logged by the sender.
+func (m *abaMiddleware) broadcastMsg(instance uuid.UUID, kind MsgKind, round uint16, val byte) error {
+	m.logger.Debug("broadcasting message", "instance", instance, "kind", kind, "round", round, "val", val)
+	amsg := &abaMsg{instance: instance, kind: kind, round: round, val: val}
+	m.beb.Transcript().RecordOutbound("aba", amsg.fields())
+	m.queue <- amsg
+	return nil
+}
+
+// sender broadcasts a frame with the queued messages whenever there are any, gathering those queued during the previous send.
+func (m *abaMiddleware) sender() {
+	for {
+		select {
+		case amsg := <-m.queue:
+			batch := m.gather(amsg)
+			m.logger.Debug("broadcasting batch", "size", len(batch))
+			if err := m.broadcastBatch(batch); err != nil {
+				m.logger.Warn("unable to broadcast batch", "size", len(batch), "error", err)
+			}
+		case <-m.senderStop:
+			m.logger.Info("closing sender")
+			return
+		}
+	}
+}
+
+func (m *abaMiddleware) gather(first *abaMsg) []*abaMsg {
+	batch := []*abaMsg{first}
+	for len(batch) < maxBatch {
+		select {
+		case amsg := <-m.queue:
+			batch = append(batch, amsg)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+func (m *abaMiddleware) broadcastBatch(batch []*abaMsg) error {
 	buf := bytes.NewBuffer([]byte{})
 	writer := bufio.NewWriter(buf)
-	if instanceBytes, err := instance.MarshalBinary(); err != nil {
+	if err := binary.Write(writer, binary.LittleEndian, uint16(len(batch))); err != nil {
+		return fmt.Errorf("unable to write batch size to buffer: %v", err)
+	}
+	for _, amsg := range batch {
+		if err := writeMsg(writer, amsg); err != nil {
+			return fmt.Errorf("unable to write message of instance %s: %v", amsg.instance, err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("unable to flush writer: %v", err)
+	} else if err := m.beb.BEBroadcast(buf.Bytes()); err != nil {
+		return fmt.Errorf("unable to broadcast message: %v", err)
+	}
+	return nil
+}
+
+func writeMsg(writer *bufio.Writer, amsg *abaMsg) error {
+	if instanceBytes, err := amsg.instance.MarshalBinary(); err != nil {
 		return fmt.Errorf("unable to marshal inner id: %v", err)
 	} else if n, err := writer.Write(instanceBytes); err != nil || n != len(instanceBytes) {
 		return fmt.Errorf("unable to write inner id to buffer: %v", err)
-	} else if err := writer.WriteByte(byte(kind)); err != nil {
+	} else if err := writer.WriteByte(byte(amsg.kind)); err != nil {
 		return fmt.Errorf("unable to write kind to buffer: %v", err)
-	} else if err := binary.Write(writer, binary.LittleEndian, round); err != nil {
+	} else if err := binary.Write(writer, binary.LittleEndian, amsg.round); err != nil {
 		return fmt.Errorf("unable to write round to buffer: %v", err)
-	} else if err := writer.WriteByte(val); err != nil {
+	} else if err := writer.WriteByte(amsg.val); err != nil {
 		return fmt.Errorf("unable to write val to buffer: %v", err)
-	} else if err := writer.Flush(); err != nil {
-		return fmt.Errorf("unable to flush writer: %v", err)
-	} else if err := m.beb.BEBroadcast(buf.Bytes()); err != nil {
-		return fmt.Errorf("unable to broadcast message: %v", err)
 	}
 	return nil
 }
 
 func (m *abaMiddleware) close() {
-	abaMiddlewareLogger.Info("sending close signal to listener")
+	m.logger.Info("sending close signal to listener and sender")
 	m.closeChan <- struct{}{}
+	m.senderStop <- struct{}{}
 }
@@ -2,7 +2,9 @@ package asynchronousBinaryAgreement
 
 import (
 	on "bkr-acs/overlayNetwork"
+	"bkr-acs/utils"
 	"github.com/google/uuid"
+	"github.com/samber/lo"
 	"github.com/stretchr/testify/assert"
 	"testing"
 )
@@ -14,7 +16,7 @@ func TestShouldMarshalAndUnmarshalBval(t *testing.T) {
 	node := on.GetTestNode(t, "localhost:6000", "localhost:6000")
 	bebChannel := on.NewBEBChannel(node, 'a')
 	on.InitializeNodes(t, []*on.Node{node})
-	m := newABAMiddleware(bebChannel)
+	m := newABAMiddleware(bebChannel, utils.DefaultLogger())
 	assert.NoError(t, m.broadcastEcho(abaInstance, round, val))
 	amsg := <-m.output
 	assert.Equal(t, echo, amsg.kind)
@@ -33,7 +35,7 @@ func TestShouldMarshalAndUnmarshalAux(t *testing.T) {
 	node := on.GetTestNode(t, "localhost:6000", "localhost:6000")
 	bebChannel := on.NewBEBChannel(node, 'a')
 	on.InitializeNodes(t, []*on.Node{node})
-	m := newABAMiddleware(bebChannel)
+	m := newABAMiddleware(bebChannel, utils.DefaultLogger())
 	assert.NoError(t, m.broadcastVote(abaInstance, round, val))
 	amsg := <-m.output
 	assert.Equal(t, vote, amsg.kind)
@@ -44,3 +46,41 @@ func TestShouldMarshalAndUnmarshalAux(t *testing.T) {
 	m.close()
 	assert.NoError(t, node.Close())
 }
+
+func TestShouldDeliverEveryMessageOfBatches(t *testing.T) {
+	node := on.GetTestNode(t, "localhost:6000", "localhost:6000")
+	bebChannel := on.NewBEBChannel(node, 'a')
+	on.InitializeNodes(t, []*on.Node{node})
+	m := newABAMiddleware(bebChannel, utils.DefaultLogger())
+	instances := lo.Times(50, func(_ int) uuid.UUID { return uuid.New() })
+	for _, instance := range instances {
+		assert.NoError(t, m.broadcastEcho(instance, 0, 1))
+		assert.NoError(t, m.broadcastVote(instance, 0, 1))
+	}
+	received := lo.Times(2*len(instances), func(_ int) *abaMsg { return <-m.output })
+	for _, instance := range instances {
+		kinds := lo.FilterMap(received, func(amsg *abaMsg, _ int) (MsgKind, bool) { return amsg.kind, amsg.instance == instance })
+		assert.ElementsMatch(t, []MsgKind{echo, vote}, kinds)
+	}
+	m.close()
+	assert.NoError(t, node.Close())
+}
+
+func TestShouldRejectMalformedBatches(t *testing.T) {
+	node := on.GetTestNode(t, "localhost:6000", "localhost:6000")
+	bebChannel := on.NewBEBChannel(node, 'a')
+	m := newABAMiddleware(bebChannel, utils.DefaultLogger())
+	id := uuid.New()
+	msg := append(id[:], byte(echo), 0, 0, 1)
+	_, err := m.parseBatch([]byte{0, 0}, bebChannel.PublicKey())
+	assert.Error(t, err)
+	_, err = m.parseBatch(append([]byte{2, 0}, msg...), bebChannel.PublicKey())
+	assert.Error(t, err)
+	_, err = m.parseBatch(append(append([]byte{1, 0}, msg...), 0), bebChannel.PublicKey())
+	assert.Error(t, err)
+	batch, err := m.parseBatch(append([]byte{1, 0}, msg...), bebChannel.PublicKey())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(batch))
+	m.close()
+	assert.NoError(t, node.Close())
+}
@@ -1,120 +1,126 @@
 package asynchronousBinaryAgreement
 
 import (
-	ct "bkr-acs/coinTosser"
 	"bkr-acs/utils"
-	"bytes"
-	"encoding/binary"
 	"fmt"
 	"github.com/google/uuid"
 	"log/slog"
-	"unsafe"
 )
 
-var abaNetworkedLogger = utils.GetLogger("ABA Networked Instance", slog.LevelWarn)
-
 type abaNetworkedInstance struct {
-	id uuid.UUID
+	*Network
 	concurrentMMR
 	decisionChan   chan byte
 	terminatedChan chan struct{}
 	hasDelivered   bool
-	abamidware     *abaMiddleware
-	termidware     *terminationMiddleware
-	ctChan         *ct.CTChannel
 	listenerClose  chan struct{}
+	logger         *slog.Logger
 }
 
-func newAbaNetworkedInstance(id uuid.UUID, n, f uint, abamidware *abaMiddleware, termidware *terminationMiddleware, ctChan *ct.CTChannel) abaNetworkedInstance {
-	a := abaNetworkedInstance{
-		id:             id,
-		concurrentMMR:  newConcurrentMMR(n, f),
+func newAbaNetworkedInstance(net *Network, opts mmrOptions) *abaNetworkedInstance {
+	a := &abaNetworkedInstance{
+		Network:        net,
+		concurrentMMR:  newConcurrentMMR(net.N, net.F, opts, net.Logger),
 		decisionChan:   make(chan byte, 1),
 		terminatedChan: make(chan struct{}, 1),
 		hasDelivered:   false,
-		abamidware:     abamidware,
-		termidware:     termidware,
-		ctChan:         ctChan,
 		listenerClose:  make(chan struct{}),
+		logger:         utils.ComponentLogger(net.Logger, "ABA Networked Instance", slog.LevelWarn),
 	}
 	go a.listener()
 	return a
 }
 
 func (a *abaNetworkedInstance) listener() {
-	abaNetworkedLogger.Info("starting listener aba networked inner", "instance", a.id)
+	a.logger.Info("starting listener aba networked inner", "instance", a.Id)
 	for {
 		select {
 		case echo := <-a.deliverEcho:
-			if err := a.abamidware.broadcastEcho(a.id, echo.r, echo.val); err != nil {
-				abaNetworkedLogger.Warn("unable to broadcast echo", "instance", a.id, "round", echo.r, "error", err)
+			if err := a.abamidware.broadcastEcho(a.Id, echo.r, echo.val); err != nil {
+				a.logger.Warn("unable to broadcast echo", "instance", a.Id, "round", echo.r, "error", err)
 			}
 		case vote := <-a.deliverVote:
-			if err := a.abamidware.broadcastVote(a.id, vote.r, vote.val); err != nil {
-				abaNetworkedLogger.Warn("unable to broadcast vote", "instance", a.id, "round", vote.r, "error", err)
+			if err := a.abamidware.broadcastVote(a.Id, vote.r, vote.val); err != nil {
+				a.logger.Warn("unable to broadcast vote", "instance", a.Id, "round", vote.r, "error", err)
 			}
 		case bind := <-a.deliverBind:
-			if err := a.abamidware.broadcastBind(a.id, bind.r, bind.val); err != nil {
-				abaNetworkedLogger.Warn("unable to broadcast bind", "instance", a.id, "round", bind.r, "error", err)
+			if err := a.abamidware.broadcastBind(a.Id, bind.r, bind.val); err != nil {
+				a.logger.Warn("unable to broadcast bind", "instance", a.Id, "round", bind.r, "error", err)
 			}
 		case decision := <-a.deliverDecision:
-			abaNetworkedLogger.Info("outputting decision", "instance", a.id, "decision", decision)
+			a.logger.Info("outputting decision", "instance", a.Id, "decision", decision)
 			a.outputDecision(decision)
 		case coinReq := <-a.coinReq:
+			if a.fastPath && coinReq == firstRound {
+				go func() {
+					if err := a.submitCoin(fastPathValue, coinReq); err != nil {
+						a.logger.Warn("unable to submit fixed coin", "instance", a.Id, "round", coinReq, "error", err)
+					}
+				}()
+				continue
+			}
 			go func() {
-				coin, err := a.getCoin(coinReq)
+				a.logger.Debug("requesting coin", "instance", a.Id, "round", coinReq)
+				coin, err := a.TossCoin(coinReq)
 				if err != nil {
-					abaNetworkedLogger.Warn("unable to get coin", "instance", a.id, "round", coinReq, "error", err)
+					a.logger.Warn("unable to get coin", "instance", a.Id, "round", coinReq, "error", err)
 				} else if err := a.submitCoin(coin, coinReq); err != nil {
-					abaNetworkedLogger.Warn("unable to submit coin", "instance", a.id, "round", coinReq, "error", err)
+					a.logger.Warn("unable to submit coin", "instance", a.Id, "round", coinReq, "error", err)
 				}
 			}()
 		case <-a.listenerClose:
-			abaNetworkedLogger.Info("closing listener", "instance", a.id)
+			a.logger.Info("closing listener", "instance", a.Id)
 			return
 		}
 	}
 }
 
-func (a *abaNetworkedInstance) getCoin(round uint16) (byte, error) {
-	coinReqSeed, err := a.makeCoinSeed(round)
-	if err != nil {
-		return bot, fmt.Errorf("unable to make coin seed: %w", err)
-	}
-	coinReceiver := make(chan bool)
-	abaNetworkedLogger.Debug("requesting coin", "instance", a.id, "round", round)
-	a.ctChan.TossCoin(coinReqSeed, coinReceiver)
-	coin := <-coinReceiver
-	if coin {
-		return 1, nil
-	} else {
-		return 0, nil
+func (a *abaNetworkedInstance) outputDecision(decision byte) {
+	a.decisionChan <- decision
+	if err := a.BroadcastDecision(decision); err != nil {
+		a.logger.Warn("unable to broadcast decision", "instance", a.Id, "decision", decision, "error", err)
 	}
 }
 
-func (a *abaNetworkedInstance) makeCoinSeed(round uint16) ([]byte, error) {
-	idBytes, err := a.id.MarshalBinary()
-	if err != nil {
-		return nil, fmt.Errorf("unable to marshal inner id: %w", err)
-	}
-	writer := bytes.NewBuffer(make([]byte, 0, int(unsafe.Sizeof(round))+len(idBytes)))
-	if n, err := writer.Write(idBytes); err != nil || n != len(idBytes) {
-		return nil, fmt.Errorf("unable to write inner id to coin seed: %w", err)
-	} else if err := binary.Write(writer, binary.LittleEndian, round); err != nil {
-		return nil, fmt.Errorf("unable to write round to coin seed: %w", err)
-	}
-	return writer.Bytes(), nil
+func (a *abaNetworkedInstance) Propose(est byte) error {
+	return a.propose(est)
 }
 
-func (a *abaNetworkedInstance) outputDecision(decision byte) {
-	a.decisionChan <- decision
-	if err := a.termidware.broadcastDecision(a.id, decision); err != nil {
-		abaNetworkedLogger.Warn("unable to broadcast decision", "instance", a.id, "decision", decision, "error", err)
+func (a *abaNetworkedInstance) Submit(msg Message) error {
+	switch msg.Kind {
+	case echo:
+		return a.submitEcho(msg.Val, msg.Sender, msg.Round)
+	case vote:
+		return a.submitVote(msg.Val, msg.Sender, msg.Round)
+	case bind:
+		return a.submitBind(msg.Val, msg.Sender, msg.Round)
+	default:
+		return fmt.Errorf("unknown message kind %s", msg.Kind)
 	}
 }
 
+func (a *abaNetworkedInstance) SubmitDecision(decision byte, sender uuid.UUID) error {
+	return a.submitDecision(decision, sender)
+}
+
+func (a *abaNetworkedInstance) Decision() <-chan byte {
+	return a.decisionChan
+}
+
+func (a *abaNetworkedInstance) Terminated() <-chan struct{} {
+	return a.terminatedChan
+}
+
+func (a *abaNetworkedInstance) State() (uint16, bool) {
+	return a.state()
+}
+
+func (a *abaNetworkedInstance) Close() {
+	a.close()
+}
+
 func (a *abaNetworkedInstance) close() {
 	a.concurrentMMR.close()
-	abaNetworkedLogger.Debug("signaling close listener", "instance", a.id)
+	a.logger.Debug("signaling close listener", "instance", a.Id)
 	a.listenerClose <- struct{}{}
 }
@@ -87,12 +87,11 @@ func testNetworkedInstancesShouldDecide(t *testing.T, n, f uint) {
 
 func makeAbaNetworkedInstance(t *testing.T, id uuid.UUID, node *on.Node, ssChan *on.SSChannel, n uint, f uint) *abaNetworkedInstance {
 	ctBebChan := on.NewBEBChannel(node, 'b')
-	ctChan, err := ct.NewCoinTosserChannel(ssChan, ctBebChan, f)
+	ctChan, err := ct.NewCoinTosserChannel(ssChan, ctBebChan, f, node.Logger())
 	assert.NoError(t, err)
 	abaBebChan := on.NewBEBChannel(node, 'c')
-	abamidware := newABAMiddleware(abaBebChan)
+	abamidware := newABAMiddleware(abaBebChan, node.Logger())
 	termBebChan := on.NewBEBChannel(node, 'd')
-	termidware := newTerminationMiddleware(termBebChan)
-	abaInstance := newAbaNetworkedInstance(id, n, f, abamidware, termidware, ctChan)
-	return &abaInstance
+	termidware := newTerminationMiddleware(termBebChan, node.Logger())
+	return newAbaNetworkedInstance(newNetwork(id, n, f, abamidware, termidware, ctChan, node.Logger()), mmrOptions{})
 }
@@ -0,0 +1,186 @@
+package asynchronousBinaryAgreement
+
+import (
+	ct "bkr-acs/coinTosser"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/google/uuid"
+	"log/slog"
+	"unsafe"
+)
+
+// Algorithm is an asynchronous binary agreement protocol run by the instances of a channel.
+// Every node of a channel must run the same algorithm.
+type Algorithm interface {
+	// Check fails if the algorithm does not tolerate f Byzantine nodes among n, or cannot run with the coin.
+	Check(n, f uint, coin ct.Coin) error
+	// Start runs a new instance of the algorithm, which reaches its peers through net.
+	Start(net *Network) Process
+}
+
+// Process is an instance of an algorithm running in this node.
+type Process interface {
+	// Propose inputs the estimate of this node.
+	Propose(est byte) error
+	// Submit hands over a message that a peer sent to this instance.
+	Submit(msg Message) error
+	// SubmitDecision hands over the decision that a peer announced for this instance.
+	SubmitDecision(decision byte, sender uuid.UUID) error
+	// Decision delivers the decision of the instance.
+	Decision() <-chan byte
+	// Terminated is signaled once the instance is no longer needed by its peers and can be closed.
+	Terminated() <-chan struct{}
+	// State returns the latest round of the instance and whether it decided.
+	State() (uint16, bool)
+	Close()
+}
+
+// Message is a message that an instance received from a peer.
+type Message struct {
+	Kind   MsgKind
+	Round  uint16
+	Val    byte
+	Sender uuid.UUID
+}
+
+// Network connects an instance to the instances with the same id in the other nodes of the channel.
+type Network struct {
+	Id         uuid.UUID
+	N          uint
+	F          uint
+	Logger     *slog.Logger
+	abamidware *abaMiddleware
+	termidware *terminationMiddleware
+	coin       ct.Coin
+	coins      *coinCache
+	coinGroup  uuid.UUID
+	coinReady  chan struct{}
+	joined     bool
+	collected  <-chan struct{}
+	fastPath   bool
+}
+
+func newNetwork(id uuid.UUID, n, f uint, abamidware *abaMiddleware, termidware *terminationMiddleware, coin ct.Coin, logger *slog.Logger) *Network {
+	coinReady := make(chan struct{})
+	close(coinReady)
+	return &Network{Id: id, N: n, F: f, Logger: logger, abamidware: abamidware, termidware: termidware, coin: coin, coinGroup: id, coinReady: coinReady}
+}
+
+// awaitCoinGroup makes the instance wait for joinCoinGroup before tossing coins, for instances created by the messages of peers
+// in a channel with shared coins, which do not know their siblings yet.
+func (net *Network) awaitCoinGroup(coins *coinCache, collected <-chan struct{}) {
+	net.coins, net.coinReady, net.collected = coins, make(chan struct{}), collected
+}
+
+// joinCoinGroup sets the group whose coins the instance tosses. It fails if the instance already joined a different group.
+func (net *Network) joinCoinGroup(group uuid.UUID) error {
+	if net.joined && net.coinGroup != group {
+		return fmt.Errorf("instance already shares the coins of %s", net.coinGroup)
+	} else if !net.joined && net.coins != nil {
+		net.coinGroup, net.joined = group, true
+		close(net.coinReady)
+	}
+	return nil
+}
+
+// FastPath tells whether the channel enabled the unanimity fast path. Algorithms without a fast path ignore it.
+func (net *Network) FastPath() bool {
+	return net.fastPath
+}
+
+// Broadcast sends a message of the instance to every node, including this one.
+func (net *Network) Broadcast(kind MsgKind, round uint16, val byte) error {
+	return net.abamidware.broadcastMsg(net.Id, kind, round, val)
+}
+
+// BroadcastDecision announces the decision of this node, so that peers can decide and terminate without running further rounds.
+func (net *Network) BroadcastDecision(decision byte) error {
+	return net.termidware.broadcastDecision(net.Id, decision)
+}
+
+// TossCoin returns the coin of a round of the instance, which is the same at every correct node if the coin of the channel is common.
+// Sibling instances sharing coins get the same coin in each round.
+func (net *Network) TossCoin(round uint16) (byte, error) {
+	select {
+	case <-net.coinReady:
+	case <-net.collected:
+		return bot, fmt.Errorf("instance collected before joining a coin group")
+	}
+	seed, err := makeCoinSeed(net.coinGroup, round)
+	if err != nil {
+		return bot, fmt.Errorf("unable to make coin seed: %w", err)
+	} else if net.coinGroup != net.Id {
+		return net.coins.toss(net.coinGroup, round, seed), nil
+	}
+	coinReceiver := make(chan bool)
+	net.coin.TossCoin(seed, coinReceiver)
+	if <-coinReceiver {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func makeCoinSeed(group uuid.UUID, round uint16) ([]byte, error) {
+	idBytes, err := group.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal inner id: %w", err)
+	}
+	writer := bytes.NewBuffer(make([]byte, 0, int(unsafe.Sizeof(round))+len(idBytes)))
+	if n, err := writer.Write(idBytes); err != nil || n != len(idBytes) {
+		return nil, fmt.Errorf("unable to write inner id to coin seed: %w", err)
+	} else if err := binary.Write(writer, binary.LittleEndian, round); err != nil {
+		return nil, fmt.Errorf("unable to write round to coin seed: %w", err)
+	}
+	return writer.Bytes(), nil
+}
+
+type mmrAlgorithm struct {
+	validity bcaValidity
+}
+
+// MMR is the default algorithm: the rounds of Mostéfaoui, Moumen and Raynal reduced to binding crusader agreement and
+// a common coin, where the rounds after the first reuse the values that were externally valid in the previous one.
+func MMR() Algorithm {
+	return mmrAlgorithm{validity: externalValidity}
+}
+
+// InternalValidityMMR runs a full binding crusader agreement with internal validity in every round, instead of the one
+// with external validity of MMR. It takes one more communication step than MMR in the rounds after the first, but no
+// round depends on the coin of the previous one.
+func InternalValidityMMR() Algorithm {
+	return mmrAlgorithm{validity: internalValidity}
+}
+
+func (a mmrAlgorithm) Check(n, f uint, coin ct.Coin) error {
+	if n <= 3*f {
+		return fmt.Errorf("%d nodes cannot tolerate %d faults, at least %d are required", n, f, 3*f+1)
+	} else if !coin.Common() {
+		return fmt.Errorf("the rounds of the algorithm only agree with a common coin")
+	}
+	return nil
+}
+
+func (a mmrAlgorithm) Start(net *Network) Process {
+	return newAbaNetworkedInstance(net, mmrOptions{validity: a.validity, fastPath: net.FastPath()})
+}
+
+type benOrAlgorithm struct{}
+
+// BenOr is the agreement of Ben-Or, which only tolerates f < n/5 faults. With the local coin of ct.NewLocalCoin it needs
+// no setup, but the expected number of rounds grows exponentially with n when the proposals are split; with a common
+// coin it is the agreement of Rabin, which takes a constant expected number of rounds.
+func BenOr() Algorithm {
+	return benOrAlgorithm{}
+}
+
+func (a benOrAlgorithm) Check(n, f uint, _ ct.Coin) error {
+	if n <= 5*f {
+		return fmt.Errorf("%d nodes cannot tolerate %d faults, at least %d are required", n, f, 5*f+1)
+	}
+	return nil
+}
+
+func (a benOrAlgorithm) Start(net *Network) Process {
+	return newBenOr(net)
+}
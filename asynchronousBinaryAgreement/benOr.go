@@ -0,0 +1,252 @@
+package asynchronousBinaryAgreement
+
+import (
+	"bkr-acs/utils"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+	"log/slog"
+)
+
+// benOr is the Byzantine agreement of Ben-Or, where nodes that cannot adopt a value toss the coin of the channel.
+// In each round a node reports its estimate with an echo, and then votes for the value reported by more than (n+f)/2
+// nodes, or for ⟂ if there is none. It decides the value with more than (n+f)/2 votes, adopts the value with f+1 votes,
+// and otherwise takes the coin of the round. Decided nodes keep running rounds until they terminate, so that the others decide as well.
+type benOr struct {
+	*Network
+	started    bool
+	tossing    bool
+	est        byte
+	round      uint16
+	voted      map[uint16]bool
+	reports    map[uint16]map[uuid.UUID]byte
+	votes      map[uint16]map[uuid.UUID]byte
+	decided    byte
+	decision   chan byte
+	terminated chan struct{}
+	termGadget *mmrTermination
+	commands   chan func()
+	closeChan  chan struct{}
+	done       chan struct{}
+	logger     *slog.Logger
+}
+
+func newBenOr(net *Network) *benOr {
+	b := &benOr{
+		Network:    net,
+		voted:      make(map[uint16]bool),
+		reports:    make(map[uint16]map[uuid.UUID]byte),
+		votes:      make(map[uint16]map[uuid.UUID]byte),
+		decided:    bot,
+		decision:   make(chan byte, 1),
+		terminated: make(chan struct{}, 1),
+		termGadget: newMmrTermination(net.N, net.F, net.Logger),
+		commands:   make(chan func()),
+		closeChan:  make(chan struct{}, 1),
+		done:       make(chan struct{}),
+		logger:     utils.ComponentLogger(net.Logger, "Ben-Or Instance", slog.LevelWarn),
+	}
+	go b.invoker()
+	return b
+}
+
+func (b *benOr) invoker() {
+	for {
+		select {
+		case cmd := <-b.commands:
+			cmd()
+		case decision := <-b.termGadget.deliverDecision:
+			b.decide(decision)
+		case <-b.termGadget.notifyTermination:
+			b.logger.Info("terminated", "instance", b.Id)
+			b.terminated <- struct{}{}
+		case <-b.closeChan:
+			b.logger.Info("closing", "instance", b.Id)
+			b.termGadget.close()
+			close(b.done)
+			return
+		}
+	}
+}
+
+func (b *benOr) Propose(est byte) error {
+	errChan := make(chan error, 1)
+	b.commands <- func() {
+		if !isInputValid(est) {
+			errChan <- fmt.Errorf("invalid input %d", est)
+		} else if b.started {
+			errChan <- fmt.Errorf("instance already has an estimate")
+		} else {
+			b.started, b.est = true, est
+			b.report()
+			errChan <- nil
+			b.advance()
+		}
+	}
+	return <-errChan
+}
+
+func (b *benOr) Submit(msg Message) error {
+	errChan := make(chan error, 1)
+	b.commands <- func() {
+		var received map[uint16]map[uuid.UUID]byte
+		switch msg.Kind {
+		case echo:
+			received = b.reports
+			if !isInputValid(msg.Val) {
+				errChan <- fmt.Errorf("invalid report %d", msg.Val)
+				return
+			}
+		case vote:
+			received = b.votes
+			if msg.Val > bot {
+				errChan <- fmt.Errorf("invalid vote %d", msg.Val)
+				return
+			}
+		default:
+			errChan <- fmt.Errorf("unexpected message kind %s", msg.Kind)
+			return
+		}
+		if received[msg.Round] == nil {
+			received[msg.Round] = make(map[uuid.UUID]byte)
+		}
+		if _, ok := received[msg.Round][msg.Sender]; ok {
+			errChan <- fmt.Errorf("sender %s already sent a %s in round %d", msg.Sender, msg.Kind, msg.Round)
+			return
+		}
+		received[msg.Round][msg.Sender] = msg.Val
+		errChan <- nil
+		b.advance()
+	}
+	return <-errChan
+}
+
+// advance goes through the steps of the current round whose quorums were reached, and through the following rounds.
+func (b *benOr) advance() {
+	quorum := int(b.N - b.F)
+	for b.started && !b.tossing {
+		r := b.round
+		if !b.voted[r] && len(b.reports[r]) >= quorum {
+			b.voted[r] = true
+			b.broadcast(vote, r, b.majority(b.reports[r]))
+		}
+		if !b.voted[r] || len(b.votes[r]) < quorum {
+			return
+		}
+		counts := count(b.votes[r])
+		if v := b.majority(b.votes[r]); v != bot {
+			b.decide(v)
+		} else if b.decided != bot {
+			b.est = b.decided
+		} else if counts[0] > b.F {
+			b.est = 0
+		} else if counts[1] > b.F {
+			b.est = 1
+		} else {
+			b.tossing = true
+			go b.tossCoin(r)
+			return
+		}
+		b.nextRound()
+	}
+}
+
+// tossCoin adopts the coin of round r as the estimate once it is tossed, without blocking the instance meanwhile.
+func (b *benOr) tossCoin(r uint16) {
+	coin, err := b.TossCoin(r)
+	if err != nil {
+		b.logger.Warn("unable to get coin", "instance", b.Id, "round", r, "error", err)
+		return
+	}
+	select {
+	case b.commands <- func() {
+		b.logger.Debug("tossed coin", "instance", b.Id, "round", r, "coin", coin)
+		b.tossing = false
+		if b.decided == bot {
+			b.est = coin
+		}
+		b.nextRound()
+		b.advance()
+	}:
+	case <-b.done:
+	}
+}
+
+func (b *benOr) nextRound() {
+	b.round++
+	b.report()
+}
+
+// majority is the value received from more than (n+f)/2 nodes, or ⟂ if there is none.
+func (b *benOr) majority(received map[uuid.UUID]byte) byte {
+	counts := count(received)
+	for _, v := range []byte{0, 1} {
+		if 2*counts[v] > b.N+b.F {
+			return v
+		}
+	}
+	return bot
+}
+
+func count(received map[uuid.UUID]byte) []uint {
+	counts := []uint{0, 0, 0}
+	for _, v := range received {
+		counts[v]++
+	}
+	return counts
+}
+
+func (b *benOr) report() {
+	b.broadcast(echo, b.round, b.est)
+}
+
+// decide outputs the decision the first time it is reached, and keeps it as the estimate of the following rounds.
+func (b *benOr) decide(decision byte) {
+	b.est = decision
+	if b.decided != bot {
+		return
+	}
+	b.logger.Info("decided", "instance", b.Id, "round", b.round, "decision", decision)
+	b.decided = decision
+	b.decision <- decision
+	go func() {
+		if err := b.BroadcastDecision(decision); err != nil {
+			b.logger.Warn("unable to broadcast decision", "instance", b.Id, "decision", decision, "error", err)
+		}
+	}()
+}
+
+func (b *benOr) broadcast(kind MsgKind, round uint16, val byte) {
+	go func() {
+		if err := b.Broadcast(kind, round, val); err != nil {
+			b.logger.Warn("unable to broadcast", "instance", b.Id, "kind", kind, "round", round, "error", err)
+		}
+	}()
+}
+
+func (b *benOr) SubmitDecision(decision byte, sender uuid.UUID) error {
+	if err := b.termGadget.submitDecision(decision, sender); err != nil {
+		return fmt.Errorf("unable to submit decision: %v", err)
+	}
+	return nil
+}
+
+func (b *benOr) Decision() <-chan byte {
+	return b.decision
+}
+
+func (b *benOr) Terminated() <-chan struct{} {
+	return b.terminated
+}
+
+func (b *benOr) State() (uint16, bool) {
+	res := make(chan lo.Tuple2[uint16, bool], 1)
+	b.commands <- func() {
+		res <- lo.T2(b.round, b.decided != bot)
+	}
+	return (<-res).Unpack()
+}
+
+func (b *benOr) Close() {
+	b.closeChan <- struct{}{}
+}
@@ -0,0 +1,26 @@
+package asynchronousBinaryAgreement
+
+import (
+	dc "bkr-acs/decisionCertificate"
+	"bytes"
+	"fmt"
+	"github.com/google/uuid"
+)
+
+// decisionValue is the value signed by the nodes that decide in an instance.
+func decisionValue(decision byte) []byte {
+	return []byte{decision}
+}
+
+// VerifyDecision checks that the certificate proves that the instance of a channel of n nodes, f of which may be faulty,
+// decided decision. Since n-f nodes signed it, a correct node decided it, and thus every correct node did.
+func VerifyDecision(cert *dc.Certificate, id uuid.UUID, decision byte, participants []uuid.UUID, n, f uint) error {
+	if cert.Instance != id {
+		return fmt.Errorf("certificate of instance %s does not certify instance %s", cert.Instance, id)
+	} else if !bytes.Equal(cert.Value, decisionValue(decision)) {
+		return fmt.Errorf("certificate does not certify decision %d", decision)
+	} else if err := cert.Verify(participants, n, f); err != nil {
+		return fmt.Errorf("invalid certificate: %v", err)
+	}
+	return nil
+}
@@ -3,25 +3,26 @@ package asynchronousBinaryAgreement
 import (
 	"bkr-acs/utils"
 	"github.com/google/uuid"
+	"github.com/samber/lo"
 	"log/slog"
 	"time"
 )
 
-var concurrentMMRLogger = utils.GetLogger("Concurrent MMR", slog.LevelWarn)
-
 type concurrentMMR struct {
 	mmr
 	commands          chan func()
 	closeListenerChan chan struct{}
 	closeInvokerChan  chan struct{}
+	logger            *slog.Logger
 }
 
-func newConcurrentMMR(n, f uint) concurrentMMR {
+func newConcurrentMMR(n, f uint, opts mmrOptions, logger *slog.Logger) concurrentMMR {
 	m := concurrentMMR{
-		mmr:               newMMR(n, f),
+		mmr:               newMMR(n, f, opts, logger),
 		commands:          make(chan func()),
 		closeListenerChan: make(chan struct{}, 1),
 		closeInvokerChan:  make(chan struct{}, 1),
+		logger:            utils.ComponentLogger(logger, "Concurrent MMR", slog.LevelWarn),
 	}
 	go m.listenExternallyValid()
 	go m.invoker()
@@ -34,7 +35,7 @@ func (m *concurrentMMR) invoker() {
 		case cmd := <-m.commands:
 			cmd()
 		case <-m.closeInvokerChan:
-			abaLogger.Info("closing concurrentMMR")
+			m.logger.Info("closing concurrentMMR")
 			m.mmr.close()
 			return
 		}
@@ -42,7 +43,7 @@ func (m *concurrentMMR) invoker() {
 }
 
 func (m *concurrentMMR) propose(est byte) error {
-	concurrentMMRLogger.Info("scheduling initial proposal estimate", "est", est)
+	m.logger.Info("scheduling initial proposal estimate", "est", est)
 	errChan := make(chan error)
 	m.commands <- func() {
 		errChan <- m.mmr.propose(est, bot, firstRound)
@@ -51,7 +52,7 @@ func (m *concurrentMMR) propose(est byte) error {
 }
 
 func (m *concurrentMMR) submitEcho(echo byte, sender uuid.UUID, r uint16) error {
-	concurrentMMRLogger.Debug("scheduling submit echo", "echo", echo, "mmrRound", r, "sender", sender)
+	m.logger.Debug("scheduling submit echo", "echo", echo, "mmrRound", r, "sender", sender)
 	errChan := make(chan error)
 	m.commands <- func() {
 		errChan <- m.mmr.submitEcho(echo, sender, r)
@@ -60,7 +61,7 @@ func (m *concurrentMMR) submitEcho(echo byte, sender uuid.UUID, r uint16) error
 }
 
 func (m *concurrentMMR) submitVote(vote byte, sender uuid.UUID, r uint16) error {
-	concurrentMMRLogger.Debug("scheduling submit vote", "vote", vote, "mmrRound", r)
+	m.logger.Debug("scheduling submit vote", "vote", vote, "mmrRound", r)
 	errChan := make(chan error)
 	m.commands <- func() {
 		errChan <- m.mmr.submitVote(vote, sender, r)
@@ -69,7 +70,7 @@ func (m *concurrentMMR) submitVote(vote byte, sender uuid.UUID, r uint16) error
 }
 
 func (m *concurrentMMR) submitBind(bind byte, sender uuid.UUID, r uint16) error {
-	concurrentMMRLogger.Debug("scheduling submit bind", "bind", bind, "mmrRound", r)
+	m.logger.Debug("scheduling submit bind", "bind", bind, "mmrRound", r)
 	errChan := make(chan error)
 	m.commands <- func() {
 		errChan <- m.mmr.submitBind(bind, sender, r)
@@ -78,7 +79,7 @@ func (m *concurrentMMR) submitBind(bind byte, sender uuid.UUID, r uint16) error
 }
 
 func (m *concurrentMMR) submitCoin(coin byte, r uint16) error {
-	concurrentMMRLogger.Debug("scheduling submit coin", "coin", coin, "mmrRound", r)
+	m.logger.Debug("scheduling submit coin", "coin", coin, "mmrRound", r)
 	errChan := make(chan error)
 	m.commands <- func() {
 		errChan <- m.mmr.submitCoin(coin, r)
@@ -87,29 +88,37 @@ func (m *concurrentMMR) submitCoin(coin byte, r uint16) error {
 }
 
 func (m *concurrentMMR) submitDecision(decision byte, sender uuid.UUID) error {
-	concurrentMMRLogger.Debug("submitting decision", "decision", decision, "sender", sender)
+	m.logger.Debug("submitting decision", "decision", decision, "sender", sender)
 	return m.mmr.submitDecision(decision, sender)
 }
 
+func (m *concurrentMMR) state() (uint16, bool) {
+	res := make(chan lo.Tuple2[uint16, bool], 1)
+	m.commands <- func() {
+		res <- lo.T2(lo.Max(lo.Keys(m.rounds)), m.hasDecided)
+	}
+	return (<-res).Unpack()
+}
+
 func (m *concurrentMMR) listenExternallyValid() {
 	for {
 		select {
 		case val := <-m.deliverExternallyValid:
-			concurrentMMRLogger.Debug("ordering execution of submission of externally valid value", "val", val.val, "from round", val.r, "to round", val.r+1)
+			m.logger.Debug("ordering execution of submission of externally valid value", "val", val.val, "from round", val.r, "to round", val.r+1)
 			go func() {
 				m.commands <- func() {
 					m.mmr.submitExternallyValid(val.val, val.r)
 				}
 			}()
 		case <-m.closeListenerChan:
-			concurrentMMRLogger.Info("closing listener concurrentMMR")
+			m.logger.Info("closing listener concurrentMMR")
 			return
 		}
 	}
 }
 
 func (m *concurrentMMR) close() {
-	concurrentMMRLogger.Info("signaling close concurrentMMR")
+	m.logger.Info("signaling close concurrentMMR")
 	go func() {
 		time.Sleep(10 * time.Second)
 		m.closeListenerChan <- struct{}{}
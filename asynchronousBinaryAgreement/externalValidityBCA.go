@@ -7,8 +7,6 @@ import (
 	"log/slog"
 )
 
-var evbcaLogger = utils.GetLogger("Externally Valid Binding Crusader Agreement", slog.LevelWarn)
-
 // Binding Crusader Agreement satisfying the External Validity property
 // External Validity: If v is externally valid and 1-v is not externally valid, then no correct process decides differently from v.
 // A value v is externally valid if (1) a correct process has proposed v or (2) if it was externally valid in the previous round and no party delivered 1-v.
@@ -35,9 +33,10 @@ type evbca struct {
 	terminateValChan        chan byte
 	unblockChan             chan struct{}
 	closeChan               chan struct{}
+	logger                  *slog.Logger
 }
 
-func newEVBCA(n, f uint) evbca {
+func newEVBCA(n, f uint, logger *slog.Logger) evbca {
 	e := evbca{
 		n:                       n,
 		f:                       f,
@@ -59,6 +58,7 @@ func newEVBCA(n, f uint) evbca {
 		terminateValChan:        make(chan byte, 1),
 		unblockChan:             make(chan struct{}, 1),
 		closeChan:               make(chan struct{}, 1),
+		logger:                  utils.ComponentLogger(logger, "Externally Valid Binding Crusader Agreement", slog.LevelWarn),
 	}
 	go e.waitToVote()
 	go e.waitToBind()
@@ -76,9 +76,9 @@ func (e evbca) propose(est, prevCoin byte) error {
 	} else if est == bot {
 		e.voteOnCoin(prevCoin)
 	} else { // est != {prevCoin, bot}
-		evbcaLogger.Info("estimate differs from previous coin. Following normal route")
+		e.logger.Info("estimate differs from previous coin. Following normal route")
 		if e.sentEchoes[est] {
-			evbcaLogger.Debug("already sent echo", "est", est)
+			e.logger.Debug("already sent echo", "est", est)
 		} else {
 			e.broadcastEcho(est)
 		}
@@ -88,7 +88,7 @@ func (e evbca) propose(est, prevCoin byte) error {
 }
 
 func (e evbca) submitExternallyValid(val byte) {
-	evbcaLogger.Info("submitting externally valid value", "val", val)
+	e.logger.Info("submitting externally valid value", "val", val)
 	e.inputExternalValidChan <- val
 }
 
@@ -96,7 +96,7 @@ func (e evbca) submitExternallyValid(val byte) {
 // Broadcasting bind to end the round ASAP
 // Broadcasting vote because some correct processes may have decided bot on the previous round, and we need their bind.
 func (e evbca) fastForward(est byte) {
-	evbcaLogger.Info("estimate equals previous coin. Fast forwarding to vote and bind", "est", est)
+	e.logger.Info("estimate equals previous coin. Fast forwarding to vote and bind", "est", est)
 	e.sentEchoes[est] = true
 	e.approveValChan <- est
 	e.bindValChan <- est
@@ -104,7 +104,7 @@ func (e evbca) fastForward(est byte) {
 
 // I have no intuitive idea why we are running this
 func (e evbca) voteOnCoin(prevCoin byte) {
-	evbcaLogger.Info("estimate is bot. Fast forwarding to vote on coin", "prevCoin", prevCoin)
+	e.logger.Info("estimate is bot. Fast forwarding to vote on coin", "prevCoin", prevCoin)
 	e.sentEchoes[prevCoin] = true
 	e.sentEchoes[1-prevCoin] = true
 	e.approveValChan <- prevCoin
@@ -118,7 +118,7 @@ func (e evbca) submitEcho(echo byte, sender uuid.UUID) error {
 	}
 	e.echoes[echo][sender] = true
 	countEcho := len(e.echoes[echo])
-	evbcaLogger.Debug("submitting echo", "echo", echo, "sender", sender, "echoes 0", len(e.echoes[0]), "echoes 1", len(e.echoes[1]))
+	e.logger.Debug("submitting echo", "echo", echo, "sender", sender, "echoes 0", len(e.echoes[0]), "echoes 1", len(e.echoes[1]))
 	if countEcho == int(e.f+1) && !e.sentEchoes[echo] {
 		e.broadcastEcho(echo)
 	}
@@ -135,7 +135,7 @@ func (e evbca) submitVote(vote byte, sender uuid.UUID) error {
 		return fmt.Errorf("sender already votes")
 	}
 	e.votes[vote][sender] = true
-	evbcaLogger.Debug("submitting vote", "vote", vote, "sender", sender, "votes 0", len(e.votes[0]), "votes 1", len(e.votes[1]))
+	e.logger.Debug("submitting vote", "vote", vote, "sender", sender, "votes 0", len(e.votes[0]), "votes 1", len(e.votes[1]))
 	if len(e.votes[vote]) == int(e.n-e.f) && len(e.votes[1-vote]) < int(e.n-e.f) {
 		e.bindValChan <- vote
 	}
@@ -149,7 +149,7 @@ func (e evbca) submitBind(bind byte, sender uuid.UUID) error {
 		return fmt.Errorf("sender already binds a value")
 	}
 	e.binds[bind][sender] = true
-	evbcaLogger.Debug("submitting bind", "bind", bind, "sender", sender, "binds 0", len(e.binds[0]), "binds 1", len(e.binds[1]), "binds bot", len(e.binds[bot]))
+	e.logger.Debug("submitting bind", "bind", bind, "sender", sender, "binds 0", len(e.binds[0]), "binds 1", len(e.binds[1]), "binds bot", len(e.binds[bot]))
 	if len(e.binds[bind]) == int(e.n-e.f) {
 		e.terminateValChan <- bind
 	} else if len(e.binds[0])+len(e.binds[1])+len(e.binds[bot]) == int(e.n-e.f) {
@@ -161,14 +161,14 @@ func (e evbca) submitBind(bind byte, sender uuid.UUID) error {
 func (e evbca) waitForPrevCoin() {
 	externalValid := bot
 	prevCoin := <-e.prevCoinChan
-	evbcaLogger.Info("received previous coin", "prevCoin", prevCoin)
+	e.logger.Info("received previous coin", "prevCoin", prevCoin)
 	for prevCoin != externalValid {
 		select {
 		case externalValid = <-e.inputExternalValidChan:
 		case <-e.unblockChan:
 		}
 	}
-	evbcaLogger.Info("externally valid value is equal to coin", "val", externalValid)
+	e.logger.Info("externally valid value is equal to coin", "val", externalValid)
 	e.approveValChan <- externalValid
 }
 
@@ -176,7 +176,7 @@ func (e evbca) waitToVote() {
 	approvedVals := []bool{false, false}
 	first := <-e.approveValChan
 	e.outputExternalValidChan <- first
-	evbcaLogger.Info("voting on value", "first", first)
+	e.logger.Info("voting on value", "first", first)
 	e.bcastVoteChan <- first
 	approvedVals[first] = true
 	for !approvedVals[1-first] {
@@ -184,11 +184,11 @@ func (e evbca) waitToVote() {
 		case val := <-e.approveValChan:
 			approvedVals[val] = true
 		case <-e.closeChan:
-			evbcaLogger.Info("stop waiting for the second value to receive enough echoes")
+			e.logger.Info("stop waiting for the second value to receive enough echoes")
 			return
 		}
 	}
-	evbcaLogger.Info("both values are valid")
+	e.logger.Info("both values are valid")
 	e.outputExternalValidChan <- 1 - first
 	e.bindBotChan <- struct{}{}
 	e.terminateBotChan <- struct{}{}
@@ -202,7 +202,7 @@ func (e evbca) waitToBind() {
 	case v := <-e.bindValChan:
 		bindVal = v
 	}
-	evbcaLogger.Info("binding value", "bindVal", bindVal)
+	e.logger.Info("binding value", "bindVal", bindVal)
 	e.bcastBindChan <- bindVal
 }
 
@@ -217,25 +217,25 @@ func (e evbca) waitToDecide() {
 			decision = bot
 		}
 	}
-	evbcaLogger.Info("decided", "decision", decision)
+	e.logger.Info("decided", "decision", decision)
 	e.outputDecision <- decision
 	e.unblockChan <- struct{}{}
 }
 
 func (e evbca) broadcastEcho(echo byte) {
-	evbcaLogger.Info("broadcasting echo", "echo", echo)
+	e.logger.Info("broadcasting echo", "echo", echo)
 	e.sentEchoes[echo] = true
 	e.bcastEchoChan <- echo
 }
 
 func (e evbca) broadcastVote(vote byte) {
-	evbcaLogger.Info("broadcasting vote", "vote", vote)
+	e.logger.Info("broadcasting vote", "vote", vote)
 	e.voted = true
 	e.bcastVoteChan <- vote
 }
 
 func (e evbca) broadcastBind(bind byte) {
-	evbcaLogger.Info("broadcasting bind", "bind", bind)
+	e.logger.Info("broadcasting bind", "bind", bind)
 	e.bound = true
 	e.bcastBindChan <- bind
 }
@@ -7,8 +7,6 @@ import (
 	"log/slog"
 )
 
-var bcaLogger = utils.GetLogger("Alternative Binding Crusader Agreement", slog.LevelWarn)
-
 // Default Binding Crusader Agreement satisfying the (internal) Validity property
 // Validity: If all correct processes propose v, no correct process decides differently from v.
 type ivbca struct {
@@ -29,9 +27,10 @@ type ivbca struct {
 	terminateBotChan        chan struct{}
 	terminateValChan        chan byte
 	unblockChan             chan struct{}
+	logger                  *slog.Logger
 }
 
-func newBCA(n, f uint) ivbca {
+func newBCA(n, f uint, logger *slog.Logger) ivbca {
 	s := ivbca{
 		n:                       n,
 		f:                       f,
@@ -50,6 +49,7 @@ func newBCA(n, f uint) ivbca {
 		terminateBotChan:        make(chan struct{}, 2),
 		terminateValChan:        make(chan byte, 1),
 		unblockChan:             make(chan struct{}, 1),
+		logger:                  utils.ComponentLogger(logger, "Alternative Binding Crusader Agreement", slog.LevelWarn),
 	}
 	go s.waitToVote()
 	go s.waitToBind()
@@ -80,7 +80,7 @@ func (s *ivbca) submitEcho(echo byte, sender uuid.UUID) error {
 	}
 	s.echoes[echo][sender] = true
 	countEcho := len(s.echoes[echo])
-	bcaLogger.Debug("submitting echo", "echo", echo, "sender", sender, "echoes 0", len(s.echoes[0]), "echoes 1", len(s.echoes[1]))
+	s.logger.Debug("submitting echo", "echo", echo, "sender", sender, "echoes 0", len(s.echoes[0]), "echoes 1", len(s.echoes[1]))
 	if countEcho == int(s.f+1) && !s.sentEchoes[echo] {
 		s.broadcastEcho(echo)
 	}
@@ -98,7 +98,7 @@ func (s *ivbca) submitVote(vote byte, sender uuid.UUID) error {
 		return fmt.Errorf("sender already voted")
 	}
 	s.voted[vote][sender] = true
-	bcaLogger.Debug("submitting vote", "vote", vote, "sender", sender, "votes 0", len(s.voted[0]), "votes 1", len(s.voted[1]))
+	s.logger.Debug("submitting vote", "vote", vote, "sender", sender, "votes 0", len(s.voted[0]), "votes 1", len(s.voted[1]))
 	if len(s.voted[vote]) == int(s.n-s.f) && len(s.voted[1-vote]) < int(s.n-s.f) {
 		s.bindValChan <- vote
 	}
@@ -112,7 +112,7 @@ func (s *ivbca) submitBind(bind byte, sender uuid.UUID) error {
 		return fmt.Errorf("sender already bound a value")
 	}
 	s.bound[bind][sender] = true
-	bcaLogger.Debug("submitting bind", "bind", bind, "sender", sender, "binds 0", len(s.bound[0]), "binds 1", len(s.bound[1]), "binds bot", len(s.bound[bot]))
+	s.logger.Debug("submitting bind", "bind", bind, "sender", sender, "binds 0", len(s.bound[0]), "binds 1", len(s.bound[1]), "binds bot", len(s.bound[bot]))
 	if len(s.bound[bind]) == int(s.n-s.f) {
 		s.terminateValChan <- bind
 	} else if len(s.bound[0])+len(s.bound[1])+len(s.bound[bot]) == int(s.n-s.f) {
@@ -123,15 +123,15 @@ func (s *ivbca) submitBind(bind byte, sender uuid.UUID) error {
 
 func (s *ivbca) waitToVote() {
 	first := <-s.approveValChan
-	bcaLogger.Info("voting on value", "first", first)
+	s.logger.Info("voting on value", "first", first)
 	s.bcastVoteChan <- first
 	select {
 	case <-s.approveValChan:
-		bcaLogger.Info("both values are valid")
+		s.logger.Info("both values are valid")
 		s.bindBotChan <- struct{}{}
 		s.terminateBotChan <- struct{}{}
 	case <-s.unblockChan:
-		bcaLogger.Info("stop waiting for the second value to receive enough echoes")
+		s.logger.Info("stop waiting for the second value to receive enough echoes")
 	}
 }
 
@@ -143,7 +143,7 @@ func (s *ivbca) waitToBind() {
 	case v := <-s.bindValChan:
 		bindVal = v
 	}
-	bcaLogger.Info("binding value", "bindVal", bindVal)
+	s.logger.Info("binding value", "bindVal", bindVal)
 	s.bcastBindChan <- bindVal
 }
 
@@ -158,13 +158,13 @@ func (s *ivbca) waitToDecide() {
 			decision = bot
 		}
 	}
-	bcaLogger.Info("decided", "decision", decision)
+	s.logger.Info("decided", "decision", decision)
 	s.outputDecision <- decision
 	s.unblockChan <- struct{}{}
 }
 
 func (s *ivbca) broadcastEcho(echo byte) {
-	bcaLogger.Info("broadcasting echo", "echo", echo)
+	s.logger.Info("broadcasting echo", "echo", echo)
 	s.sentEchoes[echo] = true
 	s.bcastEchoChan <- echo
 }
@@ -26,7 +26,7 @@ func testBCAShouldDecideIfAllProposeSame(t *testing.T, proposal byte) {
 	n := 3*f + 1
 	scheduler := newOrderedBCAScheduler(t)
 	instances := lo.Map(lo.Range(int(n)), func(_ int, _ int) *ivbca {
-		instance := newBCA(n, f)
+		instance := newBCA(n, f, utils.DefaultLogger())
 		return &instance
 	})
 	senders := lo.Map(instances, func(_ *ivbca, _ int) uuid.UUID {
@@ -52,7 +52,7 @@ func TestBCAShouldTerminateWithManyDifferingResponses(t *testing.T) {
 	n := 3*f + 1
 	scheduler := newOrderedBCAScheduler(t)
 	instances := lo.Map(lo.Range(int(n)), func(_ int, _ int) *ivbca {
-		instance := newBCA(n, f)
+		instance := newBCA(n, f, utils.DefaultLogger())
 		return &instance
 	})
 	senders := lo.Map(instances, func(_ *ivbca, _ int) uuid.UUID {
@@ -7,11 +7,29 @@ import (
 	"log/slog"
 )
 
-var abaLogger = utils.GetLogger("MMR Instance", slog.LevelWarn)
-
 const firstRound = 0
 const averageNumRounds = 2
 
+// bcaValidity selects the binding crusader agreement run by the rounds after the first, which always has internal validity.
+type bcaValidity byte
+
+const (
+	externalValidity bcaValidity = iota
+	internalValidity
+)
+
+// fastPathValue is the fixed coin of the first round with the fast path, which is the value it decides.
+const fastPathValue byte = 1
+
+// mmrOptions are the variations of the algorithm, which every node must run alike.
+// With the fast path, the coin of the first round is fixed to fastPathValue, which is safe since MMR only needs the coin to be
+// common for safety. A node then decides fastPathValue as soon as n-f nodes vote for it in the first round: no correct
+// node binds the other value, so the first round ends with fastPathValue or ⟂ at every correct node, and ⟂ adopts the coin.
+type mmrOptions struct {
+	validity bcaValidity
+	fastPath bool
+}
+
 type roundMsg struct {
 	val byte
 	r   uint16
@@ -27,8 +45,10 @@ func (r *cancelableRound) close() {
 }
 
 type mmr struct {
-	n                      uint
-	f                      uint
+	n uint
+	f uint
+	mmrOptions
+	fastVotes              map[uuid.UUID]bool
 	deliverEcho            chan roundMsg
 	deliverVote            chan roundMsg
 	deliverBind            chan roundMsg
@@ -39,12 +59,15 @@ type mmr struct {
 	coinReq                chan uint16
 	rounds                 map[uint16]*cancelableRound
 	termGadget             *mmrTermination
+	logger                 *slog.Logger
 }
 
-func newMMR(n, f uint) mmr {
+func newMMR(n, f uint, opts mmrOptions, logger *slog.Logger) mmr {
 	m := mmr{
 		n:                      n,
 		f:                      f,
+		mmrOptions:             opts,
+		fastVotes:              make(map[uuid.UUID]bool),
 		deliverEcho:            make(chan roundMsg, 2*(averageNumRounds+1)),
 		deliverVote:            make(chan roundMsg, averageNumRounds+1),
 		deliverBind:            make(chan roundMsg, averageNumRounds+1),
@@ -54,7 +77,8 @@ func newMMR(n, f uint) mmr {
 		hasDecided:             false,
 		coinReq:                make(chan uint16, averageNumRounds+1),
 		rounds:                 make(map[uint16]*cancelableRound),
-		termGadget:             newMmrTermination(n, f),
+		termGadget:             newMmrTermination(n, f, logger),
+		logger:                 utils.ComponentLogger(logger, "MMR Instance", slog.LevelWarn),
 	}
 	m.initFirstRound()
 	go m.reachDecision()
@@ -62,7 +86,7 @@ func newMMR(n, f uint) mmr {
 }
 
 func (m *mmr) propose(est, prevCoin byte, r uint16) error {
-	abaLogger.Debug("proposing estimate", "est", est, "round", r)
+	m.logger.Debug("proposing estimate", "est", est, "round", r)
 	round := m.getRound(r)
 	if err := round.propose(est, prevCoin); err != nil {
 		return fmt.Errorf("unable to propose to round %d: %v", r, err)
@@ -71,7 +95,7 @@ func (m *mmr) propose(est, prevCoin byte, r uint16) error {
 }
 
 func (m *mmr) submitEcho(echo byte, sender uuid.UUID, r uint16) error {
-	abaLogger.Debug("submitting echo", "echo", echo, "sender", sender, "round", r)
+	m.logger.Debug("submitting echo", "echo", echo, "sender", sender, "round", r)
 	round := m.getRound(r)
 	if err := round.submitEcho(echo, sender); err != nil {
 		return fmt.Errorf("unable to submit echo to round %d: %v", r, err)
@@ -80,16 +104,29 @@ func (m *mmr) submitEcho(echo byte, sender uuid.UUID, r uint16) error {
 }
 
 func (m *mmr) submitVote(vote byte, sender uuid.UUID, r uint16) error {
-	abaLogger.Debug("submitting vote", "vote", vote, "sender", sender, "round", r)
+	m.logger.Debug("submitting vote", "vote", vote, "sender", sender, "round", r)
 	round := m.getRound(r)
 	if err := round.submitVote(vote, sender); err != nil {
 		return fmt.Errorf("unable to submit vote to round %d: %v", r, err)
+	} else if m.fastPath && r == firstRound && vote == fastPathValue {
+		m.countFastVote(sender)
 	}
 	return nil
 }
 
+// countFastVote decides fastPathValue once n-f nodes voted for it in the first round.
+// The round goes on, since the nodes that did not see these votes need the binds of this node.
+func (m *mmr) countFastVote(sender uuid.UUID) {
+	m.fastVotes[sender] = true
+	if len(m.fastVotes) == int(m.n-m.f) && !m.hasDecided {
+		m.logger.Info("deciding on the fast path", "decision", fastPathValue)
+		m.hasDecided = true
+		m.reachedDecision <- fastPathValue
+	}
+}
+
 func (m *mmr) submitBind(bind byte, sender uuid.UUID, r uint16) error {
-	abaLogger.Debug("submitting bind", "bind", bind, "sender", sender, "round", r)
+	m.logger.Debug("submitting bind", "bind", bind, "sender", sender, "round", r)
 	round := m.getRound(r)
 	if err := round.submitBind(bind, sender); err != nil {
 		return fmt.Errorf("unable to submit bind to round %d: %v", r, err)
@@ -98,21 +135,32 @@ func (m *mmr) submitBind(bind byte, sender uuid.UUID, r uint16) error {
 }
 
 func (m *mmr) submitCoin(coin byte, r uint16) error {
-	abaLogger.Debug("submitting coin", "coin", coin, "mmrRound", r)
+	m.logger.Debug("submitting coin", "coin", coin, "mmrRound", r)
 	round := m.getRound(r)
 	if res := round.submitCoin(coin); res.err != nil {
 		return fmt.Errorf("unable to submit coin to round %d: %v", r, res.err)
 	} else if res.decided && !m.hasDecided {
 		m.hasDecided = true
 		m.reachedDecision <- res.estimate
-	} else if err := m.propose(res.estimate, coin, r+1); err != nil {
+	} else if res.decided && m.fastPath {
+		// Nodes that decided on the fast path stop at the first round where the others can decide too.
+		m.logger.Debug("stopping after fast decision", "mmrRound", r)
+	} else if err := m.propose(res.estimate, m.prevCoin(coin), r+1); err != nil {
 		return fmt.Errorf("unable to propose to round %d: %v", r+1, err)
 	}
 	return nil
 }
 
+// prevCoin is the coin passed to the next round, which only rounds with external validity use.
+func (m *mmr) prevCoin(coin byte) byte {
+	if m.validity == internalValidity {
+		return bot
+	}
+	return coin
+}
+
 func (m *mmr) submitExternallyValid(val byte, r uint16) {
-	abaLogger.Debug("submitting externally valid value", "val", val, "round", r)
+	m.logger.Debug("submitting externally valid value", "val", val, "round", r)
 	round := m.getRound(r + 1)
 	round.submitExternallyValid(val)
 }
@@ -128,7 +176,12 @@ func (m *mmr) getRound(rNum uint16) *cancelableRound {
 }
 
 func (m *mmr) newRound(r uint16) *cancelableRound {
-	round := newRound(m.n, m.f)
+	var round mmrRound
+	if m.validity == internalValidity {
+		round = newFirstRound(m.n, m.f, m.logger)
+	} else {
+		round = newRound(m.n, m.f, m.logger)
+	}
 	closeChan := make(chan struct{}, 1)
 	go m.listenRequests(&round, closeChan, r)
 	return &cancelableRound{
@@ -138,7 +191,7 @@ func (m *mmr) newRound(r uint16) *cancelableRound {
 }
 
 func (m *mmr) initFirstRound() {
-	round := newFirstRound(m.n, m.f)
+	round := newFirstRound(m.n, m.f, m.logger)
 	closeChan := make(chan struct{}, 1)
 	go m.listenRequests(&round, closeChan, firstRound)
 	m.rounds[firstRound] = &cancelableRound{
@@ -151,32 +204,32 @@ func (m *mmr) listenRequests(round *mmrRound, close chan struct{}, rnum uint16)
 	for {
 		select {
 		case echo := <-round.getBcastEchoChan():
-			abaLogger.Debug("broadcasting echo", "echo", echo, "round", rnum)
+			m.logger.Debug("broadcasting echo", "echo", echo, "round", rnum)
 			go func() {
 				m.deliverEcho <- roundMsg{val: echo, r: rnum}
 			}()
 		case vote := <-round.getBcastVoteChan():
-			abaLogger.Debug("broadcasting vote", "vote", vote, "round", rnum)
+			m.logger.Debug("broadcasting vote", "vote", vote, "round", rnum)
 			go func() {
 				m.deliverVote <- roundMsg{val: vote, r: rnum}
 			}()
 		case bind := <-round.getBcastBindChan():
-			abaLogger.Debug("broadcasting bind", "bind", bind, "round", rnum)
+			m.logger.Debug("broadcasting bind", "bind", bind, "round", rnum)
 			go func() {
 				m.deliverBind <- roundMsg{val: bind, r: rnum}
 			}()
 		case <-round.coinReqChan:
-			abaLogger.Debug("coin request", "round", rnum)
+			m.logger.Debug("coin request", "round", rnum)
 			go func() {
 				m.coinReq <- rnum
 			}()
 		case val := <-round.getOutputExternalValidChan():
-			abaLogger.Debug("external valid value", "val", val, "round", rnum)
+			m.logger.Debug("external valid value", "val", val, "round", rnum)
 			go func() {
 				m.deliverExternallyValid <- roundMsg{val: val, r: rnum}
 			}()
 		case <-close:
-			abaLogger.Info("closing concurrentMMR round", "round", rnum)
+			m.logger.Info("closing concurrentMMR round", "round", rnum)
 			return
 		}
 	}
@@ -46,7 +46,7 @@ func (o *mmrOrderedScheduler) addInstance(m *concurrentMMR) *wrappedMMR {
 }
 
 func (o *mmrOrderedScheduler) getChannels(n, f uint, sender uuid.UUID) *wrappedMMR {
-	m := newConcurrentMMR(n, f)
+	m := newConcurrentMMR(n, f, mmrOptions{}, utils.DefaultLogger())
 	wmmr := o.addInstance(&m)
 	go o.listenEchoes(o.t, m.deliverEcho, sender)
 	go o.listenVotes(o.t, m.deliverVote, sender)
@@ -171,7 +171,7 @@ func (u *mmrUnorderedScheduler) addInstance(m *concurrentMMR) *wrappedMMR {
 }
 
 func (u *mmrUnorderedScheduler) getChannels(n, f uint, sender uuid.UUID) *wrappedMMR {
-	m := newConcurrentMMR(n, f)
+	m := newConcurrentMMR(n, f, mmrOptions{}, utils.DefaultLogger())
 	wmmr := u.addInstance(&m)
 	go u.listenEchoes(m.deliverEcho, sender)
 	go u.listenVotes(m.deliverVote, sender)
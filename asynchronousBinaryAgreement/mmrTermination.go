@@ -7,8 +7,6 @@ import (
 	"log/slog"
 )
 
-var termLocalLogger = utils.GetLogger("Local MMR Termination", slog.LevelWarn)
-
 const bot byte = 2
 
 type mmrTermination struct {
@@ -20,9 +18,10 @@ type mmrTermination struct {
 	notifyTermination chan struct{}
 	commands          chan func()
 	closeChan         chan struct{}
+	logger            *slog.Logger
 }
 
-func newMmrTermination(n uint, f uint) *mmrTermination {
+func newMmrTermination(n uint, f uint, logger *slog.Logger) *mmrTermination {
 	t := &mmrTermination{
 		received:          make(map[uuid.UUID]bool),
 		results:           []uint{0, 0},
@@ -32,9 +31,10 @@ func newMmrTermination(n uint, f uint) *mmrTermination {
 		notifyTermination: make(chan struct{}, 1),
 		commands:          make(chan func()),
 		closeChan:         make(chan struct{}, 1),
+		logger:            utils.ComponentLogger(logger, "Local MMR Termination", slog.LevelWarn),
 	}
 	go t.invoker()
-	termLocalLogger.Info("new mmrTermination created")
+	t.logger.Info("new mmrTermination created")
 	return t
 }
 
@@ -44,7 +44,7 @@ func (t *mmrTermination) invoker() {
 		case cmd := <-t.commands:
 			cmd()
 		case <-t.closeChan:
-			abaLogger.Info("closing mmrTermination")
+			t.logger.Info("closing mmrTermination")
 			return
 		}
 	}
@@ -60,13 +60,13 @@ func (t *mmrTermination) submitDecision(decision byte, sender uuid.UUID) error {
 		} else {
 			t.received[sender] = true
 			t.results[decision]++
-			abaLogger.Debug("submitting decision", "decision", decision, "sender", sender, "received", t.results[decision], "required", t.f+1)
+			t.logger.Debug("submitting decision", "decision", decision, "sender", sender, "received", t.results[decision], "required", t.f+1)
 			if t.results[decision] == t.f+1 {
-				abaLogger.Info("decision reached", "decision", decision)
+				t.logger.Info("decision reached", "decision", decision)
 				t.deliverDecision <- decision
 			}
 			if t.results[0]+t.results[1] == t.n-t.f {
-				abaLogger.Info("termination reached", "decision", decision)
+				t.logger.Info("termination reached", "decision", decision)
 				t.notifyTermination <- struct{}{}
 			}
 			output <- nil
@@ -76,6 +76,6 @@ func (t *mmrTermination) submitDecision(decision byte, sender uuid.UUID) error {
 }
 
 func (t *mmrTermination) close() {
-	abaLogger.Info("signaling close mmrTermination")
+	t.logger.Info("signaling close mmrTermination")
 	t.closeChan <- struct{}{}
 }
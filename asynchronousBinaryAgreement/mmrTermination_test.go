@@ -1,6 +1,7 @@
 package asynchronousBinaryAgreement
 
 import (
+	"bkr-acs/utils"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"testing"
@@ -8,7 +9,7 @@ import (
 )
 
 func TestMMRShouldTerminateWithOwnDecision(t *testing.T) {
-	tg := newMmrTermination(1, 0)
+	tg := newMmrTermination(1, 0, utils.DefaultLogger())
 	proposedDecision := byte(0)
 	err := tg.submitDecision(proposedDecision, uuid.New())
 	assert.NoError(t, err)
@@ -19,14 +20,14 @@ func TestMMRShouldTerminateWithOwnDecision(t *testing.T) {
 func TestMMRShouldNotDecideImmediately(t *testing.T) {
 	f := uint(1)
 	n := 3*f + 1
-	tg := newMmrTermination(n, f)
+	tg := newMmrTermination(n, f, utils.DefaultLogger())
 	err := tg.submitDecision(byte(0), uuid.New())
 	assert.NoError(t, err)
 	shouldNotTerminateOrDecide(t, tg)
 }
 
 func TestShouldFilterRepeatedDecisionProposals(t *testing.T) {
-	tg := newMmrTermination(2, 1)
+	tg := newMmrTermination(2, 1, utils.DefaultLogger())
 	sender := uuid.New()
 	proposedDecision := byte(0)
 	err := tg.submitDecision(proposedDecision, sender)
@@ -36,7 +37,7 @@ func TestShouldFilterRepeatedDecisionProposals(t *testing.T) {
 }
 
 func TestShouldFilterInvalidDecisions(t *testing.T) {
-	tg := newMmrTermination(2, 1)
+	tg := newMmrTermination(2, 1, utils.DefaultLogger())
 	err := tg.submitDecision(bot, uuid.New())
 	assert.Error(t, err)
 }
@@ -44,7 +45,7 @@ func TestShouldFilterInvalidDecisions(t *testing.T) {
 func TestMMRShouldWaitForThresholdDecisions(t *testing.T) {
 	f := uint(3)
 	n := 3*f + 1
-	tg := newMmrTermination(n, f)
+	tg := newMmrTermination(n, f, utils.DefaultLogger())
 	for i := uint(0); i < f; i++ {
 		err := tg.submitDecision(byte(0), uuid.New())
 		assert.NoError(t, err)
@@ -1,6 +1,7 @@
 package asynchronousBinaryAgreement
 
 import (
+	"bkr-acs/utils"
 	"github.com/google/uuid"
 	"github.com/samber/lo"
 	"github.com/stretchr/testify/assert"
@@ -248,3 +249,18 @@ func testShouldDecideSameDifferentProposals(t *testing.T, n uint, correct uint,
 		wmmr.m.close()
 	}
 }
+
+func TestShouldDecideOnFastPathWithoutBindsOrCoin(t *testing.T) {
+	m := newConcurrentMMR(4, 1, mmrOptions{fastPath: true}, utils.DefaultLogger())
+	peers := lo.Times(3, func(_ int) uuid.UUID { return uuid.New() })
+	assert.NoError(t, m.propose(fastPathValue))
+	for _, peer := range peers {
+		assert.NoError(t, m.submitEcho(fastPathValue, peer, firstRound))
+	}
+	for _, peer := range peers {
+		assert.NoError(t, m.submitVote(fastPathValue, peer, firstRound))
+	}
+	assert.Equal(t, fastPathValue, <-m.deliverDecision)
+	assert.Empty(t, m.coinReq)
+	m.close()
+}
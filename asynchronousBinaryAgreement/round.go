@@ -20,34 +20,35 @@ type bca interface {
 	getOutputExternalValidChan() chan byte
 }
 
-var roundLogger = utils.GetLogger("MMR Round", slog.LevelWarn)
-
 type mmrRound struct {
 	bca
 	coinReqChan        chan struct{}
 	coinReceiveChan    chan byte
 	internalTransition chan roundTransitionResult
+	logger             *slog.Logger
 }
 
-func newFirstRound(n, f uint) mmrRound {
-	ivbca := newBCA(n, f)
+func newFirstRound(n, f uint, logger *slog.Logger) mmrRound {
+	ivbca := newBCA(n, f, logger)
 	round := mmrRound{
 		bca:                &ivbca,
 		coinReqChan:        make(chan struct{}, 1),
 		coinReceiveChan:    make(chan byte, 1),
 		internalTransition: make(chan roundTransitionResult, 1),
+		logger:             utils.ComponentLogger(logger, "MMR Round", slog.LevelWarn),
 	}
 	go round.execRound()
 	return round
 }
 
-func newRound(n, f uint) mmrRound {
-	evbca := newEVBCA(n, f)
+func newRound(n, f uint, logger *slog.Logger) mmrRound {
+	evbca := newEVBCA(n, f, logger)
 	round := mmrRound{
 		bca:                &evbca,
 		coinReqChan:        make(chan struct{}, 1),
 		coinReceiveChan:    make(chan byte, 1),
 		internalTransition: make(chan roundTransitionResult, 1),
+		logger:             utils.ComponentLogger(logger, "MMR Round", slog.LevelWarn),
 	}
 	go round.execRound()
 	return round
@@ -64,13 +65,13 @@ type roundTransitionResult struct {
 }
 
 func (r *mmrRound) execRound() {
-	roundLogger.Info("executing round")
+	r.logger.Info("executing round")
 	dec := <-r.bca.getOutputDecision()
-	roundLogger.Info("round decided", "dec", dec)
-	roundLogger.Info("requesting coin")
+	r.logger.Info("round decided", "dec", dec)
+	r.logger.Info("requesting coin")
 	r.coinReqChan <- struct{}{}
 	coin := <-r.coinReceiveChan
-	roundLogger.Info("received coin", "coin", coin)
+	r.logger.Info("received coin", "coin", coin)
 	if dec == bot {
 		r.internalTransition <- roundTransitionResult{estimate: coin}
 	} else {
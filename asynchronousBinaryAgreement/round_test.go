@@ -1,6 +1,7 @@
 package asynchronousBinaryAgreement
 
 import (
+	"bkr-acs/utils"
 	"github.com/google/uuid"
 	"github.com/samber/lo"
 	"github.com/stretchr/testify/assert"
@@ -8,39 +9,39 @@ import (
 )
 
 func TestRoundShouldRejectInvalidEstimate(t *testing.T) {
-	r := newFirstRound(1, 0)
+	r := newFirstRound(1, 0, utils.DefaultLogger())
 	assert.Error(t, r.propose(bot, bot))
 }
 
 func TestRoundShouldRejectInvalidBVal(t *testing.T) {
 	someId := uuid.New()
-	r := newFirstRound(1, 0)
+	r := newFirstRound(1, 0, utils.DefaultLogger())
 	assert.Error(t, r.submitEcho(bot, someId))
 }
 
 func TestRoundShouldRejectInvalidAux(t *testing.T) {
 	someId := uuid.New()
-	r := newFirstRound(1, 0)
+	r := newFirstRound(1, 0, utils.DefaultLogger())
 	assert.Error(t, r.submitVote(bot, someId))
 }
 
 func TestRoundShouldRejectRepeatedAux(t *testing.T) {
 	sender := uuid.New()
-	r := newFirstRound(1, 0)
+	r := newFirstRound(1, 0, utils.DefaultLogger())
 	assert.NoError(t, r.submitVote(0, sender))
 	assert.Error(t, r.submitVote(0, sender))
 }
 
 func TestRoundShouldNotRejectDifferentBValSameSender(t *testing.T) {
 	sender := uuid.New()
-	r := newFirstRound(1, 0)
+	r := newFirstRound(1, 0, utils.DefaultLogger())
 	assert.NoError(t, r.submitEcho(0, sender))
 	assert.NoError(t, r.submitEcho(1, sender))
 }
 
 func TestRoundShouldRejectSameBValSameSender(t *testing.T) {
 	sender := uuid.New()
-	r := newRound(1, 0)
+	r := newRound(1, 0, utils.DefaultLogger())
 	assert.NoError(t, r.submitEcho(0, sender))
 	assert.Error(t, r.submitEcho(0, sender))
 	assert.NoError(t, r.submitEcho(1, sender))
@@ -87,7 +88,7 @@ func TestRoundShouldNotDecideOwnEstimate1Coin0(t *testing.T) {
 
 func followSingleNodeCommonPath(t *testing.T, est byte) *mmrRound {
 	myId := uuid.New()
-	r := newFirstRound(1, 0)
+	r := newFirstRound(1, 0, utils.DefaultLogger())
 	assert.NoError(t, r.propose(est, bot))
 	echo := <-r.getBcastEchoChan()
 	assert.Equal(t, est, echo)
@@ -256,7 +257,7 @@ func testRoundAllProposeTheSame(t *testing.T, correctNodes, n, f, byzantine int,
 func instantiateCorrect(t *testing.T, maxNodes, numNodes, f int) []*mmrRound {
 	s := newOrderedScheduler()
 	rounds := lo.Map(lo.Range(numNodes), func(_ int, _ int) *mmrRound {
-		r := newFirstRound(uint(maxNodes), uint(f))
+		r := newFirstRound(uint(maxNodes), uint(f), utils.DefaultLogger())
 		return &r
 	})
 	for _, r := range rounds {
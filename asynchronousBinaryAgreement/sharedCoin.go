@@ -0,0 +1,60 @@
+package asynchronousBinaryAgreement
+
+import (
+	ct "bkr-acs/coinTosser"
+	"bkr-acs/utils"
+	"github.com/google/uuid"
+	"sync"
+)
+
+// sharedCoin is the coin of a round of a group of sibling instances, which is set once the toss completes.
+type sharedCoin struct {
+	done  chan struct{}
+	value byte
+}
+
+// coinCache tosses the coin of each round of a group once for all the siblings that request it, and remembers its value
+// until the group is collected, since siblings may reach a round long after the others.
+type coinCache struct {
+	lock  sync.Mutex
+	coins map[uuid.UUID]map[uint16]*sharedCoin
+	coin  ct.Coin
+}
+
+func newCoinCache(coin ct.Coin) *coinCache {
+	return &coinCache{coins: make(map[uuid.UUID]map[uint16]*sharedCoin), coin: coin}
+}
+
+func (c *coinCache) toss(group uuid.UUID, round uint16, seed []byte) byte {
+	c.lock.Lock()
+	if c.coins[group] == nil {
+		c.coins[group] = make(map[uint16]*sharedCoin)
+	}
+	coin := c.coins[group][round]
+	if coin == nil {
+		coin = &sharedCoin{done: make(chan struct{})}
+		c.coins[group][round] = coin
+		go func() {
+			coinReceiver := make(chan bool)
+			c.coin.TossCoin(seed, coinReceiver)
+			if <-coinReceiver {
+				coin.value = 1
+			}
+			close(coin.done)
+		}()
+	}
+	c.lock.Unlock()
+	<-coin.done
+	return coin.value
+}
+
+// collect forgets the coins of the groups with a sequence below the watermark.
+func (c *coinCache) collect(watermark uint64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for group := range c.coins {
+		if utils.InstanceSequence(group) < watermark {
+			delete(c.coins, group)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package asynchronousBinaryAgreement
+
+import (
+	ct "bkr-acs/coinTosser"
+	"bkr-acs/utils"
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+)
+
+// AbaInstanceState is a snapshot of an instance that has not terminated yet.
+// An instance may have decided and still be live while it waits for enough decisions to terminate.
+type AbaInstanceState struct {
+	Id      uuid.UUID `json:"id"`
+	Round   uint16    `json:"round"`
+	Decided bool      `json:"decided"`
+}
+
+// AbaState lists the instances of the channel that have not been collected by the low watermark.
+// DecisionRounds is the total number of rounds the Decided instances went through before deciding.
+type AbaState struct {
+	Live           []AbaInstanceState   `json:"live"`
+	Finished       []uuid.UUID          `json:"finished"`
+	Watermark      uint64               `json:"watermark"`
+	Admission      utils.AdmissionState `json:"admission"`
+	Decided        uint64               `json:"decided"`
+	DecisionRounds uint64               `json:"decisionRounds"`
+}
+
+// State returns a snapshot of the instances of the channel.
+func (c *AbaChannel) State() AbaState {
+	res := make(chan AbaState, 1)
+	c.commands <- func() error {
+		live := make([]AbaInstanceState, 0, len(c.instances))
+		for id, instance := range c.instances {
+			round, decided := instance.process.State()
+			live = append(live, AbaInstanceState{Id: id, Round: round, Decided: decided})
+		}
+		res <- AbaState{Live: live, Finished: lo.Keys(c.finished), Watermark: c.watermark, Admission: c.admission.State(), Decided: c.decided, DecisionRounds: c.decisionRound}
+		return nil
+	}
+	return <-res
+}
+
+// CoinState returns a snapshot of the coin used by the channel. Coins without instances, such as the local coin, return an empty one.
+func (c *AbaChannel) CoinState() (ct.CTState, error) {
+	return c.coin.State()
+}
@@ -11,8 +11,6 @@ import (
 	"log/slog"
 )
 
-var termLogger = utils.GetLogger("ABA Termination Middleware", slog.LevelWarn)
-
 type terminationMsg struct {
 	sender   uuid.UUID
 	instance uuid.UUID
@@ -23,16 +21,18 @@ type terminationMiddleware struct {
 	beb       *on.BEBChannel
 	output    chan *terminationMsg
 	closeChan chan struct{}
+	logger    *slog.Logger
 }
 
-func newTerminationMiddleware(beb *on.BEBChannel) *terminationMiddleware {
+func newTerminationMiddleware(beb *on.BEBChannel, logger *slog.Logger) *terminationMiddleware {
 	tg := &terminationMiddleware{
 		beb:       beb,
 		output:    make(chan *terminationMsg),
 		closeChan: make(chan struct{}),
+		logger:    utils.ComponentLogger(logger, "ABA Termination Middleware", slog.LevelWarn),
 	}
 	go tg.brbDeliver()
-	termLogger.Info("new termination middleware created")
+	tg.logger.Info("new termination middleware created")
 	return tg
 }
 
@@ -41,10 +41,10 @@ func (m *terminationMiddleware) brbDeliver() {
 		select {
 		case brbMsg := <-m.beb.GetBEBChan():
 			if err := m.processMsg(brbMsg); err != nil {
-				termLogger.Warn("unable to process termination message", "error", err)
+				m.logger.Warn("unable to process termination message", "error", err)
 			}
 		case <-m.closeChan:
-			termLogger.Info("closing termination gadget")
+			m.logger.Info("closing termination gadget")
 			return
 		}
 	}
@@ -56,9 +56,9 @@ func (m *terminationMiddleware) processMsg(brbMsg on.BEBMsg) error {
 		return fmt.Errorf("unable to convert public key to uuid: %v", err)
 	}
 	if tm, err := m.parseMsg(brbMsg.Content, senderId); err != nil {
-		termLogger.Warn("unable to parse termination message", "error", err)
+		m.logger.Warn("unable to parse termination message", "error", err)
 	} else {
-		termLogger.Debug("received termination message", "sender", tm.sender, "inner", tm.instance, "decision", tm.decision)
+		m.logger.Debug("received termination message", "sender", tm.sender, "inner", tm.instance, "decision", tm.decision)
 		go func() { m.output <- tm }()
 	}
 	return nil
@@ -76,11 +76,13 @@ func (m *terminationMiddleware) parseMsg(msg []byte, sender uuid.UUID) (*termina
 	if err := binary.Read(reader, binary.LittleEndian, &tm.decision); err != nil {
 		return nil, fmt.Errorf("unable to read decision from termination message: %v", err)
 	}
+	m.beb.Transcript().RecordInbound("term", sender, map[string]string{"instance": tm.instance.String(), "decision": fmt.Sprint(tm.decision)})
 	return tm, nil
 }
 
 func (m *terminationMiddleware) broadcastDecision(instance uuid.UUID, decision byte) error {
-	termLogger.Debug("broadcasting termination decision", "instance", instance, "decision", decision)
+	m.logger.Debug("broadcasting termination decision", "instance", instance, "decision", decision)
+	m.beb.Transcript().RecordOutbound("term", map[string]string{"instance": instance.String(), "decision": fmt.Sprint(decision)})
 	buf := bytes.NewBuffer([]byte{})
 	writer := bufio.NewWriter(buf)
 	if idBytes, err := instance.MarshalBinary(); err != nil {
@@ -98,6 +100,6 @@ func (m *terminationMiddleware) broadcastDecision(instance uuid.UUID, decision b
 }
 
 func (m *terminationMiddleware) close() {
-	termLogger.Info("signaling close termination middleware")
+	m.logger.Info("signaling close termination middleware")
 	m.closeChan <- struct{}{}
 }
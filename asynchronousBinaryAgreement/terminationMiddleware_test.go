@@ -2,6 +2,7 @@ package asynchronousBinaryAgreement
 
 import (
 	on "bkr-acs/overlayNetwork"
+	"bkr-acs/utils"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"testing"
@@ -13,7 +14,7 @@ func TestMarshalAndUnmarshalTerminationMessage(t *testing.T) {
 	node := on.GetTestNode(t, "localhost:6000", "localhost:6000")
 	bebChannel := on.NewBEBChannel(node, 't')
 	on.InitializeNodes(t, []*on.Node{node})
-	m := newTerminationMiddleware(bebChannel)
+	m := newTerminationMiddleware(bebChannel, utils.DefaultLogger())
 	assert.NoError(t, m.broadcastDecision(abaInstance, decision))
 	tm := <-m.output
 	assert.Equal(t, abaInstance, tm.instance)
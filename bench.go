@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// benchCommand proposes to many ACS instances through the client APIs of a running cluster and reports the throughput and latency.
+// Every daemon proposes to every instance, since BKR only terminates when all correct nodes propose.
+func benchCommand(args []string) error {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	membershipPathname := flags.String("membership", "", "membership file with the client addresses of the nodes")
+	daemonsList := flags.String("daemons", "", "comma separated list of client addresses, used if -membership is empty")
+	numInstances := flags.Int("instances", 100, "number of ACS instances to run")
+	size := flags.Int("size", 32, "size in bytes of each proposal")
+	concurrency := flags.Int("concurrency", 8, "number of instances in flight")
+	prefix := flags.String("prefix", fmt.Sprintf("bench-%d", time.Now().Unix()), "prefix of the instance names")
+	firstSeq := flags.Uint64("sequence", 0, "sequence of the first instance; the following instances use the following sequences")
+	timeout := flags.Duration("timeout", time.Minute, "time to wait for each instance to be decided")
+	_ = flags.Parse(args)
+	daemons, err := benchDaemons(*membershipPathname, *daemonsList)
+	if err != nil {
+		return err
+	}
+	outputs, stop, err := streamOutputs(daemons[0])
+	if err != nil {
+		return fmt.Errorf("unable to stream outputs: %v", err)
+	}
+	defer stop()
+	b := &bench{daemons: daemons, size: *size, waiting: make(map[uuid.UUID]chan struct{})}
+	go b.collect(outputs)
+	names := lo.Map(lo.Range(*numInstances), func(i int, _ int) string { return fmt.Sprintf("%s-%d", *prefix, i) })
+	latencies := make([]time.Duration, 0, len(names))
+	latenciesLock := sync.Mutex{}
+	errs := make([]error, 0)
+	semaphore := make(chan struct{}, max(*concurrency, 1))
+	wg := sync.WaitGroup{}
+	start := time.Now()
+	for i, name := range names {
+		seq := *firstSeq + uint64(i)
+		semaphore <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			latency, err := b.runInstance(name, seq, *timeout)
+			latenciesLock.Lock()
+			defer latenciesLock.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+			} else {
+				latencies = append(latencies, latency)
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	slices.Sort(latencies)
+	fmt.Printf("instances: %d decided, %d failed\n", len(latencies), len(errs))
+	fmt.Printf("elapsed: %v\n", elapsed)
+	fmt.Printf("decisions/s: %.2f\n", float64(len(latencies))/elapsed.Seconds())
+	fmt.Printf("latency p50: %v p99: %v\n", percentile(latencies, 0.50), percentile(latencies, 0.99))
+	if len(errs) > 0 {
+		return fmt.Errorf("%d instances failed, first error: %v", len(errs), errs[0])
+	}
+	return nil
+}
+
+type bench struct {
+	daemons []string
+	size    int
+	lock    sync.Mutex
+	waiting map[uuid.UUID]chan struct{}
+}
+
+func (b *bench) runInstance(name string, seq uint64, timeout time.Duration) (time.Duration, error) {
+	id := parseInstanceId(name, seq)
+	decided := make(chan struct{})
+	b.lock.Lock()
+	b.waiting[id] = decided
+	b.lock.Unlock()
+	start := time.Now()
+	for _, daemon := range b.daemons {
+		proposal := make([]byte, b.size)
+		_, _ = rand.Read(proposal)
+		if err := submitProposal(daemon, name, seq, proposal); err != nil {
+			return 0, fmt.Errorf("unable to propose to %s: %v", daemon, err)
+		}
+	}
+	select {
+	case <-decided:
+		return time.Since(start), nil
+	case <-time.After(timeout):
+		return 0, fmt.Errorf("instance %s was not decided within %v", name, timeout)
+	}
+}
+
+func (b *bench) collect(outputs chan acsDecision) {
+	for decision := range outputs {
+		b.lock.Lock()
+		if decided, ok := b.waiting[decision.Instance]; ok {
+			delete(b.waiting, decision.Instance)
+			close(decided)
+		}
+		b.lock.Unlock()
+	}
+}
+
+func benchDaemons(membershipPathname, daemonsList string) ([]string, error) {
+	if membershipPathname != "" {
+		m, err := loadMembership(membershipPathname)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load membership: %v", err)
+		}
+		daemons := lo.FilterMap(m.Members, func(mem member, _ int) (string, bool) { return mem.Daemon, mem.Daemon != "" })
+		if len(daemons) != len(m.Members) {
+			return nil, fmt.Errorf("every member must have a client address")
+		}
+		return daemons, nil
+	} else if daemonsList != "" {
+		return strings.Split(daemonsList, ","), nil
+	}
+	return nil, fmt.Errorf("either -membership or -daemons is required")
+}
+
+func submitProposal(daemon, instance string, seq uint64, proposal []byte) error {
+	body, err := json.Marshal(proposalRequest{Instance: instance, Sequence: seq, Proposal: proposal})
+	if err != nil {
+		return fmt.Errorf("unable to marshal proposal: %v", err)
+	}
+	resp, err := http.Post(fmt.Sprintf("http://%s/proposals", daemon), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("unable to post proposal: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("client API answered %s", resp.Status)
+	}
+	return nil
+}
+
+// streamOutputs subscribes to the outputs of a daemon and decodes them until stop is called.
+func streamOutputs(daemon string) (chan acsDecision, func(), error) {
+	resp, err := http.Get(fmt.Sprintf("http://%s/outputs", daemon))
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to subscribe: %v", err)
+	} else if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, nil, fmt.Errorf("client API answered %s", resp.Status)
+	}
+	outputs := make(chan acsDecision, subscriberBuffer)
+	go func() {
+		defer close(outputs)
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+		for scanner.Scan() {
+			var decision acsDecision
+			if err := json.Unmarshal(scanner.Bytes(), &decision); err != nil {
+				logger.Warn("unable to decode output", "error", err)
+				continue
+			}
+			outputs <- decision
+		}
+	}()
+	return outputs, func() { resp.Body.Close() }, nil
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[min(int(float64(len(sorted))*p), len(sorted)-1)]
+}
@@ -0,0 +1,239 @@
+package byzantineReliableBroadcast
+
+import (
+	"bkr-acs/utils"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	. "github.com/google/uuid"
+	"log/slog"
+)
+
+// avidProtocol is the erasure-coded broadcast of Cachin and Tessaro.
+// The sender gives each node one fragment of the payload with a Merkle proof, nodes echo only their fragment,
+// and the payload is rebuilt from n-2f fragments, so each node sends O(|m|) bytes instead of O(n·|m|).
+type avidProtocol struct {
+	code *erasureCode
+}
+
+func (p *avidProtocol) broadcast(m *brbMiddleware, seq uint64, tag, msg []byte) error {
+	fragments := p.code.encode(msg)
+	tree := newMerkleTree(fragments)
+	msgs := make([][]byte, len(fragments))
+	for i, fragment := range fragments {
+		msgs[i] = marshalFragment(&fragmentMsg{root: tree.root(), idx: i, proof: tree.proof(i), fragment: fragment})
+	}
+	return m.scatterSend(seq, tag, msgs)
+}
+
+func (p *avidProtocol) newInstance(n, f uint, id UUID, m *brbMiddleware, output chan BRBMsg, done chan struct{}, logger *slog.Logger) *brbInstance {
+	echo, ready := m.makeChannels(id, done)
+	handler := newAvidHandler(n, f, p.code, echo, ready, output, logger)
+	return newInstance(handler, done, handler.logger)
+}
+
+// fragmentMsg is the content of a send message. Echoes carry it prefixed by the id of the sender of the broadcast.
+type fragmentMsg struct {
+	root     [hashSize]byte
+	idx      int
+	proof    [][hashSize]byte
+	fragment []byte
+}
+
+func marshalFragment(m *fragmentMsg) []byte {
+	buf := bytes.NewBuffer(make([]byte, 0, hashSize+3+len(m.proof)*hashSize+len(m.fragment)))
+	buf.Write(m.root[:])
+	_ = binary.Write(buf, binary.BigEndian, uint16(m.idx))
+	buf.WriteByte(byte(len(m.proof)))
+	for _, hash := range m.proof {
+		buf.Write(hash[:])
+	}
+	buf.Write(m.fragment)
+	return buf.Bytes()
+}
+
+func unmarshalFragment(data []byte) (*fragmentMsg, error) {
+	if len(data) < hashSize+3 {
+		return nil, fmt.Errorf("fragment message too short")
+	}
+	m := &fragmentMsg{
+		root: [hashSize]byte(data[:hashSize]),
+		idx:  int(binary.BigEndian.Uint16(data[hashSize:])),
+	}
+	depth := int(data[hashSize+2])
+	data = data[hashSize+3:]
+	if len(data) < depth*hashSize {
+		return nil, fmt.Errorf("fragment message too short for a proof of %d hashes", depth)
+	}
+	m.proof = make([][hashSize]byte, depth)
+	for i := range m.proof {
+		m.proof[i] = [hashSize]byte(data[i*hashSize : (i+1)*hashSize])
+	}
+	m.fragment = data[depth*hashSize:]
+	return m, nil
+}
+
+// avidKey identifies the payload a node echoes or readies: the sender of the broadcast and the root of its fragments.
+type avidKey struct {
+	sender UUID
+	root   [hashSize]byte
+}
+
+func (k avidKey) marshal() []byte {
+	return append(k.sender[:], k.root[:]...)
+}
+
+func unmarshalAvidKey(data []byte) (avidKey, error) {
+	if len(data) < int(idLen)+hashSize {
+		return avidKey{}, fmt.Errorf("message too short for sender and root")
+	}
+	return avidKey{sender: UUID(data[:idLen]), root: [hashSize]byte(data[idLen : int(idLen)+hashSize])}, nil
+}
+
+type avidHandler struct {
+	n            uint
+	f            uint
+	code         *erasureCode
+	echoChan     chan<- []byte
+	readyChan    chan<- []byte
+	outputChan   chan<- BRBMsg
+	echoed       bool
+	readied      bool
+	delivered    bool
+	peersEchoed  map[UUID]bool
+	peersReadied map[UUID]bool
+	fragments    map[avidKey]map[int][]byte
+	readies      map[avidKey]uint
+	logger       *slog.Logger
+}
+
+func newAvidHandler(n, f uint, code *erasureCode, echo, ready chan []byte, output chan BRBMsg, logger *slog.Logger) *avidHandler {
+	return &avidHandler{
+		n:            n,
+		f:            f,
+		code:         code,
+		echoChan:     echo,
+		readyChan:    ready,
+		outputChan:   output,
+		peersEchoed:  make(map[UUID]bool),
+		peersReadied: make(map[UUID]bool),
+		fragments:    make(map[avidKey]map[int][]byte),
+		readies:      make(map[avidKey]uint),
+		logger:       utils.ComponentLogger(logger, "AVID Instance", slog.LevelWarn),
+	}
+}
+
+// handleSend echoes the fragment the sender gave this node, if its proof is valid.
+func (h *avidHandler) handleSend(msg []byte, sender UUID) error {
+	if h.echoed {
+		return nil
+	}
+	fragment, err := unmarshalFragment(msg)
+	if err != nil {
+		return fmt.Errorf("unable to unmarshal fragment: %v", err)
+	} else if err := verifyMerkleProof(fragment.root, int(h.n), fragment.idx, fragment.fragment, fragment.proof); err != nil {
+		return fmt.Errorf("invalid fragment: %v", err)
+	}
+	h.logger.Debug("echoing fragment", "sender", sender, "idx", fragment.idx)
+	h.echoed = true
+	echoMsg := append(sender[:], msg...)
+	go func() { h.echoChan <- echoMsg }()
+	return nil
+}
+
+// handleEcho stores the fragment of a peer. Each fragment index counts once, so that peers cannot echo fragments of others.
+func (h *avidHandler) handleEcho(msg []byte, sender UUID) error {
+	if h.peersEchoed[sender] {
+		return fmt.Errorf("already received echo from peer %s", sender)
+	}
+	key, err := unmarshalAvidKey(msg)
+	if err != nil {
+		return fmt.Errorf("unable to unmarshal echo: %v", err)
+	}
+	fragment, err := unmarshalFragment(msg[idLen:])
+	if err != nil {
+		return fmt.Errorf("unable to unmarshal fragment: %v", err)
+	} else if err := verifyMerkleProof(fragment.root, int(h.n), fragment.idx, fragment.fragment, fragment.proof); err != nil {
+		return fmt.Errorf("invalid fragment from peer %s: %v", sender, err)
+	}
+	h.peersEchoed[sender] = true
+	if h.fragments[key] == nil {
+		h.fragments[key] = make(map[int][]byte)
+	}
+	if _, ok := h.fragments[key][fragment.idx]; ok {
+		h.logger.Debug("ignoring repeated fragment", "sender", sender, "idx", fragment.idx)
+		return nil
+	}
+	h.fragments[key][fragment.idx] = fragment.fragment
+	h.logger.Debug("received fragment", "sender", sender, "idx", fragment.idx, "received", len(h.fragments[key]), "required", h.n-h.f)
+	if uint(len(h.fragments[key])) >= h.n-h.f {
+		h.sendReady(key)
+	}
+	return h.tryDeliver(key)
+}
+
+func (h *avidHandler) handleReady(msg []byte, sender UUID) error {
+	if h.peersReadied[sender] {
+		return fmt.Errorf("already received ready from peer %s", sender)
+	}
+	key, err := unmarshalAvidKey(msg)
+	if err != nil {
+		return fmt.Errorf("unable to unmarshal ready: %v", err)
+	}
+	h.peersReadied[sender] = true
+	h.readies[key]++
+	h.logger.Debug("received ready", "sender", sender, "received", h.readies[key], "required", h.n-h.f)
+	if h.readies[key] >= h.f+1 {
+		h.sendReady(key)
+	}
+	return h.tryDeliver(key)
+}
+
+func (h *avidHandler) sendReady(key avidKey) {
+	if h.readied {
+		return
+	}
+	h.logger.Info("sending ready message", "sender", key.sender)
+	h.readied = true
+	readyMsg := key.marshal()
+	go func() { h.readyChan <- readyMsg }()
+}
+
+// tryDeliver rebuilds the payload once enough nodes are ready and enough fragments were received.
+// The payload is encoded again and checked against the root, so that every correct node rejects a sender whose fragments are inconsistent.
+func (h *avidHandler) tryDeliver(key avidKey) error {
+	if h.delivered || h.readies[key] < h.n-h.f || uint(len(h.fragments[key])) < h.n-2*h.f {
+		return nil
+	}
+	h.delivered = true
+	indices := make([]int, 0, len(h.fragments[key]))
+	fragments := make([][]byte, 0, len(h.fragments[key]))
+	for idx, fragment := range h.fragments[key] {
+		indices = append(indices, idx)
+		fragments = append(fragments, fragment)
+	}
+	payload, err := h.code.decode(indices, fragments)
+	if err != nil {
+		return fmt.Errorf("unable to decode payload: %v", err)
+	} else if root := newMerkleTree(h.code.encode(payload)).root(); root != key.root {
+		return fmt.Errorf("decoded payload does not match the root of the fragments")
+	}
+	h.logger.Info("delivering output message", "issuer", key.sender)
+	h.outputChan <- BRBMsg{Content: payload, Sender: key.sender}
+	return nil
+}
+
+func (h *avidHandler) state(id UUID) BRBInstanceState {
+	phase := uint(1)
+	if h.readied {
+		phase = 3
+	} else if h.echoed {
+		phase = 2
+	}
+	return BRBInstanceState{
+		Id:      id,
+		Phase:   phase,
+		Echoes:  uint(len(h.peersEchoed)),
+		Readies: uint(len(h.peersReadied)),
+	}
+}
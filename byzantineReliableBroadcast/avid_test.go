@@ -0,0 +1,59 @@
+package byzantineReliableBroadcast
+
+import (
+	on "bkr-acs/overlayNetwork"
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestAvidChannelShouldBroadcastToSelf(t *testing.T) {
+	testAvidShouldBroadcastToAll(t, 1, 0, 1, 0, 1024)
+}
+
+func TestAvidChannelShouldBroadcastToAllNoFaults(t *testing.T) {
+	testAvidShouldBroadcastToAll(t, 7, 2, 7, 0, 64*1024)
+}
+
+func TestAvidChannelShouldBroadcastToAllMaxCrash(t *testing.T) {
+	f := uint(2)
+	n := 3*f + 1
+	testAvidShouldBroadcastToAll(t, n, f, n-f, 0, 64*1024)
+}
+
+func TestAvidChannelShouldBroadcastToAllMaxByzantine(t *testing.T) {
+	f := uint(2)
+	n := 3*f + 1
+	testAvidShouldBroadcastToAll(t, n, f, n-f, f, 64*1024)
+}
+
+func TestAvidChannelShouldRejectInvalidParameters(t *testing.T) {
+	node := getNode(t, "localhost:6000")
+	_, err := NewAVIDChannel(3, 2, on.NewBEBChannel(node, 'b'), node.Logger())
+	assert.Error(t, err)
+	assert.NoError(t, node.Close())
+}
+
+func testAvidShouldBroadcastToAll(t *testing.T, n, f, correct, byzantine uint, size int) {
+	addresses := lo.Map(lo.Range(int(n)), func(_ int, i int) string { return fmt.Sprintf("localhost:%d", 6000+i) })
+	nodes := lo.Map(addresses, func(address string, _ int) *on.Node { return getNode(t, address) })
+	channels := lo.Map(nodes[:correct], func(node *on.Node, _ int) *BRBChannel {
+		c, err := NewAVIDChannel(n, f, on.NewBEBChannel(node, 'b'), node.Logger())
+		assert.NoError(t, err)
+		return c
+	})
+	byzChannels := lo.Map(nodes[correct:correct+byzantine], func(node *on.Node, _ int) *byzChannel {
+		return createByzChannel(on.NewBEBChannel(node, 'b'), node.Logger())
+	})
+	on.InitializeNodes(t, nodes)
+	msg := make([]byte, size)
+	_, _ = rand.Read(msg)
+	_, err := channels[0].BRBroadcast(msg)
+	assert.NoError(t, err)
+	outputs := lo.Map(channels, func(c *BRBChannel, _ int) BRBMsg { return <-c.BrbDeliver })
+	assert.True(t, lo.EveryBy(outputs, func(recov BRBMsg) bool { return bytes.Equal(msg, recov.Content) }))
+	teardown(t, channels, byzChannels, nodes)
+}
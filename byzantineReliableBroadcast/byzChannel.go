@@ -2,7 +2,9 @@ package byzantineReliableBroadcast
 
 import (
 	on "bkr-acs/overlayNetwork"
+	"bkr-acs/utils"
 	"github.com/google/uuid"
+	"log/slog"
 )
 
 const byzMsg = "I am byzantine and I hate candy :("
@@ -10,14 +12,17 @@ const byzMsg = "I am byzantine and I hate candy :("
 type byzChannel struct {
 	middleware *brbMiddleware
 	received   map[uuid.UUID]bool
+	watermark  uint64
+	setMark    chan uint64
 	closeChan  chan struct{}
 }
 
-func createByzChannel(beb *on.BEBChannel) *byzChannel {
+func createByzChannel(beb *on.BEBChannel, logger *slog.Logger) *byzChannel {
 	deliverChan := make(chan *msg)
 	byz := &byzChannel{
-		middleware: newBRBMiddleware(beb, deliverChan),
+		middleware: newBRBMiddleware(beb, deliverChan, logger),
 		received:   make(map[uuid.UUID]bool),
+		setMark:    make(chan uint64),
 		closeChan:  make(chan struct{}, 1),
 	}
 	go byz.bebDeliver(deliverChan)
@@ -29,6 +34,8 @@ func (b *byzChannel) bebDeliver(deliverChan <-chan *msg) {
 		select {
 		case msg := <-deliverChan:
 			b.processMsg(msg)
+		case seq := <-b.setMark:
+			b.collect(seq)
 		case <-b.closeChan:
 			return
 		}
@@ -36,7 +43,9 @@ func (b *byzChannel) bebDeliver(deliverChan <-chan *msg) {
 }
 
 func (b *byzChannel) processMsg(msg *msg) {
-	if !b.received[msg.id] {
+	if utils.InstanceSequence(msg.id) < b.watermark {
+		return
+	} else if !b.received[msg.id] {
 		b.received[msg.id] = true
 		b.middleware.broadcastMsg(ready, msg.id, []byte(byzMsg))
 		b.middleware.broadcastMsg(ready, msg.id, []byte(byzMsg))
@@ -45,6 +54,19 @@ func (b *byzChannel) processMsg(msg *msg) {
 	}
 }
 
+func (b *byzChannel) setLowWatermark(seq uint64) {
+	b.setMark <- seq
+}
+
+func (b *byzChannel) collect(seq uint64) {
+	b.watermark = max(b.watermark, seq)
+	for id := range b.received {
+		if utils.InstanceSequence(id) < b.watermark {
+			delete(b.received, id)
+		}
+	}
+}
+
 func (b *byzChannel) close() {
 	b.closeChan <- struct{}{}
 }
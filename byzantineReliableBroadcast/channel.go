@@ -2,15 +2,19 @@ package byzantineReliableBroadcast
 
 import (
 	on "bkr-acs/overlayNetwork"
+	"bkr-acs/transcript"
 	"bkr-acs/utils"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	. "github.com/google/uuid"
 	"log/slog"
 )
 
-var channelLogger = utils.GetLogger("BRB Channel", slog.LevelWarn)
-
+// BRBMsg is the output of an instance: the payload broadcast by its sender, with the id and tag of the instance.
 type BRBMsg struct {
+	Id      UUID
+	Tag     []byte
 	Content []byte
 	Sender  UUID
 }
@@ -18,16 +22,70 @@ type BRBMsg struct {
 type BRBChannel struct {
 	instances     map[UUID]*brbInstance
 	finished      map[UUID]bool
+	outputs       map[UUID]BRBMsg
+	broadcasts    map[UUID]bool
+	handles       map[UUID]*Broadcast
+	subscriptions map[UUID]chan BRBMsg
+	watermark     uint64
+	admission     *utils.Admission
+	fifo          *fifoOrder
+	nextSeq       uint64
 	n             uint
 	f             uint
+	protocol      protocol
 	middleware    *brbMiddleware
 	BrbDeliver    chan BRBMsg
 	commands      chan<- func() error
 	closeCommands chan<- struct{}
 	closeDeliver  chan<- struct{}
+	logger        *slog.Logger
+}
+
+// protocol is the broadcast algorithm run by the instances of a channel.
+type protocol interface {
+	broadcast(m *brbMiddleware, seq uint64, tag, msg []byte) error
+	newInstance(n, f uint, id UUID, m *brbMiddleware, output chan BRBMsg, done chan struct{}, logger *slog.Logger) *brbInstance
+}
+
+// brachaProtocol is the broadcast of Bracha, in which every node echoes the whole payload.
+type brachaProtocol struct{}
+
+func (brachaProtocol) broadcast(m *brbMiddleware, seq uint64, tag, msg []byte) error {
+	return m.broadcastSend(seq, tag, msg)
+}
+
+func (brachaProtocol) newInstance(n, f uint, id UUID, m *brbMiddleware, output chan BRBMsg, done chan struct{}, logger *slog.Logger) *brbInstance {
+	echo, ready := m.makeChannels(id, done)
+	return newBrbInstance(n, f, echo, ready, output, done, logger)
+}
+
+// finishedServer is implemented by the protocols whose peers may still need the payload after this node delivered it.
+// The channel keeps the outputs of finished instances until they are collected when its protocol is one of them.
+type finishedServer interface {
+	serveFinished(m *brbMiddleware, id UUID, output BRBMsg, msg *msg)
+}
+
+func NewBRBChannel(n, f uint, beb *on.BEBChannel, logger *slog.Logger) *BRBChannel {
+	return newBRBChannel(n, f, brachaProtocol{}, beb, logger)
+}
+
+// NewAVIDChannel creates a channel that disperses erasure-coded fragments of each payload instead of echoing it whole.
+// It requires n to be at most 255 and all nodes of the network to use the same kind of channel.
+func NewAVIDChannel(n, f uint, beb *on.BEBChannel, logger *slog.Logger) (*BRBChannel, error) {
+	code, err := newErasureCode(int(n), int(n-2*f))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create erasure code: %v", err)
+	}
+	return newBRBChannel(n, f, &avidProtocol{code: code}, beb, logger), nil
+}
+
+// NewDigestBRBChannel creates a channel running Bracha's broadcast in which echoes and readies carry a digest of the payload.
+// Only the send carries the payload, and nodes that did not receive it fetch it from the peers that echoed its digest.
+func NewDigestBRBChannel(n, f uint, beb *on.BEBChannel, logger *slog.Logger) *BRBChannel {
+	return newBRBChannel(n, f, digestProtocol{}, beb, logger)
 }
 
-func NewBRBChannel(n, f uint, beb *on.BEBChannel) *BRBChannel {
+func newBRBChannel(n, f uint, protocol protocol, beb *on.BEBChannel, logger *slog.Logger) *BRBChannel {
 	commands := make(chan func() error)
 	deliverChan := make(chan *msg)
 	closeCommands := make(chan struct{}, 1)
@@ -35,58 +93,235 @@ func NewBRBChannel(n, f uint, beb *on.BEBChannel) *BRBChannel {
 	channel := &BRBChannel{
 		instances:     make(map[UUID]*brbInstance),
 		finished:      make(map[UUID]bool),
+		outputs:       make(map[UUID]BRBMsg),
+		broadcasts:    make(map[UUID]bool),
+		handles:       make(map[UUID]*Broadcast),
+		subscriptions: make(map[UUID]chan BRBMsg),
+		admission:     utils.NewAdmission(),
 		n:             n,
 		f:             f,
-		middleware:    newBRBMiddleware(beb, deliverChan),
+		protocol:      protocol,
+		middleware:    newBRBMiddleware(beb, deliverChan, logger),
 		BrbDeliver:    make(chan BRBMsg),
 		commands:      commands,
 		closeCommands: closeCommands,
 		closeDeliver:  closeDeliver,
+		logger:        utils.ComponentLogger(logger, "BRB Channel", slog.LevelWarn),
 	}
-	go invoker(commands, closeCommands)
+	go channel.invoker(commands, closeCommands)
 	go channel.bebDeliver(deliverChan, closeDeliver)
-	channelLogger.Info("BRB channel created", "n", n, "f", f)
+	channel.logger.Info("BRB channel created", "n", n, "f", f)
 	return channel
 }
 
-func (c *BRBChannel) BRBroadcast(msg []byte) error {
-	channelLogger.Debug("broadcasting message", "msg", string(msg))
-	return c.middleware.broadcastSend(msg)
+// BRBroadcast broadcasts msg in a new instance and returns the broadcast, which completes once this node delivers it.
+// In FIFO mode the instance takes the sequence following the last one this node broadcast in, and otherwise sequence 0.
+func (c *BRBChannel) BRBroadcast(msg []byte) (*Broadcast, error) {
+	return c.broadcast(nil, nil, msg)
+}
+
+// BRBroadcastWithSequence broadcasts msg in an instance with the given sequence number.
+// The instance is collected once the low watermark of the channel is raised above the sequence.
+func (c *BRBChannel) BRBroadcastWithSequence(seq uint64, msg []byte) (*Broadcast, error) {
+	return c.broadcast(&seq, nil, msg)
+}
+
+// BRBroadcastWithTag broadcasts msg in the instance identified by this node, the sequence and the tag.
+// A tag can only be used once per sequence, and tags cannot be chosen in FIFO mode, where a sequence identifies the instance.
+func (c *BRBChannel) BRBroadcastWithTag(seq uint64, tag, msg []byte) (*Broadcast, error) {
+	if len(tag) == 0 {
+		return nil, fmt.Errorf("unable to broadcast: empty tag")
+	}
+	return c.broadcast(&seq, tag, msg)
+}
+
+func (c *BRBChannel) broadcast(seq *uint64, tag, msg []byte) (*Broadcast, error) {
+	res := make(chan error, 1)
+	var handle *Broadcast
+	c.commands <- func() error {
+		id, chosen, err := c.reserveInstance(seq, tag)
+		if err == nil {
+			tag, handle = chosen, newBroadcast(id)
+			c.handles[id] = handle
+		}
+		res <- err
+		return nil
+	}
+	if err := <-res; err != nil {
+		return nil, fmt.Errorf("unable to broadcast: %v", err)
+	}
+	c.logger.Debug("broadcasting message", "id", handle.Id, "msg", string(msg))
+	if err := c.protocol.broadcast(c.middleware, utils.InstanceSequence(handle.Id), tag, sealPayload(tag, msg)); err != nil {
+		c.commands <- func() error {
+			delete(c.handles, handle.Id)
+			return nil
+		}
+		return nil, fmt.Errorf("unable to broadcast: %v", err)
+	}
+	return handle, nil
+}
+
+// reserveInstance chooses the sequence and tag of a broadcast of this node, and rejects instances it already broadcast in.
+// Without a tag, a random one keeps the instance apart from the other broadcasts of this node with the same sequence.
+func (c *BRBChannel) reserveInstance(seq *uint64, tag []byte) (UUID, []byte, error) {
+	if c.fifo != nil && tag != nil {
+		return Nil, nil, fmt.Errorf("tags cannot be chosen in FIFO mode")
+	}
+	var s uint64
+	if seq != nil {
+		s = *seq
+	} else if c.fifo != nil {
+		s = max(c.nextSeq, c.watermark)
+	}
+	random := c.fifo == nil && tag == nil
+	if random {
+		tag = make([]byte, 16)
+		if _, err := rand.Read(tag); err != nil {
+			return Nil, nil, fmt.Errorf("unable to generate tag: %v", err)
+		}
+	} else if len(tag) > maxTagLen {
+		return Nil, nil, fmt.Errorf("tag of %d bytes exceeds the limit of %d", len(tag), maxTagLen)
+	}
+	self, err := utils.PkToUUID(c.middleware.bebChannel.PublicKey())
+	if err != nil {
+		return Nil, nil, fmt.Errorf("unable to compute own id: %v", err)
+	}
+	id := computeInstanceId(tag, s, self)
+	if random {
+		return id, tag, nil
+	} else if c.broadcasts[id] {
+		return Nil, nil, fmt.Errorf("already broadcast in instance %s", id)
+	}
+	c.broadcasts[id] = true
+	if c.fifo != nil {
+		c.nextSeq = max(c.nextSeq, s+1)
+	}
+	return id, tag, nil
+}
+
+// EnableFIFO delivers the broadcasts of each sender in the order of their sequences, holding back those that follow a gap.
+// Each sequence of a sender identifies a single instance, so that a sender cannot broadcast twice with the same sequence.
+// All nodes must enable it before broadcasting, and the watermark skips the sequences of broadcasts that never delivered.
+func (c *BRBChannel) EnableFIFO() {
+	c.commands <- func() error {
+		if c.fifo == nil {
+			c.fifo = newFIFOOrder(c.watermark, c.logger)
+		}
+		return nil
+	}
+}
+
+// SetLowWatermark drops the state of the instances with a sequence below seq, and ignores their messages from then on.
+// Instances that have not delivered are abandoned, so the watermark should only be raised past instances that are no longer needed.
+func (c *BRBChannel) SetLowWatermark(seq uint64) {
+	c.commands <- func() error {
+		if seq <= c.watermark {
+			return nil
+		}
+		c.logger.Debug("raising low watermark", "from", c.watermark, "to", seq)
+		c.watermark = seq
+		c.admission.Collect(seq)
+		for id := range c.broadcasts {
+			if c.isCollected(id) {
+				delete(c.broadcasts, id)
+			}
+		}
+		c.collectDeliveries()
+		if c.fifo != nil {
+			c.deliver(c.fifo.collect(seq))
+		}
+		for id := range c.finished {
+			if c.isCollected(id) {
+				delete(c.finished, id)
+				delete(c.outputs, id)
+			}
+		}
+		for id, instance := range c.instances {
+			if c.isCollected(id) {
+				delete(c.instances, id)
+				go instance.close()
+			}
+		}
+		return nil
+	}
+}
+
+// SetAdmissionPolicy limits the instances that peers can create in this channel.
+// Messages of instances that are not admitted are dropped, so the limits must leave room for the instances correct peers run concurrently.
+func (c *BRBChannel) SetAdmissionPolicy(policy utils.AdmissionPolicy) {
+	c.commands <- func() error {
+		c.admission.SetPolicy(policy)
+		return nil
+	}
+}
+
+func (c *BRBChannel) isCollected(id UUID) bool {
+	return utils.InstanceSequence(id) < c.watermark
 }
 
 func (c *BRBChannel) processMsg(msg *msg) error {
 	id := msg.id
-	if c.finished[id] {
-		channelLogger.Debug("received message from finished instance", "id", id)
+	if c.isCollected(id) {
+		c.logger.Debug("received message from collected instance", "id", id)
+		return nil
+	} else if c.finished[id] {
+		c.logger.Debug("received message from finished instance", "id", id)
+		if server, ok := c.protocol.(finishedServer); ok {
+			server.serveFinished(c.middleware, id, c.outputs[id], msg)
+		}
+		return nil
+	}
+	if c.fifo != nil && msg.kind == send && len(msg.tag) > 0 {
+		c.logger.Warn("rejecting tagged send in FIFO mode", "id", id, "from", msg.sender)
 		return nil
 	}
 	instance, ok := c.instances[id]
 	if !ok {
+		if !c.admission.Admit(id, msg.sender, c.watermark) {
+			c.logger.Debug("rejected message from unadmitted instance", "id", id, "from", msg.sender)
+			return nil
+		}
 		instance = c.createInstance(msg.id)
 	}
 	switch msg.kind {
 	case send:
-		channelLogger.Debug("processing send message", "id", id, "from", msg.sender, "content", string(msg.content))
+		c.logger.Debug("processing send message", "id", id, "from", msg.sender, "content", string(msg.content))
 		go func() {
 			err := instance.send(msg.content, msg.sender)
 			if err != nil {
-				channelLogger.Warn("unable to process send message", "id", id, "err", err)
+				c.logger.Warn("unable to process send message", "id", id, "err", err)
 			}
 		}()
 	case echo:
-		channelLogger.Debug("processing echo message", "id", id, "from", msg.sender, "content", string(msg.content))
+		c.logger.Debug("processing echo message", "id", id, "from", msg.sender, "content", string(msg.content))
 		go func() {
 			err := instance.echo(msg.content, msg.sender)
 			if err != nil {
-				channelLogger.Warn("unable to process echo message", "id", id, "err", err)
+				c.logger.Warn("unable to process echo message", "id", id, "err", err)
 			}
 		}()
 	case ready:
-		channelLogger.Debug("processing ready message", "id", id, "from", msg.sender, "content", string(msg.content))
+		c.logger.Debug("processing ready message", "id", id, "from", msg.sender, "content", string(msg.content))
 		go func() {
 			err := instance.ready(msg.content, msg.sender)
 			if err != nil {
-				channelLogger.Warn("unable to process ready message", "id", id, "err", err)
+				c.logger.Warn("unable to process ready message", "id", id, "err", err)
+			}
+		}()
+	case request:
+		c.logger.Debug("processing request message", "id", id, "from", msg.sender)
+		go func() {
+			err := instance.request(msg.content, msg.sender)
+			if err != nil {
+				c.logger.Warn("unable to process request message", "id", id, "err", err)
+			}
+		}()
+	case reply:
+		c.logger.Debug("processing reply message", "id", id, "from", msg.sender)
+		go func() {
+			err := instance.reply(msg.content, msg.sender)
+			if err != nil {
+				c.logger.Warn("unable to process reply message", "id", id, "err", err)
 			}
 		}()
 	default:
@@ -96,30 +331,54 @@ func (c *BRBChannel) processMsg(msg *msg) error {
 }
 
 func (c *BRBChannel) createInstance(id UUID) *brbInstance {
-	echoChan, readyChan := c.middleware.makeChannels(id)
 	outputChan := make(chan BRBMsg)
-	instance := newBrbInstance(c.n, c.f, echoChan, readyChan, outputChan)
+	done := make(chan struct{})
+	instance := c.protocol.newInstance(c.n, c.f, id, c.middleware, outputChan, done, c.logger)
 	c.instances[id] = instance
-	go c.processOutput(outputChan, id)
+	go c.processOutput(outputChan, done, id)
 	return instance
 }
 
-func (c *BRBChannel) processOutput(outputChan <-chan BRBMsg, id UUID) {
-	output := <-outputChan
-	channelLogger.Debug("delivering output message", "id", id)
+func (c *BRBChannel) processOutput(outputChan <-chan BRBMsg, done <-chan struct{}, id UUID) {
+	var output BRBMsg
+	select {
+	case output = <-outputChan:
+	case <-done:
+		c.logger.Debug("instance collected before delivering", "id", id)
+		return
+	}
 	c.commands <- func() error {
-		go func() { c.BrbDeliver <- output }()
+		if opened, err := openPayload(id, output); err != nil {
+			c.logger.Warn("discarding output message", "id", id, "sender", output.Sender, "error", err)
+		} else {
+			c.logger.Debug("delivering output message", "id", id)
+			c.Transcript().RecordDecision("brb", map[string]string{"instance": id.String(), "sender": opened.Sender.String(), "content": hex.EncodeToString(opened.Content)})
+			if c.fifo != nil {
+				c.deliver(c.fifo.add(utils.InstanceSequence(id), opened))
+			} else {
+				c.deliver([]BRBMsg{opened})
+			}
+		}
 		instance, ok := c.instances[id]
 		if !ok {
 			return fmt.Errorf("channel handler %s not found upon delivery", id)
 		}
 		c.finished[id] = true
+		if _, ok := c.protocol.(finishedServer); ok {
+			c.outputs[id] = output
+		}
+		c.admission.Release(id)
 		delete(c.instances, id)
 		go instance.close()
 		return nil
 	}
 }
 
+// Transcript returns the recorder of the node this channel runs on.
+func (c *BRBChannel) Transcript() *transcript.Recorder {
+	return c.middleware.bebChannel.Transcript()
+}
+
 func (c *BRBChannel) Close() {
 	c.closeCommands <- struct{}{}
 	c.closeDeliver <- struct{}{}
@@ -133,21 +392,21 @@ func (c *BRBChannel) bebDeliver(deliverChan <-chan *msg, closeDeliver <-chan str
 				return c.processMsg(deliver)
 			}
 		case <-closeDeliver:
-			channelLogger.Info("closing deliver executor")
+			c.logger.Info("closing deliver executor")
 			return
 		}
 	}
 }
 
-func invoker(commands <-chan func() error, closeCommands <-chan struct{}) {
+func (c *BRBChannel) invoker(commands <-chan func() error, closeCommands <-chan struct{}) {
 	for {
 		select {
 		case cmd := <-commands:
 			if err := cmd(); err != nil {
-				channelLogger.Error("error executing command", "error", err)
+				c.logger.Error("error executing command", "error", err)
 			}
 		case <-closeCommands:
-			channelLogger.Info("closing executor")
+			c.logger.Info("closing executor")
 			return
 		}
 	}
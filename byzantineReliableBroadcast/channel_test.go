@@ -2,26 +2,43 @@ package byzantineReliableBroadcast
 
 import (
 	on "bkr-acs/overlayNetwork"
+	"bkr-acs/utils"
 	"bytes"
 	"fmt"
 	"github.com/samber/lo"
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func TestChannelShouldBroadcastToSelf(t *testing.T) {
 	node := getNode(t, "localhost:6000")
 	beb := on.NewBEBChannel(node, 'b')
-	c := NewBRBChannel(1, 0, beb)
+	c := NewBRBChannel(1, 0, beb, node.Logger())
 	on.InitializeNodes(t, []*on.Node{node})
 	msg := []byte("hello")
-	assert.NoError(t, c.BRBroadcast(msg))
+	_, err := c.BRBroadcast(msg)
+	assert.NoError(t, err)
 	recov := <-c.BrbDeliver
 	assert.Equal(t, msg, recov.Content)
 	assert.NoError(t, node.Close())
 	c.Close()
 }
 
+func TestChannelStateShouldReportFinishedInstances(t *testing.T) {
+	node := getNode(t, "localhost:6000")
+	beb := on.NewBEBChannel(node, 'b')
+	c := NewBRBChannel(1, 0, beb, node.Logger())
+	on.InitializeNodes(t, []*on.Node{node})
+	_, err := c.BRBroadcast([]byte("hello"))
+	assert.NoError(t, err)
+	<-c.BrbDeliver
+	assert.Eventually(t, func() bool { return len(c.State().Finished) == 1 }, time.Second, 10*time.Millisecond)
+	assert.Empty(t, c.State().Live)
+	assert.NoError(t, node.Close())
+	c.Close()
+}
+
 func TestChannelShouldBroadcastToAllNoFaults(t *testing.T) {
 	n := uint(10)
 	testShouldBroadcastToAll(t, n, 0, n, 0)
@@ -53,11 +70,12 @@ func testShouldBroadcastToAll(t *testing.T, n, f, correct, byzantine uint) {
 	})
 	byzChannels := lo.Map(nodes[correct:correct+byzantine], func(node *on.Node, _ int) *byzChannel {
 		beb := on.NewBEBChannel(node, 'b')
-		return createByzChannel(beb)
+		return createByzChannel(beb, node.Logger())
 	})
 	on.InitializeNodes(t, nodes)
 	msg := []byte("hello")
-	assert.NoError(t, channels[0].BRBroadcast(msg))
+	_, err := channels[0].BRBroadcast(msg)
+	assert.NoError(t, err)
 	outputs := lo.Map(channels, func(c *BRBChannel, _ int) BRBMsg { return <-c.BrbDeliver })
 	assert.True(t, lo.EveryBy(outputs, func(recov BRBMsg) bool { return bytes.Equal(msg, recov.Content) }))
 	teardown(t, channels, byzChannels, nodes)
@@ -69,7 +87,7 @@ func getNode(t *testing.T, address string) *on.Node {
 
 func getChannel(n, f uint, node *on.Node) *BRBChannel {
 	beb := on.NewBEBChannel(node, 'b')
-	return NewBRBChannel(n, f, beb)
+	return NewBRBChannel(n, f, beb, node.Logger())
 }
 
 func teardown(t *testing.T, channels []*BRBChannel, byzChannels []*byzChannel, nodes []*on.Node) {
@@ -81,3 +99,129 @@ func teardown(t *testing.T, channels []*BRBChannel, byzChannels []*byzChannel, n
 	}
 	assert.True(t, lo.EveryBy(nodes, func(node *on.Node) bool { return node.Close() == nil }))
 }
+
+func TestChannelShouldCollectInstancesBelowWatermark(t *testing.T) {
+	node := getNode(t, "localhost:6000")
+	beb := on.NewBEBChannel(node, 'b')
+	c := NewBRBChannel(1, 0, beb, node.Logger())
+	on.InitializeNodes(t, []*on.Node{node})
+	_, err := c.BRBroadcastWithSequence(1, []byte("old"))
+	assert.NoError(t, err)
+	<-c.BrbDeliver
+	assert.Eventually(t, func() bool { return len(c.State().Finished) == 1 }, time.Second, 10*time.Millisecond)
+	c.SetLowWatermark(2)
+	assert.Eventually(t, func() bool { return len(c.State().Finished) == 0 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, uint64(2), c.State().Watermark)
+	_, err = c.BRBroadcastWithSequence(1, []byte("late"))
+	assert.NoError(t, err)
+	_, err = c.BRBroadcastWithSequence(2, []byte("new"))
+	assert.NoError(t, err)
+	recov := <-c.BrbDeliver
+	assert.Equal(t, []byte("new"), recov.Content)
+	assert.NoError(t, node.Close())
+	c.Close()
+}
+
+func TestChannelShouldRejectInstancesOutsideAdmissionWindow(t *testing.T) {
+	node := getNode(t, "localhost:6000")
+	beb := on.NewBEBChannel(node, 'b')
+	c := NewBRBChannel(1, 0, beb, node.Logger())
+	c.SetAdmissionPolicy(utils.AdmissionPolicy{Window: 10})
+	on.InitializeNodes(t, []*on.Node{node})
+	_, err := c.BRBroadcastWithSequence(10, []byte("far"))
+	assert.NoError(t, err)
+	_, err = c.BRBroadcastWithSequence(9, []byte("near"))
+	assert.NoError(t, err)
+	recov := <-c.BrbDeliver
+	assert.Equal(t, []byte("near"), recov.Content)
+	assert.Equal(t, uint64(1), c.State().Admission.RejectedByWindow)
+	assert.NoError(t, node.Close())
+	c.Close()
+}
+
+func TestChannelShouldReturnIdOfTaggedBroadcast(t *testing.T) {
+	node := getNode(t, "localhost:6000")
+	beb := on.NewBEBChannel(node, 'b')
+	c := NewBRBChannel(1, 0, beb, node.Logger())
+	on.InitializeNodes(t, []*on.Node{node})
+	tag := []byte("tag")
+	broadcast, err := c.BRBroadcastWithTag(3, tag, []byte("hello"))
+	assert.NoError(t, err)
+	self, err := node.GetId()
+	assert.NoError(t, err)
+	assert.Equal(t, computeInstanceId(tag, 3, self), broadcast.Id)
+	assert.Equal(t, uint64(3), utils.InstanceSequence(broadcast.Id))
+	recov := <-c.BrbDeliver
+	assert.Equal(t, BRBMsg{Id: broadcast.Id, Tag: tag, Content: []byte("hello"), Sender: self}, recov)
+	<-broadcast.Done()
+	assert.NoError(t, broadcast.Err())
+	_, err = c.BRBroadcastWithTag(3, tag, []byte("again"))
+	assert.Error(t, err)
+	assert.NoError(t, node.Close())
+	c.Close()
+}
+
+func TestChannelShouldDeliverInSenderOrderInFIFOMode(t *testing.T) {
+	node := getNode(t, "localhost:6000")
+	beb := on.NewBEBChannel(node, 'b')
+	c := NewBRBChannel(1, 0, beb, node.Logger())
+	c.EnableFIFO()
+	on.InitializeNodes(t, []*on.Node{node})
+	_, err := c.BRBroadcastWithSequence(1, []byte("second"))
+	assert.NoError(t, err)
+	_, err = c.BRBroadcastWithSequence(1, []byte("fork"))
+	assert.Error(t, err)
+	_, err = c.BRBroadcastWithTag(0, []byte("tag"), []byte("tagged"))
+	assert.Error(t, err)
+	_, err = c.BRBroadcastWithSequence(0, []byte("first"))
+	assert.NoError(t, err)
+	broadcast, err := c.BRBroadcast([]byte("third"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), utils.InstanceSequence(broadcast.Id))
+	outputs := []BRBMsg{<-c.BrbDeliver, <-c.BrbDeliver, <-c.BrbDeliver}
+	assert.Equal(t, []string{"first", "second", "third"}, contents(outputs))
+	assert.NoError(t, node.Close())
+	c.Close()
+}
+
+func TestChannelShouldDeliverToSubscriber(t *testing.T) {
+	node := getNode(t, "localhost:6000")
+	beb := on.NewBEBChannel(node, 'b')
+	c := NewBRBChannel(1, 0, beb, node.Logger())
+	on.InitializeNodes(t, []*on.Node{node})
+	self, err := node.GetId()
+	assert.NoError(t, err)
+	tag := []byte("subscribed")
+	id := computeInstanceId(tag, 0, self)
+	sub, err := c.Subscribe(id)
+	assert.NoError(t, err)
+	_, err = c.BRBroadcastWithTag(0, tag, []byte("hello"))
+	assert.NoError(t, err)
+	recov := <-sub
+	assert.Equal(t, []byte("hello"), recov.Content)
+	assert.Equal(t, id, recov.Id)
+	assert.Eventually(t, func() bool { return len(c.State().Finished) == 1 }, time.Second, 10*time.Millisecond)
+	_, err = c.Subscribe(id)
+	assert.Error(t, err)
+	select {
+	case <-c.BrbDeliver:
+		t.Fatal("subscribed delivery reached BrbDeliver")
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.NoError(t, node.Close())
+	c.Close()
+}
+
+func TestChannelShouldFailBroadcastCollectedBeforeDelivering(t *testing.T) {
+	node := getNode(t, "localhost:6000")
+	beb := on.NewBEBChannel(node, 'b')
+	c := NewBRBChannel(4, 1, beb, node.Logger())
+	on.InitializeNodes(t, []*on.Node{node})
+	broadcast, err := c.BRBroadcastWithSequence(1, []byte("hello"))
+	assert.NoError(t, err)
+	c.SetLowWatermark(2)
+	<-broadcast.Done()
+	assert.Error(t, broadcast.Err())
+	assert.NoError(t, node.Close())
+	c.Close()
+}
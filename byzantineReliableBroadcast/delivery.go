@@ -0,0 +1,135 @@
+package byzantineReliableBroadcast
+
+import (
+	"bkr-acs/utils"
+	"encoding/binary"
+	"fmt"
+	. "github.com/google/uuid"
+)
+
+// Broadcast is a broadcast of this node, which completes once this node delivers it.
+type Broadcast struct {
+	Id   UUID
+	done chan struct{}
+	err  error
+}
+
+func newBroadcast(id UUID) *Broadcast {
+	return &Broadcast{Id: id, done: make(chan struct{})}
+}
+
+// Done is closed once the broadcast was delivered by this node or will no longer be.
+func (b *Broadcast) Done() <-chan struct{} {
+	return b.done
+}
+
+// Err explains why the broadcast will not be delivered, and is nil if it was. It must only be called once Done is closed.
+func (b *Broadcast) Err() error {
+	return b.err
+}
+
+func (b *Broadcast) complete(err error) {
+	b.err = err
+	close(b.done)
+}
+
+// sealPayload prefixes the payload of a broadcast with its tag, so that every node that delivers it learns the tag,
+// even if it never received the send message.
+func sealPayload(tag, msg []byte) []byte {
+	sealed := binary.LittleEndian.AppendUint16(make([]byte, 0, 2+len(tag)+len(msg)), uint16(len(tag)))
+	return append(append(sealed, tag...), msg...)
+}
+
+// openPayload recovers the tag and content of the output of an instance, and checks that the tag is the one the id was computed from.
+// The check depends only on the output, so all correct nodes accept or reject the same outputs.
+func openPayload(id UUID, output BRBMsg) (BRBMsg, error) {
+	if len(output.Content) < 2 {
+		return BRBMsg{}, fmt.Errorf("payload too short for a tag")
+	}
+	tagLen := int(binary.LittleEndian.Uint16(output.Content))
+	if len(output.Content) < 2+tagLen {
+		return BRBMsg{}, fmt.Errorf("payload too short for a tag of %d bytes", tagLen)
+	}
+	tag := output.Content[2 : 2+tagLen]
+	if expected := computeInstanceId(tag, utils.InstanceSequence(id), output.Sender); expected != id {
+		return BRBMsg{}, fmt.Errorf("tag of the payload does not match instance %s", id)
+	}
+	return BRBMsg{Id: id, Tag: tag, Content: output.Content[2+tagLen:], Sender: output.Sender}, nil
+}
+
+// Subscribe returns a channel that receives the delivery of the instance with the given id instead of BrbDeliver.
+// The id of a broadcast of another node is computed with InstanceId from the sequence and tag it broadcasts with.
+// It fails if the instance already delivered, and the channel is closed if the instance is collected before delivering.
+func (c *BRBChannel) Subscribe(id UUID) (<-chan BRBMsg, error) {
+	res := make(chan error, 1)
+	sub := make(chan BRBMsg, 1)
+	c.commands <- func() error {
+		if c.isCollected(id) {
+			res <- fmt.Errorf("instance %s is below the low watermark", id)
+		} else if c.finished[id] {
+			res <- fmt.Errorf("instance %s already delivered", id)
+		} else if _, ok := c.subscriptions[id]; ok {
+			res <- fmt.Errorf("instance %s already has a subscriber", id)
+		} else {
+			c.subscriptions[id] = sub
+			res <- nil
+		}
+		return nil
+	}
+	if err := <-res; err != nil {
+		return nil, fmt.Errorf("unable to subscribe: %v", err)
+	}
+	return sub, nil
+}
+
+// deliver hands outputs over to their subscribers or to BrbDeliver, and completes the broadcasts of this node among them.
+// In FIFO mode the outputs reach BrbDeliver in order, after the outputs of previous calls.
+func (c *BRBChannel) deliver(outputs []BRBMsg) {
+	unsubscribed := make([]BRBMsg, 0, len(outputs))
+	for _, output := range outputs {
+		if handle, ok := c.handles[output.Id]; ok {
+			delete(c.handles, output.Id)
+			handle.complete(nil)
+		}
+		if sub, ok := c.subscriptions[output.Id]; ok {
+			delete(c.subscriptions, output.Id)
+			sub <- output
+			close(sub)
+		} else {
+			unsubscribed = append(unsubscribed, output)
+		}
+	}
+	if len(unsubscribed) == 0 {
+		return
+	} else if c.fifo == nil {
+		for _, output := range unsubscribed {
+			go func() { c.BrbDeliver <- output }()
+		}
+		return
+	}
+	previous, done := c.fifo.last, make(chan struct{})
+	c.fifo.last = done
+	go func() {
+		<-previous
+		for _, output := range unsubscribed {
+			c.BrbDeliver <- output
+		}
+		close(done)
+	}()
+}
+
+// collectDeliveries ends the broadcasts and subscriptions of the instances below the watermark.
+func (c *BRBChannel) collectDeliveries() {
+	for id, handle := range c.handles {
+		if c.isCollected(id) {
+			delete(c.handles, id)
+			handle.complete(fmt.Errorf("instance %s collected before delivering", id))
+		}
+	}
+	for id, sub := range c.subscriptions {
+		if c.isCollected(id) {
+			delete(c.subscriptions, id)
+			close(sub)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package byzantineReliableBroadcast
+
+import (
+	"crypto/sha256"
+	"fmt"
+	. "github.com/google/uuid"
+	"log/slog"
+)
+
+// digestProtocol is Bracha's broadcast in which only the send carries the payload, while echoes and readies carry its digest.
+// A node that gathers enough readies for a digest whose payload it does not hold fetches it from the peers that echoed the digest.
+type digestProtocol struct{}
+
+func (digestProtocol) broadcast(m *brbMiddleware, seq uint64, tag, msg []byte) error {
+	return m.broadcastSend(seq, tag, msg)
+}
+
+// serveFinished answers the requests of peers that still need the payload of an instance this node delivered.
+func (digestProtocol) serveFinished(m *brbMiddleware, id UUID, output BRBMsg, msg *msg) {
+	if msg.kind != request || string(msg.content) != string(digestMsg(output.Sender, output.Content)) {
+		return
+	}
+	go m.unicastMsg(reply, id, msg.sender, append(output.Sender[:], output.Content...))
+}
+
+func (digestProtocol) newInstance(n, f uint, id UUID, m *brbMiddleware, output chan BRBMsg, done chan struct{}, logger *slog.Logger) *brbInstance {
+	echo, ready := m.makeChannels(id, done)
+	handler := newDigestHandler(n, f, echo, ready, m.makeUnicastChannel(id, done), output, logger)
+	return newInstance(handler, done, handler.bracha.logger)
+}
+
+// payloadServer is implemented by the handlers whose peers may fetch the payload from them.
+type payloadServer interface {
+	handleRequest(msg []byte, sender UUID) error
+	handleReply(msg []byte, sender UUID) error
+}
+
+// digestMsg computes the content of the echoes and readies of a payload: the id of its sender followed by the digest of both.
+func digestMsg(sender UUID, payload []byte) []byte {
+	digest := sha256.Sum256(append(sender[:], payload...))
+	return append(sender[:], digest[:]...)
+}
+
+// digestHandler runs Bracha's phases on digests, and holds the payload or fetches it to deliver.
+type digestHandler struct {
+	bracha     *brbHandler
+	quorum     chan BRBMsg
+	unicast    chan<- unicast
+	outputChan chan<- BRBMsg
+	payloads   map[string][]byte
+	echoers    map[string][]UUID
+	requesters map[string][]UUID
+	wanted     []byte
+	delivered  bool
+}
+
+func newDigestHandler(n, f uint, echo, ready chan []byte, unicastChan chan<- unicast, output chan BRBMsg, logger *slog.Logger) *digestHandler {
+	quorum := make(chan BRBMsg, 1)
+	return &digestHandler{
+		bracha:     newBrbHandler(n, f, echo, ready, quorum, logger),
+		quorum:     quorum,
+		unicast:    unicastChan,
+		outputChan: output,
+		payloads:   make(map[string][]byte),
+		echoers:    make(map[string][]UUID),
+		requesters: make(map[string][]UUID),
+	}
+}
+
+// handleSend keeps the payload and has Bracha's phases echo its digest.
+func (h *digestHandler) handleSend(msg []byte, sender UUID) error {
+	content := digestMsg(sender, msg)
+	if _, ok := h.payloads[string(content)]; !ok {
+		h.store(string(content), sender, msg)
+	}
+	if err := h.bracha.handleSend(content[idLen:], sender); err != nil {
+		return err
+	}
+	return h.afterPhase()
+}
+
+func (h *digestHandler) handleEcho(msg []byte, sender UUID) error {
+	if len(msg) != int(idLen)+sha256.Size {
+		return fmt.Errorf("echo from peer %s does not hold a digest", sender)
+	} else if err := h.bracha.handleEcho(msg, sender); err != nil {
+		return err
+	}
+	h.echoers[string(msg)] = append(h.echoers[string(msg)], sender)
+	if h.wanted != nil && string(h.wanted) == string(msg) {
+		h.request(sender)
+	}
+	return h.afterPhase()
+}
+
+func (h *digestHandler) handleReady(msg []byte, sender UUID) error {
+	if len(msg) != int(idLen)+sha256.Size {
+		return fmt.Errorf("ready from peer %s does not hold a digest", sender)
+	} else if err := h.bracha.handleReady(msg, sender); err != nil {
+		return err
+	}
+	return h.afterPhase()
+}
+
+// afterPhase delivers once Bracha's phases output a digest, or fetches its payload from the echoers if it is missing.
+func (h *digestHandler) afterPhase() error {
+	select {
+	case out := <-h.quorum:
+		content := append(out.Sender[:], out.Content...)
+		if payload, ok := h.payloads[string(content)]; ok {
+			h.deliver(out.Sender, payload)
+			return nil
+		}
+		h.bracha.logger.Info("fetching payload from echoers", "issuer", out.Sender, "echoers", len(h.echoers[string(content)]))
+		h.wanted = content
+		for _, echoer := range h.echoers[string(content)] {
+			h.request(echoer)
+		}
+	default:
+	}
+	return nil
+}
+
+func (h *digestHandler) request(peer UUID) {
+	content := h.wanted
+	go func() { h.unicast <- unicast{kind: request, to: peer, content: content} }()
+}
+
+// handleRequest replies with the payload of the requested digest, or once it is known if this node does not hold it yet.
+func (h *digestHandler) handleRequest(msg []byte, sender UUID) error {
+	if len(msg) != int(idLen)+sha256.Size {
+		return fmt.Errorf("request from peer %s does not hold a digest", sender)
+	} else if payload, ok := h.payloads[string(msg)]; ok {
+		h.reply(sender, UUID(msg[:idLen]), payload)
+	} else {
+		h.requesters[string(msg)] = append(h.requesters[string(msg)], sender)
+	}
+	return nil
+}
+
+// handleReply accepts any payload that matches a digest this node needs or was asked for.
+func (h *digestHandler) handleReply(msg []byte, sender UUID) error {
+	if len(msg) < int(idLen) {
+		return fmt.Errorf("reply from peer %s is too short", sender)
+	}
+	issuer, payload := UUID(msg[:idLen]), msg[idLen:]
+	content := string(digestMsg(issuer, payload))
+	if _, ok := h.payloads[content]; ok {
+		return nil
+	} else if content != string(h.wanted) && h.requesters[content] == nil {
+		return fmt.Errorf("reply from peer %s does not match a requested digest", sender)
+	}
+	h.store(content, issuer, payload)
+	return nil
+}
+
+// store keeps the payload of a digest, sends it to the peers that requested it, and delivers it if this node was fetching it.
+func (h *digestHandler) store(content string, issuer UUID, payload []byte) {
+	h.payloads[content] = payload
+	for _, requester := range h.requesters[content] {
+		h.reply(requester, issuer, payload)
+	}
+	delete(h.requesters, content)
+	if content == string(h.wanted) {
+		h.deliver(issuer, payload)
+	}
+}
+
+func (h *digestHandler) reply(peer, issuer UUID, payload []byte) {
+	content := append(issuer[:], payload...)
+	go func() { h.unicast <- unicast{kind: reply, to: peer, content: content} }()
+}
+
+func (h *digestHandler) deliver(issuer UUID, payload []byte) {
+	if h.delivered {
+		return
+	}
+	h.delivered = true
+	h.bracha.logger.Info("delivering output message", "issuer", issuer)
+	h.outputChan <- BRBMsg{Content: payload, Sender: issuer}
+}
+
+func (h *digestHandler) state(id UUID) BRBInstanceState {
+	return h.bracha.state(id)
+}
@@ -0,0 +1,68 @@
+package byzantineReliableBroadcast
+
+import (
+	on "bkr-acs/overlayNetwork"
+	"bkr-acs/utils"
+	"bytes"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDigestChannelShouldBroadcastToAllNoFaults(t *testing.T) {
+	testDigestShouldBroadcastToAll(t, 4, 1, 4, 0)
+}
+
+func TestDigestChannelShouldBroadcastToAllMaxByzantine(t *testing.T) {
+	f := uint(2)
+	n := 3*f + 1
+	testDigestShouldBroadcastToAll(t, n, f, n-f, f)
+}
+
+func TestDigestHandlerShouldFetchMissingPayload(t *testing.T) {
+	echoChan, readyChan, unicastChan := make(chan []byte, 1), make(chan []byte, 1), make(chan unicast, 1)
+	outputChan := make(chan BRBMsg, 1)
+	h := newDigestHandler(4, 1, echoChan, readyChan, unicastChan, outputChan, utils.DefaultLogger())
+	issuer, payload := uuid.New(), []byte("hello")
+	content := digestMsg(issuer, payload)
+	peers := lo.Map(lo.Range(3), func(_ int, _ int) uuid.UUID { return uuid.New() })
+	assert.NoError(t, h.handleEcho(content, peers[0]))
+	for _, peer := range peers {
+		assert.NoError(t, h.handleReady(content, peer))
+	}
+	req := <-unicastChan
+	assert.Equal(t, unicast{kind: request, to: peers[0], content: content}, req)
+	assert.Error(t, h.handleReply(append(issuer[:], []byte("forged")...), peers[0]))
+	assert.NoError(t, h.handleReply(append(issuer[:], payload...), peers[0]))
+	assert.Equal(t, BRBMsg{Content: payload, Sender: issuer}, <-outputChan)
+}
+
+func TestDigestHandlerShouldAnswerRequestOnceItHoldsPayload(t *testing.T) {
+	unicastChan := make(chan unicast, 1)
+	h := newDigestHandler(4, 1, make(chan []byte, 1), make(chan []byte, 1), unicastChan, make(chan BRBMsg, 1), utils.DefaultLogger())
+	issuer, requester, payload := uuid.New(), uuid.New(), []byte("hello")
+	assert.NoError(t, h.handleRequest(digestMsg(issuer, payload), requester))
+	assert.NoError(t, h.handleSend(payload, issuer))
+	rep := <-unicastChan
+	assert.Equal(t, unicast{kind: reply, to: requester, content: append(issuer[:], payload...)}, rep)
+}
+
+func testDigestShouldBroadcastToAll(t *testing.T, n, f, correct, byzantine uint) {
+	addresses := lo.Map(lo.Range(int(n)), func(_ int, i int) string { return fmt.Sprintf("localhost:%d", 6000+i) })
+	nodes := lo.Map(addresses, func(address string, _ int) *on.Node { return getNode(t, address) })
+	channels := lo.Map(nodes[:correct], func(node *on.Node, _ int) *BRBChannel {
+		return NewDigestBRBChannel(n, f, on.NewBEBChannel(node, 'b'), node.Logger())
+	})
+	byzChannels := lo.Map(nodes[correct:correct+byzantine], func(node *on.Node, _ int) *byzChannel {
+		return createByzChannel(on.NewBEBChannel(node, 'b'), node.Logger())
+	})
+	on.InitializeNodes(t, nodes)
+	msg := []byte("hello")
+	_, err := channels[0].BRBroadcast(msg)
+	assert.NoError(t, err)
+	outputs := lo.Map(channels, func(c *BRBChannel, _ int) BRBMsg { return <-c.BrbDeliver })
+	assert.True(t, lo.EveryBy(outputs, func(recov BRBMsg) bool { return bytes.Equal(msg, recov.Content) }))
+	teardown(t, channels, byzChannels, nodes)
+}
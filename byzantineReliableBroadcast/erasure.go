@@ -0,0 +1,149 @@
+package byzantineReliableBroadcast
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// gfExp and gfLog are the exponential and logarithm tables of GF(2^8) with the polynomial x^8+x^4+x^3+x^2+1.
+var gfExp, gfLog = computeGFTables()
+
+func computeGFTables() ([512]byte, [256]byte) {
+	var exp [512]byte
+	var log [256]byte
+	x := 1
+	for i := 0; i < 255; i++ {
+		exp[i] = byte(x)
+		log[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+	for i := 255; i < 512; i++ {
+		exp[i] = exp[i-255]
+	}
+	return exp, log
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+255-int(gfLog[b])]
+}
+
+// lagrangeCoefficients returns the coefficients that evaluate at x the polynomial interpolating the points xs.
+// Subtraction in GF(2^8) is xor.
+func lagrangeCoefficients(xs []byte, x byte) []byte {
+	coefs := make([]byte, len(xs))
+	for i, xi := range xs {
+		num, den := byte(1), byte(1)
+		for j, xj := range xs {
+			if i != j {
+				num = gfMul(num, x^xj)
+				den = gfMul(den, xi^xj)
+			}
+		}
+		coefs[i] = gfDiv(num, den)
+	}
+	return coefs
+}
+
+// combineShards returns the shard whose every byte is the linear combination of the bytes of shards.
+func combineShards(coefs []byte, shards [][]byte) []byte {
+	res := make([]byte, len(shards[0]))
+	for i, coef := range coefs {
+		if coef == 0 {
+			continue
+		}
+		logCoef := int(gfLog[coef])
+		for j, b := range shards[i] {
+			if b != 0 {
+				res[j] ^= gfExp[logCoef+int(gfLog[b])]
+			}
+		}
+	}
+	return res
+}
+
+// erasureCode is a systematic Reed-Solomon code over GF(2^8) that splits a payload into n fragments, any k of which recover it.
+// Fragment i is the evaluation at i of the polynomial of degree below k whose evaluations at 0..k-1 are the data shards.
+type erasureCode struct {
+	n, k int
+}
+
+const payloadLengthSize = 8
+
+func newErasureCode(n, k int) (*erasureCode, error) {
+	if k < 1 || k > n || n > 255 {
+		return nil, fmt.Errorf("invalid erasure code parameters n=%d k=%d", n, k)
+	}
+	return &erasureCode{n: n, k: k}, nil
+}
+
+// encode prefixes the payload with its length, pads it to k shards of equal size and extends them to n fragments.
+func (e *erasureCode) encode(payload []byte) [][]byte {
+	shardSize := (payloadLengthSize + len(payload) + e.k - 1) / e.k
+	data := make([]byte, shardSize*e.k)
+	binary.BigEndian.PutUint64(data, uint64(len(payload)))
+	copy(data[payloadLengthSize:], payload)
+	fragments := make([][]byte, e.n)
+	for i := 0; i < e.k; i++ {
+		fragments[i] = data[i*shardSize : (i+1)*shardSize]
+	}
+	xs := e.points(e.k)
+	for i := e.k; i < e.n; i++ {
+		fragments[i] = combineShards(lagrangeCoefficients(xs, byte(i)), fragments[:e.k])
+	}
+	return fragments
+}
+
+// decode recovers the payload from the fragments at the given indices, of which it uses the first k.
+func (e *erasureCode) decode(indices []int, fragments [][]byte) ([]byte, error) {
+	if len(indices) < e.k || len(indices) != len(fragments) {
+		return nil, fmt.Errorf("expected at least %d fragments, got %d", e.k, len(indices))
+	}
+	indices, fragments = indices[:e.k], fragments[:e.k]
+	shardSize := len(fragments[0])
+	xs := make([]byte, e.k)
+	seen := make(map[int]bool, e.k)
+	for i, idx := range indices {
+		if idx < 0 || idx >= e.n {
+			return nil, fmt.Errorf("fragment index %d out of range", idx)
+		} else if seen[idx] {
+			return nil, fmt.Errorf("duplicate fragment index %d", idx)
+		} else if len(fragments[i]) != shardSize {
+			return nil, fmt.Errorf("fragments have different sizes")
+		}
+		xs[i] = byte(idx)
+		seen[idx] = true
+	}
+	data := make([]byte, 0, shardSize*e.k)
+	for i := 0; i < e.k; i++ {
+		data = append(data, combineShards(lagrangeCoefficients(xs, byte(i)), fragments)...)
+	}
+	if len(data) < payloadLengthSize {
+		return nil, fmt.Errorf("decoded data too short")
+	}
+	length := binary.BigEndian.Uint64(data)
+	if length > uint64(len(data)-payloadLengthSize) {
+		return nil, fmt.Errorf("decoded length %d exceeds data size", length)
+	}
+	return data[payloadLengthSize : payloadLengthSize+int(length)], nil
+}
+
+func (e *erasureCode) points(k int) []byte {
+	xs := make([]byte, k)
+	for i := range xs {
+		xs[i] = byte(i)
+	}
+	return xs
+}
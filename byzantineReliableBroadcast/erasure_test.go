@@ -0,0 +1,55 @@
+package byzantineReliableBroadcast
+
+import (
+	"crypto/rand"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestErasureCodeShouldDecodeFromAnyKFragments(t *testing.T) {
+	code, err := newErasureCode(7, 3)
+	assert.NoError(t, err)
+	payload := make([]byte, 1000)
+	_, _ = rand.Read(payload)
+	fragments := code.encode(payload)
+	assert.Len(t, fragments, 7)
+	for _, indices := range [][]int{{0, 1, 2}, {4, 5, 6}, {6, 0, 3}, {2, 5, 1, 4}} {
+		chosen := make([][]byte, len(indices))
+		for i, idx := range indices {
+			chosen[i] = fragments[idx]
+		}
+		decoded, err := code.decode(indices, chosen)
+		assert.NoError(t, err)
+		assert.Equal(t, payload, decoded)
+	}
+}
+
+func TestErasureCodeShouldRejectTooFewFragments(t *testing.T) {
+	code, err := newErasureCode(4, 2)
+	assert.NoError(t, err)
+	fragments := code.encode([]byte("hello"))
+	_, err = code.decode([]int{3}, fragments[3:])
+	assert.Error(t, err)
+	_, err = code.decode([]int{1, 1}, [][]byte{fragments[1], fragments[1]})
+	assert.Error(t, err)
+}
+
+func TestErasureCodeShouldHandleEmptyPayload(t *testing.T) {
+	code, err := newErasureCode(4, 2)
+	assert.NoError(t, err)
+	fragments := code.encode([]byte{})
+	decoded, err := code.decode([]int{2, 3}, fragments[2:])
+	assert.NoError(t, err)
+	assert.Empty(t, decoded)
+}
+
+func TestMerkleProofsShouldVerifyOnlyTheirFragment(t *testing.T) {
+	fragments := [][]byte{[]byte("a"), []byte("b"), []byte("c"), []byte("d"), []byte("e")}
+	tree := newMerkleTree(fragments)
+	for i, fragment := range fragments {
+		assert.NoError(t, verifyMerkleProof(tree.root(), len(fragments), i, fragment, tree.proof(i)))
+	}
+	assert.Error(t, verifyMerkleProof(tree.root(), len(fragments), 1, fragments[0], tree.proof(0)))
+	assert.Error(t, verifyMerkleProof(tree.root(), len(fragments), 0, []byte("x"), tree.proof(0)))
+	assert.Error(t, verifyMerkleProof(tree.root(), len(fragments), 5, fragments[0], tree.proof(0)))
+}
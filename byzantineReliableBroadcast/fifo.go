@@ -0,0 +1,82 @@
+package byzantineReliableBroadcast
+
+import (
+	. "github.com/google/uuid"
+	"log/slog"
+)
+
+// fifoOrder holds back the deliveries of each sender until all its broadcasts with lower sequences were delivered.
+// It is not thread safe and is used from the invoker of the channel.
+type fifoOrder struct {
+	floor   uint64
+	next    map[UUID]uint64
+	pending map[UUID]map[uint64]BRBMsg
+	last    chan struct{}
+	logger  *slog.Logger
+}
+
+func newFIFOOrder(floor uint64, logger *slog.Logger) *fifoOrder {
+	last := make(chan struct{})
+	close(last)
+	return &fifoOrder{
+		floor:   floor,
+		next:    make(map[UUID]uint64),
+		pending: make(map[UUID]map[uint64]BRBMsg),
+		last:    last,
+		logger:  logger,
+	}
+}
+
+// nextOf is the sequence of the next broadcast of sender to be delivered.
+func (o *fifoOrder) nextOf(sender UUID) uint64 {
+	return max(o.next[sender], o.floor)
+}
+
+// add buffers the output of the broadcast of sender with sequence seq, and returns the outputs that are now in order.
+// A second output for a sequence of the same sender is rejected, whether it repeats the first or forks from it.
+func (o *fifoOrder) add(seq uint64, output BRBMsg) []BRBMsg {
+	sender := output.Sender
+	if _, ok := o.pending[sender][seq]; ok || seq < o.nextOf(sender) {
+		o.logger.Warn("rejecting repeated sequence", "sender", sender, "seq", seq)
+		return nil
+	}
+	if o.pending[sender] == nil {
+		o.pending[sender] = make(map[uint64]BRBMsg)
+	}
+	o.pending[sender][seq] = output
+	return o.flush(sender)
+}
+
+// collect skips the sequences below the watermark, whose broadcasts will never be delivered, and returns the outputs
+// that were waiting for them.
+func (o *fifoOrder) collect(watermark uint64) []BRBMsg {
+	if watermark <= o.floor {
+		return nil
+	}
+	o.floor = watermark
+	var outputs []BRBMsg
+	for sender, pending := range o.pending {
+		for seq := range pending {
+			if seq < watermark {
+				delete(pending, seq)
+			}
+		}
+		outputs = append(outputs, o.flush(sender)...)
+	}
+	return outputs
+}
+
+func (o *fifoOrder) flush(sender UUID) []BRBMsg {
+	var outputs []BRBMsg
+	next := o.nextOf(sender)
+	for output, ok := o.pending[sender][next]; ok; output, ok = o.pending[sender][next] {
+		outputs = append(outputs, output)
+		delete(o.pending[sender], next)
+		next++
+	}
+	o.next[sender] = next
+	if len(o.pending[sender]) == 0 {
+		delete(o.pending, sender)
+	}
+	return outputs
+}
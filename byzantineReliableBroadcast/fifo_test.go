@@ -0,0 +1,45 @@
+package byzantineReliableBroadcast
+
+import (
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"log/slog"
+	"testing"
+)
+
+func TestFIFOOrderShouldBufferGaps(t *testing.T) {
+	o := newFIFOOrder(0, slog.Default())
+	sender := uuid.New()
+	assert.Empty(t, o.add(1, BRBMsg{Content: []byte("b"), Sender: sender}))
+	assert.Empty(t, o.add(2, BRBMsg{Content: []byte("c"), Sender: sender}))
+	outputs := o.add(0, BRBMsg{Content: []byte("a"), Sender: sender})
+	assert.Equal(t, []string{"a", "b", "c"}, contents(outputs))
+}
+
+func TestFIFOOrderShouldRejectRepeatedSequences(t *testing.T) {
+	o := newFIFOOrder(0, slog.Default())
+	sender := uuid.New()
+	assert.Len(t, o.add(0, BRBMsg{Content: []byte("a"), Sender: sender}), 1)
+	assert.Empty(t, o.add(0, BRBMsg{Content: []byte("fork"), Sender: sender}))
+	assert.Empty(t, o.add(2, BRBMsg{Content: []byte("c"), Sender: sender}))
+	assert.Empty(t, o.add(2, BRBMsg{Content: []byte("fork"), Sender: sender}))
+	outputs := o.add(1, BRBMsg{Content: []byte("b"), Sender: sender})
+	assert.Equal(t, []string{"b", "c"}, contents(outputs))
+}
+
+func TestFIFOOrderShouldSkipCollectedSequences(t *testing.T) {
+	o := newFIFOOrder(0, slog.Default())
+	sender := uuid.New()
+	assert.Empty(t, o.add(3, BRBMsg{Content: []byte("d"), Sender: sender}))
+	assert.Equal(t, []string{"d"}, contents(o.collect(3)))
+	assert.Empty(t, o.add(2, BRBMsg{Content: []byte("late"), Sender: sender}))
+	assert.Empty(t, o.add(0, BRBMsg{Content: []byte("other"), Sender: uuid.New()}))
+}
+
+func contents(outputs []BRBMsg) []string {
+	res := make([]string, len(outputs))
+	for i, output := range outputs {
+		res[i] = string(output.Content)
+	}
+	return res
+}
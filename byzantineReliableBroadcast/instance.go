@@ -7,22 +7,38 @@ import (
 	"log/slog"
 )
 
-var instanceLogger = utils.GetLogger("BRB Instance", slog.LevelWarn)
+// instanceHandler is the state machine of a broadcast algorithm, driven by the messages of one instance.
+type instanceHandler interface {
+	handleSend(msg []byte, sender UUID) error
+	handleEcho(msg []byte, sender UUID) error
+	handleReady(msg []byte, sender UUID) error
+	state(id UUID) BRBInstanceState
+}
 
 type brbInstance struct {
-	handler   *brbHandler
+	handler   instanceHandler
 	commands  chan<- func()
 	closeChan chan<- struct{}
+	done      chan struct{}
+	logger    *slog.Logger
+}
+
+// newBrbInstance creates an instance whose done channel is closed along with it, releasing the goroutines waiting on its outputs.
+func newBrbInstance(n, f uint, echo, ready chan []byte, output chan BRBMsg, done chan struct{}, logger *slog.Logger) *brbInstance {
+	handler := newBrbHandler(n, f, echo, ready, output, logger)
+	return newInstance(handler, done, handler.logger)
 }
 
-func newBrbInstance(n, f uint, echo, ready chan []byte, output chan BRBMsg) *brbInstance {
-	handler := newBrbHandler(n, f, echo, ready, output)
+// newInstance runs handler in its own goroutine, which is stopped when the instance is closed.
+func newInstance(handler instanceHandler, done chan struct{}, logger *slog.Logger) *brbInstance {
 	commands := make(chan func())
 	closeChan := make(chan struct{}, 1)
 	executor := &brbInstance{
 		handler:   handler,
 		commands:  commands,
 		closeChan: closeChan,
+		done:      done,
+		logger:    logger,
 	}
 	go executor.invoker(commands, closeChan)
 	return executor
@@ -52,21 +68,54 @@ func (e *brbInstance) ready(msg []byte, sender UUID) error {
 	return <-errChan
 }
 
+func (e *brbInstance) request(msg []byte, sender UUID) error {
+	server, ok := e.handler.(payloadServer)
+	if !ok {
+		return fmt.Errorf("instance does not serve payloads")
+	}
+	errChan := make(chan error)
+	e.commands <- func() {
+		errChan <- server.handleRequest(msg, sender)
+	}
+	return <-errChan
+}
+
+func (e *brbInstance) reply(msg []byte, sender UUID) error {
+	server, ok := e.handler.(payloadServer)
+	if !ok {
+		return fmt.Errorf("instance does not fetch payloads")
+	}
+	errChan := make(chan error)
+	e.commands <- func() {
+		errChan <- server.handleReply(msg, sender)
+	}
+	return <-errChan
+}
+
+func (e *brbInstance) state(id UUID) BRBInstanceState {
+	res := make(chan BRBInstanceState, 1)
+	e.commands <- func() {
+		res <- e.handler.state(id)
+	}
+	return <-res
+}
+
 func (e *brbInstance) invoker(commands <-chan func(), closeChan <-chan struct{}) {
 	for {
 		select {
 		case command := <-commands:
 			command()
 		case <-closeChan:
-			instanceLogger.Info("closing executor")
+			e.logger.Info("closing executor")
 			return
 		}
 	}
 }
 
 func (e *brbInstance) close() {
-	instanceLogger.Info("sending signal to close brb handler")
+	e.logger.Info("sending signal to close brb handler")
 	e.closeChan <- struct{}{}
+	close(e.done)
 }
 
 type brbHandler struct {
@@ -74,6 +123,7 @@ type brbHandler struct {
 	peersEchoed  map[UUID]bool
 	peersReadied map[UUID]bool
 	handler      *brbPhase1Handler
+	logger       *slog.Logger
 }
 
 type brbData struct {
@@ -83,27 +133,29 @@ type brbData struct {
 	readies map[UUID]uint
 }
 
-func newBrbHandler(n, f uint, echo, ready chan []byte, output chan BRBMsg) *brbHandler {
+func newBrbHandler(n, f uint, echo, ready chan []byte, output chan BRBMsg, logger *slog.Logger) *brbHandler {
+	instanceLogger := utils.ComponentLogger(logger, "BRB Instance", slog.LevelWarn)
 	data := brbData{
 		n:       n,
 		f:       f,
 		echoes:  make(map[UUID]uint),
 		readies: make(map[UUID]uint),
 	}
-	ph3 := newPhase3Handler(&data, output)
-	ph2 := newPhase2Handler(&data, ready, ph3)
-	ph1 := newPhase1Handler(&data, echo, ph2)
+	ph3 := newPhase3Handler(&data, output, logger)
+	ph2 := newPhase2Handler(&data, ready, ph3, logger)
+	ph1 := newPhase1Handler(&data, echo, ph2, logger)
 	instance := &brbHandler{
 		data:         &data,
 		peersEchoed:  make(map[UUID]bool),
 		peersReadied: make(map[UUID]bool),
 		handler:      ph1,
+		logger:       instanceLogger,
 	}
 	return instance
 }
 
 func (h *brbHandler) handleSend(msg []byte, sender UUID) error {
-	instanceLogger.Debug("submitting send message", "sender", sender, "msg", string(msg))
+	h.logger.Debug("submitting send message", "sender", sender, "msg", string(msg))
 	if err := h.handler.handleSend(msg, sender); err != nil {
 		return fmt.Errorf("unable to handle send: %v", err)
 	}
@@ -111,7 +163,7 @@ func (h *brbHandler) handleSend(msg []byte, sender UUID) error {
 }
 
 func (h *brbHandler) handleEcho(msg []byte, sender UUID) error {
-	instanceLogger.Debug("submitting echo message", "sender", sender, "msg", string(msg))
+	h.logger.Debug("submitting echo message", "sender", sender, "msg", string(msg))
 	ok := h.peersEchoed[sender]
 	if ok {
 		return fmt.Errorf("already received echo from peer %s", sender)
@@ -127,7 +179,7 @@ func (h *brbHandler) handleEcho(msg []byte, sender UUID) error {
 }
 
 func (h *brbHandler) handleReady(msg []byte, sender UUID) error {
-	instanceLogger.Debug("submitting ready message", "sender", sender, "msg", string(msg))
+	h.logger.Debug("submitting ready message", "sender", sender, "msg", string(msg))
 	ok := h.peersReadied[sender]
 	if ok {
 		return fmt.Errorf("already received ready from peer %s", sender)
@@ -141,3 +193,18 @@ func (h *brbHandler) handleReady(msg []byte, sender UUID) error {
 	}
 	return nil
 }
+
+func (h *brbHandler) state(id UUID) BRBInstanceState {
+	phase := uint(1)
+	if h.handler.nextPhase.isFinished {
+		phase = 3
+	} else if h.handler.isFinished {
+		phase = 2
+	}
+	return BRBInstanceState{
+		Id:      id,
+		Phase:   phase,
+		Echoes:  uint(len(h.peersEchoed)),
+		Readies: uint(len(h.peersReadied)),
+	}
+}
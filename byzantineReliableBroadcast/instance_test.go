@@ -1,6 +1,7 @@
 package byzantineReliableBroadcast
 
 import (
+	"bkr-acs/utils"
 	"bytes"
 	"github.com/google/uuid"
 	"github.com/samber/lo"
@@ -12,7 +13,7 @@ func TestShouldReceiveSelfBroadcast(t *testing.T) {
 	scheduler := newOrderedScheduler()
 	echoChan, readyChan := scheduler.getChannels(t, uuid.New())
 	outputChan := make(chan BRBMsg)
-	instance := newBrbInstance(1, 0, echoChan, readyChan, outputChan)
+	instance := newBrbInstance(1, 0, echoChan, readyChan, outputChan, make(chan struct{}), utils.DefaultLogger())
 	scheduler.instances = append(scheduler.instances, instance)
 	msg := []byte("hello")
 	assert.NoError(t, instance.send(msg, uuid.New()))
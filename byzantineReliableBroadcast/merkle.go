@@ -0,0 +1,92 @@
+package byzantineReliableBroadcast
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+)
+
+const hashSize = sha256.Size
+
+// merkleTree commits to the fragments of an erasure-coded payload.
+// Leaves and inner nodes are hashed with different prefixes, and the leaves are padded with zero hashes to a power of two.
+type merkleTree struct {
+	levels [][][hashSize]byte
+}
+
+func newMerkleTree(fragments [][]byte) *merkleTree {
+	width := 1
+	for width < len(fragments) {
+		width *= 2
+	}
+	leaves := make([][hashSize]byte, width)
+	for i, fragment := range fragments {
+		leaves[i] = hashLeaf(fragment)
+	}
+	levels := [][][hashSize]byte{leaves}
+	for level := leaves; len(level) > 1; {
+		next := make([][hashSize]byte, len(level)/2)
+		for i := range next {
+			next[i] = hashInner(level[2*i], level[2*i+1])
+		}
+		levels = append(levels, next)
+		level = next
+	}
+	return &merkleTree{levels: levels}
+}
+
+func (t *merkleTree) root() [hashSize]byte {
+	return t.levels[len(t.levels)-1][0]
+}
+
+// proof returns the siblings of the path from leaf idx to the root.
+func (t *merkleTree) proof(idx int) [][hashSize]byte {
+	proof := make([][hashSize]byte, 0, len(t.levels)-1)
+	for _, level := range t.levels[:len(t.levels)-1] {
+		proof = append(proof, level[idx^1])
+		idx /= 2
+	}
+	return proof
+}
+
+// merkleDepth is the length of the proofs of a tree with n leaves.
+func merkleDepth(n int) int {
+	depth := 0
+	for width := 1; width < n; width *= 2 {
+		depth++
+	}
+	return depth
+}
+
+func verifyMerkleProof(root [hashSize]byte, n, idx int, fragment []byte, proof [][hashSize]byte) error {
+	if idx < 0 || idx >= n {
+		return fmt.Errorf("fragment index %d out of range", idx)
+	} else if len(proof) != merkleDepth(n) {
+		return fmt.Errorf("proof has %d hashes, expected %d", len(proof), merkleDepth(n))
+	}
+	hash := hashLeaf(fragment)
+	for _, sibling := range proof {
+		if idx%2 == 0 {
+			hash = hashInner(hash, sibling)
+		} else {
+			hash = hashInner(sibling, hash)
+		}
+		idx /= 2
+	}
+	if !bytes.Equal(hash[:], root[:]) {
+		return fmt.Errorf("proof does not match root")
+	}
+	return nil
+}
+
+func hashLeaf(fragment []byte) [hashSize]byte {
+	return sha256.Sum256(append([]byte{0}, fragment...))
+}
+
+func hashInner(left, right [hashSize]byte) [hashSize]byte {
+	buf := make([]byte, 0, 1+2*hashSize)
+	buf = append(buf, 1)
+	buf = append(buf, left[:]...)
+	buf = append(buf, right[:]...)
+	return sha256.Sum256(buf)
+}
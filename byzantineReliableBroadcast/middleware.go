@@ -7,25 +7,45 @@ import (
 	"bytes"
 	"crypto/ecdsa"
 	"encoding/binary"
+	"encoding/hex"
 	"fmt"
 	"github.com/google/uuid"
+	"io"
 	"log/slog"
-	"math/rand"
+	"math"
 )
 
-var middlewareLogger = utils.GetLogger("BRB Middleware", slog.LevelWarn)
-
 type middlewareCode byte
 
 const (
 	send middlewareCode = 'a' + iota
 	echo
 	ready
+	request
+	reply
 )
 
+func (c middlewareCode) String() string {
+	switch c {
+	case send:
+		return "send"
+	case echo:
+		return "echo"
+	case ready:
+		return "ready"
+	case request:
+		return "request"
+	case reply:
+		return "reply"
+	default:
+		return fmt.Sprintf("unknown(%d)", byte(c))
+	}
+}
+
 type msg struct {
 	kind    middlewareCode
 	id      uuid.UUID
+	tag     []byte
 	sender  uuid.UUID
 	content []byte
 }
@@ -34,16 +54,18 @@ type brbMiddleware struct {
 	bebChannel  *on.BEBChannel
 	deliverChan chan<- *msg
 	closeChan   chan struct{}
+	logger      *slog.Logger
 }
 
-func newBRBMiddleware(bebChannel *on.BEBChannel, deliverChan chan<- *msg) *brbMiddleware {
+func newBRBMiddleware(bebChannel *on.BEBChannel, deliverChan chan<- *msg, logger *slog.Logger) *brbMiddleware {
 	m := &brbMiddleware{
 		bebChannel:  bebChannel,
 		deliverChan: deliverChan,
 		closeChan:   make(chan struct{}, 1),
+		logger:      utils.ComponentLogger(logger, "BRB Middleware", slog.LevelWarn),
 	}
 	go m.bebDeliver(bebChannel.GetBEBChan())
-	middlewareLogger.Info("new BRB middleware created")
+	m.logger.Info("new BRB middleware created")
 	return m
 }
 
@@ -52,45 +74,71 @@ func (m *brbMiddleware) bebDeliver(bebChan <-chan on.BEBMsg) {
 		select {
 		case bebMsg := <-bebChan:
 			if structMsg, err := m.processMsg(bebMsg.Content, bebMsg.Sender); err != nil {
-				channelLogger.Warn("unable to processMsg message during beb delivery", "error", err)
+				m.logger.Warn("unable to processMsg message during beb delivery", "error", err)
 			} else {
-				channelLogger.Debug("received message from beb", "sender", structMsg.sender, "type", structMsg.kind, "msg", string(structMsg.content))
+				m.logger.Debug("received message from beb", "sender", structMsg.sender, "type", structMsg.kind, "msg", string(structMsg.content))
 				go func() { m.deliverChan <- structMsg }()
 			}
 		case <-m.closeChan:
-			channelLogger.Info("closing byzantineReliableBroadcast middleware")
+			m.logger.Info("closing byzantineReliableBroadcast middleware")
 			return
 		}
 	}
 }
 
-func (m *brbMiddleware) makeChannels(id uuid.UUID) (chan []byte, chan []byte) {
+func (m *brbMiddleware) makeChannels(id uuid.UUID, done <-chan struct{}) (chan []byte, chan []byte) {
 	echoChan := make(chan []byte)
-	go m.broadcastMsgOnSignal(echo, id, echoChan)
+	go m.broadcastMsgOnSignal(echo, id, echoChan, done)
 	readyChan := make(chan []byte)
-	go m.broadcastMsgOnSignal(ready, id, readyChan)
+	go m.broadcastMsgOnSignal(ready, id, readyChan, done)
 	return echoChan, readyChan
 }
 
-func (m *brbMiddleware) broadcastSend(msg []byte) error {
-	middlewareLogger.Debug("broadcasting msg", "kind", send, "msg", string(msg))
-	structuredMsg, err := m.wrapSend(msg)
+func (m *brbMiddleware) broadcastSend(seq uint64, tag, msg []byte) error {
+	m.logger.Debug("broadcasting msg", "kind", send, "seq", seq, "msg", string(msg))
+	structuredMsg, err := m.wrapSend(tag, seq, msg)
 	if err != nil {
 		return fmt.Errorf("error wrapping send: %v", err)
-	} else if err = m.bebChannel.BEBroadcast(structuredMsg); err != nil {
+	}
+	m.bebChannel.Transcript().RecordOutbound("brb", map[string]string{"kind": send.String(), "content": hex.EncodeToString(msg)})
+	if err = m.bebChannel.BEBroadcast(structuredMsg); err != nil {
 		return fmt.Errorf("error broadcasting send: %v", err)
 	}
 	return nil
 }
 
-func (m *brbMiddleware) wrapSend(msg []byte) ([]byte, error) {
+// scatterSend starts an instance in which each node receives its own send message, the first one being this node's.
+func (m *brbMiddleware) scatterSend(seq uint64, tag []byte, msgs [][]byte) error {
+	m.logger.Debug("scattering msgs", "kind", send, "seq", seq, "count", len(msgs))
+	structuredMsgs := make([][]byte, len(msgs))
+	for i, msg := range msgs {
+		structuredMsg, err := m.wrapSend(tag, seq, msg)
+		if err != nil {
+			return fmt.Errorf("error wrapping send: %v", err)
+		}
+		structuredMsgs[i] = structuredMsg
+	}
+	m.bebChannel.Transcript().RecordOutbound("brb", map[string]string{"kind": send.String(), "fragments": fmt.Sprint(len(msgs))})
+	if err := m.bebChannel.Scatter(structuredMsgs); err != nil {
+		return fmt.Errorf("error scattering send: %v", err)
+	}
+	return nil
+}
+
+func (m *brbMiddleware) wrapSend(tag []byte, seq uint64, msg []byte) ([]byte, error) {
+	if len(tag) > maxTagLen {
+		return nil, fmt.Errorf("tag of %d bytes exceeds the limit of %d", len(tag), maxTagLen)
+	}
 	buf := bytes.NewBuffer([]byte{})
 	writer := bufio.NewWriter(buf)
-	nonce := rand.Uint32()
 	if _, err := writer.Write([]byte{byte(send)}); err != nil {
 		return nil, fmt.Errorf("unable to write send code to buffer: %v", err)
-	} else if err := binary.Write(writer, binary.LittleEndian, nonce); err != nil {
-		return nil, fmt.Errorf("unable to write nonce to buffer: %v", err)
+	} else if err := binary.Write(writer, binary.LittleEndian, uint16(len(tag))); err != nil {
+		return nil, fmt.Errorf("unable to write tag length to buffer: %v", err)
+	} else if _, err := writer.Write(tag); err != nil {
+		return nil, fmt.Errorf("unable to write tag to buffer: %v", err)
+	} else if err := binary.Write(writer, binary.LittleEndian, seq); err != nil {
+		return nil, fmt.Errorf("unable to write sequence to buffer: %v", err)
 	} else if _, err := writer.Write(msg); err != nil {
 		return nil, fmt.Errorf("unable to write message to buffer: %v", err)
 	} else if err := writer.Flush(); err != nil {
@@ -99,33 +147,60 @@ func (m *brbMiddleware) wrapSend(msg []byte) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-func (m *brbMiddleware) genId(sender *ecdsa.PublicKey) (uuid.UUID, error) {
-	nonce := rand.Uint32()
-	encodedPk, err := utils.SerializePublicKey(sender)
+func (m *brbMiddleware) broadcastMsgOnSignal(code middlewareCode, id uuid.UUID, ch chan []byte, done <-chan struct{}) {
+	select {
+	case msg := <-ch:
+		m.broadcastMsg(code, id, msg)
+	case <-done:
+	}
+}
+
+func (m *brbMiddleware) broadcastMsg(code middlewareCode, id uuid.UUID, msg []byte) {
+	m.logger.Debug("broadcasting msg", "kind", code, "msg", string(msg))
+	structuredMsg, err := m.wrapMessage(code, id, msg)
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("unable to serialize public key during byzantineReliableBroadcast: %v", err)
+		m.logger.Warn("error wrapping message", "error", err)
+		return
 	}
-	buf := bytes.NewBuffer(encodedPk)
-	if err := binary.Write(buf, binary.LittleEndian, nonce); err != nil {
-		return uuid.Nil, fmt.Errorf("unable to write nonce to buffer during byzantineReliableBroadcast: %v", err)
+	m.bebChannel.Transcript().RecordOutbound("brb", map[string]string{"kind": code.String(), "instance": id.String(), "content": hex.EncodeToString(msg)})
+	if err = m.bebChannel.BEBroadcast(structuredMsg); err != nil {
+		m.logger.Warn("error broadcasting message", "error", err)
 	}
-	id := utils.BytesToUUID(buf.Bytes())
-	return id, nil
 }
 
-func (m *brbMiddleware) broadcastMsgOnSignal(code middlewareCode, id uuid.UUID, ch chan []byte) {
-	msg := <-ch
-	m.broadcastMsg(code, id, msg)
+// unicast is a message sent to a single node, such as the request for a payload or its reply.
+type unicast struct {
+	kind    middlewareCode
+	to      uuid.UUID
+	content []byte
 }
 
-func (m *brbMiddleware) broadcastMsg(code middlewareCode, id uuid.UUID, msg []byte) {
-	middlewareLogger.Debug("broadcasting msg", "kind", code, "msg", string(msg))
+// makeUnicastChannel returns a channel whose messages are sent until the instance is done.
+func (m *brbMiddleware) makeUnicastChannel(id uuid.UUID, done <-chan struct{}) chan unicast {
+	unicastChan := make(chan unicast)
+	go func() {
+		for {
+			select {
+			case msg := <-unicastChan:
+				m.unicastMsg(msg.kind, id, msg.to, msg.content)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return unicastChan
+}
+
+func (m *brbMiddleware) unicastMsg(code middlewareCode, id, to uuid.UUID, msg []byte) {
+	m.logger.Debug("unicasting msg", "kind", code, "to", to)
 	structuredMsg, err := m.wrapMessage(code, id, msg)
 	if err != nil {
-		channelLogger.Warn("error wrapping message", "error", err)
+		m.logger.Warn("error wrapping message", "error", err)
 		return
-	} else if err = m.bebChannel.BEBroadcast(structuredMsg); err != nil {
-		channelLogger.Warn("error broadcasting message", "error", err)
+	}
+	m.bebChannel.Transcript().RecordOutbound("brb", map[string]string{"kind": code.String(), "instance": id.String(), "to": to.String(), "content": hex.EncodeToString(msg)})
+	if err = m.bebChannel.Unicast(structuredMsg, to); err != nil {
+		m.logger.Warn("error unicasting message", "to", to, "error", err)
 	}
 }
 
@@ -157,7 +232,7 @@ func (m *brbMiddleware) processMsg(msg []byte, sender *ecdsa.PublicKey) (*msg, e
 	kind := middlewareCode(byteType)
 	if kind == send {
 		return m.processSend(reader, sender)
-	} else if kind == echo || kind == ready {
+	} else if kind == echo || kind == ready || kind == request || kind == reply {
 		return m.deserializeMsg(kind, reader, sender)
 	} else {
 		return nil, fmt.Errorf("unhandled default case in instance id computation")
@@ -165,34 +240,50 @@ func (m *brbMiddleware) processMsg(msg []byte, sender *ecdsa.PublicKey) (*msg, e
 }
 
 func (m *brbMiddleware) processSend(reader *bytes.Reader, sender *ecdsa.PublicKey) (*msg, error) {
-	id, err := m.readId(reader, sender)
+	id, tag, err := m.readId(reader, sender)
 	if err != nil {
 		return nil, fmt.Errorf("unable to processMsg id generation: %v", err)
 	}
-	return m.deserializeIDMsg(send, reader, sender, id)
-}
-
-func (m *brbMiddleware) readId(reader *bytes.Reader, sender *ecdsa.PublicKey) (uuid.UUID, error) {
-	var nonce uint32
-	err := binary.Read(reader, binary.LittleEndian, &nonce)
+	structMsg, err := m.deserializeIDMsg(send, reader, sender, id)
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("unable to read nonce from message during instance id computation: %v", err)
+		return nil, err
 	}
-	return m.computeInstanceId(nonce, sender)
+	structMsg.tag = tag
+	return structMsg, nil
 }
 
-func (m *brbMiddleware) computeInstanceId(nonce uint32, sender *ecdsa.PublicKey) (uuid.UUID, error) {
-	encodedPk, err := utils.SerializePublicKey(sender)
-	if err != nil {
-		return uuid.UUID{}, fmt.Errorf("bcb channel unable to serialize public key: %v", err)
+func (m *brbMiddleware) readId(reader *bytes.Reader, sender *ecdsa.PublicKey) (uuid.UUID, []byte, error) {
+	var tagLen uint16
+	var seq uint64
+	if err := binary.Read(reader, binary.LittleEndian, &tagLen); err != nil {
+		return uuid.Nil, nil, fmt.Errorf("unable to read tag length from message during instance id computation: %v", err)
+	}
+	tag := make([]byte, tagLen)
+	if _, err := io.ReadFull(reader, tag); err != nil {
+		return uuid.Nil, nil, fmt.Errorf("unable to read tag from message during instance id computation: %v", err)
+	} else if err := binary.Read(reader, binary.LittleEndian, &seq); err != nil {
+		return uuid.Nil, nil, fmt.Errorf("unable to read sequence from message during instance id computation: %v", err)
 	}
-	buf := bytes.NewBuffer(encodedPk)
-	err = binary.Write(buf, binary.LittleEndian, nonce)
+	senderId, err := utils.PkToUUID(sender)
 	if err != nil {
-		return uuid.UUID{}, fmt.Errorf("unable to write nonce to buffer: %v", err)
+		return uuid.Nil, nil, fmt.Errorf("unable to convert sender public key to UUID: %v", err)
 	}
-	id := utils.BytesToUUID(buf.Bytes())
-	return id, nil
+	return computeInstanceId(tag, seq, senderId), tag, nil
+}
+
+// maxTagLen is the longest tag a send message can carry.
+const maxTagLen = math.MaxUint16
+
+// computeInstanceId identifies a broadcast by its sender and tag, keeping the sequence chosen by the sender.
+// Since it only depends on what the sender chose, the sender knows the id of its broadcast before sending it.
+func computeInstanceId(tag []byte, seq uint64, sender uuid.UUID) uuid.UUID {
+	return utils.NewInstanceId(seq, append(sender[:], tag...))
+}
+
+// InstanceId returns the id of the instance in which sender broadcasts with the sequence and tag, as chosen with
+// BRBroadcastWithTag, so that other nodes can subscribe to it before it delivers.
+func InstanceId(sender uuid.UUID, seq uint64, tag []byte) uuid.UUID {
+	return computeInstanceId(tag, seq, sender)
 }
 
 func (m *brbMiddleware) deserializeMsg(kind middlewareCode, reader *bytes.Reader, sender *ecdsa.PublicKey) (*msg, error) {
@@ -212,6 +303,7 @@ func (m *brbMiddleware) deserializeIDMsg(kind middlewareCode, reader *bytes.Read
 	if n, err := reader.Read(content); err != nil || n != len(content) {
 		return nil, fmt.Errorf("unable to read content: %v", err)
 	}
+	m.bebChannel.Transcript().RecordInbound("brb", senderId, map[string]string{"kind": kind.String(), "instance": id.String(), "content": hex.EncodeToString(content)})
 	return &msg{
 		kind:    kind,
 		id:      id,
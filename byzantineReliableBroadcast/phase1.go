@@ -7,27 +7,27 @@ import (
 	"log/slog"
 )
 
-var phase1Logger = utils.GetLogger("BRB Phase 1", slog.LevelWarn)
-
 type brbPhase1Handler struct {
 	data       *brbData
 	echoChan   chan<- []byte
 	isFinished bool
 	nextPhase  *brbPhase2Handler
+	logger     *slog.Logger
 }
 
-func newPhase1Handler(data *brbData, echoChan chan<- []byte, nextPhase *brbPhase2Handler) *brbPhase1Handler {
+func newPhase1Handler(data *brbData, echoChan chan<- []byte, nextPhase *brbPhase2Handler, logger *slog.Logger) *brbPhase1Handler {
 	return &brbPhase1Handler{
 		data:       data,
 		echoChan:   echoChan,
 		isFinished: false,
 		nextPhase:  nextPhase,
+		logger:     utils.ComponentLogger(logger, "BRB Phase 1", slog.LevelWarn),
 	}
 }
 
 func (b *brbPhase1Handler) handleSend(msg []byte, sender uuid.UUID) error {
 	if !b.isFinished {
-		phase1Logger.Debug("processing send message", "sender", sender, "msg", string(msg))
+		b.logger.Debug("processing send message", "sender", sender, "msg", string(msg))
 		b.isFinished = true
 		senderBytes, err := sender.MarshalBinary()
 		if err != nil {
@@ -46,9 +46,9 @@ func (b *brbPhase1Handler) handleEcho(msg []byte, id uuid.UUID) error {
 		if !ok {
 			return fmt.Errorf("unable to find echoes in phase 1 with message id %s", id)
 		}
-		phase1Logger.Debug("processing echo message", "sender", id, "msg", string(msg), "received", numEchoes, "required", b.data.f+1)
+		b.logger.Debug("processing echo message", "sender", id, "msg", string(msg), "received", numEchoes, "required", b.data.f+1)
 		if numEchoes == b.data.f+1 {
-			phase1Logger.Info("received enough echoes to advance to phase 2")
+			b.logger.Info("received enough echoes to advance to phase 2")
 			b.isFinished = true
 			b.sendEcho(msg)
 			return b.nextPhase.handleEcho(msg, id)
@@ -65,9 +65,9 @@ func (b *brbPhase1Handler) handleReady(msg []byte, id uuid.UUID) error {
 		if !ok {
 			return fmt.Errorf("unable to find readies with message id %s", id)
 		}
-		instanceLogger.Debug("processing ready message", "sender", id, "msg", string(msg), "received", numReadies, "required", b.data.f+1)
+		b.logger.Debug("processing ready message", "sender", id, "msg", string(msg), "received", numReadies, "required", b.data.f+1)
 		if numReadies == b.data.f+1 {
-			phase1Logger.Info("received enough readies to advance to phase 2")
+			b.logger.Info("received enough readies to advance to phase 2")
 			b.isFinished = true
 			b.sendEcho(msg)
 			return b.nextPhase.handleReady(msg, id)
@@ -77,6 +77,6 @@ func (b *brbPhase1Handler) handleReady(msg []byte, id uuid.UUID) error {
 }
 
 func (b *brbPhase1Handler) sendEcho(msg []byte) {
-	phase1Logger.Info("sending echo message", "msg", string(msg))
+	b.logger.Info("sending echo message", "msg", string(msg))
 	go func() { b.echoChan <- msg }()
 }
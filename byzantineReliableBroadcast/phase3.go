@@ -8,19 +8,19 @@ import (
 	"unsafe"
 )
 
-var phase3Logger = utils.GetLogger("BRB Phase 3", slog.LevelWarn)
-
 var idLen = unsafe.Sizeof(uuid.UUID{})
 
 type brbPhase3Handler struct {
 	data       *brbData
 	outputChan chan<- BRBMsg
+	logger     *slog.Logger
 }
 
-func newPhase3Handler(data *brbData, output chan<- BRBMsg) *brbPhase3Handler {
+func newPhase3Handler(data *brbData, output chan<- BRBMsg, logger *slog.Logger) *brbPhase3Handler {
 	return &brbPhase3Handler{
 		data:       data,
 		outputChan: output,
+		logger:     utils.ComponentLogger(logger, "BRB Phase 3", slog.LevelWarn),
 	}
 }
 
@@ -29,13 +29,13 @@ func (b *brbPhase3Handler) handleReady(msg []byte, id uuid.UUID) error {
 	if !ok {
 		return fmt.Errorf("unable to find id for ready message in phase 3")
 	}
-	phase3Logger.Debug("processing ready message", "sender", id, "msg", string(msg), "received", numReadies, "required", b.data.n-b.data.f)
+	b.logger.Debug("processing ready message", "sender", id, "msg", string(msg), "received", numReadies, "required", b.data.n-b.data.f)
 	if numReadies == b.data.n-b.data.f {
 		sender, content, err := parseMsg(msg)
 		if err != nil {
 			return fmt.Errorf("unable to parse ready message: %v", err)
 		}
-		phase3Logger.Info("received enough readies to deliver output message", "issuer", sender, "msg", string(content))
+		b.logger.Info("received enough readies to deliver output message", "issuer", sender, "msg", string(content))
 		b.outputChan <- BRBMsg{
 			Content: content,
 			Sender:  sender,
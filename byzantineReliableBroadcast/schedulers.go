@@ -158,7 +158,7 @@ func (u *unorderedScheduler) stop() {
 func instantiateCorrect(t *testing.T, outputChans []chan BRBMsg, scheduler scheduler, n, f uint) {
 	for _, o := range outputChans {
 		echoChan, readyChan := scheduler.getChannels(t, uuid.New())
-		instance := newBrbInstance(n, f, echoChan, readyChan, o)
+		instance := newBrbInstance(n, f, echoChan, readyChan, o, make(chan struct{}), utils.DefaultLogger())
 		scheduler.addInstance(instance)
 	}
 }
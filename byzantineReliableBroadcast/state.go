@@ -0,0 +1,41 @@
+package byzantineReliableBroadcast
+
+import (
+	"bkr-acs/utils"
+	. "github.com/google/uuid"
+	"github.com/samber/lo"
+)
+
+// BRBInstanceState is a snapshot of an instance that has not delivered yet.
+// Phase 1 waits for the send or enough echoes, phase 2 for enough echoes or readies, and phase 3 for enough readies to deliver.
+type BRBInstanceState struct {
+	Id      UUID `json:"id"`
+	Phase   uint `json:"phase"`
+	Echoes  uint `json:"echoes"`
+	Readies uint `json:"readies"`
+}
+
+// BRBState lists the instances of the channel that have not been collected by the low watermark.
+type BRBState struct {
+	Live      []BRBInstanceState   `json:"live"`
+	Finished  []UUID               `json:"finished"`
+	Watermark uint64               `json:"watermark"`
+	Admission utils.AdmissionState `json:"admission"`
+}
+
+// State returns a snapshot of the instances of the channel.
+func (c *BRBChannel) State() BRBState {
+	res := make(chan BRBState, 1)
+	c.commands <- func() error {
+		res <- BRBState{
+			Live: lo.MapToSlice(c.instances, func(id UUID, instance *brbInstance) BRBInstanceState {
+				return instance.state(id)
+			}),
+			Finished:  lo.Keys(c.finished),
+			Watermark: c.watermark,
+			Admission: c.admission.State(),
+		}
+		return nil
+	}
+	return <-res
+}
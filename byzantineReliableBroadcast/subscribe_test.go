@@ -0,0 +1,37 @@
+package byzantineReliableBroadcast_test
+
+import (
+	brb "bkr-acs/byzantineReliableBroadcast"
+	on "bkr-acs/overlayNetwork"
+	"fmt"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestChannelShouldDeliverPeerBroadcastToSubscriber(t *testing.T) {
+	nodes := lo.Map(lo.Range(4), func(i int, _ int) *on.Node {
+		return on.GetTestNode(t, fmt.Sprintf("localhost:%d", 6000+i), "localhost:6000")
+	})
+	channels := lo.Map(nodes, func(node *on.Node, _ int) *brb.BRBChannel {
+		return brb.NewBRBChannel(4, 1, on.NewBEBChannel(node, 'b'), node.Logger())
+	})
+	on.InitializeNodes(t, nodes)
+	sender, err := nodes[0].GetId()
+	assert.NoError(t, err)
+	tag := []byte("subscribed")
+	id := brb.InstanceId(sender, 7, tag)
+	sub, err := channels[1].Subscribe(id)
+	assert.NoError(t, err)
+	broadcast, err := channels[0].BRBroadcastWithTag(7, tag, []byte("hello"))
+	assert.NoError(t, err)
+	assert.Equal(t, id, broadcast.Id)
+	output := <-sub
+	assert.Equal(t, id, output.Id)
+	assert.Equal(t, sender, output.Sender)
+	assert.Equal(t, []byte("hello"), output.Content)
+	for _, c := range channels {
+		c.Close()
+	}
+	assert.True(t, lo.EveryBy(nodes, func(node *on.Node) bool { return node.Close() == nil }))
+}
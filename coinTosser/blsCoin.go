@@ -0,0 +1,337 @@
+package coinTosser
+
+import (
+	on "bkr-acs/overlayNetwork"
+	"bkr-acs/utils"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"github.com/cloudflare/circl/ecc/bls12381"
+	. "github.com/google/uuid"
+	"github.com/samber/lo"
+	"io"
+	"log/slog"
+)
+
+const blsDst = "BKR_COIN_BLS12381G2_XMD:SHA-256_SSWU_RO_"
+
+// blsShare is the signature share of a node over the seed of a coin.
+type blsShare struct {
+	id     UUID
+	index  uint16
+	sig    bls12381.G2
+	sender UUID
+}
+
+// blsToss gathers the valid signature shares of a coin this node tossed, until threshold+1 of them determine the signature.
+type blsToss struct {
+	base    bls12381.G2
+	shares  map[uint16]*bls12381.G2
+	senders map[UUID]bool
+	output  chan bool
+}
+
+// BLSCoinChannel is the threshold coin of unique BLS signatures over BLS12-381: the coin of a seed is a bit of the
+// hash of the signature of the seed under the key of the deal, which threshold+1 nodes compute from their signature shares.
+// Each share is checked on its own with a pairing, so no proof is sent, but it needs the trusted setup of DealBLSOffline.
+type BLSCoinChannel struct {
+	deal          *blsDeal
+	tosses        map[UUID]*blsToss
+	unordered     map[UUID][]*blsShare
+	finished      map[UUID]bool
+	watermark     uint64
+	admission     *utils.Admission
+	evidence      evidenceLog
+	shareIds      map[UUID]uint16
+	beb           *on.BEBChannel
+	commands      chan func() error
+	closeCommands chan struct{}
+	closeDeliver  chan struct{}
+	logger        *slog.Logger
+}
+
+func NewBLSCoinChannel(dealBytes []byte, beb *on.BEBChannel, logger *slog.Logger) (*BLSCoinChannel, error) {
+	d, err := unmarshalBLSDeal(dealBytes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal deal: %v", err)
+	}
+	c := &BLSCoinChannel{
+		deal:          d,
+		tosses:        make(map[UUID]*blsToss),
+		unordered:     make(map[UUID][]*blsShare),
+		finished:      make(map[UUID]bool),
+		admission:     utils.NewAdmission(),
+		beb:           beb,
+		commands:      make(chan func() error),
+		closeCommands: make(chan struct{}, 1),
+		closeDeliver:  make(chan struct{}, 1),
+		logger:        utils.ComponentLogger(logger, "BLS Coin Channel", slog.LevelWarn),
+	}
+	go c.invoker()
+	go c.bebDeliver()
+	c.logger.Info("initialized channel from offline deal", "index", d.index, "threshold", d.threshold)
+	return c, nil
+}
+
+// TossCoin signs seed with the share of this node and outputs the coin once threshold+1 signature shares are valid.
+// As with the threshold coin, seeds that start with the id of an instance give the coin the sequence of that instance.
+func (c *BLSCoinChannel) TossCoin(seed []byte, outputChan chan bool) {
+	c.commands <- func() error {
+		id := coinId(seed)
+		if c.isCollected(id) {
+			c.logger.Debug("ignoring toss of collected coin", "id", id)
+			return nil
+		} else if c.finished[id] || c.tosses[id] != nil {
+			return fmt.Errorf("coin %s was already tossed", id)
+		}
+		toss := &blsToss{base: hashSeed(seed), shares: make(map[uint16]*bls12381.G2), senders: make(map[UUID]bool), output: outputChan}
+		c.tosses[id] = toss
+		var sig bls12381.G2
+		sig.ScalarMult(&c.deal.share, &toss.base)
+		go func() {
+			if err := c.broadcastShare(id, sig); err != nil {
+				c.logger.Error("unable to broadcast signature share", "id", id, "error", err)
+			}
+		}()
+		for _, share := range c.unordered[id] {
+			if err := c.submitShare(share); err != nil {
+				c.logger.Warn("unable to submit share", "id", id, "sender", share.sender, "error", err)
+			}
+		}
+		delete(c.unordered, id)
+		c.admission.Release(id)
+		return nil
+	}
+}
+
+// hashSeed maps seed to the point of G2 that the nodes sign.
+func hashSeed(seed []byte) bls12381.G2 {
+	var base bls12381.G2
+	base.Hash(seed, []byte(blsDst))
+	return base
+}
+
+func (c *BLSCoinChannel) Common() bool {
+	return true
+}
+
+// submitShare adds a share to the toss of its coin if its pairing checks, and outputs the coin once there are enough.
+func (c *BLSCoinChannel) submitShare(share *blsShare) error {
+	toss := c.tosses[share.id]
+	if share.index == 0 || int(share.index) > len(c.deal.pubShares) {
+		c.reportShare(UnknownShareId, share)
+		return fmt.Errorf("share index %d out of range", share.index)
+	} else if toss.senders[share.sender] {
+		c.reportShare(DuplicateShare, share)
+		return fmt.Errorf("repeated share of sender %s", share.sender)
+	} else if registered, ok := c.shareIds[share.sender]; c.shareIds != nil && (!ok || registered != share.index) {
+		c.reportShare(ForeignShareId, share)
+		return fmt.Errorf("share of index %d from sender %s with another index", share.index, share.sender)
+	} else if toss.shares[share.index] != nil {
+		return fmt.Errorf("repeated share of index %d", share.index)
+	}
+	toss.senders[share.sender] = true
+	lhs := bls12381.Pair(bls12381.G1Generator(), &share.sig)
+	rhs := bls12381.Pair(&c.deal.pubShares[share.index-1], &toss.base)
+	if !lhs.IsEqual(rhs) {
+		c.reportShare(InvalidShare, share)
+		return fmt.Errorf("invalid signature share of index %d", share.index)
+	}
+	toss.shares[share.index] = &share.sig
+	if len(toss.shares) < int(c.deal.threshold)+1 {
+		return nil
+	}
+	coin := combineSignature(toss.shares)
+	c.logger.Debug("computed coin", "id", share.id, "coin", coin)
+	delete(c.tosses, share.id)
+	c.finished[share.id] = true
+	c.beb.Transcript().RecordDecision("ct", map[string]string{"instance": share.id.String(), "coin": fmt.Sprint(coin)})
+	go func() { toss.output <- coin }()
+	return nil
+}
+
+// combineSignature interpolates the signature from the shares in the exponent and reduces it to a coin.
+// BLS signatures are unique, so every set of shares yields the same signature and the same coin.
+func combineSignature(shares map[uint16]*bls12381.G2) bool {
+	indices := lo.Keys(shares)
+	var sig bls12381.G2
+	sig.SetIdentity()
+	for _, index := range indices {
+		lambda := lagrangeAtZero(index, indices)
+		var term bls12381.G2
+		term.ScalarMult(&lambda, shares[index])
+		sig.Add(&sig, &term)
+	}
+	digest := sha256.Sum256(sig.BytesCompressed())
+	return digest[0]&1 == 1
+}
+
+// SetLowWatermark drops the state of the coins with a sequence below seq, and ignores their shares from then on.
+func (c *BLSCoinChannel) SetLowWatermark(seq uint64) {
+	c.commands <- func() error {
+		if seq <= c.watermark {
+			return nil
+		}
+		c.watermark = seq
+		c.admission.Collect(seq)
+		for id := range c.finished {
+			if c.isCollected(id) {
+				delete(c.finished, id)
+			}
+		}
+		for id := range c.unordered {
+			if c.isCollected(id) {
+				delete(c.unordered, id)
+			}
+		}
+		for id := range c.tosses {
+			if c.isCollected(id) {
+				delete(c.tosses, id)
+			}
+		}
+		return nil
+	}
+}
+
+// SetAdmissionPolicy limits the coins for which peers can have shares buffered before this node tosses them.
+func (c *BLSCoinChannel) SetAdmissionPolicy(policy utils.AdmissionPolicy) {
+	c.commands <- func() error {
+		c.admission.SetPolicy(policy)
+		return nil
+	}
+}
+
+func (c *BLSCoinChannel) isCollected(id UUID) bool {
+	return utils.InstanceSequence(id) < c.watermark
+}
+
+// State returns a snapshot of the channel, whose key fingerprint identifies the public key of the deal.
+func (c *BLSCoinChannel) State() (CTState, error) {
+	res := make(chan CTState, 1)
+	c.commands <- func() error {
+		res <- CTState{
+			KeyFingerprint: c.deal.fingerprint(),
+			Live: lo.MapToSlice(c.tosses, func(id UUID, toss *blsToss) CTInstanceState {
+				return CTInstanceState{Id: id, Shares: uint(len(toss.shares)), Required: uint(c.deal.threshold) + 1}
+			}),
+			Pending:   lo.Keys(c.unordered),
+			Finished:  lo.Keys(c.finished),
+			Admission: c.admission.State(),
+			Evidence:  c.evidence.snapshot(),
+		}
+		return nil
+	}
+	return <-res, nil
+}
+
+func (c *BLSCoinChannel) reportShare(kind MisbehaviourKind, share *blsShare) {
+	c.evidence.report(kind, share.sender, share.id, fmt.Sprint(share.index), share.sig.BytesCompressed())
+}
+
+// RegisterShareIndices binds the index of the share of each node, as CTChannel.RegisterShareIndices does.
+func (c *BLSCoinChannel) RegisterShareIndices(indices map[UUID]uint64) error {
+	if lo.ContainsBy(lo.Values(indices), func(index uint64) bool { return index == 0 || index > uint64(len(c.deal.pubShares)) }) {
+		return fmt.Errorf("share indices must be in [1, %d]", len(c.deal.pubShares))
+	}
+	c.commands <- func() error {
+		c.shareIds = lo.MapValues(indices, func(index uint64, _ UUID) uint16 { return uint16(index) })
+		return nil
+	}
+	return nil
+}
+
+// Evidence returns the evidence of misbehaviour that the channel gathered, oldest first.
+func (c *BLSCoinChannel) Evidence() []Evidence {
+	res := make(chan []Evidence, 1)
+	c.commands <- func() error {
+		res <- c.evidence.snapshot()
+		return nil
+	}
+	return <-res
+}
+
+func (c *BLSCoinChannel) processShare(share *blsShare) error {
+	if c.finished[share.id] || c.isCollected(share.id) {
+		return nil
+	} else if c.tosses[share.id] != nil {
+		return c.submitShare(share)
+	} else if !c.admission.Admit(share.id, share.sender, c.watermark) {
+		c.logger.Debug("rejected share of unadmitted coin", "id", share.id, "sender", share.sender)
+		return nil
+	}
+	c.unordered[share.id] = append(c.unordered[share.id], share)
+	return nil
+}
+
+func (c *BLSCoinChannel) broadcastShare(id UUID, sig bls12381.G2) error {
+	buf := bytes.NewBuffer(make([]byte, 0, len(id)+2+bls12381.G2SizeCompressed))
+	buf.Write(id[:])
+	_ = binary.Write(buf, binary.LittleEndian, c.deal.index)
+	buf.Write(sig.BytesCompressed())
+	c.beb.Transcript().RecordOutbound("ct", map[string]string{"instance": id.String(), "index": fmt.Sprint(c.deal.index)})
+	return c.beb.BEBroadcast(buf.Bytes())
+}
+
+func parseBLSShare(content []byte, sender UUID) (*blsShare, error) {
+	reader := bytes.NewReader(content)
+	share := &blsShare{sender: sender}
+	sigBytes := make([]byte, bls12381.G2SizeCompressed)
+	if _, err := io.ReadFull(reader, share.id[:]); err != nil {
+		return nil, fmt.Errorf("unable to read id: %v", err)
+	} else if err := binary.Read(reader, binary.LittleEndian, &share.index); err != nil {
+		return nil, fmt.Errorf("unable to read index: %v", err)
+	} else if _, err := io.ReadFull(reader, sigBytes); err != nil {
+		return nil, fmt.Errorf("unable to read signature share: %v", err)
+	} else if err := share.sig.SetBytes(sigBytes); err != nil {
+		return nil, fmt.Errorf("unable to decode signature share: %v", err)
+	} else if reader.Len() > 0 {
+		return nil, fmt.Errorf("%d trailing bytes after the share", reader.Len())
+	}
+	return share, nil
+}
+
+func (c *BLSCoinChannel) bebDeliver() {
+	for {
+		select {
+		case bebMsg := <-c.beb.GetBEBChan():
+			sender, err := utils.PkToUUID(bebMsg.Sender)
+			if err != nil {
+				c.logger.Warn("unable to compute sender id", "error", err)
+				continue
+			}
+			share, err := parseBLSShare(bebMsg.Content, sender)
+			if err != nil {
+				c.logger.Warn("unable to parse share", "sender", sender, "error", err)
+				continue
+			}
+			c.beb.Transcript().RecordInbound("ct", sender, map[string]string{"instance": share.id.String(), "index": fmt.Sprint(share.index), "sig": hex.EncodeToString(share.sig.BytesCompressed())})
+			c.commands <- func() error {
+				return c.processShare(share)
+			}
+		case <-c.closeDeliver:
+			c.logger.Info("closing deliver executor")
+			return
+		}
+	}
+}
+
+func (c *BLSCoinChannel) invoker() {
+	for {
+		select {
+		case command := <-c.commands:
+			if err := command(); err != nil {
+				c.logger.Warn("error executing command", "error", err)
+			}
+		case <-c.closeCommands:
+			c.logger.Info("closing executor")
+			return
+		}
+	}
+}
+
+func (c *BLSCoinChannel) Close() {
+	c.closeDeliver <- struct{}{}
+	c.closeCommands <- struct{}{}
+}
@@ -0,0 +1,70 @@
+package coinTosser
+
+import (
+	on "bkr-acs/overlayNetwork"
+	"bkr-acs/utils"
+	"fmt"
+	"github.com/cloudflare/circl/ecc/bls12381"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestBLSCoinShouldDeliverSameCoin(t *testing.T) {
+	numNodes, threshold := uint(4), uint(2)
+	nodes := lo.Map(lo.Range(int(numNodes)), func(i int, _ int) *on.Node {
+		return on.GetTestNode(t, fmt.Sprintf("localhost:%d", 6000+i), "localhost:6000")
+	})
+	bebChans := lo.Map(nodes, func(n *on.Node, _ int) *on.BEBChannel { return on.NewBEBChannel(n, 'c') })
+	on.InitializeNodes(t, nodes)
+	deals, err := DealBLSOffline(threshold, numNodes)
+	assert.NoError(t, err)
+	coins := lo.ZipBy2(deals, bebChans, func(d []byte, beb *on.BEBChannel) *BLSCoinChannel {
+		c, err := NewBLSCoinChannel(d, beb, utils.DefaultLogger())
+		assert.NoError(t, err)
+		return c
+	})
+	for _, seed := range []string{"first", "second"} {
+		outputChans := lo.Map(coins, func(*BLSCoinChannel, int) chan bool { return make(chan bool) })
+		for i, c := range coins {
+			c.TossCoin([]byte(seed), outputChans[i])
+		}
+		outcomes := lo.Map(outputChans, func(oc chan bool, _ int) bool { return <-oc })
+		assert.True(t, lo.EveryBy(outcomes, func(outcome bool) bool { return outcome == outcomes[0] }))
+	}
+	states := lo.Map(coins, func(c *BLSCoinChannel, _ int) CTState {
+		state, err := c.State()
+		assert.NoError(t, err)
+		return state
+	})
+	assert.True(t, lo.EveryBy(states, func(state CTState) bool { return state.KeyFingerprint == states[0].KeyFingerprint }))
+	for _, c := range coins {
+		c.Close()
+	}
+	assert.True(t, lo.EveryBy(nodes, func(n *on.Node) bool { return n.Close() == nil }))
+}
+
+func TestBLSCoinShouldCombineAnySharesIntoSameSignature(t *testing.T) {
+	deals := lo.Map(lo.Must(DealBLSOffline(2, 4)), func(d []byte, _ int) *blsDeal { return lo.Must(unmarshalBLSDeal(d)) })
+	base := hashSeed([]byte("seed"))
+	coins := lo.Map([][]int{{0, 1, 2}, {1, 2, 3}, {0, 2, 3}}, func(indices []int, _ int) bool {
+		shares := lo.SliceToMap(indices, func(i int) (uint16, *bls12381.G2) {
+			var sig bls12381.G2
+			sig.ScalarMult(&deals[i].share, &base)
+			return deals[i].index, &sig
+		})
+		return combineSignature(shares)
+	})
+	assert.True(t, lo.EveryBy(coins, func(coin bool) bool { return coin == coins[0] }))
+}
+
+func TestBLSCoinShouldRejectTamperedDeal(t *testing.T) {
+	deals, err := DealBLSOffline(2, 4)
+	assert.NoError(t, err)
+	_, err = unmarshalBLSDeal(deals[0])
+	assert.NoError(t, err)
+	tampered := append([]byte{}, deals[0]...)
+	tampered[5] ^= 1
+	_, err = unmarshalBLSDeal(tampered)
+	assert.Error(t, err)
+}
@@ -0,0 +1,153 @@
+package coinTosser
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"github.com/cloudflare/circl/ecc/bls12381"
+	"io"
+)
+
+// blsDeal is the share of the BLS coin key of one node, together with the public key shares of every node.
+// The share of node i is p(i) for a polynomial p of degree t whose p(0) is the key, and its public key share is p(i)·g1.
+type blsDeal struct {
+	index     uint16
+	threshold uint16
+	share     bls12381.Scalar
+	publicKey bls12381.G1
+	pubShares []bls12381.G1
+}
+
+// DealBLSOffline creates a random BLS coin key and splits it among numNodes nodes, as a trusted setup would.
+// Any threshold+1 nodes compute the coin of a seed, and each deal is loaded with NewBLSCoinChannel.
+func DealBLSOffline(threshold, numNodes uint) ([][]byte, error) {
+	if threshold >= numNodes || numNodes > 0xffff {
+		return nil, fmt.Errorf("unable to split a key among %d nodes with threshold %d", numNodes, threshold)
+	}
+	coefs := make([]bls12381.Scalar, threshold+1)
+	for i := range coefs {
+		if err := coefs[i].Random(rand.Reader); err != nil {
+			return nil, fmt.Errorf("unable to sample polynomial: %v", err)
+		}
+	}
+	shares := make([]bls12381.Scalar, numNodes)
+	pubShares := make([]bls12381.G1, numNodes)
+	for i := range shares {
+		shares[i] = evalPolynomial(coefs, uint64(i+1))
+		pubShares[i].ScalarMult(&shares[i], bls12381.G1Generator())
+	}
+	var publicKey bls12381.G1
+	publicKey.ScalarMult(&coefs[0], bls12381.G1Generator())
+	deals := make([][]byte, numNodes)
+	for i := range deals {
+		d := &blsDeal{index: uint16(i + 1), threshold: uint16(threshold), share: shares[i], publicKey: publicKey, pubShares: pubShares}
+		dealBytes, err := d.marshalBinary()
+		if err != nil {
+			return nil, fmt.Errorf("unable to marshal %d-th deal: %v", i, err)
+		}
+		deals[i] = dealBytes
+	}
+	return deals, nil
+}
+
+func evalPolynomial(coefs []bls12381.Scalar, x uint64) bls12381.Scalar {
+	var xs, res bls12381.Scalar
+	xs.SetUint64(x)
+	for i := len(coefs) - 1; i >= 0; i-- {
+		res.Mul(&res, &xs)
+		res.Add(&res, &coefs[i])
+	}
+	return res
+}
+
+// lagrangeAtZero is the coefficient of the share with the given index when interpolating p(0) from the shares of indices.
+func lagrangeAtZero(index uint16, indices []uint16) bls12381.Scalar {
+	var num, den, xi bls12381.Scalar
+	num.SetOne()
+	den.SetOne()
+	xi.SetUint64(uint64(index))
+	for _, j := range indices {
+		if j == index {
+			continue
+		}
+		var xj, diff bls12381.Scalar
+		xj.SetUint64(uint64(j))
+		diff.Sub(&xj, &xi)
+		num.Mul(&num, &xj)
+		den.Mul(&den, &diff)
+	}
+	den.Inv(&den)
+	num.Mul(&num, &den)
+	return num
+}
+
+func (d *blsDeal) marshalBinary() ([]byte, error) {
+	shareBytes, err := d.share.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal share: %v", err)
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, 6+len(shareBytes)+(len(d.pubShares)+1)*bls12381.G1SizeCompressed))
+	_ = binary.Write(buf, binary.LittleEndian, d.index)
+	_ = binary.Write(buf, binary.LittleEndian, d.threshold)
+	buf.Write(shareBytes)
+	buf.Write(d.publicKey.BytesCompressed())
+	_ = binary.Write(buf, binary.LittleEndian, uint16(len(d.pubShares)))
+	for _, pubShare := range d.pubShares {
+		buf.Write(pubShare.BytesCompressed())
+	}
+	return buf.Bytes(), nil
+}
+
+func unmarshalBLSDeal(data []byte) (*blsDeal, error) {
+	reader := bytes.NewReader(data)
+	d := &blsDeal{}
+	var numShares uint16
+	shareBytes := make([]byte, bls12381.ScalarSize)
+	if err := binary.Read(reader, binary.LittleEndian, &d.index); err != nil {
+		return nil, fmt.Errorf("unable to read index: %v", err)
+	} else if err := binary.Read(reader, binary.LittleEndian, &d.threshold); err != nil {
+		return nil, fmt.Errorf("unable to read threshold: %v", err)
+	} else if _, err := io.ReadFull(reader, shareBytes); err != nil {
+		return nil, fmt.Errorf("unable to read share: %v", err)
+	} else if err := d.share.UnmarshalBinary(shareBytes); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal share: %v", err)
+	} else if err := readG1(reader, &d.publicKey); err != nil {
+		return nil, fmt.Errorf("unable to read public key: %v", err)
+	} else if err := binary.Read(reader, binary.LittleEndian, &numShares); err != nil {
+		return nil, fmt.Errorf("unable to read number of public key shares: %v", err)
+	}
+	d.pubShares = make([]bls12381.G1, numShares)
+	for i := range d.pubShares {
+		if err := readG1(reader, &d.pubShares[i]); err != nil {
+			return nil, fmt.Errorf("unable to read %d-th public key share: %v", i, err)
+		}
+	}
+	if d.index == 0 || d.index > numShares || d.threshold >= numShares {
+		return nil, fmt.Errorf("deal of index %d and threshold %d does not fit %d nodes", d.index, d.threshold, numShares)
+	} else if reader.Len() > 0 {
+		return nil, fmt.Errorf("%d trailing bytes after the deal", reader.Len())
+	}
+	var expected bls12381.G1
+	expected.ScalarMult(&d.share, bls12381.G1Generator())
+	if !expected.IsEqual(&d.pubShares[d.index-1]) {
+		return nil, fmt.Errorf("share does not match its public key share")
+	}
+	return d, nil
+}
+
+func readG1(reader *bytes.Reader, point *bls12381.G1) error {
+	pointBytes := make([]byte, bls12381.G1SizeCompressed)
+	if _, err := io.ReadFull(reader, pointBytes); err != nil {
+		return err
+	}
+	return point.SetBytes(pointBytes)
+}
+
+// fingerprint identifies the public key of the deal, which is the same at every node.
+func (d *blsDeal) fingerprint() string {
+	digest := sha256.Sum256(d.publicKey.BytesCompressed())
+	return hex.EncodeToString(digest[:])
+}
@@ -11,8 +11,6 @@ import (
 	"log/slog"
 )
 
-var channelLogger = utils.GetLogger("CT Channel", slog.LevelWarn)
-
 type CoinObserver interface {
 	DeliverCoin(id UUID, toss bool)
 }
@@ -20,53 +18,125 @@ type CoinObserver interface {
 type CTChannel struct {
 	instances      map[UUID]*coinToss
 	finished       map[UUID]bool
+	watermark      uint64
+	admission      *utils.Admission
+	evidence       evidenceLog
+	shareIds       map[UUID]group.Scalar
+	previous       *deal
+	refresh        *refresher
+	closeRefresh   chan struct{}
 	outputChannels map[UUID]chan mo.Result[bool]
 	unordered      map[UUID][]func() error
 	t              uint
 	deal           *deal
 	middleware     *ctMiddleware
+	verifier       *shareVerifier
 	commands       chan func() error
 	closeCommands  chan struct{}
 	closeDeliver   chan struct{}
+	logger         *slog.Logger
+}
+
+func NewCoinTosserChannel(ssChan *on.SSChannel, bebChan *on.BEBChannel, t uint, logger *slog.Logger) (*CTChannel, error) {
+	c := newCoinTosserChannel(bebChan, t, logger)
+	go c.initializeChannel(ssChan)
+	c.logger.Info("initializing channel", "threshold", t)
+	return c, nil
 }
 
-func NewCoinTosserChannel(ssChan *on.SSChannel, bebChan *on.BEBChannel, t uint) (*CTChannel, error) {
+// NewCoinTosserChannelFromDeal creates a channel with one of the deals produced by DealOffline instead of waiting for a dealer.
+func NewCoinTosserChannelFromDeal(dealBytes []byte, bebChan *on.BEBChannel, t uint, logger *slog.Logger) (*CTChannel, error) {
+	d, err := unmarshalDeal(dealBytes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal deal: %v", err)
+	}
+	c := newCoinTosserChannel(bebChan, t, logger)
+	c.deal = d
+	go c.invoker()
+	c.logger.Info("initialized channel from offline deal", "threshold", t)
+	return c, nil
+}
+
+func newCoinTosserChannel(bebChan *on.BEBChannel, t uint, logger *slog.Logger) *CTChannel {
 	deliverChan := make(chan *msg)
 	c := &CTChannel{
 		instances:      make(map[UUID]*coinToss),
 		outputChannels: make(map[UUID]chan mo.Result[bool]),
 		unordered:      make(map[UUID][]func() error),
 		finished:       make(map[UUID]bool),
+		admission:      utils.NewAdmission(),
 		t:              t,
-		middleware:     newCTMiddleware(bebChan, deliverChan),
+		middleware:     newCTMiddleware(bebChan, deliverChan, logger),
 		commands:       make(chan func() error),
 		closeCommands:  make(chan struct{}, 1),
 		closeDeliver:   make(chan struct{}, 1),
+		closeRefresh:   make(chan struct{}),
+		logger:         utils.ComponentLogger(logger, "CT Channel", slog.LevelWarn),
 	}
-	go c.initializeChannel(ssChan)
+	c.verifier = newShareVerifier(c.commands, c.deliverVerified, logger)
 	go c.bebDeliver(deliverChan)
-	channelLogger.Info("initializing channel", "threshold", t)
-	return c, nil
+	return c
 }
 
 func (c *CTChannel) initializeChannel(ssChan *on.SSChannel) {
-	d, err := listenDeal(ssChan.GetSSChan())
+	d, err := listenDeal(ssChan.GetSSChan(), c.logger)
 	if err != nil {
-		channelLogger.Error("unable to listen deal", "error", err)
+		c.logger.Error("unable to listen deal", "error", err)
 		return
 	}
 	c.deal = d
-	channelLogger.Info("received deal. Starting to process commands")
+	c.logger.Info("received deal. Starting to process commands")
 	c.invoker()
 }
 
+// TossCoin contributes this node's share to the coin identified by seed.
+// Seeds that start with the id of the instance tossing the coin, as the ABA seeds do, give the coin the sequence of that instance.
+// No coin is output if the coin is collected before it is tossed.
 func (c *CTChannel) TossCoin(seed []byte, outputChan chan bool) {
+	tossChan := make(chan tossOutput)
+	go func() {
+		if output := <-tossChan; output.err == nil {
+			outputChan <- randomnessToBool(output.randomness)
+		}
+	}()
+	c.toss(seed, tossChan)
+}
+
+// TossIndex outputs an index below n, which every node obtains for seed, drawn from the randomness of a single toss.
+// The bias from reducing the 256 bits of randomness modulo n is negligible.
+func (c *CTChannel) TossIndex(seed []byte, n uint, outputChan chan uint) {
+	tossChan := make(chan tossOutput)
+	go func() {
+		if output := <-tossChan; output.err == nil {
+			outputChan <- randomnessToIndex(output.randomness, n)
+		}
+	}()
+	c.toss(seed, tossChan)
+}
+
+// tossOutput is the outcome of a toss: the 32 bytes of randomness and the shares they were recovered from, or an error
+// if the coin was collected before its toss completed.
+type tossOutput struct {
+	randomness []byte
+	proof      []shareProof
+	err        error
+}
+
+// toss contributes this node's share to the toss identified by seed, and outputs its outcome on outputChan exactly once.
+func (c *CTChannel) toss(seed []byte, outputChan chan tossOutput) {
 	c.commands <- func() error {
-		id := utils.BytesToUUID(seed)
+		id := coinId(seed)
+		if c.isCollected(id) {
+			c.logger.Debug("ignoring toss of collected coin", "id", id)
+			go func() { outputChan <- tossOutput{err: fmt.Errorf("coin %s is below the low watermark", id)} }()
+			return nil
+		}
 		base := group.Ristretto255.HashToElement(seed, []byte("coin_toss"))
-		ct := newCoinToss(c.t, base, c.deal, outputChan)
+		randomnessChan := make(chan []byte)
+		ct := newRandomnessToss(c.t, base, c.deal, randomnessChan, c.logger)
+		go c.finishOnOutput(id, ct, randomnessChan, c.recordCoin(id, outputChan))
 		c.instances[id] = ct
-		channelLogger.Debug("tossing coin", "id", id)
+		c.logger.Debug("tossing coin", "id", id)
 		share, err := ct.tossCoin()
 		if err != nil {
 			return fmt.Errorf("unable to create toss coin share: %v", err)
@@ -74,7 +144,7 @@ func (c *CTChannel) TossCoin(seed []byte, outputChan chan bool) {
 		go func() {
 			err = c.middleware.broadcastCTShare(id, share)
 			if err != nil {
-				ctLogger.Error("unable to broadcast coin toss share", "error", err)
+				c.logger.Error("unable to broadcast coin toss share", "error", err)
 			}
 		}()
 		c.processUnordered(id)
@@ -82,6 +152,97 @@ func (c *CTChannel) TossCoin(seed []byte, outputChan chan bool) {
 	}
 }
 
+func coinId(seed []byte) UUID {
+	if len(seed) < len(UUID{}) {
+		return utils.NewInstanceId(0, seed)
+	}
+	return utils.DeriveInstanceId(UUID(seed[:len(UUID{})]), seed[len(UUID{}):])
+}
+
+// finishOnOutput marks the coin as finished once it is computed, so that its state is released and late shares are ignored.
+// The shares combined into the coin are read by the invoker, after it has recorded the share that completed the coin.
+func (c *CTChannel) finishOnOutput(id UUID, ct *coinToss, randomnessChan <-chan []byte, outputChan chan tossOutput) {
+	select {
+	case randomness := <-randomnessChan:
+		proofChan := make(chan []shareProof, 1)
+		c.commands <- func() error {
+			proofChan <- ct.combinedProof()
+			if c.instances[id] == ct {
+				delete(c.instances, id)
+				c.finished[id] = true
+				go ct.close()
+			}
+			return nil
+		}
+		outputChan <- tossOutput{randomness: randomness, proof: <-proofChan}
+	case <-ct.done:
+		outputChan <- tossOutput{err: fmt.Errorf("coin %s was collected before its toss completed", id)}
+	}
+}
+
+// SetLowWatermark drops the state of the coins with a sequence below seq, and ignores their shares from then on.
+func (c *CTChannel) SetLowWatermark(seq uint64) {
+	c.commands <- func() error {
+		if seq <= c.watermark {
+			return nil
+		}
+		c.logger.Debug("raising low watermark", "from", c.watermark, "to", seq)
+		c.watermark = seq
+		c.admission.Collect(seq)
+		for id := range c.finished {
+			if c.isCollected(id) {
+				delete(c.finished, id)
+			}
+		}
+		for id := range c.unordered {
+			if c.isCollected(id) {
+				delete(c.unordered, id)
+			}
+		}
+		for id := range c.outputChannels {
+			if c.isCollected(id) {
+				delete(c.outputChannels, id)
+			}
+		}
+		for id, ct := range c.instances {
+			if c.isCollected(id) {
+				delete(c.instances, id)
+				go ct.close()
+			}
+		}
+		return nil
+	}
+}
+
+// SetAdmissionPolicy limits the coins for which peers can have shares buffered before this node tosses them.
+// Shares of coins that are not admitted are dropped, so the limits must leave room for the coins correct peers toss concurrently.
+func (c *CTChannel) SetAdmissionPolicy(policy utils.AdmissionPolicy) {
+	c.commands <- func() error {
+		c.admission.SetPolicy(policy)
+		return nil
+	}
+}
+
+func (c *CTChannel) isCollected(id UUID) bool {
+	return utils.InstanceSequence(id) < c.watermark
+}
+
+func (c *CTChannel) recordCoin(id UUID, outputChan chan tossOutput) chan tossOutput {
+	recorder := c.middleware.bebChannel.Transcript()
+	if !recorder.IsEnabled() {
+		return outputChan
+	}
+	recordedChan := make(chan tossOutput)
+	go func() {
+		output := <-recordedChan
+		if output.err == nil {
+			recorder.RecordDecision("ct", map[string]string{"instance": id.String(), "coin": fmt.Sprint(randomnessToBool(output.randomness))})
+		}
+		outputChan <- output
+	}()
+	return recordedChan
+}
+
 func (c *CTChannel) processUnordered(id UUID) {
 	for _, command := range c.unordered[id] {
 		err := command()
@@ -93,6 +254,7 @@ func (c *CTChannel) processUnordered(id UUID) {
 		}
 	}
 	delete(c.unordered, id)
+	c.admission.Release(id)
 }
 
 func (c *CTChannel) bebDeliver(deliverChan <-chan *msg) {
@@ -100,39 +262,93 @@ func (c *CTChannel) bebDeliver(deliverChan <-chan *msg) {
 		select {
 		case msg := <-deliverChan:
 			command := func() error { return c.submitShare(msg.id, msg.sender, msg.share) }
-			c.scheduleShareSubmission(msg.id, command)
+			c.scheduleShareSubmission(msg.id, msg.sender, command)
 		case <-c.closeDeliver:
-			channelLogger.Info("closing deliver executor")
+			c.logger.Info("closing deliver executor")
 			return
 		}
 	}
 }
 
+// submitShare hands a share to the verifier, along with the deal of its epoch. Shares of the epoch after the current
+// one are kept until this node refreshes its shares, and those of older epochs than the previous one are ignored.
 func (c *CTChannel) submitShare(id, senderId UUID, ctShare ctShare) error {
-	if c.finished[id] {
+	key := shareKey{sender: senderId, epoch: ctShare.epoch}
+	if c.finished[id] || c.isCollected(id) {
 		return nil
 	} else if ct := c.instances[id]; ct == nil {
 		return fmt.Errorf("coin toss instance not found")
-	} else if err := ct.submitShare(ctShare, senderId); err != nil {
-		return fmt.Errorf("unable to submit share: %v", err)
+	} else if ct.senders[key] {
+		c.evidence.reportShare(DuplicateShare, senderId, id, ctShare)
+		c.logger.Warn("peer sent a second share", "id", id, "sender", senderId, "epoch", ctShare.epoch)
+		return nil
+	} else if !c.checkShareId(id, senderId, ctShare) {
+		c.logger.Warn("peer sent a share with an unexpected id", "id", id, "sender", senderId)
+		return nil
+	} else if ctShare.epoch == c.deal.epoch+1 {
+		ct.senders[key] = true
+		ct.early = append(ct.early, &msg{id: id, sender: senderId, share: ctShare})
+		c.logger.Debug("kept share of the next epoch", "id", id, "sender", senderId, "epoch", ctShare.epoch)
+		return nil
+	} else if d := c.dealOf(ctShare.epoch); d == nil {
+		c.logger.Debug("ignoring share of a past epoch", "id", id, "sender", senderId, "epoch", ctShare.epoch)
+		return nil
+	} else {
+		ct.senders[key] = true
+		c.verifier.submit(verification{id: id, sender: senderId, toss: ct, deal: d, share: ctShare})
+	}
+	c.logger.Debug("submitted share for verification", "id", id, "sender", senderId)
+	return nil
+}
+
+// deliverVerified adds a verified share to its toss, unless the toss finished or was collected while it was verified.
+// Invalid shares are evidence even if the toss no longer needs them.
+func (c *CTChannel) deliverVerified(job verification, valid bool) func() error {
+	return func() error {
+		if !valid {
+			c.evidence.reportShare(InvalidShare, job.sender, job.id, job.share)
+			c.logger.Warn("peer sent an invalid share", "id", job.id, "sender", job.sender)
+			return nil
+		} else if c.instances[job.id] != job.toss {
+			return nil
+		} else if err := job.toss.sp.processShare(job.share.pt, job.share.epoch, job.sender); err != nil {
+			return fmt.Errorf("unable to submit share: %v", err)
+		}
+		job.toss.recordCombined(job.deal, job.share)
+		return nil
+	}
+}
+
+// dealOf returns the deal of the epoch, if it is the current or the previous one. The share of the previous deal is erased.
+func (c *CTChannel) dealOf(epoch uint64) *deal {
+	if epoch == c.deal.epoch {
+		return c.deal
+	} else if c.previous != nil && epoch == c.previous.epoch {
+		return c.previous
 	}
-	channelLogger.Debug("submitted share", "id", id, "sender", senderId)
 	return nil
 }
 
-func (c *CTChannel) scheduleShareSubmission(id UUID, command func() error) {
+func (c *CTChannel) scheduleShareSubmission(id, senderId UUID, command func() error) {
 	c.commands <- func() error {
 		if c.finished[id] {
-			ctLogger.Debug("ignoring share submission for finished instance", "id", id)
+			c.logger.Debug("ignoring share submission for finished instance", "id", id)
+			return nil
+		} else if c.isCollected(id) {
+			c.logger.Debug("ignoring share submission for collected instance", "id", id)
 			return nil
 		} else if c.instances[id] == nil {
-			ctLogger.Debug("scheduling share submission for uninitialized instance", "id", id)
+			if !c.admission.Admit(id, senderId, c.watermark) {
+				c.logger.Debug("rejected share of unadmitted instance", "id", id, "sender", senderId)
+				return nil
+			}
+			c.logger.Debug("scheduling share submission for uninitialized instance", "id", id)
 			if c.unordered[id] == nil {
 				c.unordered[id] = make([]func() error, 0)
 			}
 			c.unordered[id] = append(c.unordered[id], command)
 		} else {
-			ctLogger.Debug("submitting share for initialized instance", "id", id)
+			c.logger.Debug("submitting share for initialized instance", "id", id)
 			return command()
 		}
 		return nil
@@ -145,18 +361,20 @@ func (c *CTChannel) invoker() {
 		case command := <-c.commands:
 			err := command()
 			if err != nil {
-				channelLogger.Error("error executing command", "error", err)
+				c.logger.Error("error executing command", "error", err)
 			}
 		case <-c.closeCommands:
-			channelLogger.Info("closing executor")
+			c.logger.Info("closing executor")
 			return
 		}
 	}
 }
 
 func (c *CTChannel) Close() {
-	channelLogger.Info("signaling close deliver executor")
+	c.logger.Info("signaling close deliver executor")
 	c.closeDeliver <- struct{}{}
-	channelLogger.Info("signaling close commands executor")
+	c.logger.Info("signaling close commands executor")
 	c.closeCommands <- struct{}{}
+	close(c.closeRefresh)
+	c.verifier.close()
 }
@@ -2,6 +2,7 @@ package coinTosser
 
 import (
 	on "bkr-acs/overlayNetwork"
+	"bkr-acs/utils"
 	"fmt"
 	"github.com/samber/lo"
 	"github.com/stretchr/testify/assert"
@@ -38,7 +39,7 @@ func testShouldDeliverWithTheshold(t *testing.T, numNodes, threshold uint) {
 	})
 	on.InitializeNodes(t, nodes)
 	ctChannels := lo.ZipBy2(ssChans, bebChans, func(ss *on.SSChannel, beb *on.BEBChannel) *CTChannel {
-		ct, err := NewCoinTosserChannel(ss, beb, threshold)
+		ct, err := NewCoinTosserChannel(ss, beb, threshold, utils.DefaultLogger())
 		assert.NoError(t, err)
 		return ct
 	})
@@ -58,3 +59,58 @@ func testShouldDeliverWithTheshold(t *testing.T, numNodes, threshold uint) {
 	}
 	assert.True(t, lo.EveryBy(nodes, func(n *on.Node) bool { return n.Close() == nil }))
 }
+
+func TestChannelShouldDeliverWithOfflineDeal(t *testing.T) {
+	numNodes, threshold := uint(4), uint(2)
+	nodes := lo.Map(lo.Range(int(numNodes)), func(i int, _ int) *on.Node {
+		return on.GetTestNode(t, fmt.Sprintf("localhost:%d", 6000+i), "localhost:6000")
+	})
+	bebChans := lo.Map(nodes, func(n *on.Node, _ int) *on.BEBChannel { return on.NewBEBChannel(n, 'c') })
+	on.InitializeNodes(t, nodes)
+	deals, err := DealOffline(NewScalar(42), threshold, numNodes)
+	assert.NoError(t, err)
+	ctChannels := lo.ZipBy2(deals, bebChans, func(d []byte, beb *on.BEBChannel) *CTChannel {
+		ct, err := NewCoinTosserChannelFromDeal(d, beb, threshold, utils.DefaultLogger())
+		assert.NoError(t, err)
+		return ct
+	})
+	outputChans := lo.Map(ctChannels, func(ct *CTChannel, _ int) chan bool { return make(chan bool) })
+	for _, tuple := range lo.Zip2(ctChannels, outputChans) {
+		ct, oc := tuple.Unpack()
+		ct.TossCoin([]byte("test"), oc)
+	}
+	outcomes := lo.Map(outputChans, func(oc chan bool, _ int) bool { return <-oc })
+	assert.True(t, lo.EveryBy(outcomes, func(outcome bool) bool { return outcome == outcomes[0] }))
+	for _, ct := range ctChannels {
+		ct.Close()
+	}
+	assert.True(t, lo.EveryBy(nodes, func(n *on.Node) bool { return n.Close() == nil }))
+}
+
+func TestChannelShouldTossCommonIndex(t *testing.T) {
+	numNodes, threshold := uint(4), uint(1)
+	nodes := lo.Map(lo.Range(int(numNodes)), func(i int, _ int) *on.Node {
+		return on.GetTestNode(t, fmt.Sprintf("localhost:%d", 6000+i), "localhost:6000")
+	})
+	bebChans := lo.Map(nodes, func(n *on.Node, _ int) *on.BEBChannel { return on.NewBEBChannel(n, 'c') })
+	on.InitializeNodes(t, nodes)
+	deals, err := DealOffline(NewScalar(42), threshold, numNodes)
+	assert.NoError(t, err)
+	ctChannels := lo.ZipBy2(deals, bebChans, func(d []byte, beb *on.BEBChannel) *CTChannel {
+		ct, err := NewCoinTosserChannelFromDeal(d, beb, threshold, utils.DefaultLogger())
+		assert.NoError(t, err)
+		return ct
+	})
+	outputChans := lo.Map(ctChannels, func(ct *CTChannel, _ int) chan uint { return make(chan uint, 1) })
+	for _, tuple := range lo.Zip2(ctChannels, outputChans) {
+		ct, oc := tuple.Unpack()
+		ct.TossIndex([]byte("test"), 7, oc)
+	}
+	indices := lo.Map(outputChans, func(oc chan uint, _ int) uint { return <-oc })
+	assert.Less(t, indices[0], uint(7))
+	assert.True(t, lo.EveryBy(indices, func(idx uint) bool { return idx == indices[0] }))
+	for _, ct := range ctChannels {
+		ct.Close()
+	}
+	assert.True(t, lo.EveryBy(nodes, func(n *on.Node) bool { return n.Close() == nil }))
+}
@@ -0,0 +1,102 @@
+package coinTosser
+
+import (
+	"bkr-acs/utils"
+	"crypto/sha256"
+	"log/slog"
+	"math/rand/v2"
+)
+
+// Coin is a source of coins identified by seeds, such as the coins of the rounds of the binary agreements.
+// CTChannel, the threshold coin of Cachin, Kursawe and Shoup, is the default one.
+type Coin interface {
+	// TossCoin outputs the coin of seed on outputChan.
+	TossCoin(seed []byte, outputChan chan bool)
+	// Common tells whether every correct node obtains the same coin for a seed.
+	// Agreements whose safety depends on the coin, such as MMR, require a common coin.
+	Common() bool
+	SetLowWatermark(seq uint64)
+	SetAdmissionPolicy(policy utils.AdmissionPolicy)
+	State() (CTState, error)
+}
+
+// Common holds for the threshold coin.
+func (c *CTChannel) Common() bool {
+	return true
+}
+
+// stateless implements the parts of the Coin interface that coins without instances do not need.
+type stateless struct{}
+
+func (stateless) SetLowWatermark(uint64)                   {}
+func (stateless) SetAdmissionPolicy(utils.AdmissionPolicy) {}
+func (stateless) State() (CTState, error)                  { return CTState{}, nil }
+
+type localCoin struct {
+	stateless
+}
+
+// NewLocalCoin flips an independent coin at each node, as in the agreement of Ben-Or.
+// It needs no setup and no messages, but it is not common, so only agreements that tolerate it can use it.
+func NewLocalCoin() Coin {
+	return localCoin{}
+}
+
+func (localCoin) TossCoin(_ []byte, outputChan chan bool) {
+	go func() { outputChan <- rand.IntN(2) == 1 }()
+}
+
+func (localCoin) Common() bool {
+	return false
+}
+
+// Beacon is a source of public randomness that returns the same value for a seed at every node.
+type Beacon interface {
+	Value(seed []byte) ([]byte, error)
+}
+
+type hashBeacon struct {
+	key []byte
+}
+
+// NewHashBeacon is the beacon that hashes the seeds with a key known to every node, such as a value published by an
+// external randomness beacon before the nodes start. It needs no setup, but whoever knows the key predicts every value.
+func NewHashBeacon(key []byte) Beacon {
+	return hashBeacon{key: key}
+}
+
+func (b hashBeacon) Value(seed []byte) ([]byte, error) {
+	hash := sha256.New()
+	hash.Write(b.key)
+	hash.Write(seed)
+	return hash.Sum(nil), nil
+}
+
+type beaconCoin struct {
+	stateless
+	beacon Beacon
+	logger *slog.Logger
+}
+
+// NewBeaconCoin takes the coin of each seed from the lowest bit of the value of a beacon.
+// The coin is common, but it is only as unpredictable as the beacon, so it is a weak coin: an adversary that learns the
+// coins in advance can schedule messages to delay the agreements, although it cannot make them disagree.
+func NewBeaconCoin(beacon Beacon, logger *slog.Logger) Coin {
+	return beaconCoin{beacon: beacon, logger: utils.ComponentLogger(logger, "Beacon Coin", slog.LevelWarn)}
+}
+
+// TossCoin outputs no coin if the beacon fails, since outputting a guess could make the nodes disagree.
+func (c beaconCoin) TossCoin(seed []byte, outputChan chan bool) {
+	go func() {
+		value, err := c.beacon.Value(seed)
+		if err != nil || len(value) == 0 {
+			c.logger.Error("unable to get beacon value", "error", err)
+			return
+		}
+		outputChan <- value[len(value)-1]&1 == 1
+	}()
+}
+
+func (beaconCoin) Common() bool {
+	return true
+}
@@ -0,0 +1,35 @@
+package coinTosser
+
+import (
+	"bkr-acs/utils"
+	"fmt"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestBeaconCoinShouldBeCommon(t *testing.T) {
+	coins := lo.Times(4, func(int) Coin { return NewBeaconCoin(NewHashBeacon([]byte("key")), utils.DefaultLogger()) })
+	outcomes := lo.Times(16, func(i int) []bool {
+		return lo.Map(coins, func(c Coin, _ int) bool {
+			outputChan := make(chan bool)
+			c.TossCoin([]byte(fmt.Sprint(i)), outputChan)
+			return <-outputChan
+		})
+	})
+	assert.True(t, lo.EveryBy(outcomes, func(o []bool) bool { return lo.EveryBy(o, func(coin bool) bool { return coin == o[0] }) }))
+	assert.True(t, lo.SomeBy(outcomes, func(o []bool) bool { return o[0] }))
+	assert.True(t, lo.SomeBy(outcomes, func(o []bool) bool { return !o[0] }))
+	assert.True(t, coins[0].Common())
+}
+
+func TestLocalCoinShouldNotBeCommon(t *testing.T) {
+	coin := NewLocalCoin()
+	outputChan := make(chan bool)
+	coin.TossCoin([]byte("seed"), outputChan)
+	<-outputChan
+	assert.False(t, coin.Common())
+	state, err := coin.State()
+	assert.NoError(t, err)
+	assert.Empty(t, state.Live)
+}
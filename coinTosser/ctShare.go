@@ -1,33 +1,49 @@
 package coinTosser
 
 import (
+	"encoding/binary"
+	"encoding/hex"
 	"fmt"
-	"github.com/cloudflare/circl/group"
-	"github.com/cloudflare/circl/zk/dleq"
+	"github.com/google/uuid"
+	"unsafe"
 )
 
+// ctShare is the share of a coin of a node, made with its share of the given epoch.
 type ctShare struct {
+	epoch uint64
 	pt    pointShare
-	proof dleq.Proof
+	proof dleqProof
 }
 
 func emptyCTShare() ctShare {
 	return ctShare{
 		pt:    emptyPointShare(),
-		proof: dleq.Proof{},
+		proof: emptyDLEQProof(),
 	}
 }
 
+func (s *ctShare) fields(id uuid.UUID) map[string]string {
+	fields := map[string]string{"instance": id.String()}
+	if shareBytes, err := s.marshalBinary(); err == nil {
+		fields["share"] = hex.EncodeToString(shareBytes)
+	}
+	return fields
+}
+
 func (s *ctShare) unmarshalBinary(data []byte) error {
 	pt := emptyPointShare()
-	proof := dleq.Proof{}
+	proof := emptyDLEQProof()
+	epochSize := int(unsafe.Sizeof(s.epoch))
 	if ptSize, err := getPointShareSize(); err != nil {
 		return fmt.Errorf("unable to get point share size: %v", err)
-	} else if err := pt.unmarshalBinary(data[:ptSize]); err != nil {
+	} else if len(data) < epochSize+ptSize {
+		return fmt.Errorf("share too short: got %d bytes", len(data))
+	} else if err := pt.unmarshalBinary(data[epochSize : epochSize+ptSize]); err != nil {
 		return fmt.Errorf("unable to unmarshal point share: %v", err)
-	} else if err := proof.UnmarshalBinary(group.Ristretto255, data[ptSize:]); err != nil {
+	} else if err := proof.unmarshalBinary(data[epochSize+ptSize:]); err != nil {
 		return fmt.Errorf("unable to unmarshal proof: %v", err)
 	}
+	s.epoch = binary.LittleEndian.Uint64(data[:epochSize])
 	s.pt = pt
 	s.proof = proof
 	return nil
@@ -38,9 +54,10 @@ func (s *ctShare) marshalBinary() ([]byte, error) {
 	if err != nil {
 		return nil, fmt.Errorf("unable to marshal point share: %v", err)
 	}
-	proofBytes, err := s.proof.MarshalBinary()
+	proofBytes, err := s.proof.marshalBinary()
 	if err != nil {
 		return nil, fmt.Errorf("unable to marshal proof: %v", err)
 	}
-	return append(ptBytes, proofBytes...), nil
+	epochBytes := binary.LittleEndian.AppendUint64(nil, s.epoch)
+	return append(append(epochBytes, ptBytes...), proofBytes...), nil
 }
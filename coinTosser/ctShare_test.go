@@ -2,10 +2,8 @@ package coinTosser
 
 import (
 	"bytes"
-	"crypto"
 	"crypto/rand"
 	"github.com/cloudflare/circl/group"
-	"github.com/cloudflare/circl/zk/dleq"
 	"github.com/stretchr/testify/assert"
 	"testing"
 )
@@ -18,6 +16,8 @@ func TestShouldUnmarshalCTShare(t *testing.T) {
 	err = recovCT.unmarshalBinary(data)
 	assert.NoError(t, err)
 	assert.True(t, arePointShareEquals(t, ogCT.pt, recovCT.pt))
+	assert.True(t, areProofsEqual(t, &ogCT.proof, &recovCT.proof))
+	assert.Error(t, recovCT.unmarshalBinary(data[:len(data)-1]))
 }
 
 func genCTShare(t *testing.T) ctShare {
@@ -31,22 +31,19 @@ func genCTShare(t *testing.T) ctShare {
 	return ctShare{pt: pt, proof: *proof}
 }
 
-func genProof(t *testing.T, val group.Scalar, base group.Element) *dleq.Proof {
-	params := dleq.Params{G: group.Ristretto255, H: crypto.SHA256, DST: []byte("ctShare_test")}
-	prover := dleq.Prover{Params: params}
+func genProof(t *testing.T, val group.Scalar, base group.Element) *dleqProof {
 	commitBase := group.Ristretto255.RandomElement(rand.Reader)
-	rnd := group.Ristretto255.RandomScalar(rand.Reader)
 	hiddenVal := mulPoint(base, val)
 	commitment := mulPoint(commitBase, val)
-	proof, err := prover.ProveWithRandomness(val, base, hiddenVal, commitBase, commitment, rnd)
+	proof, err := proveDLEQ(val, commitBase, base, commitment, hiddenVal)
 	assert.NoError(t, err)
-	return proof
+	return &proof
 }
 
-func areProofsEqual(t *testing.T, a, b *dleq.Proof) bool {
-	aBytes, err := a.MarshalBinary()
+func areProofsEqual(t *testing.T, a, b *dleqProof) bool {
+	aBytes, err := a.marshalBinary()
 	assert.NoError(t, err)
-	bBytes, err := b.MarshalBinary()
+	bBytes, err := b.marshalBinary()
 	assert.NoError(t, err)
 	return bytes.Equal(aBytes, bBytes)
 }
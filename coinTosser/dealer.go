@@ -6,7 +6,9 @@ import (
 	"bufio"
 	"bytes"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/binary"
+	"encoding/hex"
 	"fmt"
 	"github.com/cloudflare/circl/group"
 	ss "github.com/cloudflare/circl/secretsharing"
@@ -15,13 +17,88 @@ import (
 	"unsafe"
 )
 
-var dealLogger = utils.GetLogger("Deal", slog.LevelWarn)
-
 func DealSecret(ssChannel *on.SSChannel, secret group.Scalar, threshold uint) error {
+	dealLogger := utils.ComponentLogger(ssChannel.Logger(), "Deal", slog.LevelWarn)
 	dealLogger.Info("dealing secret", "secret", secret, "threshold", threshold)
 	return ssChannel.SSBroadcast(secret, threshold, computeCommitment)
 }
 
+// DealOffline splits the secret among numNodes nodes without a network, as a trusted setup would.
+// Each deal holds the share of one node followed by the public commitment, and is loaded with NewCoinTosserChannelFromDeal.
+func DealOffline(secret group.Scalar, threshold, numNodes uint) ([][]byte, error) {
+	shares := shareSecret(threshold, numNodes, secret)
+	commitment, err := computeCommitment(shares)
+	if err != nil {
+		return nil, fmt.Errorf("unable to compute commitment: %v", err)
+	}
+	deals := make([][]byte, len(shares))
+	for i, share := range shares {
+		shareBytes, err := marshalShare(share)
+		if err != nil {
+			return nil, fmt.Errorf("unable to marshal %d-th share: %v", i, err)
+		}
+		deals[i] = append(shareBytes, commitment...)
+	}
+	return deals, nil
+}
+
+// unmarshalDeal reads a deal written by DealOffline, or by marshalDeal after a refresh, in which case the epoch follows the commitment.
+func unmarshalDeal(data []byte) (*deal, error) {
+	scalarSize, err := utils.GetScalarSize()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get scalar size: %v", err)
+	} else if len(data) < 2*scalarSize {
+		return nil, fmt.Errorf("deal is too short: got %d bytes, expected at least %d", len(data), 2*scalarSize)
+	}
+	share, err := unmarshalShare(data[:2*scalarSize])
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal share: %v", err)
+	}
+	commitment, epoch, err := splitEpoch(data[2*scalarSize:])
+	if err != nil {
+		return nil, fmt.Errorf("unable to read epoch: %v", err)
+	}
+	base, commits, err := unmarshalCommitment(commitment)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal commitment: %v", err)
+	}
+	return &deal{base: base, share: share, commits: commits, epoch: epoch}, nil
+}
+
+// splitEpoch separates the commitment from the epoch that may follow it.
+func splitEpoch(data []byte) ([]byte, uint64, error) {
+	elementSize, err := getElementSize()
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to get element size: %v", err)
+	}
+	pointShareSize, err := getPointShareSize()
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to get point share size: %v", err)
+	}
+	commitLen, _, err := unmarshalCommitLen(data[min(elementSize, len(data)):])
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to unmarshal commitment length: %v", err)
+	}
+	commitmentSize := elementSize + int(unsafe.Sizeof(commitLen)) + int(commitLen)*pointShareSize
+	if len(data) == commitmentSize+int(unsafe.Sizeof(uint64(0))) {
+		return data[:commitmentSize], binary.LittleEndian.Uint64(data[commitmentSize:]), nil
+	}
+	return data, 0, nil
+}
+
+// marshalDeal writes the deal in the format of DealOffline, followed by its epoch.
+func marshalDeal(d *deal) ([]byte, error) {
+	shareBytes, err := marshalShare(d.share)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal share: %v", err)
+	}
+	commitment, err := marshalCommitment(d.base, d.commits)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal commitment: %v", err)
+	}
+	return binary.LittleEndian.AppendUint64(append(shareBytes, commitment...), d.epoch), nil
+}
+
 func computeCommitment(shares []ss.Share) ([]byte, error) {
 	base := group.Ristretto255.RandomElement(rand.Reader)
 	commits := lo.Map(shares, func(share ss.Share, _ int) pointShare { return shareToPoint(share, base) })
@@ -66,13 +143,25 @@ func writeCommitment(base []byte, commits [][]byte) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// deal is the share of a node and the commitments to the shares of every node. The epoch counts the refreshes of the shares.
 type deal struct {
 	base    group.Element
 	share   ss.Share
 	commits []pointShare
+	epoch   uint64
+}
+
+// fingerprint identifies the public part of the deal, which is the same at every node.
+func (d *deal) fingerprint() (string, error) {
+	commitment, err := marshalCommitment(d.base, d.commits)
+	if err != nil {
+		return "", fmt.Errorf("unable to marshal commitment: %v", err)
+	}
+	digest := sha256.Sum256(commitment)
+	return hex.EncodeToString(digest[:]), nil
 }
 
-func listenDeal(ssChan <-chan *on.SSMsg) (*deal, error) {
+func listenDeal(ssChan <-chan *on.SSMsg, logger *slog.Logger) (*deal, error) {
 	ssMsg := <-ssChan
 	if ssMsg.Err != nil {
 		return nil, fmt.Errorf("received error message: %v", ssMsg.Err)
@@ -82,8 +171,8 @@ func listenDeal(ssChan <-chan *on.SSMsg) (*deal, error) {
 	if err != nil {
 		return nil, fmt.Errorf("unable to unmarshal commitment: %v", err)
 	}
-	dealLogger.Info("received deal", "share", share, "base", base, "commits", commits)
-	return &deal{base, share, commits}, nil
+	utils.ComponentLogger(logger, "Deal", slog.LevelWarn).Info("received deal", "share", share, "base", base, "commits", commits)
+	return &deal{base: base, share: share, commits: commits}, nil
 }
 
 func unmarshalCommitment(data []byte) (group.Element, []pointShare, error) {
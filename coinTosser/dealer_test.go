@@ -2,6 +2,7 @@ package coinTosser
 
 import (
 	on "bkr-acs/overlayNetwork"
+	"bkr-acs/utils"
 	"fmt"
 	"github.com/cloudflare/circl/group"
 	ss "github.com/cloudflare/circl/secretsharing"
@@ -17,7 +18,7 @@ func TestShouldDealToSelf(t *testing.T) {
 	secret := group.Ristretto255.NewScalar().SetUint64(42)
 	err := DealSecret(ssChan, secret, 0)
 	assert.NoError(t, err)
-	d, err := listenDeal(ssChan.GetSSChan())
+	d, err := listenDeal(ssChan.GetSSChan(), utils.DefaultLogger())
 	assert.NoError(t, err)
 	assert.Equal(t, secret, d.share.Value)
 	assert.NoError(t, node.Close())
@@ -62,7 +63,7 @@ func TestShouldDealRecoverableSecret(t *testing.T) {
 }
 
 func listenDealTest(t *testing.T, ssChan *on.SSChannel) *deal {
-	d, err := listenDeal(ssChan.GetSSChan())
+	d, err := listenDeal(ssChan.GetSSChan(), utils.DefaultLogger())
 	assert.NoError(t, err)
 	return d
 }
@@ -0,0 +1,265 @@
+package coinTosser
+
+import (
+	"crypto/rand"
+	"fmt"
+	"github.com/cloudflare/circl/group"
+	"github.com/samber/lo"
+	"math/bits"
+)
+
+// dleqProof is a Chaum-Pedersen proof that a coin share and the commitment of its sender have the same discrete log.
+// It carries the commitments of the prover instead of the challenge, which is recomputed from them, so that the
+// verification equations of several proofs can be checked at once with a random linear combination.
+type dleqProof struct {
+	a group.Element
+	b group.Element
+	s group.Scalar
+}
+
+// dleqStatement claims that log_g(commit) = log_h(point), as proven by proof.
+type dleqStatement struct {
+	g, h, commit, point group.Element
+	proof               dleqProof
+}
+
+func emptyDLEQProof() dleqProof {
+	return dleqProof{a: group.Ristretto255.NewElement(), b: group.Ristretto255.NewElement(), s: group.Ristretto255.NewScalar()}
+}
+
+// proveDLEQ proves that commit = x·g and point = x·h.
+func proveDLEQ(x group.Scalar, g, h, commit, point group.Element) (dleqProof, error) {
+	r := group.Ristretto255.RandomScalar(rand.Reader)
+	a := mulPoint(g, r)
+	b := mulPoint(h, r)
+	c, err := dleqChallenge(g, h, commit, point, a, b)
+	if err != nil {
+		return dleqProof{}, fmt.Errorf("unable to compute challenge: %v", err)
+	}
+	s := group.Ristretto255.NewScalar().Mul(c, x)
+	s.Add(s, r)
+	return dleqProof{a: a, b: b, s: s}, nil
+}
+
+func dleqChallenge(elements ...group.Element) (group.Scalar, error) {
+	encoded, err := encodeElements(elements...)
+	if err != nil {
+		return nil, err
+	}
+	return hashChallenge(encoded), nil
+}
+
+func encodeElements(elements ...group.Element) ([][]byte, error) {
+	encoded := make([][]byte, 0, len(elements))
+	for _, element := range elements {
+		elementBytes, err := element.MarshalBinary()
+		if err != nil {
+			return nil, fmt.Errorf("unable to marshal element: %v", err)
+		}
+		encoded = append(encoded, elementBytes)
+	}
+	return encoded, nil
+}
+
+func hashChallenge(encoded [][]byte) group.Scalar {
+	return group.Ristretto255.HashToScalar(lo.Flatten(encoded), []byte(dleqDst))
+}
+
+// dleqTerms are the elements of the equations of a statement, in the order in which the challenge hashes them, with their
+// encodings and the challenge, computed once for all the batches the statement joins.
+type dleqTerms struct {
+	elements []group.Element
+	encoded  [][]byte
+	c, s     group.Scalar
+}
+
+func (st *dleqStatement) terms() (dleqTerms, error) {
+	elements := []group.Element{st.g, st.h, st.commit, st.point, st.proof.a, st.proof.b}
+	encoded, err := encodeElements(elements...)
+	if err != nil {
+		return dleqTerms{}, err
+	}
+	return dleqTerms{elements: elements, encoded: encoded, c: hashChallenge(encoded), s: st.proof.s}, nil
+}
+
+func (st *dleqStatement) verify() bool {
+	t, err := st.terms()
+	return err == nil && t.verify()
+}
+
+// verify checks s·g = a + c·commit and s·h = b + c·point.
+func (t *dleqTerms) verify() bool {
+	g, h, commit, point, a, b := t.elements[0], t.elements[1], t.elements[2], t.elements[3], t.elements[4], t.elements[5]
+	lhsG := mulPoint(g, t.s)
+	rhsG := group.Ristretto255.NewElement().Add(a, mulPoint(commit, t.c))
+	lhsH := mulPoint(h, t.s)
+	rhsH := group.Ristretto255.NewElement().Add(b, mulPoint(point, t.c))
+	return lhsG.IsEqual(rhsG) && lhsH.IsEqual(rhsH)
+}
+
+// verifyDLEQBatch checks that the sum of the equations of every statement, each weighted by a random scalar, holds.
+// It holds for valid statements, and holds with negligible probability otherwise, so a failure only says that some statement
+// is invalid. Terms with the same element, such as the bases of shares of the same toss, are added up, and the sum is
+// computed with a single multi-scalar multiplication.
+func verifyDLEQBatch(batch []dleqTerms) bool {
+	combination := newLinearCombination()
+	for _, t := range batch {
+		rhoG := group.Ristretto255.RandomScalar(rand.Reader)
+		rhoH := group.Ristretto255.RandomScalar(rand.Reader)
+		coefs := []group.Scalar{
+			group.Ristretto255.NewScalar().Mul(rhoG, t.s),
+			group.Ristretto255.NewScalar().Mul(rhoH, t.s),
+			group.Ristretto255.NewScalar().Neg(group.Ristretto255.NewScalar().Mul(rhoG, t.c)),
+			group.Ristretto255.NewScalar().Neg(group.Ristretto255.NewScalar().Mul(rhoH, t.c)),
+			group.Ristretto255.NewScalar().Neg(rhoG),
+			group.Ristretto255.NewScalar().Neg(rhoH),
+		}
+		for i, element := range t.elements {
+			combination.add(t.encoded[i], element, coefs[i])
+		}
+	}
+	total, err := combination.sum()
+	return err == nil && total.IsIdentity()
+}
+
+// verifyDLEQs tells which statements hold. It checks them in a batch, and splits a failed batch in halves that are
+// checked in turn, so that a few invalid statements cost a few batches over the valid ones instead of a check for each.
+func verifyDLEQs(statements []dleqStatement) []bool {
+	valid := make([]bool, len(statements))
+	indices := make([]int, 0, len(statements))
+	batch := make([]dleqTerms, 0, len(statements))
+	for i, st := range statements {
+		if t, err := st.terms(); err == nil {
+			indices, batch = append(indices, i), append(batch, t)
+		}
+	}
+	for j, ok := range verifyDLEQHalves(batch) {
+		valid[indices[j]] = ok
+	}
+	return valid
+}
+
+// minBatch is the size up to which checking the statements one by one costs less than a batch and its halves.
+const minBatch = 2
+
+// verifyDLEQHalves checks the batch, and if it fails, each of its halves. Batches of minBatch statements or fewer are
+// checked one by one.
+func verifyDLEQHalves(batch []dleqTerms) []bool {
+	if len(batch) <= minBatch {
+		return lo.Map(batch, func(t dleqTerms, _ int) bool { return t.verify() })
+	} else if verifyDLEQBatch(batch) {
+		return lo.Times(len(batch), func(int) bool { return true })
+	}
+	half := len(batch) / 2
+	return append(verifyDLEQHalves(batch[:half]), verifyDLEQHalves(batch[half:])...)
+}
+
+// linearCombination adds up the coefficients of equal elements, and sums the products of all distinct elements at once.
+type linearCombination struct {
+	elements map[string]group.Element
+	coefs    map[string]group.Scalar
+}
+
+func newLinearCombination() *linearCombination {
+	return &linearCombination{elements: make(map[string]group.Element), coefs: make(map[string]group.Scalar)}
+}
+
+// add adds coef·element to the combination, where the element is identified by its encoding.
+func (l *linearCombination) add(encoded []byte, element group.Element, coef group.Scalar) {
+	key := string(encoded)
+	if l.coefs[key] == nil {
+		l.elements[key], l.coefs[key] = element, group.Ristretto255.NewScalar()
+	}
+	l.coefs[key].Add(l.coefs[key], coef)
+}
+
+func (l *linearCombination) sum() (group.Element, error) {
+	elements := make([]group.Element, 0, len(l.elements))
+	coefs := make([][]byte, 0, len(l.elements))
+	for key, element := range l.elements {
+		coefBytes, err := l.coefs[key].MarshalBinary()
+		if err != nil {
+			return nil, fmt.Errorf("unable to marshal coefficient: %v", err)
+		}
+		elements, coefs = append(elements, element), append(coefs, coefBytes)
+	}
+	return multiScalarMul(elements, coefs), nil
+}
+
+// multiScalarMul computes the sum of coefs[i]·elements[i] with the bucket method of Pippenger, whose coefficients are
+// little-endian scalars. The doublings are shared by all the terms, and each window of the coefficients costs one
+// addition per term plus a fixed number per window, which is far less than a multiplication per term.
+// It does not run in constant time, which is fine since the coefficients are public or random.
+func multiScalarMul(elements []group.Element, coefs [][]byte) group.Element {
+	width := max(1, bits.Len(uint(len(elements)))-3)
+	coefBits := 8 * lo.Max(lo.Map(coefs, func(coef []byte, _ int) int { return len(coef) }))
+	total := group.Ristretto255.Identity()
+	for window := (coefBits + width - 1) / width; window > 0; window-- {
+		for i := 0; i < width; i++ {
+			total.Dbl(total)
+		}
+		buckets := make([]group.Element, 1<<width)
+		for i, element := range elements {
+			digit := coefDigit(coefs[i], (window-1)*width, width)
+			if digit == 0 {
+				continue
+			} else if buckets[digit] == nil {
+				buckets[digit] = element.Copy()
+			} else {
+				buckets[digit].Add(buckets[digit], element)
+			}
+		}
+		running, windowSum := group.Ristretto255.Identity(), group.Ristretto255.Identity()
+		for digit := len(buckets) - 1; digit > 0; digit-- {
+			if buckets[digit] != nil {
+				running.Add(running, buckets[digit])
+			}
+			windowSum.Add(windowSum, running)
+		}
+		total.Add(total, windowSum)
+	}
+	return total
+}
+
+// coefDigit reads the width bits of the little-endian coefficient that start at bit offset.
+func coefDigit(coef []byte, offset, width int) int {
+	digit := 0
+	for i := 0; i < width; i++ {
+		if bit := offset + i; bit/8 < len(coef) && coef[bit/8]>>(bit%8)&1 == 1 {
+			digit |= 1 << i
+		}
+	}
+	return digit
+}
+
+func (p *dleqProof) marshalBinary() ([]byte, error) {
+	aBytes, err := p.a.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal first commitment: %v", err)
+	}
+	bBytes, err := p.b.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal second commitment: %v", err)
+	}
+	sBytes, err := p.s.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal response: %v", err)
+	}
+	return append(append(aBytes, bBytes...), sBytes...), nil
+}
+
+func (p *dleqProof) unmarshalBinary(data []byte) error {
+	elementSize, err := getElementSize()
+	if err != nil {
+		return fmt.Errorf("unable to get element size: %v", err)
+	} else if len(data) < 2*elementSize {
+		return fmt.Errorf("proof too short: got %d bytes", len(data))
+	} else if err := p.a.UnmarshalBinary(data[:elementSize]); err != nil {
+		return fmt.Errorf("unable to unmarshal first commitment: %v", err)
+	} else if err := p.b.UnmarshalBinary(data[elementSize : 2*elementSize]); err != nil {
+		return fmt.Errorf("unable to unmarshal second commitment: %v", err)
+	} else if err := p.s.UnmarshalBinary(data[2*elementSize:]); err != nil {
+		return fmt.Errorf("unable to unmarshal response: %v", err)
+	}
+	return nil
+}
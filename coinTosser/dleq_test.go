@@ -0,0 +1,103 @@
+package coinTosser
+
+import (
+	"crypto/rand"
+	"fmt"
+	"github.com/cloudflare/circl/group"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDLEQProofShouldVerify(t *testing.T) {
+	st := genStatement(t, group.Ristretto255.RandomElement(rand.Reader))
+	assert.True(t, st.verify())
+	st.point = group.Ristretto255.RandomElement(rand.Reader)
+	assert.False(t, st.verify())
+}
+
+func TestDLEQBatchShouldVerifyValidProofs(t *testing.T) {
+	statements := genStatements(t, 8)
+	assert.True(t, verifyDLEQBatch(genTerms(t, statements)))
+}
+
+func TestDLEQBatchShouldRejectOneInvalidProof(t *testing.T) {
+	statements := genStatements(t, 8)
+	statements[5].proof.s = group.Ristretto255.RandomScalar(rand.Reader)
+	assert.False(t, verifyDLEQBatch(genTerms(t, statements)))
+	assert.Equal(t, 5, lo.IndexOf(lo.Map(statements, func(st dleqStatement, _ int) bool { return st.verify() }), false))
+}
+
+func TestDLEQsShouldTellInvalidProofsApart(t *testing.T) {
+	statements := genStatements(t, 11)
+	statements[2].proof.s = group.Ristretto255.RandomScalar(rand.Reader)
+	statements[9].point = group.Ristretto255.RandomElement(rand.Reader)
+	valid := verifyDLEQs(statements)
+	assert.Equal(t, []int{2, 9}, lo.Filter(lo.Range(11), func(i int, _ int) bool { return !valid[i] }))
+}
+
+func TestMultiScalarMulShouldSumProducts(t *testing.T) {
+	for _, n := range []int{1, 7, 70} {
+		elements := lo.Times(n, func(int) group.Element { return group.Ristretto255.RandomElement(rand.Reader) })
+		scalars := lo.Times(n, func(int) group.Scalar { return group.Ristretto255.RandomScalar(rand.Reader) })
+		expected := group.Ristretto255.Identity()
+		coefs := lo.Map(scalars, func(s group.Scalar, i int) []byte {
+			expected.Add(expected, mulPoint(elements[i], s))
+			coef, err := s.MarshalBinary()
+			assert.NoError(t, err)
+			return coef
+		})
+		assert.True(t, expected.IsEqual(multiScalarMul(elements, coefs)))
+	}
+}
+
+func BenchmarkDLEQSequential(b *testing.B) {
+	statements := genStatements(&testing.T{}, maxBatch)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, st := range statements {
+			st.verify()
+		}
+	}
+}
+
+func BenchmarkDLEQBatch(b *testing.B) {
+	statements := genStatements(&testing.T{}, maxBatch)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		verifyDLEQs(statements)
+	}
+}
+
+func BenchmarkDLEQBatchOneInvalid(b *testing.B) {
+	statements := genStatements(&testing.T{}, maxBatch)
+	statements[maxBatch/2].proof.s = group.Ristretto255.RandomScalar(rand.Reader)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		verifyDLEQs(statements)
+	}
+}
+
+func genStatements(t *testing.T, n int) []dleqStatement {
+	bases := lo.Times(2, func(i int) group.Element {
+		return group.Ristretto255.HashToElement([]byte(fmt.Sprint(i)), []byte("dleq_test"))
+	})
+	return lo.Times(n, func(i int) dleqStatement { return genStatement(t, bases[i%2]) })
+}
+
+func genTerms(t *testing.T, statements []dleqStatement) []dleqTerms {
+	return lo.Map(statements, func(st dleqStatement, _ int) dleqTerms {
+		terms, err := st.terms()
+		assert.NoError(t, err)
+		return terms
+	})
+}
+
+func genStatement(t *testing.T, h group.Element) dleqStatement {
+	g := group.Ristretto255.HashToElement([]byte("commit"), []byte("dleq_test"))
+	x := group.Ristretto255.RandomScalar(rand.Reader)
+	commit, point := mulPoint(g, x), mulPoint(h, x)
+	proof, err := proveDLEQ(x, g, h, commit, point)
+	assert.NoError(t, err)
+	return dleqStatement{g: g, h: h, commit: commit, point: point, proof: proof}
+}
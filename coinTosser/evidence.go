@@ -0,0 +1,108 @@
+package coinTosser
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/cloudflare/circl/group"
+	. "github.com/google/uuid"
+	"github.com/samber/lo"
+)
+
+// maxEvidence bounds the evidence kept by a channel. The oldest evidence is dropped first.
+const maxEvidence = 1024
+
+// MisbehaviourKind is the fault that a piece of evidence shows.
+type MisbehaviourKind string
+
+const (
+	// InvalidShare is a share whose proof does not verify.
+	InvalidShare MisbehaviourKind = "invalidShare"
+	// DuplicateShare is a second share of a sender for the same toss.
+	DuplicateShare MisbehaviourKind = "duplicateShare"
+	// UnknownShareId is a share with an id that the deal does not commit to.
+	UnknownShareId MisbehaviourKind = "unknownShareId"
+	// ForeignShareId is a share with an id other than the one registered for its sender.
+	ForeignShareId MisbehaviourKind = "foreignShareId"
+	// InvalidRefresh is a contribution to a refresh of the shares that does not match its commitments, or the ones agreed.
+	InvalidRefresh MisbehaviourKind = "invalidRefresh"
+)
+
+// Evidence is a share that shows that its sender misbehaved. Shares arrive over authenticated channels, so the sender is
+// the node that sent it, but the share is not signed and only convinces the node that received it.
+type Evidence struct {
+	Kind     MisbehaviourKind `json:"kind"`
+	Sender   UUID             `json:"sender"`
+	Instance UUID             `json:"instance"`
+	ShareId  string           `json:"shareId"`
+	Share    []byte           `json:"share"`
+}
+
+// evidenceLog keeps the latest evidence gathered by a channel.
+type evidenceLog struct {
+	entries []Evidence
+}
+
+func (l *evidenceLog) report(kind MisbehaviourKind, sender, instance UUID, shareId string, share []byte) {
+	l.entries = append(l.entries, Evidence{Kind: kind, Sender: sender, Instance: instance, ShareId: shareId, Share: share})
+	if len(l.entries) > maxEvidence {
+		l.entries = l.entries[len(l.entries)-maxEvidence:]
+	}
+}
+
+func (l *evidenceLog) snapshot() []Evidence {
+	return append([]Evidence{}, l.entries...)
+}
+
+func (l *evidenceLog) reportShare(kind MisbehaviourKind, sender, instance UUID, share ctShare) {
+	var shareBytes []byte
+	if marshalled, err := share.marshalBinary(); err == nil {
+		shareBytes = marshalled
+	}
+	l.report(kind, sender, instance, scalarId(share.pt.id), shareBytes)
+}
+
+func scalarId(id group.Scalar) string {
+	idBytes, err := id.MarshalBinary()
+	if err != nil {
+		return ""
+	}
+	return hex.EncodeToString(idBytes)
+}
+
+// Evidence returns the evidence of misbehaviour that the channel gathered, oldest first.
+func (c *CTChannel) Evidence() []Evidence {
+	res := make(chan []Evidence, 1)
+	c.commands <- func() error {
+		res <- c.evidence.snapshot()
+		return nil
+	}
+	return <-res
+}
+
+// RegisterShareIndices binds the index of the share of each node, which is the index of its share file with an offline deal.
+// From then on, only the shares of a node with its own index are combined, and shares of unregistered nodes are evidence.
+// Without registration, the shares of a toss are combined as long as no two have the same index.
+func (c *CTChannel) RegisterShareIndices(indices map[UUID]uint64) error {
+	if lo.Contains(lo.Values(indices), 0) {
+		return fmt.Errorf("share indices start at 1")
+	}
+	c.commands <- func() error {
+		c.shareIds = lo.MapValues(indices, func(index uint64, _ UUID) group.Scalar { return NewScalar(index) })
+		return nil
+	}
+	return nil
+}
+
+// checkShareId reports the share as evidence if the deal does not commit to its id, or if the id is not the one registered for its sender.
+func (c *CTChannel) checkShareId(id, sender UUID, share ctShare) bool {
+	if _, err := c.deal.getCommit(share.pt.id); err != nil {
+		c.evidence.reportShare(UnknownShareId, sender, id, share)
+		return false
+	} else if c.shareIds == nil {
+		return true
+	} else if registered, ok := c.shareIds[sender]; !ok || !registered.IsEqual(share.pt.id) {
+		c.evidence.reportShare(ForeignShareId, sender, id, share)
+		return false
+	}
+	return true
+}
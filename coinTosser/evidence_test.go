@@ -0,0 +1,96 @@
+package coinTosser
+
+import (
+	on "bkr-acs/overlayNetwork"
+	"bkr-acs/utils"
+	"github.com/cloudflare/circl/group"
+	. "github.com/google/uuid"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestChannelShouldReportMisbehavingSenders(t *testing.T) {
+	node := on.GetTestNode(t, "localhost:6200", "localhost:6200")
+	beb := on.NewBEBChannel(node, 'c')
+	on.InitializeNodes(t, []*on.Node{node})
+	dealBytes, err := DealOffline(NewScalar(42), 1, 4)
+	assert.NoError(t, err)
+	deals := lo.Map(dealBytes, func(d []byte, _ int) *deal { return lo.Must(unmarshalDeal(d)) })
+	c, err := NewCoinTosserChannelFromDeal(dealBytes[0], beb, 1, utils.DefaultLogger())
+	assert.NoError(t, err)
+	ownId := lo.Must(node.GetId())
+	honest, foreign, forger, stranger := New(), New(), New(), New()
+	assert.NoError(t, c.RegisterShareIndices(map[UUID]uint64{ownId: 1, honest: 2, foreign: 3, forger: 4}))
+	seed := []byte("evidence")
+	base := group.Ristretto255.HashToElement(seed, []byte("coin_toss"))
+	shares := lo.Map(deals, func(d *deal, _ int) ctShare {
+		return lo.Must(newCoinToss(1, base, d, make(chan bool, 1), utils.DefaultLogger()).tossCoin())
+	})
+	forged := shares[3]
+	forged.proof = shares[2].proof
+	unknown := shares[2]
+	unknown.pt.id = NewScalar(100)
+	outputChan := make(chan bool, 1)
+	c.TossCoin(seed, outputChan)
+	id := coinId(seed)
+	submit := func(sender UUID, share ctShare) {
+		c.commands <- func() error { return c.submitShare(id, sender, share) }
+	}
+	submit(foreign, shares[1])
+	submit(forger, forged)
+	submit(forger, shares[3])
+	submit(stranger, unknown)
+	submit(honest, shares[1])
+	<-outputChan
+	expected := []lo.Tuple2[MisbehaviourKind, UUID]{{A: ForeignShareId, B: foreign}, {A: DuplicateShare, B: forger}, {A: UnknownShareId, B: stranger}, {A: InvalidShare, B: forger}}
+	assert.Eventually(t, func() bool {
+		evidence := lo.Map(c.Evidence(), func(e Evidence, _ int) lo.Tuple2[MisbehaviourKind, UUID] { return lo.T2(e.Kind, e.Sender) })
+		return assert.ObjectsAreEqual(expected, evidence)
+	}, 5*time.Second, 10*time.Millisecond)
+	state, err := c.State()
+	assert.NoError(t, err)
+	assert.Len(t, state.Evidence, len(expected))
+	c.Close()
+	assert.NoError(t, node.Close())
+}
+
+func TestBLSCoinShouldReportMisbehavingSenders(t *testing.T) {
+	node := on.GetTestNode(t, "localhost:6210", "localhost:6210")
+	beb := on.NewBEBChannel(node, 'c')
+	on.InitializeNodes(t, []*on.Node{node})
+	dealBytes, err := DealBLSOffline(1, 4)
+	assert.NoError(t, err)
+	deals := lo.Map(dealBytes, func(d []byte, _ int) *blsDeal { return lo.Must(unmarshalBLSDeal(d)) })
+	c, err := NewBLSCoinChannel(dealBytes[0], beb, utils.DefaultLogger())
+	assert.NoError(t, err)
+	honest, foreign, forger, stranger := New(), New(), New(), New()
+	assert.NoError(t, c.RegisterShareIndices(map[UUID]uint64{lo.Must(node.GetId()): 1, honest: 2, foreign: 3, forger: 4}))
+	seed := []byte("evidence")
+	base := hashSeed(seed)
+	outputChan := make(chan bool, 1)
+	c.TossCoin(seed, outputChan)
+	id := coinId(seed)
+	submit := func(sender UUID, index uint16, signer *blsDeal) {
+		share := &blsShare{id: id, index: index, sender: sender}
+		share.sig.ScalarMult(&signer.share, &base)
+		c.commands <- func() error {
+			if err := c.processShare(share); err != nil {
+				c.logger.Warn("unable to process share", "error", err)
+			}
+			return nil
+		}
+	}
+	submit(foreign, 2, deals[1])
+	submit(forger, 4, deals[2])
+	submit(forger, 4, deals[3])
+	submit(stranger, 9, deals[3])
+	submit(honest, 2, deals[1])
+	<-outputChan
+	evidence := lo.Map(c.Evidence(), func(e Evidence, _ int) lo.Tuple2[MisbehaviourKind, UUID] { return lo.T2(e.Kind, e.Sender) })
+	expected := []lo.Tuple2[MisbehaviourKind, UUID]{{A: ForeignShareId, B: foreign}, {A: InvalidShare, B: forger}, {A: DuplicateShare, B: forger}, {A: UnknownShareId, B: stranger}}
+	assert.Equal(t, expected, evidence)
+	c.Close()
+	assert.NoError(t, node.Close())
+}
@@ -2,75 +2,84 @@ package coinTosser
 
 import (
 	"bkr-acs/utils"
-	"crypto"
-	"encoding/binary"
 	"fmt"
 	"github.com/cloudflare/circl/group"
-	"github.com/cloudflare/circl/zk/dleq"
 	. "github.com/google/uuid"
+	"github.com/samber/lo"
 	"log/slog"
-	"math/rand"
-	"unsafe"
 )
 
-var ctLogger = utils.GetLogger("CT Instance", slog.LevelWarn)
-
 const dleqDst = "DLEQ"
 
+// coinToss gathers the shares of a coin. Its deal is the one of the latest epoch of this node, with which it makes its own shares.
 type coinToss struct {
-	base group.Element
-	d    *deal
-	sp   *shareProcessor
+	base     group.Element
+	d        *deal
+	sp       *shareProcessor
+	senders  map[shareKey]bool
+	early    []*msg
+	combined map[uint64][]shareProof
+	done     chan struct{}
+	logger   *slog.Logger
 }
 
-func newCoinToss(threshold uint, base group.Element, d *deal, outputChan chan bool) *coinToss {
-	sp := newShareProcessor(threshold, outputChan)
-	ct := &coinToss{
-		base: base,
-		d:    d,
-		sp:   sp,
-	}
-	ctLogger.Info("new coin toss created", "threshold", threshold, "base", base)
+// shareKey identifies the share of a sender for an epoch. A node sends one share of each coin per epoch it goes through while the coin is tossed.
+type shareKey struct {
+	sender UUID
+	epoch  uint64
+}
+
+func newCoinToss(threshold uint, base group.Element, d *deal, outputChan chan bool, logger *slog.Logger) *coinToss {
+	randomnessChan := make(chan []byte)
+	ct := newRandomnessToss(threshold, base, d, randomnessChan, logger)
+	go func() {
+		select {
+		case randomness := <-randomnessChan:
+			outputChan <- randomnessToBool(randomness)
+		case <-ct.done:
+		}
+	}()
 	return ct
 }
 
-// Go does not allow structs as const values, so this is here to replace it :(
-func getDLEQParams() dleq.Params {
-	return dleq.Params{G: group.Ristretto255, H: crypto.SHA256, DST: []byte(dleqDst)}
+// newRandomnessToss creates a toss that outputs the 32 bytes hashed from the point recovered from the shares,
+// from which both the coins and the values of the random beacon are taken.
+func newRandomnessToss(threshold uint, base group.Element, d *deal, outputChan chan []byte, logger *slog.Logger) *coinToss {
+	logger = utils.ComponentLogger(logger, "CT Instance", slog.LevelWarn)
+	sp := newShareProcessor(threshold, outputChan, logger)
+	ct := &coinToss{
+		base:     base,
+		d:        d,
+		sp:       sp,
+		senders:  make(map[shareKey]bool),
+		combined: make(map[uint64][]shareProof),
+		done:     make(chan struct{}),
+		logger:   logger,
+	}
+	ct.logger.Info("new coin toss created", "threshold", threshold, "base", base)
+	return ct
 }
 
 func (ct *coinToss) tossCoin() (ctShare, error) {
-	ctLogger.Info("tossing coin")
+	ct.logger.Info("tossing coin")
 	share := shareToPoint(ct.d.share, ct.base)
 	proof, err := ct.genProof(share.point)
 	if err != nil {
 		return ctShare{}, fmt.Errorf("unable to generate proof: %v", err)
 	}
-	return ctShare{pt: share, proof: proof}, nil
+	return ctShare{epoch: ct.d.epoch, pt: share, proof: proof}, nil
 }
 
-// Strange that the prover can choose the randomness seed for the proof
-// TODO: I have to check the proof and see if this is secure. And if not warn the Circl devs
-func (ct *coinToss) genProof(valToProve group.Element) (dleq.Proof, error) {
-	seed := ct.computeProofSeed()
+func (ct *coinToss) genProof(valToProve group.Element) (dleqProof, error) {
 	myCommit, err := ct.d.getCommit(ct.d.share.ID)
 	if err != nil {
-		return dleq.Proof{}, fmt.Errorf("unable to get my commitment: %v", err)
+		return dleqProof{}, fmt.Errorf("unable to get my commitment: %v", err)
 	}
-	params := getDLEQParams()
-	prover := dleq.Prover{Params: params}
-	proof, err := prover.ProveWithRandomness(ct.d.share.Value, ct.base, valToProve, ct.d.base, *myCommit, seed)
+	proof, err := proveDLEQ(ct.d.share.Value, ct.d.base, ct.base, *myCommit, valToProve)
 	if err != nil {
-		return dleq.Proof{}, fmt.Errorf("unable to generate proof: %v", err)
+		return dleqProof{}, fmt.Errorf("unable to generate proof: %v", err)
 	}
-	return *proof, nil
-}
-
-func (ct *coinToss) computeProofSeed() group.Scalar {
-	seed := make([]byte, unsafe.Sizeof(uint32(0)))
-	binary.LittleEndian.PutUint32(seed, rand.Uint32())
-	scalarSeed := group.Ristretto255.HashToScalar(seed, []byte("dleqSeed"))
-	return scalarSeed
+	return proof, nil
 }
 
 func (d *deal) getCommit(idx group.Scalar) (*group.Element, error) {
@@ -86,90 +95,141 @@ func (d *deal) getCommit(idx group.Scalar) (*group.Element, error) {
 }
 
 func (ct *coinToss) submitShare(ctShare ctShare, senderId UUID) error {
-	ctLogger.Debug("received share", "share", ctShare.pt, "sender", senderId)
+	ct.logger.Debug("received share", "share", ctShare.pt, "sender", senderId)
 	isValid, err := ct.isTossValid(ctShare)
 	if err != nil {
 		return fmt.Errorf("unable to validate share from peer %v: %v", senderId, err)
 	} else if !isValid {
 		return fmt.Errorf("invalid share from peer %v", senderId)
+	} else if err := ct.sp.processShare(ctShare.pt, ctShare.epoch, senderId); err != nil {
+		return err
+	}
+	ct.recordCombined(ct.d, ctShare)
+	return nil
+}
+
+// recordCombined keeps a share accepted by the share processor, with the commitment its proof refers to, in the order
+// the processor received it, so that the first t+1 shares of an epoch are those the coin was recovered from.
+func (ct *coinToss) recordCombined(d *deal, share ctShare) {
+	if commit, err := d.getCommit(share.pt.id); err != nil {
+		ct.logger.Warn("unable to record combined share", "error", err)
 	} else {
-		return ct.sp.processShare(ctShare.pt, senderId)
+		ct.combined[share.epoch] = append(ct.combined[share.epoch], shareProof{commit: *commit, share: share})
 	}
 }
 
+// combinedProof returns the shares the coin was recovered from, which anyone can check against the group key.
+func (ct *coinToss) combinedProof() []shareProof {
+	for _, shares := range ct.combined {
+		if uint(len(shares)) > ct.sp.t {
+			return shares[:ct.sp.t+1]
+		}
+	}
+	return nil
+}
+
 func (ct *coinToss) isTossValid(share ctShare) (bool, error) {
-	peerCommit, err := ct.d.getCommit(share.pt.id)
+	st, err := ct.statement(ct.d, share)
+	if err != nil {
+		return false, err
+	}
+	return st.verify(), nil
+}
+
+// statement is the claim proven by a share: its point hides the share of the commitment of its id in the deal of its epoch.
+func (ct *coinToss) statement(d *deal, share ctShare) (dleqStatement, error) {
+	peerCommit, err := d.getCommit(share.pt.id)
 	if err != nil {
-		return false, fmt.Errorf("unable to get peer commitment: %v", err)
+		return dleqStatement{}, fmt.Errorf("unable to get peer commitment: %v", err)
 	}
-	verifier := dleq.Verifier{Params: getDLEQParams()}
-	return verifier.Verify(ct.base, share.pt.point, ct.d.base, *peerCommit, &share.proof), nil
+	return dleqStatement{g: d.base, h: ct.base, commit: *peerCommit, point: share.pt.point, proof: share.proof}, nil
 }
 
+// shareProcessor combines the first t+1 shares of the same epoch. Shares of different epochs lie on different polynomials,
+// so they are never combined together, although any t+1 shares of an epoch recover the same point.
 type shareProcessor struct {
 	t            uint
-	shares       []pointShare
-	receivedFrom map[UUID]bool
-	outputChan   chan bool
+	shares       map[uint64][]pointShare
+	computed     bool
+	receivedFrom map[shareKey]bool
+	outputChan   chan []byte
 	commands     chan<- func()
 	closeChan    chan struct{}
+	logger       *slog.Logger
 }
 
-func newShareProcessor(t uint, outputChan chan bool) *shareProcessor {
+func newShareProcessor(t uint, outputChan chan []byte, logger *slog.Logger) *shareProcessor {
 	commands := make(chan func())
 	sp := &shareProcessor{
 		t:            t,
-		shares:       make([]pointShare, 0),
-		receivedFrom: make(map[UUID]bool),
+		shares:       make(map[uint64][]pointShare),
+		receivedFrom: make(map[shareKey]bool),
 		outputChan:   outputChan,
 		commands:     commands,
 		closeChan:    make(chan struct{}),
+		logger:       logger,
 	}
 	go sp.invoker(commands, sp.closeChan)
 	return sp
 }
 
-func (sp *shareProcessor) processShare(share pointShare, senderId UUID) error {
+func (sp *shareProcessor) processShare(share pointShare, epoch uint64, senderId UUID) error {
 	errChan := make(chan error)
 	sp.commands <- func() {
-		if sp.receivedFrom[senderId] {
-			errChan <- fmt.Errorf("peer %v already sent share", senderId)
+		key := shareKey{sender: senderId, epoch: epoch}
+		if sp.receivedFrom[key] {
+			errChan <- fmt.Errorf("peer %v already sent share of epoch %d", senderId, epoch)
+			return
+		} else if lo.ContainsBy(sp.shares[epoch], func(s pointShare) bool { return s.id.IsEqual(share.id) }) {
+			errChan <- fmt.Errorf("share of index %v was already combined", share.id)
+			return
 		}
-		sp.receivedFrom[senderId] = true
-		sp.shares = append(sp.shares, share)
-		ctLogger.Debug("received share", "num received", len(sp.shares), "required", sp.t+1)
-		if len(sp.shares) == int(sp.t+1) {
-			ctLogger.Info("received all shares required to compute coin")
-			secretPoint := recoverSecretFromPoints(sp.shares)
-			coin, err := hashPointToBool(secretPoint)
-			ctLogger.Info("computed random coin", "coin", coin)
+		sp.receivedFrom[key] = true
+		sp.shares[epoch] = append(sp.shares[epoch], share)
+		sp.logger.Debug("received share", "epoch", epoch, "num received", len(sp.shares[epoch]), "required", sp.t+1)
+		if !sp.computed && len(sp.shares[epoch]) == int(sp.t+1) {
+			sp.logger.Info("received all shares required to compute coin", "epoch", epoch)
+			sp.computed = true
+			secretPoint := recoverSecretFromPoints(sp.shares[epoch])
+			randomness, err := hashPoint(secretPoint)
 			if err != nil {
-				errChan <- fmt.Errorf("unable to hash point to bool: %v", err)
+				errChan <- fmt.Errorf("unable to hash point: %v", err)
+				return
 			}
-			go func() { sp.outputChan <- coin }()
+			sp.logger.Info("computed randomness", "randomness", randomness)
+			go func() { sp.outputChan <- randomness }()
 		}
 		errChan <- nil
 	}
 	return <-errChan
 }
 
+func (sp *shareProcessor) numShares() uint {
+	res := make(chan uint, 1)
+	sp.commands <- func() {
+		res <- uint(lo.Max(lo.Map(lo.Values(sp.shares), func(shares []pointShare, _ int) int { return len(shares) })))
+	}
+	return <-res
+}
+
 func (sp *shareProcessor) invoker(commands <-chan func(), closeChan <-chan struct{}) {
 	for {
 		select {
 		case command := <-commands:
 			command()
 		case <-closeChan:
-			ctLogger.Info("closing share processor")
+			sp.logger.Info("closing share processor")
 			return
 		}
 	}
 }
 
 func (sp *shareProcessor) close() {
-	ctLogger.Info("sending signal to close share processor")
+	sp.logger.Info("sending signal to close share processor")
 	sp.closeChan <- struct{}{}
 }
 
 func (ct *coinToss) close() {
+	close(ct.done)
 	ct.sp.close()
 }
@@ -10,8 +10,6 @@ import (
 	"log/slog"
 )
 
-var middlewareLogger = utils.GetLogger("CT Middleware", slog.LevelWarn)
-
 type msg struct {
 	id     uuid.UUID
 	sender uuid.UUID
@@ -22,16 +20,18 @@ type ctMiddleware struct {
 	bebChannel  *overlayNetwork.BEBChannel
 	deliverChan chan<- *msg
 	closeChan   chan struct{}
+	logger      *slog.Logger
 }
 
-func newCTMiddleware(bebChannel *overlayNetwork.BEBChannel, deliverChan chan<- *msg) *ctMiddleware {
+func newCTMiddleware(bebChannel *overlayNetwork.BEBChannel, deliverChan chan<- *msg, logger *slog.Logger) *ctMiddleware {
 	m := &ctMiddleware{
 		bebChannel:  bebChannel,
 		deliverChan: deliverChan,
 		closeChan:   make(chan struct{}, 1),
+		logger:      utils.ComponentLogger(logger, "CT Middleware", slog.LevelWarn),
 	}
 	go m.bebDeliver(bebChannel.GetBEBChan())
-	middlewareLogger.Info("new CT middleware created")
+	m.logger.Info("new CT middleware created")
 	return m
 }
 
@@ -41,9 +41,10 @@ func (m *ctMiddleware) bebDeliver(bebChan <-chan overlayNetwork.BEBMsg) {
 		case bebMsg := <-bebChan:
 			structMsg, err := m.processMsg(bebMsg.Content, bebMsg.Sender)
 			if err != nil {
-				channelLogger.Warn("unable to processMsg message during beb delivery", "error", err)
+				m.logger.Warn("unable to processMsg message during beb delivery", "error", err)
+				continue
 			}
-			middlewareLogger.Debug("beb message delivered", "instance", structMsg.id, "sender", structMsg.sender, "share", structMsg.share)
+			m.logger.Debug("beb message delivered", "instance", structMsg.id, "sender", structMsg.sender, "share", structMsg.share)
 			m.deliverChan <- structMsg
 		case <-m.closeChan:
 			return
@@ -68,6 +69,7 @@ func (m *ctMiddleware) processMsg(content []byte, sender *ecdsa.PublicKey) (*msg
 	} else if err := share.unmarshalBinary(shareBytes); err != nil {
 		return nil, fmt.Errorf("unable to unmarshal share: %v", err)
 	}
+	m.bebChannel.Transcript().RecordInbound("ct", senderId, share.fields(id))
 	return &msg{
 		id:     id,
 		sender: senderId,
@@ -76,7 +78,8 @@ func (m *ctMiddleware) processMsg(content []byte, sender *ecdsa.PublicKey) (*msg
 }
 
 func (m *ctMiddleware) broadcastCTShare(id uuid.UUID, share ctShare) error {
-	middlewareLogger.Debug("broadcasting CT share", "instance", id, "share", share)
+	m.logger.Debug("broadcasting CT share", "instance", id, "share", share)
+	m.bebChannel.Transcript().RecordOutbound("ct", share.fields(id))
 	idBytes, err := id.MarshalBinary()
 	if err != nil {
 		return fmt.Errorf("unable to marshal id: %v", err)
@@ -2,6 +2,7 @@ package coinTosser
 
 import (
 	on "bkr-acs/overlayNetwork"
+	"bkr-acs/utils"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"testing"
@@ -12,7 +13,7 @@ func TestShouldUnmarshalCTShareMessage(t *testing.T) {
 	bebChannel := on.NewBEBChannel(node, 'c')
 	on.InitializeNodes(t, []*on.Node{node})
 	deliverChan := make(chan *msg)
-	m := newCTMiddleware(bebChannel, deliverChan)
+	m := newCTMiddleware(bebChannel, deliverChan, utils.DefaultLogger())
 	id := uuid.New()
 	share := genCTShare(t)
 	err := m.broadcastCTShare(id, share)
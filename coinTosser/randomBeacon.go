@@ -0,0 +1,164 @@
+package coinTosser
+
+import (
+	"bkr-acs/utils"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	. "github.com/google/uuid"
+	"github.com/samber/lo"
+	"slices"
+	"sync"
+)
+
+const beaconName = "beacon"
+
+// BeaconEntry is a value of the chain of the random beacon.
+// Value hashes the round, the value of the previous round and the randomness tossed from them, and Proof holds the shares
+// the randomness was recovered from, so the chain can be checked against the group key with VerifyChain.
+type BeaconEntry struct {
+	Round      uint64 `json:"round"`
+	Previous   []byte `json:"previous"`
+	Randomness []byte `json:"randomness"`
+	Proof      []byte `json:"proof"`
+	Value      []byte `json:"value"`
+}
+
+// RandomBeacon outputs public randomness from the secret of a threshold coin: no coalition of up to t nodes can predict
+// or bias a value before a correct node contributes its share to it. Every node of the channel must request the same rounds.
+// The channel should be dedicated to the beacon, since raising its low watermark would drop the values of earlier sequences.
+type RandomBeacon struct {
+	lock     sync.Mutex
+	ctChan   *CTChannel
+	previous BeaconEntry
+}
+
+func NewRandomBeacon(ctChan *CTChannel) *RandomBeacon {
+	return &RandomBeacon{ctChan: ctChan, previous: BeaconEntry{Value: make([]byte, sha256.Size)}}
+}
+
+// Value returns the 32 uniform bytes tossed for seed, which do not depend on the chain.
+// It implements Beacon, so NewBeaconCoin can toss coins from it. It fails if the toss is collected before it completes.
+func (b *RandomBeacon) Value(seed []byte) ([]byte, error) {
+	output := b.toss(seed)
+	return output.randomness, output.err
+}
+
+func (b *RandomBeacon) toss(seed []byte) tossOutput {
+	outputChan := make(chan tossOutput)
+	b.ctChan.toss(seed, outputChan)
+	return <-outputChan
+}
+
+// Next tosses the value of the round after the last one, seeded with that round and the value of the previous one.
+// The first round is 1, and it follows a value of zeros.
+func (b *RandomBeacon) Next() (BeaconEntry, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	round, previous := b.previous.Round+1, b.previous.Value
+	output := b.toss(beaconSeed(round, previous))
+	if output.err != nil {
+		return BeaconEntry{}, fmt.Errorf("unable to toss randomness of round %d: %v", round, output.err)
+	}
+	proof, err := marshalTossProof(output.proof)
+	if err != nil {
+		return BeaconEntry{}, fmt.Errorf("unable to marshal proof of round %d: %v", round, err)
+	}
+	b.previous = BeaconEntry{Round: round, Previous: previous, Randomness: output.randomness, Proof: proof, Value: chainValue(round, previous, output.randomness)}
+	return b.previous, nil
+}
+
+func beaconSeed(round uint64, previous []byte) []byte {
+	id := utils.NewInstanceId(round, []byte(beaconName))
+	return append(id[:], previous...)
+}
+
+func chainValue(round uint64, previous, randomness []byte) []byte {
+	hash := sha256.New()
+	_ = binary.Write(hash, binary.LittleEndian, round)
+	hash.Write(previous)
+	hash.Write(randomness)
+	return hash.Sum(nil)
+}
+
+// VerifyChain checks that the entries are consecutive rounds, each linked to the value of the one before, with the value
+// hashed from its randomness and with a proof that the randomness was tossed by the nodes holding the shares of groupKey,
+// as returned by CTChannel.GroupKey.
+func VerifyChain(entries []BeaconEntry, groupKey []byte) error {
+	for i, entry := range entries {
+		if i > 0 && entry.Round != entries[i-1].Round+1 {
+			return fmt.Errorf("round %d follows round %d", entry.Round, entries[i-1].Round)
+		} else if i > 0 && !bytes.Equal(entry.Previous, entries[i-1].Value) {
+			return fmt.Errorf("round %d is not linked to the value of round %d", entry.Round, entries[i-1].Round)
+		} else if len(entry.Randomness) != sha256.Size {
+			return fmt.Errorf("round %d has %d bytes of randomness", entry.Round, len(entry.Randomness))
+		} else if !bytes.Equal(entry.Value, chainValue(entry.Round, entry.Previous, entry.Randomness)) {
+			return fmt.Errorf("round %d has a value that does not match its randomness", entry.Round)
+		} else if err := verifyTossProof(beaconSeed(entry.Round, entry.Previous), entry.Randomness, entry.Proof, groupKey); err != nil {
+			return fmt.Errorf("round %d has randomness that was not tossed by the group: %v", entry.Round, err)
+		}
+	}
+	return nil
+}
+
+// randomStream expands a value of the beacon into as many uniform words as needed, by hashing it with a counter.
+type randomStream struct {
+	value   []byte
+	counter uint64
+}
+
+func newRandomStream(value []byte) *randomStream {
+	return &randomStream{value: value}
+}
+
+func (s *randomStream) uint64() uint64 {
+	hash := sha256.New()
+	hash.Write(s.value)
+	_ = binary.Write(hash, binary.LittleEndian, s.counter)
+	s.counter++
+	return binary.LittleEndian.Uint64(hash.Sum(nil))
+}
+
+// uint64n is uniform in [0, n). Words below 2^64 mod n are rejected, so that the others take every residue equally often.
+func (s *randomStream) uint64n(n uint64) uint64 {
+	limit := -n % n
+	for {
+		if word := s.uint64(); word >= limit {
+			return word % n
+		}
+	}
+}
+
+// UniformInt derives an integer uniform in [low, high) from a value of the beacon.
+func UniformInt(value []byte, low, high uint64) (uint64, error) {
+	if low >= high {
+		return 0, fmt.Errorf("empty range [%d, %d)", low, high)
+	}
+	return low + newRandomStream(value).uint64n(high-low), nil
+}
+
+// Permutation derives a uniform permutation of [0, n) from a value of the beacon, with the shuffle of Fisher and Yates.
+func Permutation(value []byte, n int) []int {
+	stream := newRandomStream(value)
+	perm := lo.Range(n)
+	for i := n - 1; i > 0; i-- {
+		j := stream.uint64n(uint64(i + 1))
+		perm[i], perm[j] = perm[j], perm[i]
+	}
+	return perm
+}
+
+// SampleCommittee derives a uniform committee of size members from a value of the beacon.
+// The members are sorted first, so every node obtains the same committee regardless of the order it lists them in.
+func SampleCommittee(value []byte, members []UUID, size int) ([]UUID, error) {
+	if size > len(members) {
+		return nil, fmt.Errorf("committee of %d out of %d members", size, len(members))
+	} else if len(lo.Uniq(members)) != len(members) {
+		return nil, fmt.Errorf("repeated members")
+	}
+	sorted := slices.Clone(members)
+	slices.SortFunc(sorted, func(a, b UUID) int { return bytes.Compare(a[:], b[:]) })
+	perm := Permutation(value, len(sorted))
+	return lo.Map(perm[:size], func(i int, _ int) UUID { return sorted[i] }), nil
+}
@@ -0,0 +1,110 @@
+package coinTosser
+
+import (
+	on "bkr-acs/overlayNetwork"
+	"bkr-acs/utils"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"slices"
+	"testing"
+)
+
+func TestRandomBeaconShouldOutputSameChain(t *testing.T) {
+	numNodes, threshold := uint(4), uint(2)
+	nodes := lo.Map(lo.Range(int(numNodes)), func(i int, _ int) *on.Node {
+		return on.GetTestNode(t, fmt.Sprintf("localhost:%d", 6100+i), "localhost:6100")
+	})
+	bebChans := lo.Map(nodes, func(n *on.Node, _ int) *on.BEBChannel { return on.NewBEBChannel(n, 'c') })
+	on.InitializeNodes(t, nodes)
+	deals, err := DealOffline(NewScalar(42), threshold, numNodes)
+	assert.NoError(t, err)
+	ctChannels := lo.ZipBy2(deals, bebChans, func(d []byte, beb *on.BEBChannel) *CTChannel {
+		ct, err := NewCoinTosserChannelFromDeal(d, beb, threshold, utils.DefaultLogger())
+		assert.NoError(t, err)
+		return ct
+	})
+	beacons := lo.Map(ctChannels, func(ct *CTChannel, _ int) *RandomBeacon { return NewRandomBeacon(ct) })
+	chains := lo.Map(beacons, func(b *RandomBeacon, _ int) chan []BeaconEntry { return make(chan []BeaconEntry, 1) })
+	for i, b := range beacons {
+		go func() {
+			chains[i] <- lo.Times(3, func(int) BeaconEntry {
+				entry, err := b.Next()
+				assert.NoError(t, err)
+				return entry
+			})
+		}()
+	}
+	entries := lo.Map(chains, func(c chan []BeaconEntry, _ int) []BeaconEntry { return <-c })
+	assert.True(t, lo.EveryBy(entries, func(chain []BeaconEntry) bool { return slices.EqualFunc(chain, entries[0], equalEntries) }))
+	assert.Equal(t, uint64(1), entries[0][0].Round)
+	groupKey, err := ctChannels[0].GroupKey()
+	assert.NoError(t, err)
+	assert.NoError(t, VerifyChain(entries[0], groupKey))
+	assert.Error(t, VerifyChain([]BeaconEntry{entries[0][0], entries[0][2]}, groupKey))
+	tampered := entries[0][1]
+	tampered.Randomness = slices.Clone(tampered.Randomness)
+	tampered.Randomness[0] ^= 1
+	assert.Error(t, VerifyChain([]BeaconEntry{entries[0][0], tampered}, groupKey))
+	forged := tampered
+	forged.Value = chainValue(forged.Round, forged.Previous, forged.Randomness)
+	assert.Error(t, VerifyChain([]BeaconEntry{entries[0][0], forged}, groupKey))
+	otherDeals, err := DealOffline(NewScalar(43), threshold, numNodes)
+	assert.NoError(t, err)
+	otherCT, err := NewCoinTosserChannelFromDeal(otherDeals[0], on.NewBEBChannel(nodes[0], 'o'), threshold, utils.DefaultLogger())
+	assert.NoError(t, err)
+	otherKey, err := otherCT.GroupKey()
+	assert.NoError(t, err)
+	assert.Error(t, VerifyChain(entries[0], otherKey))
+	otherCT.Close()
+	pendingId, collectedId := utils.NewInstanceId(7, []byte("pending")), utils.NewInstanceId(3, []byte("collected"))
+	pending := make(chan error, 1)
+	go func() {
+		_, err := beacons[0].Value(pendingId[:])
+		pending <- err
+	}()
+	ctChannels[0].SetLowWatermark(8)
+	assert.Error(t, <-pending)
+	_, err = beacons[0].Value(collectedId[:])
+	assert.Error(t, err)
+	for _, ct := range ctChannels {
+		ct.Close()
+	}
+	assert.True(t, lo.EveryBy(nodes, func(n *on.Node) bool { return n.Close() == nil }))
+}
+
+func equalEntries(a, b BeaconEntry) bool {
+	return a.Round == b.Round && slices.Equal(a.Previous, b.Previous) && slices.Equal(a.Randomness, b.Randomness) && slices.Equal(a.Value, b.Value)
+}
+
+func TestUniformIntShouldStayInRange(t *testing.T) {
+	values := lo.Times(200, func(i int) uint64 {
+		v, err := UniformInt([]byte(fmt.Sprint(i)), 10, 13)
+		assert.NoError(t, err)
+		return v
+	})
+	assert.ElementsMatch(t, []uint64{10, 11, 12}, lo.Uniq(values))
+	_, err := UniformInt([]byte("seed"), 3, 3)
+	assert.Error(t, err)
+}
+
+func TestPermutationShouldContainEveryIndex(t *testing.T) {
+	perm := Permutation([]byte("seed"), 50)
+	assert.ElementsMatch(t, lo.Range(50), perm)
+	assert.Equal(t, perm, Permutation([]byte("seed"), 50))
+	assert.NotEqual(t, perm, Permutation([]byte("other"), 50))
+}
+
+func TestSampleCommitteeShouldNotDependOnOrder(t *testing.T) {
+	members := lo.Times(10, func(int) uuid.UUID { return uuid.New() })
+	committee, err := SampleCommittee([]byte("seed"), members, 4)
+	assert.NoError(t, err)
+	assert.Len(t, lo.Uniq(committee), 4)
+	assert.Subset(t, members, committee)
+	reversed, err := SampleCommittee([]byte("seed"), lo.Reverse(slices.Clone(members)), 4)
+	assert.NoError(t, err)
+	assert.Equal(t, committee, reversed)
+	_, err = SampleCommittee([]byte("seed"), members, 11)
+	assert.Error(t, err)
+}
@@ -0,0 +1,775 @@
+package coinTosser
+
+import (
+	on "bkr-acs/overlayNetwork"
+	"bkr-acs/utils"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"github.com/cloudflare/circl/group"
+	ss "github.com/cloudflare/circl/secretsharing"
+	. "github.com/google/uuid"
+	"github.com/samber/lo"
+)
+
+const refreshName = "refresh"
+
+// RefreshLookahead is the number of epochs past the current one whose deals and echoes a node keeps, so that the
+// messages of the nodes that moved on to later refreshes are not lost while this node finishes the ones before.
+const RefreshLookahead = 2
+
+const (
+	refreshDealMsg byte = iota
+	refreshEchoMsg
+)
+
+// refreshDeal is what a dealer sends to one node to refresh the shares to an epoch. The dealer picks a random bivariate
+// polynomial phi of degree t in x and f in y, with phi(0, 0) = 0, and commits to its coefficients. The node with share id
+// i gets its row phi(i, y), whose value at zero is added to its share, and its column phi(x, i), whose value at the id j
+// of every node it echoes to that node, since it is the point phi(j, i) of the row of j.
+type refreshDeal struct {
+	epoch   uint64
+	commits [][]group.Element
+	row     []group.Scalar
+	column  []group.Scalar
+}
+
+// refreshEcho is a point of the row of the receiver, sent by a node with a valid column of the dealer.
+// Any f+1 valid echoes give the row, so a node completes the refresh even if the dealer did not send it a valid deal.
+type refreshEcho struct {
+	epoch   uint64
+	dealer  UUID
+	commits [][]group.Element
+	point   group.Scalar
+}
+
+// dealing is what a node knows of the sharing of a dealer in an epoch: the value of its row at zero if the dealer sent
+// it a valid deal, and the points of its row echoed by the other nodes, for each commitment they echoed.
+type dealing struct {
+	dealt   bool
+	digest  []byte
+	value   group.Scalar
+	commits map[string][][]group.Element
+	echoes  map[string]map[UUID]group.Scalar
+	echoers map[UUID]bool
+}
+
+// refreshRound is the state of the refresh to one epoch.
+type refreshRound struct {
+	contribution []byte
+	dealings     map[UUID]*dealing
+	agreed       map[UUID][]byte
+	done         chan error
+	waiters      []refreshWaiter
+}
+
+// refreshWaiter is notified of the progress of a round until ready returns true. If the shares reach the epoch first,
+// or the round cannot be kept, dropped is called instead, and told whether the shares reached the epoch.
+type refreshWaiter struct {
+	ready   func(r *refreshRound) bool
+	dropped func(passed bool)
+}
+
+// refresher keeps the rounds of the refreshes to the epochs after the current one.
+type refresher struct {
+	beb      *on.BEBChannel
+	f        uint
+	keystore func([]byte) error
+	rounds   map[uint64]*refreshRound
+}
+
+// EnableRefresh lets the channel refresh its shares over beb, which must not be used by other channels, tolerating f
+// faulty nodes. Each refreshed deal is handed to keystore before it replaces the current one, so that the share it
+// holds can be overwritten. The dealers address their deals by share index, so the indices must be registered.
+func (c *CTChannel) EnableRefresh(beb *on.BEBChannel, f uint, keystore func([]byte) error) {
+	c.commands <- func() error {
+		c.refresh = &refresher{beb: beb, f: f, keystore: keystore, rounds: make(map[uint64]*refreshRound)}
+		return nil
+	}
+	go c.listenRefresh(beb.GetBEBChan())
+}
+
+// Epoch returns the number of refreshes of the shares of this node.
+func (c *CTChannel) Epoch() uint64 {
+	res := make(chan uint64, 1)
+	c.commands <- func() error {
+		res <- c.deal.epoch
+		return nil
+	}
+	return <-res
+}
+
+// ContributeRefresh deals a fresh sharing of zero to the registered nodes, whose values are added to their shares of
+// the current epoch to make their shares of the given epoch, which must be the next one. It returns the digest of the
+// commitments of the sharing, and contributing again to the same epoch returns the same digest without dealing again.
+func (c *CTChannel) ContributeRefresh(epoch uint64) ([]byte, error) {
+	type result struct {
+		digest []byte
+		err    error
+	}
+	res := make(chan result, 1)
+	c.commands <- func() error {
+		if c.refresh == nil {
+			res <- result{err: fmt.Errorf("refresh is not enabled")}
+		} else if c.shareIds == nil {
+			res <- result{err: fmt.Errorf("refresh requires the share indices of the nodes")}
+		} else if epoch != c.deal.epoch+1 {
+			res <- result{err: fmt.Errorf("unable to refresh to epoch %d from epoch %d", epoch, c.deal.epoch)}
+		} else if r := c.refreshRound(epoch); r.contribution != nil {
+			res <- result{digest: r.contribution}
+		} else {
+			digest, err := c.dealRefresh(epoch, r)
+			res <- result{digest: digest, err: err}
+		}
+		return nil
+	}
+	r := <-res
+	return r.digest, r.err
+}
+
+func (c *CTChannel) dealRefresh(epoch uint64, r *refreshRound) ([]byte, error) {
+	deals, digest, err := newRefreshDeals(c.deal.base, c.t, c.refresh.f, epoch, c.shareIds)
+	if err != nil {
+		return nil, err
+	}
+	msgs := make(map[UUID][]byte, len(deals))
+	for node, rd := range deals {
+		msg, err := marshalRefreshDeal(rd)
+		if err != nil {
+			return nil, fmt.Errorf("unable to marshal deal: %v", err)
+		}
+		msgs[node] = msg
+	}
+	r.contribution = digest
+	c.unicastRefresh(msgs)
+	c.logger.Info("contributed to refresh", "epoch", epoch)
+	return digest, nil
+}
+
+// newRefreshDeals deals a random bivariate polynomial of degree t in x and f in y that is zero at (0, 0) to the nodes
+// with the given share ids, and returns their deals with the digest of the commitments of the polynomial.
+func newRefreshDeals(base group.Element, t, f uint, epoch uint64, ids map[UUID]group.Scalar) (map[UUID]*refreshDeal, []byte, error) {
+	phi := lo.Times(int(t)+1, func(int) []group.Scalar {
+		return lo.Times(int(f)+1, func(int) group.Scalar { return RandomScalar() })
+	})
+	phi[0][0] = NewScalar(0)
+	commits := lo.Map(phi, func(coefficients []group.Scalar, _ int) []group.Element {
+		return lo.Map(coefficients, func(a group.Scalar, _ int) group.Element { return mulPoint(base, a) })
+	})
+	digest, err := refreshDigest(epoch, commits)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to compute digest: %v", err)
+	}
+	deals := lo.MapValues(ids, func(id group.Scalar, _ UUID) *refreshDeal {
+		return &refreshDeal{
+			epoch:   epoch,
+			commits: commits,
+			row:     lo.Map(transpose(phi), func(coefficients []group.Scalar, _ int) group.Scalar { return evaluateScalars(coefficients, id) }),
+			column:  lo.Map(phi, func(coefficients []group.Scalar, _ int) group.Scalar { return evaluateScalars(coefficients, id) }),
+		}
+	})
+	for _, a := range lo.Flatten(phi) {
+		a.SetUint64(0)
+	}
+	return deals, digest, nil
+}
+
+func (c *CTChannel) unicastRefresh(msgs map[UUID][]byte) {
+	beb := c.refresh.beb
+	go func() {
+		for node, msg := range msgs {
+			if err := beb.Unicast(msg, node); err != nil {
+				c.logger.Warn("unable to send refresh message", "node", node, "error", err)
+			}
+		}
+	}()
+}
+
+// RefreshStarted is closed once f+1 dealers sent this node valid deals for the epoch, so that at least one correct node
+// started the refresh, or once the shares of this node reached the epoch.
+func (c *CTChannel) RefreshStarted(epoch uint64) <-chan struct{} {
+	started := make(chan struct{})
+	c.commands <- func() error {
+		c.awaitRefresh(epoch, func(r *refreshRound) bool {
+			if uint(len(lo.PickBy(r.dealings, func(_ UUID, d *dealing) bool { return d.digest != nil }))) <= c.refresh.f {
+				return false
+			}
+			close(started)
+			return true
+		}, func(bool) { close(started) })
+		return nil
+	}
+	return started
+}
+
+// CompletedDealers outputs the dealers whose sharings for the epoch completed at this node, with the digests of their
+// commitments, once there are count of them. A sharing completes once 2f+1 nodes echoed it, so f+1 correct nodes hold
+// its columns and every correct node gets the row it needs. It outputs nil if the shares reached the epoch first.
+func (c *CTChannel) CompletedDealers(epoch uint64, count int) <-chan map[UUID][]byte {
+	res := make(chan map[UUID][]byte, 1)
+	c.commands <- func() error {
+		c.awaitRefresh(epoch, func(r *refreshRound) bool {
+			if completed := c.completedDealers(r); len(completed) >= count {
+				res <- completed
+				return true
+			}
+			return false
+		}, func(bool) { res <- nil })
+		return nil
+	}
+	return res
+}
+
+// AwaitCompletion outputs true once the sharings of all the dealers for the epoch completed at this node with the
+// given digests, or if the shares reached the epoch, and false if some dealer is not registered or the epoch is too
+// far ahead. Proposals of the dealers to apply can be accepted once it outputs true, since every correct node then
+// completes the sharings of the dealers they name.
+func (c *CTChannel) AwaitCompletion(epoch uint64, dealers map[UUID][]byte) <-chan bool {
+	res := make(chan bool, 1)
+	c.commands <- func() error {
+		if lo.SomeBy(lo.Keys(dealers), func(dealer UUID) bool { _, ok := c.shareIds[dealer]; return !ok }) {
+			res <- false
+			return nil
+		}
+		c.awaitRefresh(epoch, func(r *refreshRound) bool {
+			if lo.EveryBy(lo.Entries(dealers), func(e lo.Entry[UUID, []byte]) bool { return c.isComplete(r.dealings[e.Key], e.Value) }) {
+				res <- true
+				return true
+			}
+			return false
+		}, func(passed bool) { res <- passed })
+		return nil
+	}
+	return res
+}
+
+func (c *CTChannel) awaitRefresh(epoch uint64, ready func(r *refreshRound) bool, dropped func(passed bool)) {
+	if c.refresh == nil {
+		dropped(false)
+	} else if epoch <= c.deal.epoch {
+		dropped(true)
+	} else if r := c.refreshRound(epoch); r == nil {
+		dropped(false)
+	} else if !ready(r) {
+		r.waiters = append(r.waiters, refreshWaiter{ready: ready, dropped: dropped})
+	}
+}
+
+// ApplyRefresh refreshes the shares of this node with the sharings of the agreed dealers, which map to the digests of
+// their commitments. It outputs nil once the shares of the new epoch replaced those of the current one, which are then
+// erased, or an error if the refreshed deal cannot be stored, in which case it can be applied again.
+func (c *CTChannel) ApplyRefresh(epoch uint64, dealers map[UUID][]byte) <-chan error {
+	done := make(chan error, 1)
+	c.commands <- func() error {
+		if c.refresh == nil {
+			done <- fmt.Errorf("refresh is not enabled")
+		} else if epoch != c.deal.epoch+1 {
+			done <- fmt.Errorf("unable to refresh to epoch %d from epoch %d", epoch, c.deal.epoch)
+		} else if len(dealers) == 0 {
+			done <- fmt.Errorf("refresh without dealers")
+		} else if lo.SomeBy(lo.Keys(dealers), func(dealer UUID) bool { _, ok := c.shareIds[dealer]; return !ok }) {
+			done <- fmt.Errorf("refresh with unregistered dealers")
+		} else {
+			r := c.refreshRound(epoch)
+			r.agreed, r.done = dealers, done
+			c.tryRefresh()
+		}
+		return nil
+	}
+	return done
+}
+
+// refreshRound returns the round of the epoch, if it is one of the epochs after the current one that are kept.
+func (c *CTChannel) refreshRound(epoch uint64) *refreshRound {
+	if epoch <= c.deal.epoch || epoch > c.deal.epoch+RefreshLookahead {
+		return nil
+	} else if r := c.refresh.rounds[epoch]; r != nil {
+		return r
+	}
+	r := &refreshRound{dealings: make(map[UUID]*dealing)}
+	c.refresh.rounds[epoch] = r
+	return r
+}
+
+func (r *refreshRound) dealing(dealer UUID) *dealing {
+	if d := r.dealings[dealer]; d != nil {
+		return d
+	}
+	d := &dealing{commits: make(map[string][][]group.Element), echoes: make(map[string]map[UUID]group.Scalar), echoers: make(map[UUID]bool)}
+	r.dealings[dealer] = d
+	return d
+}
+
+func (c *CTChannel) listenRefresh(bebChan <-chan on.BEBMsg) {
+	for {
+		select {
+		case bebMsg := <-bebChan:
+			sender, err := utils.PkToUUID(bebMsg.Sender)
+			if err != nil {
+				c.logger.Warn("unable to get id of refresh sender", "error", err)
+				continue
+			}
+			command := func() error { return c.receiveRefresh(sender, bebMsg.Content) }
+			select {
+			case c.commands <- command:
+			case <-c.closeRefresh:
+				return
+			}
+		case <-c.closeRefresh:
+			return
+		}
+	}
+}
+
+func (c *CTChannel) receiveRefresh(sender UUID, content []byte) error {
+	if _, ok := c.shareIds[sender]; !ok {
+		return fmt.Errorf("refresh message from unregistered node %s", sender)
+	} else if len(content) == 0 {
+		return fmt.Errorf("empty refresh message from %s", sender)
+	}
+	switch content[0] {
+	case refreshDealMsg:
+		return c.receiveDeal(sender, content)
+	case refreshEchoMsg:
+		return c.receiveEcho(sender, content)
+	default:
+		c.evidence.report(InvalidRefresh, sender, refreshId(c.deal.epoch+1), scalarId(c.deal.share.ID), content)
+		return fmt.Errorf("unknown refresh message from %s", sender)
+	}
+}
+
+// receiveDeal keeps the value of the row that a dealer sent this node, if the row and the column check against its
+// commitments, and echoes the column to every node.
+func (c *CTChannel) receiveDeal(dealer UUID, content []byte) error {
+	rd, err := unmarshalRefreshDeal(content, c.t, c.refresh.f)
+	if err != nil {
+		c.evidence.report(InvalidRefresh, dealer, refreshId(c.deal.epoch+1), scalarId(c.deal.share.ID), content)
+		return fmt.Errorf("unable to unmarshal refresh deal: %v", err)
+	}
+	r := c.refreshRound(rd.epoch)
+	if r == nil {
+		c.logger.Debug("ignoring refresh deal of an epoch that is not kept", "dealer", dealer, "epoch", rd.epoch)
+		return nil
+	}
+	d := r.dealing(dealer)
+	if d.dealt {
+		c.evidence.report(DuplicateShare, dealer, refreshId(rd.epoch), scalarId(c.deal.share.ID), content)
+		return fmt.Errorf("second refresh deal from %s", dealer)
+	}
+	d.dealt = true
+	if !rd.verify(c.deal.base, c.deal.share.ID) {
+		c.evidence.report(InvalidRefresh, dealer, refreshId(rd.epoch), scalarId(c.deal.share.ID), content)
+		c.notifyRefresh(r)
+		return fmt.Errorf("invalid refresh deal from %s", dealer)
+	}
+	digest, err := refreshDigest(rd.epoch, rd.commits)
+	if err != nil {
+		return fmt.Errorf("unable to compute digest: %v", err)
+	}
+	d.digest, d.value = digest, rd.row[0]
+	d.commits[string(digest)] = rd.commits
+	if err := c.echoDeal(dealer, rd); err != nil {
+		return fmt.Errorf("unable to echo refresh deal: %v", err)
+	}
+	c.notifyRefresh(r)
+	return nil
+}
+
+func (c *CTChannel) echoDeal(dealer UUID, rd *refreshDeal) error {
+	msgs := make(map[UUID][]byte, len(c.shareIds))
+	for node, id := range c.shareIds {
+		msg, err := marshalRefreshEcho(&refreshEcho{epoch: rd.epoch, dealer: dealer, commits: rd.commits, point: evaluateScalars(rd.column, id)})
+		if err != nil {
+			return fmt.Errorf("unable to marshal echo: %v", err)
+		}
+		msgs[node] = msg
+	}
+	for _, a := range append(append([]group.Scalar{}, rd.row[1:]...), rd.column...) {
+		a.SetUint64(0)
+	}
+	c.unicastRefresh(msgs)
+	return nil
+}
+
+// receiveEcho keeps a point of the row of this node that checks against the commitments it was echoed with.
+func (c *CTChannel) receiveEcho(echoer UUID, content []byte) error {
+	echo, err := unmarshalRefreshEcho(content, c.t, c.refresh.f)
+	if err != nil {
+		c.evidence.report(InvalidRefresh, echoer, refreshId(c.deal.epoch+1), scalarId(c.deal.share.ID), content)
+		return fmt.Errorf("unable to unmarshal refresh echo: %v", err)
+	}
+	r := c.refreshRound(echo.epoch)
+	if r == nil {
+		c.logger.Debug("ignoring refresh echo of an epoch that is not kept", "echoer", echoer, "epoch", echo.epoch)
+		return nil
+	} else if _, ok := c.shareIds[echo.dealer]; !ok {
+		return fmt.Errorf("echo from %s of unregistered dealer %s", echoer, echo.dealer)
+	}
+	d := r.dealing(echo.dealer)
+	if d.echoers[echoer] {
+		c.evidence.report(DuplicateShare, echoer, refreshId(echo.epoch), scalarId(c.deal.share.ID), content)
+		return fmt.Errorf("second refresh echo from %s", echoer)
+	}
+	d.echoers[echoer] = true
+	if !echo.verify(c.deal.base, c.deal.share.ID, c.shareIds[echoer]) {
+		c.evidence.report(InvalidRefresh, echoer, refreshId(echo.epoch), scalarId(c.deal.share.ID), content)
+		return fmt.Errorf("invalid refresh echo from %s", echoer)
+	}
+	digest, err := refreshDigest(echo.epoch, echo.commits)
+	if err != nil {
+		return fmt.Errorf("unable to compute digest: %v", err)
+	}
+	key := string(digest)
+	if d.echoes[key] == nil {
+		d.commits[key] = echo.commits
+		d.echoes[key] = make(map[UUID]group.Scalar)
+	}
+	d.echoes[key][echoer] = echo.point
+	c.notifyRefresh(r)
+	return nil
+}
+
+// notifyRefresh tells the waiters of the round about its progress, and applies the refresh to the next epoch if it can.
+func (c *CTChannel) notifyRefresh(r *refreshRound) {
+	r.waiters = lo.Filter(r.waiters, func(w refreshWaiter, _ int) bool { return !w.ready(r) })
+	c.tryRefresh()
+}
+
+func (c *CTChannel) completedDealers(r *refreshRound) map[UUID][]byte {
+	completed := make(map[UUID][]byte)
+	for dealer, d := range r.dealings {
+		for key, echoes := range d.echoes {
+			if uint(len(echoes)) >= 2*c.refresh.f+1 {
+				completed[dealer] = []byte(key)
+			}
+		}
+	}
+	return completed
+}
+
+func (c *CTChannel) isComplete(d *dealing, digest []byte) bool {
+	return d != nil && uint(len(d.echoes[string(digest)])) >= 2*c.refresh.f+1
+}
+
+// recoverRow returns the value at zero of the row of this node in the sharing of the dealer with the given digest,
+// either from the deal of the dealer or from f+1 echoes, along with the commitments of the sharing.
+func (c *CTChannel) recoverRow(d *dealing, digest []byte) (*refreshContribution, bool) {
+	key := string(digest)
+	if d == nil || d.commits[key] == nil {
+		return nil, false
+	} else if d.digest != nil && bytes.Equal(d.digest, digest) {
+		return &refreshContribution{commits: d.commits[key], value: d.value}, true
+	} else if uint(len(d.echoes[key])) <= c.refresh.f {
+		return nil, false
+	}
+	echoers := lo.Keys(d.echoes[key])[:c.refresh.f+1]
+	points := lo.Map(echoers, func(echoer UUID, _ int) ss.Share {
+		return ss.Share{ID: c.shareIds[echoer], Value: d.echoes[key][echoer]}
+	})
+	return &refreshContribution{commits: d.commits[key], value: interpolateAtZero(points)}, true
+}
+
+// refreshContribution is the value at zero of the row of this node in the sharing of a dealer, with its commitments.
+type refreshContribution struct {
+	commits [][]group.Element
+	value   group.Scalar
+}
+
+// tryRefresh replaces the deal with the one of the next epoch once the rows of all the agreed dealers are known.
+func (c *CTChannel) tryRefresh() {
+	epoch := c.deal.epoch + 1
+	r := c.refresh.rounds[epoch]
+	if r == nil || r.agreed == nil {
+		return
+	}
+	contributions := make([]*refreshContribution, 0, len(r.agreed))
+	for dealer, digest := range r.agreed {
+		contribution, ok := c.recoverRow(r.dealings[dealer], digest)
+		if !ok {
+			return
+		}
+		contributions = append(contributions, contribution)
+	}
+	next, err := c.refreshedDeal(contributions)
+	if err != nil {
+		c.failRefresh(r, fmt.Errorf("unable to refresh deal: %v", err))
+		return
+	} else if dealBytes, err := marshalDeal(next); err != nil {
+		c.failRefresh(r, fmt.Errorf("unable to marshal refreshed deal: %v", err))
+		return
+	} else if c.refresh.keystore != nil {
+		if err := c.refresh.keystore(dealBytes); err != nil {
+			c.failRefresh(r, fmt.Errorf("unable to store refreshed deal: %v", err))
+			return
+		}
+	}
+	c.installDeal(next)
+	for _, d := range r.dealings {
+		if d.value != nil {
+			d.value.SetUint64(0)
+		}
+		for _, echoes := range d.echoes {
+			for _, point := range echoes {
+				point.SetUint64(0)
+			}
+		}
+	}
+	delete(c.refresh.rounds, epoch)
+	for _, w := range r.waiters {
+		w.dropped(true)
+	}
+	c.logger.Info("refreshed shares", "epoch", next.epoch)
+	c.middleware.bebChannel.Transcript().RecordDecision("refresh", map[string]string{"epoch": fmt.Sprint(next.epoch)})
+	r.done <- nil
+}
+
+func (c *CTChannel) failRefresh(r *refreshRound, err error) {
+	r.done <- err
+	r.agreed, r.done = nil, nil
+}
+
+// refreshedDeal adds the contributions to the share of this node, and the commitments of their first columns to the
+// commitment of every share.
+func (c *CTChannel) refreshedDeal(contributions []*refreshContribution) (*deal, error) {
+	value := lo.Reduce(contributions, func(acc group.Scalar, contribution *refreshContribution, _ int) group.Scalar {
+		return addScalar(acc, contribution.value)
+	}, c.deal.share.Value)
+	commits := lo.Map(c.deal.commits, func(commit pointShare, _ int) pointShare {
+		point := lo.Reduce(contributions, func(acc group.Element, contribution *refreshContribution, _ int) group.Element {
+			return addPoint(acc, evaluatePoints(transpose(contribution.commits)[0], commit.id))
+		}, commit.point)
+		return pointShare{id: commit.id, point: point}
+	})
+	next := &deal{base: c.deal.base, share: ss.Share{ID: c.deal.share.ID, Value: value}, commits: commits, epoch: c.deal.epoch + 1}
+	if own, err := next.getCommit(next.share.ID); err != nil {
+		return nil, fmt.Errorf("unable to get own commitment: %v", err)
+	} else if !mulPoint(next.base, value).IsEqual(*own) {
+		return nil, fmt.Errorf("refreshed share does not match its commitment")
+	}
+	return next, nil
+}
+
+// InstallRefreshedDeal replaces the deal of this channel with a refreshed deal of the next epoch, computed by another
+// channel that holds the same share, such as the one that refreshes the shares for the coin tosser of its agreements.
+func (c *CTChannel) InstallRefreshedDeal(dealBytes []byte) error {
+	next, err := unmarshalDeal(dealBytes)
+	if err != nil {
+		return fmt.Errorf("unable to unmarshal deal: %v", err)
+	}
+	res := make(chan error, 1)
+	c.commands <- func() error {
+		if next.epoch != c.deal.epoch+1 {
+			res <- fmt.Errorf("unable to install deal of epoch %d at epoch %d", next.epoch, c.deal.epoch)
+		} else if !next.base.IsEqual(c.deal.base) || !next.share.ID.IsEqual(c.deal.share.ID) {
+			res <- fmt.Errorf("deal is not a refresh of the share of this channel")
+		} else if !recoverSecretFromPoints(next.commits).IsEqual(recoverSecretFromPoints(c.deal.commits)) {
+			res <- fmt.Errorf("deal does not share the secret of this channel")
+		} else if own, err := next.getCommit(next.share.ID); err != nil || !mulPoint(next.base, next.share.Value).IsEqual(*own) {
+			res <- fmt.Errorf("share of the deal does not match its commitment")
+		} else {
+			c.installDeal(next)
+			res <- nil
+		}
+		return nil
+	}
+	return <-res
+}
+
+// installDeal replaces the deal with the one of the next epoch, erases the share of the current one, and keeps its
+// commitments to verify the shares of the coins tossed across the refresh.
+func (c *CTChannel) installDeal(next *deal) {
+	previous := c.deal
+	c.deal, c.previous = next, previous
+	previous.share.Value.SetUint64(0)
+	c.retossInstances()
+}
+
+// retossInstances contributes a share of the new epoch to every coin being tossed, since the shares of the previous
+// epoch of the nodes that refreshed in the meantime cannot be combined with those of the nodes that did not.
+func (c *CTChannel) retossInstances() {
+	for id, ct := range c.instances {
+		ct.d = c.deal
+		share, err := ct.tossCoin()
+		if err != nil {
+			c.logger.Error("unable to create toss coin share", "id", id, "error", err)
+			continue
+		}
+		go func() {
+			if err := c.middleware.broadcastCTShare(id, share); err != nil {
+				c.logger.Error("unable to broadcast coin toss share", "error", err)
+			}
+		}()
+		for _, early := range ct.early {
+			c.verifier.submit(verification{id: early.id, sender: early.sender, toss: ct, deal: c.deal, share: early.share})
+		}
+		ct.early = nil
+	}
+}
+
+// verify checks the row and the column of the node with share id x against the commitments of the dealer.
+func (rd *refreshDeal) verify(base group.Element, x group.Scalar) bool {
+	if !rd.commits[0][0].IsIdentity() {
+		return false
+	}
+	rowValid := lo.EveryBy(lo.Zip2(rd.row, transpose(rd.commits)), func(pair lo.Tuple2[group.Scalar, []group.Element]) bool {
+		return mulPoint(base, pair.A).IsEqual(evaluatePoints(pair.B, x))
+	})
+	columnValid := lo.EveryBy(lo.Zip2(rd.column, rd.commits), func(pair lo.Tuple2[group.Scalar, []group.Element]) bool {
+		return mulPoint(base, pair.A).IsEqual(evaluatePoints(pair.B, x))
+	})
+	return rowValid && columnValid
+}
+
+// verify checks that the point is phi(x, y) for the node with share id x, echoed by the node with share id y.
+func (echo *refreshEcho) verify(base group.Element, x, y group.Scalar) bool {
+	if !echo.commits[0][0].IsIdentity() {
+		return false
+	}
+	inner := lo.Map(echo.commits, func(commits []group.Element, _ int) group.Element { return evaluatePoints(commits, y) })
+	return mulPoint(base, echo.point).IsEqual(evaluatePoints(inner, x))
+}
+
+// evaluateScalars evaluates at x the polynomial with the given coefficients, starting from the constant term.
+func evaluateScalars(coefficients []group.Scalar, x group.Scalar) group.Scalar {
+	return lo.ReduceRight(coefficients, func(acc group.Scalar, a group.Scalar, _ int) group.Scalar {
+		return addScalar(mulScalar(acc, x), a)
+	}, NewScalar(0))
+}
+
+// evaluatePoints is evaluateScalars on the commitments to the coefficients.
+func evaluatePoints(commits []group.Element, x group.Scalar) group.Element {
+	return lo.ReduceRight(commits, func(acc group.Element, commit group.Element, _ int) group.Element {
+		return addPoint(mulPoint(acc, x), commit)
+	}, group.Ristretto255.Identity())
+}
+
+// interpolateAtZero returns the value at zero of the polynomial through the points.
+func interpolateAtZero(points []ss.Share) group.Scalar {
+	ids := lo.Map(points, func(point ss.Share, _ int) group.Scalar { return point.ID })
+	return lo.Reduce(points, func(acc group.Scalar, point ss.Share, _ int) group.Scalar {
+		return addScalar(acc, mulScalar(point.Value, lagrangeCoefficient(point.ID, ids)))
+	}, NewScalar(0))
+}
+
+func transpose[T any](m [][]T) [][]T {
+	return lo.Times(len(m[0]), func(j int) []T { return lo.Map(m, func(row []T, _ int) T { return row[j] }) })
+}
+
+func refreshId(epoch uint64) UUID {
+	return utils.NewInstanceId(epoch, []byte(refreshName))
+}
+
+func refreshDigest(epoch uint64, commits [][]group.Element) ([]byte, error) {
+	hash := sha256.New()
+	_ = binary.Write(hash, binary.LittleEndian, epoch)
+	for _, commit := range lo.Flatten(commits) {
+		commitBytes, err := commit.MarshalBinary()
+		if err != nil {
+			return nil, fmt.Errorf("unable to marshal commitment: %v", err)
+		}
+		hash.Write(commitBytes)
+	}
+	return hash.Sum(nil), nil
+}
+
+func marshalRefreshDeal(rd *refreshDeal) ([]byte, error) {
+	buf := bytes.NewBuffer([]byte{refreshDealMsg})
+	_ = binary.Write(buf, binary.LittleEndian, rd.epoch)
+	if err := writeElements(buf, lo.Flatten(rd.commits)); err != nil {
+		return nil, fmt.Errorf("unable to marshal commitments: %v", err)
+	} else if err := writeScalars(buf, append(append([]group.Scalar{}, rd.row...), rd.column...)); err != nil {
+		return nil, fmt.Errorf("unable to marshal row and column: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func marshalRefreshEcho(echo *refreshEcho) ([]byte, error) {
+	buf := bytes.NewBuffer([]byte{refreshEchoMsg})
+	_ = binary.Write(buf, binary.LittleEndian, echo.epoch)
+	buf.Write(echo.dealer[:])
+	if err := writeElements(buf, lo.Flatten(echo.commits)); err != nil {
+		return nil, fmt.Errorf("unable to marshal commitments: %v", err)
+	} else if err := writeScalars(buf, []group.Scalar{echo.point}); err != nil {
+		return nil, fmt.Errorf("unable to marshal point: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// unmarshalRefreshDeal reads a deal with the commitments of a polynomial of degree t in x and f in y.
+func unmarshalRefreshDeal(data []byte, t, f uint) (*refreshDeal, error) {
+	commits, scalars, epoch, err := unmarshalRefreshMsg(data, refreshDealMsg, 0, t, f, int(t+f+2))
+	if err != nil {
+		return nil, err
+	}
+	return &refreshDeal{epoch: epoch, commits: commits, row: scalars[:f+1], column: scalars[f+1:]}, nil
+}
+
+// unmarshalRefreshEcho reads an echo with the commitments of a polynomial of degree t in x and f in y.
+func unmarshalRefreshEcho(data []byte, t, f uint) (*refreshEcho, error) {
+	commits, scalars, epoch, err := unmarshalRefreshMsg(data, refreshEchoMsg, len(UUID{}), t, f, 1)
+	if err != nil {
+		return nil, err
+	}
+	return &refreshEcho{epoch: epoch, dealer: UUID(data[9 : 9+len(UUID{})]), commits: commits, point: scalars[0]}, nil
+}
+
+// unmarshalRefreshMsg reads the kind and the epoch of a message, skips the extra bytes after them, and reads the
+// (t+1)(f+1) commitments and the given number of scalars that follow.
+func unmarshalRefreshMsg(data []byte, kind byte, extra int, t, f uint, numScalars int) ([][]group.Element, []group.Scalar, uint64, error) {
+	elementSize, err := getElementSize()
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("unable to get element size: %v", err)
+	}
+	scalarSize, err := utils.GetScalarSize()
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("unable to get scalar size: %v", err)
+	}
+	numCommits := int((t + 1) * (f + 1))
+	headerSize := 1 + 8 + extra
+	if expected := headerSize + numCommits*elementSize + numScalars*scalarSize; len(data) != expected {
+		return nil, nil, 0, fmt.Errorf("message has incorrect size: got %d bytes, expected %d", len(data), expected)
+	} else if data[0] != kind {
+		return nil, nil, 0, fmt.Errorf("message of kind %d instead of %d", data[0], kind)
+	}
+	epoch := binary.LittleEndian.Uint64(data[1:9])
+	data = data[headerSize:]
+	elements := make([]group.Element, numCommits)
+	for i := range elements {
+		elements[i] = group.Ristretto255.NewElement()
+		if err := elements[i].UnmarshalBinary(data[i*elementSize : (i+1)*elementSize]); err != nil {
+			return nil, nil, 0, fmt.Errorf("unable to unmarshal %d-th commitment: %v", i, err)
+		}
+	}
+	data = data[numCommits*elementSize:]
+	scalars := make([]group.Scalar, numScalars)
+	for i := range scalars {
+		scalars[i] = group.Ristretto255.NewScalar()
+		if err := scalars[i].UnmarshalBinary(data[i*scalarSize : (i+1)*scalarSize]); err != nil {
+			return nil, nil, 0, fmt.Errorf("unable to unmarshal %d-th scalar: %v", i, err)
+		}
+	}
+	return lo.Chunk(elements, int(f+1)), scalars, epoch, nil
+}
+
+func writeElements(buf *bytes.Buffer, elements []group.Element) error {
+	for _, element := range elements {
+		elementBytes, err := element.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		buf.Write(elementBytes)
+	}
+	return nil
+}
+
+func writeScalars(buf *bytes.Buffer, scalars []group.Scalar) error {
+	for _, scalar := range scalars {
+		scalarBytes, err := scalar.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		buf.Write(scalarBytes)
+	}
+	return nil
+}
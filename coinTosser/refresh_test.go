@@ -0,0 +1,214 @@
+package coinTosser
+
+import (
+	on "bkr-acs/overlayNetwork"
+	"bkr-acs/utils"
+	"fmt"
+	"github.com/cloudflare/circl/group"
+	ss "github.com/cloudflare/circl/secretsharing"
+	. "github.com/google/uuid"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestChannelShouldRefreshSharesOfSameSecret(t *testing.T) {
+	nodes, channels, _, stored := setupRefresh(t, 6300)
+	sibling, err := NewCoinTosserChannelFromDeal(lo.Must(marshalDeal(channels[0].deal)), on.NewBEBChannel(nodes[0], 's'), 2, utils.DefaultLogger())
+	assert.NoError(t, err)
+	tossAll(t, channels, "before refresh")
+	duringChans := lo.Map(channels, func(*CTChannel, int) chan bool { return make(chan bool, 1) })
+	for i, c := range channels[:2] {
+		c.TossCoin([]byte("during refresh"), duringChans[i])
+	}
+	dealers := lo.SliceToMap(lo.Range(len(nodes)), func(i int) (UUID, []byte) {
+		digest, err := channels[i].ContributeRefresh(1)
+		assert.NoError(t, err)
+		again, err := channels[i].ContributeRefresh(1)
+		assert.NoError(t, err)
+		assert.Equal(t, digest, again)
+		return lo.Must(nodes[i].GetId()), digest
+	})
+	<-channels[0].RefreshStarted(1)
+	assert.Len(t, <-channels[0].CompletedDealers(1, 3), 3)
+	assert.True(t, <-channels[1].AwaitCompletion(1, dealers))
+	for _, done := range lo.Map(channels, func(c *CTChannel, _ int) <-chan error { return c.ApplyRefresh(1, dealers) }) {
+		assert.NoError(t, <-done)
+	}
+	assert.True(t, <-channels[1].AwaitCompletion(1, dealers))
+	assert.Nil(t, <-channels[1].CompletedDealers(1, 4))
+	assertRefreshedSecret(t, stored(), 1)
+	assert.True(t, lo.EveryBy(channels, func(c *CTChannel) bool { return c.Epoch() == 1 }))
+	assert.Error(t, sibling.InstallRefreshedDeal(stored()[1]))
+	assert.NoError(t, sibling.InstallRefreshedDeal(stored()[0]))
+	assert.Error(t, sibling.InstallRefreshedDeal(stored()[0]))
+	assert.Equal(t, uint64(1), sibling.Epoch())
+	sibling.Close()
+	for i, c := range channels[2:] {
+		c.TossCoin([]byte("during refresh"), duringChans[i+2])
+	}
+	during := lo.Map(duringChans, func(oc chan bool, _ int) bool { return <-oc })
+	assert.True(t, lo.EveryBy(during, func(outcome bool) bool { return outcome == during[0] }))
+	tossAll(t, channels, "after refresh")
+	closeRefresh(t, nodes, channels)
+}
+
+func TestChannelShouldRefreshWithRowsEchoedByOtherNodes(t *testing.T) {
+	nodes, channels, refreshBebs, stored := setupRefresh(t, 6320)
+	dealers := lo.SliceToMap(lo.Range(len(nodes)-1), func(i int) (UUID, []byte) {
+		digest, err := channels[i].ContributeRefresh(1)
+		assert.NoError(t, err)
+		return lo.Must(nodes[i].GetId()), digest
+	})
+	d := lo.Must(unmarshalDeal(lo.Must(marshalDeal(channels[0].deal))))
+	ids := lo.SliceToMap(lo.Range(len(nodes)), func(i int) (UUID, group.Scalar) { return lo.Must(nodes[i].GetId()), NewScalar(uint64(i + 1)) })
+	deals, digest, err := newRefreshDeals(d.base, 2, 1, 1, ids)
+	assert.NoError(t, err)
+	victim, faulty := lo.Must(nodes[0].GetId()), lo.Must(nodes[3].GetId())
+	deals[victim].row[0] = addScalar(deals[victim].row[0], NewScalar(1))
+	for node, rd := range deals {
+		assert.NoError(t, refreshBebs[3].Unicast(lo.Must(marshalRefreshDeal(rd)), node))
+	}
+	dealers[faulty] = digest
+	for _, done := range lo.Map(channels, func(c *CTChannel, _ int) <-chan error { return c.ApplyRefresh(1, dealers) }) {
+		assert.NoError(t, <-done)
+	}
+	assertRefreshedSecret(t, stored(), 1)
+	assert.True(t, lo.SomeBy(channels[0].Evidence(), func(e Evidence) bool { return e.Kind == InvalidRefresh && e.Sender == faulty }))
+	tossAll(t, channels, "after refresh")
+	closeRefresh(t, nodes, channels)
+}
+
+func setupRefresh(t *testing.T, port int) ([]*on.Node, []*CTChannel, []*on.BEBChannel, func() [][]byte) {
+	numNodes, threshold := uint(4), uint(2)
+	nodes := lo.Map(lo.Range(int(numNodes)), func(i int, _ int) *on.Node {
+		return on.GetTestNode(t, fmt.Sprintf("localhost:%d", port+i), fmt.Sprintf("localhost:%d", port))
+	})
+	ctBebs := lo.Map(nodes, func(n *on.Node, _ int) *on.BEBChannel { return on.NewBEBChannel(n, 'c') })
+	refreshBebs := lo.Map(nodes, func(n *on.Node, _ int) *on.BEBChannel { return on.NewBEBChannel(n, 'r') })
+	on.InitializeNodes(t, nodes)
+	dealBytes, err := DealOffline(NewScalar(42), threshold, numNodes)
+	assert.NoError(t, err)
+	indices := lo.SliceToMap(lo.Range(int(numNodes)), func(i int) (UUID, uint64) { return lo.Must(nodes[i].GetId()), uint64(i + 1) })
+	var lock sync.Mutex
+	stored := make([][]byte, numNodes)
+	channels := lo.Map(dealBytes, func(d []byte, i int) *CTChannel {
+		c, err := NewCoinTosserChannelFromDeal(d, ctBebs[i], threshold, utils.DefaultLogger())
+		assert.NoError(t, err)
+		assert.NoError(t, c.RegisterShareIndices(indices))
+		c.EnableRefresh(refreshBebs[i], 1, func(refreshed []byte) error {
+			lock.Lock()
+			defer lock.Unlock()
+			stored[i] = refreshed
+			return nil
+		})
+		return c
+	})
+	return nodes, channels, refreshBebs, func() [][]byte {
+		lock.Lock()
+		defer lock.Unlock()
+		return slices.Clone(stored)
+	}
+}
+
+func assertRefreshedSecret(t *testing.T, stored [][]byte, epoch uint64) {
+	refreshed := lo.Map(stored, func(d []byte, _ int) *deal { return lo.Must(unmarshalDeal(d)) })
+	assert.True(t, lo.EveryBy(refreshed, func(d *deal) bool { return d.epoch == epoch }))
+	secret, err := ss.Recover(2, lo.Map(refreshed[1:], func(d *deal, _ int) ss.Share { return d.share }))
+	assert.NoError(t, err)
+	assert.True(t, secret.IsEqual(NewScalar(42)))
+}
+
+func closeRefresh(t *testing.T, nodes []*on.Node, channels []*CTChannel) {
+	for _, c := range channels {
+		c.Close()
+	}
+	assert.True(t, lo.EveryBy(nodes, func(n *on.Node) bool { return n.Close() == nil }))
+}
+
+func tossAll(t *testing.T, channels []*CTChannel, seed string) {
+	outputChans := lo.Map(channels, func(*CTChannel, int) chan bool { return make(chan bool) })
+	for i, c := range channels {
+		c.TossCoin([]byte(seed), outputChans[i])
+	}
+	outcomes := lo.Map(outputChans, func(oc chan bool, _ int) bool { return <-oc })
+	assert.True(t, lo.EveryBy(outcomes, func(outcome bool) bool { return outcome == outcomes[0] }))
+}
+
+func TestShareProcessorShouldNotCombineSharesOfDifferentEpochs(t *testing.T) {
+	deals := makeLocalDeals(1, 3, NewScalar(42))
+	coefficients := []group.Scalar{RandomScalar()}
+	base := group.Ristretto255.HashToElement([]byte("seed"), []byte("refresh_test"))
+	epochShare := func(d *deal, epoch uint64) pointShare {
+		if epoch == 0 {
+			return shareToPoint(d.share, base)
+		}
+		refreshed := addScalar(d.share.Value, evaluateScalars(append([]group.Scalar{NewScalar(0)}, coefficients...), d.share.ID))
+		return shareToPoint(ss.Share{ID: d.share.ID, Value: refreshed}, base)
+	}
+	mixed, single := make(chan []byte, 1), make(chan []byte, 1)
+	sp := newShareProcessor(1, mixed, utils.DefaultLogger())
+	assert.NoError(t, sp.processShare(epochShare(deals[0], 0), 0, New()))
+	assert.NoError(t, sp.processShare(epochShare(deals[1], 1), 1, New()))
+	assert.Never(t, func() bool { return len(mixed) > 0 }, 100*time.Millisecond, 10*time.Millisecond)
+	assert.NoError(t, sp.processShare(epochShare(deals[2], 1), 1, New()))
+	reference := newShareProcessor(1, single, utils.DefaultLogger())
+	assert.NoError(t, reference.processShare(epochShare(deals[0], 0), 0, New()))
+	assert.NoError(t, reference.processShare(epochShare(deals[1], 0), 0, New()))
+	assert.Equal(t, <-single, <-mixed)
+	sp.close()
+	reference.close()
+}
+
+func TestChannelShouldKeepDealsOfUpcomingEpochs(t *testing.T) {
+	node := on.GetTestNode(t, "localhost:6310", "localhost:6310")
+	ctBeb, refreshBeb := on.NewBEBChannel(node, 'c'), on.NewBEBChannel(node, 'r')
+	on.InitializeNodes(t, []*on.Node{node})
+	dealBytes, err := DealOffline(NewScalar(42), 2, 4)
+	assert.NoError(t, err)
+	c, err := NewCoinTosserChannelFromDeal(dealBytes[0], ctBeb, 2, utils.DefaultLogger())
+	assert.NoError(t, err)
+	dealer, unregistered := New(), New()
+	indices := map[UUID]uint64{lo.Must(node.GetId()): 1, dealer: 2}
+	assert.NoError(t, c.RegisterShareIndices(indices))
+	c.EnableRefresh(refreshBeb, 1, nil)
+	d := lo.Must(unmarshalDeal(dealBytes[0]))
+	ids := lo.MapValues(indices, func(index uint64, _ UUID) group.Scalar { return NewScalar(index) })
+	receive := func(sender UUID, epoch uint64, forge bool) error {
+		deals, _, err := newRefreshDeals(d.base, 2, 1, epoch, ids)
+		assert.NoError(t, err)
+		rd := deals[lo.Must(node.GetId())]
+		if forge {
+			rd.column[1] = addScalar(rd.column[1], NewScalar(1))
+		}
+		res := make(chan error, 1)
+		c.commands <- func() error {
+			res <- c.receiveRefresh(sender, lo.Must(marshalRefreshDeal(rd)))
+			return nil
+		}
+		return <-res
+	}
+	assert.NoError(t, receive(dealer, RefreshLookahead, false))
+	assert.Error(t, receive(dealer, RefreshLookahead, false))
+	assert.NoError(t, receive(dealer, RefreshLookahead+1, false))
+	assert.Error(t, receive(dealer, 1, true))
+	assert.Error(t, receive(unregistered, 1, false))
+	kept := make(chan []uint64, 1)
+	c.commands <- func() error {
+		kept <- lo.Keys(lo.PickBy(c.refresh.rounds, func(_ uint64, r *refreshRound) bool { return r.dealings[dealer].digest != nil }))
+		return nil
+	}
+	assert.Equal(t, []uint64{RefreshLookahead}, <-kept)
+	kinds := lo.Map(c.Evidence(), func(e Evidence, _ int) MisbehaviourKind { return e.Kind })
+	assert.Equal(t, []MisbehaviourKind{DuplicateShare, InvalidRefresh}, kinds)
+	assert.True(t, <-c.AwaitCompletion(0, map[UUID][]byte{dealer: nil}))
+	assert.False(t, <-c.AwaitCompletion(RefreshLookahead+1, map[UUID][]byte{dealer: nil}))
+	assert.False(t, <-c.AwaitCompletion(1, map[UUID][]byte{unregistered: nil}))
+	assert.Error(t, <-c.ApplyRefresh(1, map[UUID][]byte{unregistered: nil}))
+	assert.Equal(t, uint64(0), c.Epoch())
+	c.Close()
+	assert.NoError(t, node.Close())
+}
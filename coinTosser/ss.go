@@ -9,6 +9,7 @@ import (
 	"github.com/cloudflare/circl/group"
 	ss "github.com/cloudflare/circl/secretsharing"
 	"github.com/samber/lo"
+	"math/big"
 )
 
 func shareSecret(threshold uint, nodes uint, secret group.Scalar) []ss.Share {
@@ -38,16 +39,26 @@ func lagrangeCoefficient(i group.Scalar, indices []group.Scalar) group.Scalar {
 	return mulScalar(numerators, inv(denominators))
 }
 
-// hashPointToBool hashes a point to a boolean value
-// Not sure if this is secure and unbiased.
-func hashPointToBool(point group.Element) (bool, error) {
+// hashPoint hashes a point to 32 bytes, which are uniform as long as the point is unpredictable and SHA-256 behaves as a random oracle.
+func hashPoint(point group.Element) ([]byte, error) {
 	pointMarshal, err := point.MarshalBinary()
 	if err != nil {
-		return false, fmt.Errorf("unable to generate bytes from point: %v", err)
+		return nil, fmt.Errorf("unable to generate bytes from point: %v", err)
 	}
 	hashed := sha256.Sum256(pointMarshal)
-	sum := lo.Reduce(hashed[:], func(acc int, b byte, _ int) int { return acc + int(b) }, 0)
-	return sum%2 == 0, nil
+	return hashed[:], nil
+}
+
+// randomnessToBool reduces the randomness of a toss to a coin.
+// The parity of the sum of the bytes is the parity of the sum of their lowest bits, so the coin is as unbiased as any of those bits.
+func randomnessToBool(randomness []byte) bool {
+	sum := lo.Reduce(randomness, func(acc int, b byte, _ int) int { return acc + int(b) }, 0)
+	return sum%2 == 0
+}
+
+func randomnessToIndex(randomness []byte, n uint) uint {
+	idx := new(big.Int).SetBytes(randomness)
+	return uint(idx.Mod(idx, new(big.Int).SetUint64(uint64(n))).Uint64())
 }
 
 func areScalarEquals(a, b group.Scalar) (bool, error) {
@@ -98,12 +98,13 @@ func TestDLEquivalenceManyShares(t *testing.T) {
 	}
 }
 
-func TestHashPointToBool(t *testing.T) {
+func TestHashPoint(t *testing.T) {
 	g := group.Ristretto255
 	point := g.HashToElement([]byte("base"), []byte("point"))
-	b, err := hashPointToBool(point)
+	randomness, err := hashPoint(point)
 	assert.NoError(t, err)
-	t.Log(b)
+	assert.Len(t, randomness, 32)
+	t.Log(randomnessToBool(randomness))
 }
 
 func TestMarshalAndUnmarshal(t *testing.T) {
@@ -0,0 +1,60 @@
+package coinTosser
+
+import (
+	"bkr-acs/utils"
+	"fmt"
+	. "github.com/google/uuid"
+	"github.com/samber/lo"
+)
+
+// CTInstanceState is a snapshot of a coin toss this node has contributed its share to.
+type CTInstanceState struct {
+	Id       UUID `json:"id"`
+	Shares   uint `json:"shares"`
+	Required uint `json:"required"`
+}
+
+// CTState is a snapshot of the coin tosses of the channel.
+// Pending holds the instances for which shares were received before this node tossed the coin.
+// The fingerprint of the key changes with the epoch, as each refresh of the shares changes their commitments.
+type CTState struct {
+	KeyFingerprint string               `json:"keyFingerprint"`
+	Epoch          uint64               `json:"epoch"`
+	Live           []CTInstanceState    `json:"live"`
+	Pending        []UUID               `json:"pending"`
+	Finished       []UUID               `json:"finished"`
+	Admission      utils.AdmissionState `json:"admission"`
+	Evidence       []Evidence           `json:"evidence"`
+}
+
+// State returns a snapshot of the channel.
+// It blocks until the channel has received its deal.
+func (c *CTChannel) State() (CTState, error) {
+	res := make(chan CTState, 1)
+	errChan := make(chan error, 1)
+	c.commands <- func() error {
+		fingerprint, err := c.deal.fingerprint()
+		if err != nil {
+			errChan <- fmt.Errorf("unable to compute key fingerprint: %v", err)
+			return nil
+		}
+		res <- CTState{
+			KeyFingerprint: fingerprint,
+			Epoch:          c.deal.epoch,
+			Live: lo.MapToSlice(c.instances, func(id UUID, ct *coinToss) CTInstanceState {
+				return CTInstanceState{Id: id, Shares: ct.sp.numShares(), Required: c.t + 1}
+			}),
+			Pending:   lo.Keys(c.unordered),
+			Finished:  lo.Keys(c.finished),
+			Admission: c.admission.State(),
+			Evidence:  c.evidence.snapshot(),
+		}
+		return nil
+	}
+	select {
+	case state := <-res:
+		return state, nil
+	case err := <-errChan:
+		return CTState{}, err
+	}
+}
@@ -0,0 +1,142 @@
+package coinTosser
+
+import (
+	"bkr-acs/utils"
+	"bytes"
+	"fmt"
+	"github.com/cloudflare/circl/group"
+	"github.com/samber/lo"
+)
+
+// shareProof is a share combined into a coin, with the commitment of its id that its proof of equal logarithms refers to.
+type shareProof struct {
+	commit group.Element
+	share  ctShare
+}
+
+// GroupKey returns the base of the deal and the commitment of the secret, which is the base raised to the secret.
+// The commitments of the shares of every epoch interpolate to it, so refreshing the shares does not change it.
+// It blocks until the deal is received.
+func (c *CTChannel) GroupKey() ([]byte, error) {
+	res := make(chan []byte, 1)
+	c.commands <- func() error {
+		key, err := marshalGroupKey(c.deal.base, recoverSecretFromPoints(c.deal.commits))
+		if err != nil {
+			res <- nil
+			return fmt.Errorf("unable to marshal group key: %v", err)
+		}
+		res <- key
+		return nil
+	}
+	if key := <-res; key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unable to compute group key")
+}
+
+func marshalGroupKey(base, secretCommit group.Element) ([]byte, error) {
+	baseBytes, err := base.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal base: %v", err)
+	}
+	commitBytes, err := secretCommit.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal secret commitment: %v", err)
+	}
+	return append(baseBytes, commitBytes...), nil
+}
+
+func unmarshalGroupKey(data []byte) (group.Element, group.Element, error) {
+	elementSize, err := getElementSize()
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to get element size: %v", err)
+	} else if len(data) != 2*elementSize {
+		return nil, nil, fmt.Errorf("group key has %d bytes instead of %d", len(data), 2*elementSize)
+	}
+	base, secretCommit := group.Ristretto255.NewElement(), group.Ristretto255.NewElement()
+	if err := base.UnmarshalBinary(data[:elementSize]); err != nil {
+		return nil, nil, fmt.Errorf("unable to unmarshal base: %v", err)
+	} else if err := secretCommit.UnmarshalBinary(data[elementSize:]); err != nil {
+		return nil, nil, fmt.Errorf("unable to unmarshal secret commitment: %v", err)
+	}
+	return base, secretCommit, nil
+}
+
+func marshalTossProof(proof []shareProof) ([]byte, error) {
+	data := make([]byte, 0)
+	for i, sp := range proof {
+		commitBytes, err := sp.commit.MarshalBinary()
+		if err != nil {
+			return nil, fmt.Errorf("unable to marshal commitment of %d-th share: %v", i, err)
+		}
+		shareBytes, err := sp.share.marshalBinary()
+		if err != nil {
+			return nil, fmt.Errorf("unable to marshal %d-th share: %v", i, err)
+		}
+		data = append(append(data, commitBytes...), shareBytes...)
+	}
+	return data, nil
+}
+
+func unmarshalTossProof(data []byte) ([]shareProof, error) {
+	elementSize, err := getElementSize()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get element size: %v", err)
+	}
+	scalarSize, err := utils.GetScalarSize()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get scalar size: %v", err)
+	}
+	// Each share is its commitment, followed by its epoch, id, point and proof of two elements and a scalar.
+	itemSize := elementSize + 8 + scalarSize + elementSize + 2*elementSize + scalarSize
+	if len(data) == 0 || len(data)%itemSize != 0 {
+		return nil, fmt.Errorf("proof of %d bytes is not a list of shares", len(data))
+	}
+	proof := make([]shareProof, 0, len(data)/itemSize)
+	for _, item := range lo.Chunk(data, itemSize) {
+		sp := shareProof{commit: group.Ristretto255.NewElement(), share: emptyCTShare()}
+		if err := sp.commit.UnmarshalBinary(item[:elementSize]); err != nil {
+			return nil, fmt.Errorf("unable to unmarshal commitment: %v", err)
+		} else if err := sp.share.unmarshalBinary(item[elementSize:]); err != nil {
+			return nil, fmt.Errorf("unable to unmarshal share: %v", err)
+		}
+		proof = append(proof, sp)
+	}
+	return proof, nil
+}
+
+// verifyTossProof checks that the randomness was tossed for seed by the nodes holding the shares of the group key.
+// Each share proves that its point is the base of the seed raised to the logarithm of its commitment, and the
+// commitments interpolate to the commitment of the secret, so the points interpolate to the base of the seed raised to
+// the secret. Shares that do not come from the deal cannot pass both checks without the secret.
+func verifyTossProof(seed, randomness, proofBytes, groupKey []byte) error {
+	base, secretCommit, err := unmarshalGroupKey(groupKey)
+	if err != nil {
+		return fmt.Errorf("invalid group key: %v", err)
+	}
+	proof, err := unmarshalTossProof(proofBytes)
+	if err != nil {
+		return fmt.Errorf("invalid proof: %v", err)
+	}
+	seedBase := group.Ristretto255.HashToElement(seed, []byte("coin_toss"))
+	for i, sp := range proof {
+		st := dleqStatement{g: base, h: seedBase, commit: sp.commit, point: sp.share.pt.point, proof: sp.share.proof}
+		if lo.ContainsBy(proof[:i], func(other shareProof) bool { return other.share.pt.id.IsEqual(sp.share.pt.id) }) {
+			return fmt.Errorf("proof repeats the share of the %d-th one", i)
+		} else if !st.verify() {
+			return fmt.Errorf("invalid proof of %d-th share", i)
+		}
+	}
+	commits := lo.Map(proof, func(sp shareProof, _ int) pointShare { return pointShare{id: sp.share.pt.id, point: sp.commit} })
+	if !recoverSecretFromPoints(commits).IsEqual(secretCommit) {
+		return fmt.Errorf("commitments of the shares do not match the group key")
+	}
+	points := lo.Map(proof, func(sp shareProof, _ int) pointShare { return sp.share.pt })
+	expected, err := hashPoint(recoverSecretFromPoints(points))
+	if err != nil {
+		return fmt.Errorf("unable to hash point: %v", err)
+	} else if !bytes.Equal(expected, randomness) {
+		return fmt.Errorf("randomness does not match the shares")
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package coinTosser
+
+import (
+	"bkr-acs/utils"
+	. "github.com/google/uuid"
+	"log/slog"
+	"runtime"
+)
+
+// maxBatch bounds the shares verified together, so that an invalid share only delays the outcomes of a few others.
+const maxBatch = 16
+
+// verification is a share waiting for its proof to be checked against the toss it was submitted to and the deal of its epoch.
+type verification struct {
+	id     UUID
+	sender UUID
+	toss   *coinToss
+	deal   *deal
+	share  ctShare
+}
+
+// shareVerifier checks the proofs of the shares on a pool of workers, outside the invoker of the channel.
+// Each worker takes the shares waiting when it becomes free and checks them in a single batch, and if the batch fails
+// it checks its halves in turn to tell the invalid shares apart. The outcomes are handed back to the invoker as commands.
+type shareVerifier struct {
+	jobs      chan verification
+	commands  chan<- func() error
+	deliver   func(job verification, valid bool) func() error
+	closeChan chan struct{}
+	logger    *slog.Logger
+}
+
+func newShareVerifier(commands chan<- func() error, deliver func(verification, bool) func() error, logger *slog.Logger) *shareVerifier {
+	v := &shareVerifier{
+		jobs:      make(chan verification, maxBatch*runtime.NumCPU()),
+		commands:  commands,
+		deliver:   deliver,
+		closeChan: make(chan struct{}),
+		logger:    utils.ComponentLogger(logger, "CT Verifier", slog.LevelWarn),
+	}
+	for i := 0; i < runtime.NumCPU(); i++ {
+		go v.worker()
+	}
+	return v
+}
+
+// submit queues a share without blocking the caller, which is the invoker the outcomes are handed back to.
+func (v *shareVerifier) submit(job verification) {
+	select {
+	case v.jobs <- job:
+	default:
+		go func() {
+			select {
+			case v.jobs <- job:
+			case <-v.closeChan:
+			}
+		}()
+	}
+}
+
+func (v *shareVerifier) worker() {
+	for {
+		select {
+		case job := <-v.jobs:
+			batch := v.drain([]verification{job})
+			for i, valid := range verifyShares(batch) {
+				select {
+				case v.commands <- v.deliver(batch[i], valid):
+				case <-v.closeChan:
+					return
+				}
+			}
+		case <-v.closeChan:
+			return
+		}
+	}
+}
+
+// drain adds the shares already waiting to the batch, up to maxBatch.
+func (v *shareVerifier) drain(batch []verification) []verification {
+	for len(batch) < maxBatch {
+		select {
+		case job := <-v.jobs:
+			batch = append(batch, job)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+// verifyShares tells which shares of the batch carry a valid proof. Shares with an unknown id are invalid.
+func verifyShares(batch []verification) []bool {
+	valid := make([]bool, len(batch))
+	indices := make([]int, 0, len(batch))
+	statements := make([]dleqStatement, 0, len(batch))
+	for i, job := range batch {
+		if st, err := job.toss.statement(job.deal, job.share); err == nil {
+			indices, statements = append(indices, i), append(statements, st)
+		}
+	}
+	for j, ok := range verifyDLEQs(statements) {
+		valid[indices[j]] = ok
+	}
+	return valid
+}
+
+func (v *shareVerifier) close() {
+	close(v.closeChan)
+}
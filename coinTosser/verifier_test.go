@@ -0,0 +1,30 @@
+package coinTosser
+
+import (
+	"bkr-acs/utils"
+	"github.com/cloudflare/circl/group"
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestShouldIdentifyInvalidSharesOfBatch(t *testing.T) {
+	deals := makeLocalDeals(3, 6, NewScalar(42))
+	base := group.Ristretto255.HashToElement([]byte("base"), []byte("verifier_test"))
+	tosses := lo.Map(deals, func(d *deal, _ int) *coinToss {
+		return newCoinToss(3, base, d, make(chan bool, 1), utils.DefaultLogger())
+	})
+	batch := lo.Map(tosses, func(ct *coinToss, _ int) verification {
+		share, err := ct.tossCoin()
+		assert.NoError(t, err)
+		return verification{id: uuid.New(), sender: uuid.New(), toss: tosses[0], deal: deals[0], share: share}
+	})
+	assert.True(t, lo.EveryBy(verifyShares(batch), func(valid bool) bool { return valid }))
+	batch[2].share.proof = batch[3].share.proof
+	batch[4].share.pt.id = NewScalar(100)
+	assert.Equal(t, []bool{true, true, false, true, false, true}, verifyShares(batch))
+	for _, ct := range tosses {
+		ct.close()
+	}
+}
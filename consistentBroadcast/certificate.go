@@ -0,0 +1,140 @@
+package consistentBroadcast
+
+import (
+	"bkr-acs/utils"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	. "github.com/google/uuid"
+	"io"
+)
+
+// Signature is the echo of a node: its signature of the statement of a broadcast and the public key that checks it.
+type Signature struct {
+	PublicKey []byte
+	Sig       []byte
+}
+
+// Certificate proves that a quorum of nodes echoed the payload with the given digest in a broadcast instance.
+// Since any two quorums share a correct node, and correct nodes echo a single payload per instance, no two payloads of
+// an instance can be certified. The certificate can be checked by any node that knows the participants.
+type Certificate struct {
+	Instance   UUID
+	Sender     UUID
+	Digest     [sha256.Size]byte
+	Signatures []Signature
+}
+
+// Quorum is the number of signed echoes in a certificate of a network with n nodes, f of which may be faulty.
+func Quorum(n, f uint) uint {
+	return (n + f + 2) / 2
+}
+
+// statement is what the nodes sign when they echo a payload.
+func statement(instance, sender UUID, digest [sha256.Size]byte) []byte {
+	buf := bytes.NewBuffer(make([]byte, 0, 3+2*len(UUID{})+len(digest)))
+	buf.WriteString("cbc")
+	buf.Write(instance[:])
+	buf.Write(sender[:])
+	buf.Write(digest[:])
+	return buf.Bytes()
+}
+
+// Verify checks that the certificate holds a quorum of valid signatures by distinct participants for content.
+func (c *Certificate) Verify(content []byte, participants []UUID, n, f uint) error {
+	if sha256.Sum256(content) != c.Digest {
+		return fmt.Errorf("content does not match the certified digest")
+	}
+	members := make(map[UUID]bool, len(participants))
+	for _, id := range participants {
+		members[id] = true
+	}
+	signers := make(map[UUID]bool, len(c.Signatures))
+	stmt := statement(c.Instance, c.Sender, c.Digest)
+	for _, sig := range c.Signatures {
+		pk, err := utils.ParsePublicKey(sig.PublicKey)
+		if err != nil {
+			return fmt.Errorf("unable to parse signer key: %v", err)
+		}
+		signer, err := utils.PkToUUID(pk)
+		if err != nil {
+			return fmt.Errorf("unable to compute signer id: %v", err)
+		} else if !members[signer] {
+			return fmt.Errorf("signer %s is not a participant", signer)
+		} else if signers[signer] {
+			return fmt.Errorf("signer %s appears twice", signer)
+		} else if !utils.VerifySignature(pk, stmt, sig.Sig) {
+			return fmt.Errorf("invalid signature by %s", signer)
+		}
+		signers[signer] = true
+	}
+	if uint(len(signers)) < Quorum(n, f) {
+		return fmt.Errorf("certificate has %d signatures, %d required", len(signers), Quorum(n, f))
+	}
+	return nil
+}
+
+func (c *Certificate) MarshalBinary() ([]byte, error) {
+	buf := bytes.NewBuffer([]byte{})
+	buf.Write(c.Instance[:])
+	buf.Write(c.Sender[:])
+	buf.Write(c.Digest[:])
+	if err := binary.Write(buf, binary.LittleEndian, uint16(len(c.Signatures))); err != nil {
+		return nil, fmt.Errorf("unable to write number of signatures: %v", err)
+	}
+	for _, sig := range c.Signatures {
+		for _, field := range [][]byte{sig.PublicKey, sig.Sig} {
+			if err := binary.Write(buf, binary.LittleEndian, uint16(len(field))); err != nil {
+				return nil, fmt.Errorf("unable to write field length: %v", err)
+			}
+			buf.Write(field)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *Certificate) UnmarshalBinary(data []byte) error {
+	_, err := c.readFrom(bytes.NewReader(data))
+	return err
+}
+
+// readFrom reads a certificate written by MarshalBinary and returns the number of bytes read.
+func (c *Certificate) readFrom(reader *bytes.Reader) (int, error) {
+	start := reader.Len()
+	var numSigs uint16
+	if _, err := io.ReadFull(reader, c.Instance[:]); err != nil {
+		return 0, fmt.Errorf("unable to read instance: %v", err)
+	} else if _, err := io.ReadFull(reader, c.Sender[:]); err != nil {
+		return 0, fmt.Errorf("unable to read sender: %v", err)
+	} else if _, err := io.ReadFull(reader, c.Digest[:]); err != nil {
+		return 0, fmt.Errorf("unable to read digest: %v", err)
+	} else if err := binary.Read(reader, binary.LittleEndian, &numSigs); err != nil {
+		return 0, fmt.Errorf("unable to read number of signatures: %v", err)
+	}
+	c.Signatures = make([]Signature, numSigs)
+	for i := range c.Signatures {
+		pk, err := readField(reader)
+		if err != nil {
+			return 0, fmt.Errorf("unable to read public key: %v", err)
+		}
+		sig, err := readField(reader)
+		if err != nil {
+			return 0, fmt.Errorf("unable to read signature: %v", err)
+		}
+		c.Signatures[i] = Signature{PublicKey: pk, Sig: sig}
+	}
+	return start - reader.Len(), nil
+}
+
+func readField(reader *bytes.Reader) ([]byte, error) {
+	var length uint16
+	if err := binary.Read(reader, binary.LittleEndian, &length); err != nil {
+		return nil, err
+	}
+	field := make([]byte, length)
+	if _, err := io.ReadFull(reader, field); err != nil {
+		return nil, err
+	}
+	return field, nil
+}
@@ -0,0 +1,307 @@
+package consistentBroadcast
+
+import (
+	on "bkr-acs/overlayNetwork"
+	"bkr-acs/transcript"
+	"bkr-acs/utils"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	. "github.com/google/uuid"
+	"log/slog"
+)
+
+// CBCMsg is a delivered payload, with the certificate that proves it was consistently broadcast.
+type CBCMsg struct {
+	Id          UUID
+	Content     []byte
+	Sender      UUID
+	Certificate *Certificate
+}
+
+// outgoing is a broadcast of this node that is gathering signed echoes.
+type outgoing struct {
+	content []byte
+	cert    *Certificate
+	signers map[UUID]bool
+}
+
+// CBCChannel implements signed echo broadcast.
+// Unlike the reliable broadcast it only guarantees consistency: correct nodes that deliver in an instance deliver the
+// same payload, but if the sender fails some of them may never deliver.
+type CBCChannel struct {
+	n             uint
+	f             uint
+	node          *on.Node
+	self          UUID
+	outgoing      map[UUID]*outgoing
+	broadcasts    map[UUID]bool
+	echoed        map[UUID]bool
+	delivered     map[UUID]bool
+	watermark     uint64
+	admission     *utils.Admission
+	middleware    *cbcMiddleware
+	CbcDeliver    chan CBCMsg
+	commands      chan func() error
+	closeCommands chan struct{}
+	closeDeliver  chan struct{}
+	logger        *slog.Logger
+}
+
+func NewCBCChannel(n, f uint, node *on.Node, beb *on.BEBChannel, logger *slog.Logger) (*CBCChannel, error) {
+	self, err := utils.PkToUUID(node.PublicKey())
+	if err != nil {
+		return nil, fmt.Errorf("unable to compute own id: %v", err)
+	}
+	deliverChan := make(chan *msg)
+	c := &CBCChannel{
+		n:             n,
+		f:             f,
+		node:          node,
+		self:          self,
+		outgoing:      make(map[UUID]*outgoing),
+		broadcasts:    make(map[UUID]bool),
+		echoed:        make(map[UUID]bool),
+		delivered:     make(map[UUID]bool),
+		admission:     utils.NewAdmission(),
+		middleware:    newCBCMiddleware(beb, deliverChan, logger),
+		CbcDeliver:    make(chan CBCMsg),
+		commands:      make(chan func() error),
+		closeCommands: make(chan struct{}, 1),
+		closeDeliver:  make(chan struct{}, 1),
+		logger:        utils.ComponentLogger(logger, "CBC Channel", slog.LevelWarn),
+	}
+	go c.invoker()
+	go c.bebDeliver(deliverChan)
+	c.logger.Info("CBC channel created", "n", n, "f", f)
+	return c, nil
+}
+
+func (c *CBCChannel) CBCBroadcast(msg []byte) (UUID, error) {
+	return c.CBCBroadcastWithSequence(0, msg)
+}
+
+// CBCBroadcastWithSequence broadcasts msg in a new instance with the given sequence and returns the id of the instance.
+// A random tag keeps the instance apart from the other broadcasts of this node with the same sequence.
+func (c *CBCChannel) CBCBroadcastWithSequence(seq uint64, msg []byte) (UUID, error) {
+	tag := make([]byte, 16)
+	if _, err := rand.Read(tag); err != nil {
+		return Nil, fmt.Errorf("unable to generate tag: %v", err)
+	}
+	return c.CBCBroadcastWithTag(seq, tag, msg)
+}
+
+// CBCBroadcastWithTag broadcasts msg in the instance identified by this node, the sequence and the tag.
+// A tag can only be used once per sequence.
+func (c *CBCChannel) CBCBroadcastWithTag(seq uint64, tag, msg []byte) (UUID, error) {
+	if len(tag) == 0 {
+		return Nil, fmt.Errorf("unable to broadcast: empty tag")
+	} else if len(tag) > maxTagLen {
+		return Nil, fmt.Errorf("unable to broadcast: tag of %d bytes exceeds the limit of %d", len(tag), maxTagLen)
+	}
+	id := computeInstanceId(tag, seq, c.self)
+	res := make(chan error, 1)
+	c.commands <- func() error {
+		if c.isCollected(id) {
+			res <- fmt.Errorf("instance %s is below the low watermark", id)
+			return nil
+		} else if c.broadcasts[id] {
+			res <- fmt.Errorf("already broadcast in instance %s", id)
+			return nil
+		} else if err := c.middleware.broadcastSend(id, seq, tag, msg); err != nil {
+			res <- err
+			return nil
+		}
+		c.broadcasts[id] = true
+		c.outgoing[id] = &outgoing{
+			content: msg,
+			cert:    &Certificate{Instance: id, Sender: c.self, Digest: sha256.Sum256(msg)},
+			signers: make(map[UUID]bool),
+		}
+		res <- nil
+		return nil
+	}
+	if err := <-res; err != nil {
+		return Nil, fmt.Errorf("unable to broadcast: %v", err)
+	}
+	return id, nil
+}
+
+// SetLowWatermark drops the state of the instances with a sequence below seq, and ignores their messages from then on.
+func (c *CBCChannel) SetLowWatermark(seq uint64) {
+	c.commands <- func() error {
+		if seq <= c.watermark {
+			return nil
+		}
+		c.watermark = seq
+		c.admission.Collect(seq)
+		for _, m := range []map[UUID]bool{c.broadcasts, c.echoed, c.delivered} {
+			for id := range m {
+				if c.isCollected(id) {
+					delete(m, id)
+				}
+			}
+		}
+		for id := range c.outgoing {
+			if c.isCollected(id) {
+				delete(c.outgoing, id)
+			}
+		}
+		return nil
+	}
+}
+
+// SetAdmissionPolicy limits the instances that peers can have this node echo or deliver.
+// Messages of instances that are not admitted are dropped, so the limits must leave room for the instances correct peers run concurrently.
+func (c *CBCChannel) SetAdmissionPolicy(policy utils.AdmissionPolicy) {
+	c.commands <- func() error {
+		c.admission.SetPolicy(policy)
+		return nil
+	}
+}
+
+func (c *CBCChannel) isCollected(id UUID) bool {
+	return utils.InstanceSequence(id) < c.watermark
+}
+
+func (c *CBCChannel) processMsg(msg *msg) error {
+	if c.isCollected(msg.id) {
+		c.logger.Debug("received message from collected instance", "id", msg.id)
+		return nil
+	}
+	known := c.broadcasts[msg.id] || c.echoed[msg.id] || c.delivered[msg.id]
+	if msg.kind != echo && !known && !c.admission.Admit(msg.id, msg.sender, c.watermark) {
+		c.logger.Debug("rejected message from unadmitted instance", "id", msg.id, "from", msg.sender)
+		return nil
+	}
+	switch msg.kind {
+	case send:
+		return c.processSend(msg)
+	case echo:
+		return c.processEcho(msg)
+	case final:
+		return c.processFinal(msg)
+	default:
+		return fmt.Errorf("unhandled default case in message processing")
+	}
+}
+
+// processSend signs the first payload of each instance and returns the signature to its sender.
+func (c *CBCChannel) processSend(msg *msg) error {
+	if c.echoed[msg.id] {
+		c.logger.Debug("ignoring repeated send", "id", msg.id, "from", msg.sender)
+		return nil
+	}
+	c.echoed[msg.id] = true
+	sig, err := c.node.Sign(statement(msg.id, msg.sender, sha256.Sum256(msg.content)))
+	if err != nil {
+		return fmt.Errorf("unable to sign echo: %v", err)
+	}
+	go func() {
+		if err := c.middleware.sendEcho(msg.id, msg.sender, sig); err != nil {
+			c.logger.Warn("unable to send echo", "id", msg.id, "error", err)
+		}
+	}()
+	return nil
+}
+
+// processEcho adds a signature to the certificate of a broadcast of this node, and disseminates it once it has a quorum.
+func (c *CBCChannel) processEcho(msg *msg) error {
+	out, ok := c.outgoing[msg.id]
+	if !ok || out.signers[msg.sender] || uint(len(out.signers)) >= Quorum(c.n, c.f) {
+		return nil
+	} else if !utils.VerifySignature(msg.senderKey, statement(msg.id, out.cert.Sender, out.cert.Digest), msg.content) {
+		return fmt.Errorf("invalid echo signature from %s", msg.sender)
+	}
+	pkBytes, err := utils.SerializePublicKey(msg.senderKey)
+	if err != nil {
+		return fmt.Errorf("unable to serialize signer key: %v", err)
+	}
+	out.signers[msg.sender] = true
+	out.cert.Signatures = append(out.cert.Signatures, Signature{PublicKey: pkBytes, Sig: msg.content})
+	if uint(len(out.signers)) == Quorum(c.n, c.f) {
+		c.logger.Info("certificate complete", "id", msg.id)
+		go func() {
+			if err := c.middleware.broadcastFinal(out.cert, out.content); err != nil {
+				c.logger.Warn("unable to broadcast final", "id", msg.id, "error", err)
+			}
+		}()
+	}
+	return nil
+}
+
+// processFinal delivers the payload of an instance once its certificate is checked against the participants.
+func (c *CBCChannel) processFinal(msg *msg) error {
+	if c.delivered[msg.id] {
+		return nil
+	} else if msg.cert.Instance != msg.id {
+		return fmt.Errorf("certificate of instance %s received in instance %s", msg.cert.Instance, msg.id)
+	}
+	participants, err := c.participants()
+	if err != nil {
+		return fmt.Errorf("unable to get participants: %v", err)
+	} else if err := msg.cert.Verify(msg.content, participants, c.n, c.f); err != nil {
+		return fmt.Errorf("invalid certificate from %s: %v", msg.sender, err)
+	}
+	c.delivered[msg.id] = true
+	c.admission.Release(msg.id)
+	delete(c.outgoing, msg.id)
+	output := CBCMsg{Id: msg.id, Content: msg.content, Sender: msg.cert.Sender, Certificate: msg.cert}
+	c.logger.Debug("delivering output message", "id", msg.id)
+	c.Transcript().RecordDecision("cbc", map[string]string{"instance": msg.id.String(), "sender": output.Sender.String(), "content": hex.EncodeToString(output.Content)})
+	go func() { c.CbcDeliver <- output }()
+	return nil
+}
+
+// participants are this node and the peers it is connected to, whose keys were authenticated when connecting.
+func (c *CBCChannel) participants() ([]UUID, error) {
+	ids, err := c.node.GetPeerIds()
+	if err != nil {
+		return nil, err
+	}
+	id, err := c.node.GetId()
+	if err != nil {
+		return nil, err
+	}
+	return append(ids, id), nil
+}
+
+// Transcript returns the recorder of the node this channel runs on.
+func (c *CBCChannel) Transcript() *transcript.Recorder {
+	return c.middleware.bebChannel.Transcript()
+}
+
+func (c *CBCChannel) Close() {
+	c.closeCommands <- struct{}{}
+	c.closeDeliver <- struct{}{}
+	c.middleware.close()
+}
+
+func (c *CBCChannel) bebDeliver(deliverChan <-chan *msg) {
+	for {
+		select {
+		case deliver := <-deliverChan:
+			c.commands <- func() error {
+				return c.processMsg(deliver)
+			}
+		case <-c.closeDeliver:
+			c.logger.Info("closing deliver executor")
+			return
+		}
+	}
+}
+
+func (c *CBCChannel) invoker() {
+	for {
+		select {
+		case cmd := <-c.commands:
+			if err := cmd(); err != nil {
+				c.logger.Warn("error executing command", "error", err)
+			}
+		case <-c.closeCommands:
+			c.logger.Info("closing executor")
+			return
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package consistentBroadcast
+
+import (
+	on "bkr-acs/overlayNetwork"
+	"bkr-acs/utils"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestChannelShouldBroadcastToSelf(t *testing.T) {
+	testShouldBroadcastToAll(t, 1, 0, 1)
+}
+
+func TestChannelShouldBroadcastToAllNoFaults(t *testing.T) {
+	testShouldBroadcastToAll(t, 4, 1, 4)
+}
+
+func TestChannelShouldBroadcastToAllMaxCrash(t *testing.T) {
+	f := uint(2)
+	n := 3*f + 1
+	testShouldBroadcastToAll(t, n, f, n-f)
+}
+
+func TestCertificateShouldNotVerifyOtherContent(t *testing.T) {
+	nodes, channels := getChannels(t, 4, 1, 4)
+	id, err := channels[0].CBCBroadcast([]byte("hello"))
+	assert.NoError(t, err)
+	output := <-channels[1].CbcDeliver
+	assert.Equal(t, id, output.Id)
+	participants := lo.Map(nodes, func(node *on.Node, _ int) uuid.UUID {
+		id, err := node.GetId()
+		assert.NoError(t, err)
+		return id
+	})
+	assert.NoError(t, output.Certificate.Verify([]byte("hello"), participants, 4, 1))
+	assert.Error(t, output.Certificate.Verify([]byte("bye"), participants, 4, 1))
+	assert.Error(t, output.Certificate.Verify([]byte("hello"), participants[1:], 4, 1))
+	certBytes, err := output.Certificate.MarshalBinary()
+	assert.NoError(t, err)
+	transferred := &Certificate{}
+	assert.NoError(t, transferred.UnmarshalBinary(certBytes))
+	assert.NoError(t, transferred.Verify([]byte("hello"), participants, 4, 1))
+	transferred.Signatures = transferred.Signatures[:Quorum(4, 1)-1]
+	assert.Error(t, transferred.Verify([]byte("hello"), participants, 4, 1))
+	teardown(t, channels, nodes)
+}
+
+func TestChannelShouldRejectRepeatedTags(t *testing.T) {
+	nodes, channels := getChannels(t, 1, 0, 1)
+	id, err := channels[0].CBCBroadcastWithTag(3, []byte("tag"), []byte("hello"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), utils.InstanceSequence(id))
+	_, err = channels[0].CBCBroadcastWithTag(3, []byte("tag"), []byte("bye"))
+	assert.Error(t, err)
+	other, err := channels[0].CBCBroadcastWithTag(4, []byte("tag"), []byte("bye"))
+	assert.NoError(t, err)
+	assert.NotEqual(t, id, other)
+	_, err = channels[0].CBCBroadcastWithTag(0, nil, []byte("untagged"))
+	assert.Error(t, err)
+	assert.Equal(t, id, (<-channels[0].CbcDeliver).Id)
+	assert.Equal(t, other, (<-channels[0].CbcDeliver).Id)
+	teardown(t, channels, nodes)
+}
+
+func TestChannelShouldRejectInstancesOutsideAdmissionWindow(t *testing.T) {
+	nodes, channels := getChannels(t, 4, 1, 4)
+	for _, c := range channels {
+		c.SetAdmissionPolicy(utils.AdmissionPolicy{Window: 10})
+	}
+	_, err := channels[0].CBCBroadcastWithSequence(10, []byte("beyond"))
+	assert.NoError(t, err)
+	id, err := channels[0].CBCBroadcastWithSequence(9, []byte("inside"))
+	assert.NoError(t, err)
+	for i, c := range channels {
+		output := <-c.CbcDeliver
+		assert.Equal(t, id, output.Id)
+		if i == 0 {
+			continue
+		}
+		assert.Eventually(t, func() bool {
+			rejected := make(chan uint64, 1)
+			c.commands <- func() error {
+				rejected <- c.admission.State().RejectedByWindow
+				return nil
+			}
+			return <-rejected == 1
+		}, time.Second, time.Millisecond)
+	}
+	teardown(t, channels, nodes)
+}
+
+func TestQuorumShouldIntersectInACorrectNode(t *testing.T) {
+	for f := uint(0); f < 10; f++ {
+		n := 3*f + 1
+		q := Quorum(n, f)
+		assert.Greater(t, 2*q, n+f)
+		assert.LessOrEqual(t, q, n-f)
+	}
+}
+
+func testShouldBroadcastToAll(t *testing.T, n, f, correct uint) {
+	nodes, channels := getChannels(t, n, f, correct)
+	msg := []byte("hello")
+	id, err := channels[0].CBCBroadcast(msg)
+	assert.NoError(t, err)
+	outputs := lo.Map(channels, func(c *CBCChannel, _ int) CBCMsg { return <-c.CbcDeliver })
+	sender, err := nodes[0].GetId()
+	assert.NoError(t, err)
+	for _, output := range outputs {
+		assert.Equal(t, msg, output.Content)
+		assert.Equal(t, id, output.Id)
+		assert.Equal(t, sender, output.Sender)
+		assert.Len(t, output.Certificate.Signatures, int(Quorum(n, f)))
+	}
+	teardown(t, channels, nodes)
+}
+
+func getChannels(t *testing.T, n, f, correct uint) ([]*on.Node, []*CBCChannel) {
+	nodes := lo.Map(lo.Range(int(n)), func(i int, _ int) *on.Node {
+		return on.GetTestNode(t, fmt.Sprintf("localhost:%d", 6000+i), "localhost:6000")
+	})
+	channels := lo.Map(nodes[:correct], func(node *on.Node, _ int) *CBCChannel {
+		c, err := NewCBCChannel(n, f, node, on.NewBEBChannel(node, 'c'), node.Logger())
+		assert.NoError(t, err)
+		return c
+	})
+	on.InitializeNodes(t, nodes)
+	return nodes, channels
+}
+
+func teardown(t *testing.T, channels []*CBCChannel, nodes []*on.Node) {
+	for _, c := range channels {
+		c.Close()
+	}
+	assert.True(t, lo.EveryBy(nodes, func(node *on.Node) bool { return node.Close() == nil }))
+}
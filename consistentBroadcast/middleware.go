@@ -0,0 +1,179 @@
+package consistentBroadcast
+
+import (
+	on "bkr-acs/overlayNetwork"
+	"bkr-acs/utils"
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"github.com/google/uuid"
+	"io"
+	"log/slog"
+	"math"
+)
+
+type middlewareCode byte
+
+const (
+	send middlewareCode = 'a' + iota
+	echo
+	final
+)
+
+func (c middlewareCode) String() string {
+	switch c {
+	case send:
+		return "send"
+	case echo:
+		return "echo"
+	case final:
+		return "final"
+	default:
+		return fmt.Sprintf("unknown(%d)", byte(c))
+	}
+}
+
+type msg struct {
+	kind      middlewareCode
+	id        uuid.UUID
+	sender    uuid.UUID
+	senderKey *ecdsa.PublicKey
+	content   []byte
+	cert      *Certificate
+}
+
+type cbcMiddleware struct {
+	bebChannel  *on.BEBChannel
+	deliverChan chan<- *msg
+	closeChan   chan struct{}
+	logger      *slog.Logger
+}
+
+func newCBCMiddleware(bebChannel *on.BEBChannel, deliverChan chan<- *msg, logger *slog.Logger) *cbcMiddleware {
+	m := &cbcMiddleware{
+		bebChannel:  bebChannel,
+		deliverChan: deliverChan,
+		closeChan:   make(chan struct{}, 1),
+		logger:      utils.ComponentLogger(logger, "CBC Middleware", slog.LevelWarn),
+	}
+	go m.bebDeliver(bebChannel.GetBEBChan())
+	return m
+}
+
+func (m *cbcMiddleware) bebDeliver(bebChan <-chan on.BEBMsg) {
+	for {
+		select {
+		case bebMsg := <-bebChan:
+			if structMsg, err := m.processMsg(bebMsg.Content, bebMsg.Sender); err != nil {
+				m.logger.Warn("unable to process message during beb delivery", "error", err)
+			} else {
+				go func() { m.deliverChan <- structMsg }()
+			}
+		case <-m.closeChan:
+			m.logger.Info("closing consistentBroadcast middleware")
+			return
+		}
+	}
+}
+
+// broadcastSend starts the instance with the given id, which the receivers compute from the sender, sequence and tag.
+func (m *cbcMiddleware) broadcastSend(id uuid.UUID, seq uint64, tag, content []byte) error {
+	buf := bytes.NewBuffer([]byte{byte(send)})
+	_ = binary.Write(buf, binary.LittleEndian, uint16(len(tag)))
+	buf.Write(tag)
+	_ = binary.Write(buf, binary.LittleEndian, seq)
+	buf.Write(content)
+	m.bebChannel.Transcript().RecordOutbound("cbc", map[string]string{"kind": send.String(), "instance": id.String(), "content": hex.EncodeToString(content)})
+	if err := m.bebChannel.BEBroadcast(buf.Bytes()); err != nil {
+		return fmt.Errorf("unable to broadcast send: %v", err)
+	}
+	return nil
+}
+
+// sendEcho returns the signature of this node to the sender of the instance.
+func (m *cbcMiddleware) sendEcho(id, to uuid.UUID, sig []byte) error {
+	buf := bytes.NewBuffer([]byte{byte(echo)})
+	buf.Write(id[:])
+	buf.Write(sig)
+	m.bebChannel.Transcript().RecordOutbound("cbc", map[string]string{"kind": echo.String(), "instance": id.String(), "to": to.String()})
+	if err := m.bebChannel.Unicast(buf.Bytes(), to); err != nil {
+		return fmt.Errorf("unable to send echo: %v", err)
+	}
+	return nil
+}
+
+func (m *cbcMiddleware) broadcastFinal(cert *Certificate, content []byte) error {
+	certBytes, err := cert.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("unable to marshal certificate: %v", err)
+	}
+	buf := bytes.NewBuffer([]byte{byte(final)})
+	buf.Write(cert.Instance[:])
+	buf.Write(certBytes)
+	buf.Write(content)
+	m.bebChannel.Transcript().RecordOutbound("cbc", map[string]string{"kind": final.String(), "instance": cert.Instance.String()})
+	if err := m.bebChannel.BEBroadcast(buf.Bytes()); err != nil {
+		return fmt.Errorf("unable to broadcast final: %v", err)
+	}
+	return nil
+}
+
+func (m *cbcMiddleware) processMsg(content []byte, sender *ecdsa.PublicKey) (*msg, error) {
+	senderId, err := utils.PkToUUID(sender)
+	if err != nil {
+		return nil, fmt.Errorf("unable to convert sender public key to UUID: %v", err)
+	}
+	reader := bytes.NewReader(content)
+	kindByte, err := reader.ReadByte()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read message kind: %v", err)
+	}
+	structMsg := &msg{kind: middlewareCode(kindByte), sender: senderId, senderKey: sender}
+	switch structMsg.kind {
+	case send:
+		var tagLen uint16
+		var seq uint64
+		if err := binary.Read(reader, binary.LittleEndian, &tagLen); err != nil {
+			return nil, fmt.Errorf("unable to read tag length: %v", err)
+		}
+		tag := make([]byte, tagLen)
+		if _, err := io.ReadFull(reader, tag); err != nil {
+			return nil, fmt.Errorf("unable to read tag: %v", err)
+		} else if err := binary.Read(reader, binary.LittleEndian, &seq); err != nil {
+			return nil, fmt.Errorf("unable to read sequence: %v", err)
+		}
+		structMsg.id = computeInstanceId(tag, seq, senderId)
+	case echo:
+		if structMsg.id, err = utils.ExtractIdFromMessage(reader); err != nil {
+			return nil, fmt.Errorf("unable to read instance id: %v", err)
+		}
+	case final:
+		if structMsg.id, err = utils.ExtractIdFromMessage(reader); err != nil {
+			return nil, fmt.Errorf("unable to read instance id: %v", err)
+		}
+		structMsg.cert = &Certificate{}
+		if _, err := structMsg.cert.readFrom(reader); err != nil {
+			return nil, fmt.Errorf("unable to read certificate: %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown message kind %v", structMsg.kind)
+	}
+	structMsg.content = make([]byte, reader.Len())
+	_, _ = reader.Read(structMsg.content)
+	m.bebChannel.Transcript().RecordInbound("cbc", senderId, map[string]string{"kind": structMsg.kind.String(), "instance": structMsg.id.String()})
+	return structMsg, nil
+}
+
+// maxTagLen is the longest tag a send message can carry.
+const maxTagLen = math.MaxUint16
+
+// computeInstanceId identifies a broadcast by its sender and tag, keeping the sequence chosen by the sender.
+func computeInstanceId(tag []byte, seq uint64, sender uuid.UUID) uuid.UUID {
+	return utils.NewInstanceId(seq, append(append([]byte("cbc"), sender[:]...), tag...))
+}
+
+func (m *cbcMiddleware) close() {
+	m.closeChan <- struct{}{}
+}
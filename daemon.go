@@ -0,0 +1,370 @@
+package main
+
+import (
+	acs "bkr-acs/agreementCommonSubset"
+	dc "bkr-acs/decisionCertificate"
+	"bkr-acs/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const subscriberBuffer = 64
+
+// proposer is the part of the BKR channel used by the client API.
+type proposer interface {
+	Propose(id uuid.UUID, proposal []byte) (chan [][]byte, error)
+	LowWatermark() uint64
+}
+
+// certifier is the part of the BKR channel that serves the certificates of the outputs.
+type certifier interface {
+	Certificate(id uuid.UUID) (<-chan *dc.Certificate, error)
+}
+
+// acsDecision is the output of an ACS instance as reported to the clients.
+type acsDecision struct {
+	Instance  uuid.UUID `json:"instance"`
+	Proposals [][]byte  `json:"proposals"`
+	DecidedAt time.Time `json:"decidedAt"`
+}
+
+// certifiedDecision is a decision with the certificate that proves it to clients that do not trust this node, as checked
+// by the verify command.
+type certifiedDecision struct {
+	acsDecision
+	Certificate []byte `json:"certificate"`
+}
+
+// proposalRequest is the body of a proposal submission.
+// The instance is a name, which is combined with the sequence into the id the same way as in the interactive mode.
+// The sequence must lie in the window of sequences above the low watermark of the node, and the state of the instance
+// is collected once the low watermark passes it.
+type proposalRequest struct {
+	Instance string `json:"instance"`
+	Sequence uint64 `json:"sequence,omitempty"`
+	Proposal []byte `json:"proposal"`
+}
+
+// clientServer exposes the ACS instances run by this node to external services through an HTTP/JSON API.
+// It observes the outputs of the BKR channel, so it also reports instances that were proposed to through other nodes.
+type clientServer struct {
+	bkr         proposer
+	window      uint64
+	lock        sync.Mutex
+	collected   uint64
+	proposed    map[uuid.UUID]bool
+	decisions   map[uuid.UUID]acsDecision
+	order       []uuid.UUID
+	subscribers map[chan acsDecision]bool
+	listener    net.Listener
+	server      *http.Server
+}
+
+// newClientServer serves the client API on address.
+// Proposals are accepted for the window sequences above the low watermark, which should be the admission window of the
+// nodes since they ignore the instances beyond it, or for any sequence not yet collected if window is 0.
+func newClientServer(address string, bkr proposer, window uint64) (*clientServer, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("unable to listen on client address: %v", err)
+	}
+	s := &clientServer{
+		bkr:         bkr,
+		window:      window,
+		proposed:    make(map[uuid.UUID]bool),
+		decisions:   make(map[uuid.UUID]acsDecision),
+		order:       make([]uuid.UUID, 0),
+		subscribers: make(map[chan acsDecision]bool),
+		listener:    listener,
+	}
+	s.server = &http.Server{Handler: s.routes()}
+	go func() {
+		if err := s.server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("client server stopped", "error", err)
+		}
+	}()
+	logger.Info("client server listening", "address", listener.Addr())
+	return s, nil
+}
+
+func (s *clientServer) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /proposals", s.handlePropose)
+	mux.HandleFunc("GET /outputs", s.handleOutputs)
+	mux.HandleFunc("GET /decisions", s.handleDecisions)
+	mux.HandleFunc("GET /decisions/{instance}", s.handleDecision)
+	mux.HandleFunc("GET /decisions/{instance}/certificate", s.handleCertificate)
+	return mux
+}
+
+func (s *clientServer) addr() net.Addr {
+	return s.listener.Addr()
+}
+
+func (s *clientServer) close() error {
+	return s.server.Close()
+}
+
+// parseInstanceId returns the id of the instance named by a request, which is either the id itself or a name.
+func parseInstanceId(instance string, seq uint64) uuid.UUID {
+	if id, err := uuid.Parse(instance); err == nil {
+		return id
+	}
+	return utils.NewInstanceId(seq, []byte(instance))
+}
+
+// DeliverOutput records the decision and forwards it to the subscribers.
+// Subscribers that fall behind are disconnected rather than blocking the BKR instance.
+func (s *clientServer) DeliverOutput(id uuid.UUID, output [][]byte) {
+	decision := acsDecision{Instance: id, Proposals: output, DecidedAt: time.Now()}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.collect()
+	if _, ok := s.decisions[id]; ok || utils.InstanceSequence(id) < s.bkr.LowWatermark() {
+		return
+	}
+	s.decisions[id] = decision
+	s.order = append(s.order, id)
+	for subscriber := range s.subscribers {
+		select {
+		case subscriber <- decision:
+		default:
+			logger.Warn("disconnecting slow output subscriber")
+			delete(s.subscribers, subscriber)
+			close(subscriber)
+		}
+	}
+}
+
+func (s *clientServer) handlePropose(w http.ResponseWriter, r *http.Request) {
+	var req proposalRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("unable to decode proposal: %v", err))
+		return
+	} else if req.Instance == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("missing instance"))
+		return
+	} else if _, err := uuid.Parse(req.Instance); err == nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("instance must be a name rather than an id, since the sequence of an id is not chosen by the client"))
+		return
+	} else if err := s.checkSequence(req.Sequence); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	id := utils.NewInstanceId(req.Sequence, []byte(req.Instance))
+	s.lock.Lock()
+	s.collect()
+	if s.proposed[id] {
+		s.lock.Unlock()
+		writeError(w, http.StatusConflict, fmt.Errorf("already proposed to instance %s", id))
+		return
+	}
+	s.proposed[id] = true
+	s.lock.Unlock()
+	if _, err := s.bkr.Propose(id, req.Proposal); err != nil {
+		s.lock.Lock()
+		delete(s.proposed, id)
+		s.lock.Unlock()
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("unable to propose: %v", err))
+		return
+	}
+	writeStatusJSON(w, http.StatusAccepted, map[string]uuid.UUID{"instance": id})
+}
+
+// collect drops the proposals and decisions of the instances below the low watermark, whose state the nodes collected.
+// It must be called with the lock held.
+func (s *clientServer) collect() {
+	watermark := s.bkr.LowWatermark()
+	if watermark <= s.collected {
+		return
+	}
+	s.collected = watermark
+	for id := range s.proposed {
+		if utils.InstanceSequence(id) < watermark {
+			delete(s.proposed, id)
+		}
+	}
+	s.order = lo.Filter(s.order, func(id uuid.UUID, _ int) bool {
+		if utils.InstanceSequence(id) < watermark {
+			delete(s.decisions, id)
+			return false
+		}
+		return true
+	})
+}
+
+// checkSequence rejects the sequences whose instances would never output, because they are already collected or lie
+// beyond the window the nodes admit, and which would otherwise raise the low watermark past the pending instances.
+func (s *clientServer) checkSequence(seq uint64) error {
+	watermark := s.bkr.LowWatermark()
+	if seq < watermark {
+		return fmt.Errorf("sequence %d is below the low watermark %d", seq, watermark)
+	} else if s.window > 0 && seq-watermark >= s.window {
+		return fmt.Errorf("sequence %d is beyond the window of %d sequences above the low watermark %d", seq, s.window, watermark)
+	}
+	return nil
+}
+
+// handleOutputs streams the decisions as newline delimited JSON until the client disconnects.
+// With history=true the decisions taken before the request are sent first.
+func (s *clientServer) handleOutputs(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming is not supported"))
+		return
+	}
+	subscriber := make(chan acsDecision, subscriberBuffer)
+	s.lock.Lock()
+	past := make([]acsDecision, 0)
+	if r.URL.Query().Get("history") == "true" {
+		past = s.pastDecisions()
+	}
+	s.subscribers[subscriber] = true
+	s.lock.Unlock()
+	defer s.unsubscribe(subscriber)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	encoder := json.NewEncoder(w)
+	for _, decision := range past {
+		if err := encoder.Encode(decision); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+	for {
+		select {
+		case decision, ok := <-subscriber:
+			if !ok {
+				return
+			} else if err := encoder.Encode(decision); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (s *clientServer) unsubscribe(subscriber chan acsDecision) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.subscribers[subscriber] {
+		delete(s.subscribers, subscriber)
+		close(subscriber)
+	}
+}
+
+func (s *clientServer) handleDecisions(w http.ResponseWriter, _ *http.Request) {
+	s.lock.Lock()
+	past := s.pastDecisions()
+	s.lock.Unlock()
+	writeJSON(w, past)
+}
+
+func (s *clientServer) handleDecision(w http.ResponseWriter, r *http.Request) {
+	if decision, ok := s.requestedDecision(w, r); ok {
+		writeJSON(w, decision)
+	}
+}
+
+// handleCertificate answers with the decision and its certificate, waiting for the certificate to complete.
+func (s *clientServer) handleCertificate(w http.ResponseWriter, r *http.Request) {
+	decision, ok := s.requestedDecision(w, r)
+	if !ok {
+		return
+	}
+	certs, ok := s.bkr.(certifier)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, fmt.Errorf("decisions are not certified"))
+		return
+	}
+	sub, err := certs.Certificate(decision.Instance)
+	if err != nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unable to get certificate: %v", err))
+		return
+	}
+	select {
+	case cert, ok := <-sub:
+		if !ok {
+			writeError(w, http.StatusGone, fmt.Errorf("instance %s was collected before its certificate completed", decision.Instance))
+			return
+		}
+		certBytes, err := cert.MarshalBinary()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("unable to marshal certificate: %v", err))
+			return
+		}
+		writeJSON(w, certifiedDecision{acsDecision: decision, Certificate: certBytes})
+	case <-r.Context().Done():
+	}
+}
+
+// requestedDecision returns the decision of the instance named by the request, answering with an error if there is none.
+func (s *clientServer) requestedDecision(w http.ResponseWriter, r *http.Request) (acsDecision, bool) {
+	var seq uint64
+	if seqStr := r.URL.Query().Get("sequence"); seqStr != "" {
+		var err error
+		if seq, err = strconv.ParseUint(seqStr, 10, 64); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid sequence: %v", err))
+			return acsDecision{}, false
+		}
+	}
+	id := parseInstanceId(r.PathValue("instance"), seq)
+	s.lock.Lock()
+	decision, ok := s.decisions[id]
+	s.lock.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("instance %s has not been decided", id))
+	}
+	return decision, ok
+}
+
+// watermarkAdvancer raises the low watermark of the node as instances output, keeping the state of the last retain
+// sequences below the first sequence that has not output. A sequence outputs once any of its instances does, and the
+// instances of the sequences above it are kept however far ahead they output, so they cannot collect the pending ones.
+type watermarkAdvancer struct {
+	bkr     interface{ SetLowWatermark(seq uint64) }
+	retain  uint64
+	lock    sync.Mutex
+	next    uint64
+	decided map[uint64]bool
+}
+
+func newWatermarkAdvancer(bkr *acs.BKRChannel, retain uint64) *watermarkAdvancer {
+	return &watermarkAdvancer{bkr: bkr, retain: retain, decided: make(map[uint64]bool)}
+}
+
+func (w *watermarkAdvancer) DeliverOutput(id uuid.UUID, _ [][]byte) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	seq := utils.InstanceSequence(id)
+	if seq < w.next {
+		return
+	}
+	w.decided[seq] = true
+	advanced := false
+	for w.decided[w.next] {
+		delete(w.decided, w.next)
+		w.next++
+		advanced = true
+	}
+	if advanced && w.next > w.retain {
+		go w.bkr.SetLowWatermark(w.next - w.retain)
+	}
+}
+
+func (s *clientServer) pastDecisions() []acsDecision {
+	past := make([]acsDecision, 0, len(s.order))
+	for _, id := range s.order {
+		past = append(past, s.decisions[id])
+	}
+	return past
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	acs "bkr-acs/agreementCommonSubset"
+	dc "bkr-acs/decisionCertificate"
+	on "bkr-acs/overlayNetwork"
+	"bkr-acs/utils"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// echoProposer decides every instance as soon as it is proposed to, with the proposal as the only output.
+type echoProposer struct {
+	client    *clientServer
+	watermark uint64
+}
+
+func (p *echoProposer) Propose(id uuid.UUID, proposal []byte) (chan [][]byte, error) {
+	go p.client.DeliverOutput(id, [][]byte{proposal})
+	return make(chan [][]byte, 1), nil
+}
+
+func (p *echoProposer) LowWatermark() uint64 {
+	return p.watermark
+}
+
+func TestClientShouldRejectInstancesThatNeverOutput(t *testing.T) {
+	bkr := &echoProposer{watermark: 10}
+	client, err := newClientServer("localhost:0", bkr, 100)
+	assert.NoError(t, err)
+	bkr.client = client
+	defer client.close()
+	url := fmt.Sprintf("http://%s", client.addr())
+	assert.Equal(t, http.StatusBadRequest, postProposalAt(t, url, uuid.New().String(), 10, "raw id"))
+	assert.Equal(t, http.StatusBadRequest, postProposalAt(t, url, "bkr-9", 9, "collected"))
+	assert.Equal(t, http.StatusBadRequest, postProposalAt(t, url, "bkr-110", 110, "beyond the window"))
+	assert.Equal(t, http.StatusAccepted, postProposalAt(t, url, "bkr-109", 109, "last in the window"))
+	assert.Equal(t, http.StatusAccepted, postProposalAt(t, url, "bkr-10", 10, "at the watermark"))
+}
+
+func TestClientShouldStreamAndStoreDecisions(t *testing.T) {
+	bkr := &echoProposer{}
+	client, err := newClientServer("localhost:0", bkr, 0)
+	assert.NoError(t, err)
+	bkr.client = client
+	defer client.close()
+	url := fmt.Sprintf("http://%s", client.addr())
+	stream, err := http.Get(url + "/outputs")
+	assert.NoError(t, err)
+	defer stream.Body.Close()
+	assert.Equal(t, http.StatusAccepted, postProposal(t, url, "bkr-0", "hello"))
+	assert.Equal(t, http.StatusConflict, postProposal(t, url, "bkr-0", "hello again"))
+	streamed := acsDecision{}
+	assert.NoError(t, json.NewDecoder(bufio.NewReader(stream.Body)).Decode(&streamed))
+	assert.Equal(t, parseInstanceId("bkr-0", 0), streamed.Instance)
+	assert.Equal(t, [][]byte{[]byte("hello")}, streamed.Proposals)
+	stored := acsDecision{}
+	assert.Equal(t, http.StatusOK, getJSON(t, url+"/decisions/bkr-0", &stored))
+	assert.Equal(t, streamed.Instance, stored.Instance)
+	all := make([]acsDecision, 0)
+	assert.Equal(t, http.StatusOK, getJSON(t, url+"/decisions", &all))
+	assert.Equal(t, 1, len(all))
+	assert.Equal(t, http.StatusNotFound, getJSON(t, url+"/decisions/bkr-1", &map[string]string{}))
+}
+
+// failingProposer fails the first proposal, as a BKR channel whose broadcast fails.
+type failingProposer struct {
+	echoProposer
+	failed bool
+}
+
+func (p *failingProposer) Propose(id uuid.UUID, proposal []byte) (chan [][]byte, error) {
+	if !p.failed {
+		p.failed = true
+		return nil, fmt.Errorf("unable to broadcast")
+	}
+	return p.echoProposer.Propose(id, proposal)
+}
+
+func TestClientShouldRetryFailedProposals(t *testing.T) {
+	bkr := &failingProposer{}
+	client, err := newClientServer("localhost:0", bkr, 0)
+	assert.NoError(t, err)
+	bkr.client = client
+	defer client.close()
+	url := fmt.Sprintf("http://%s", client.addr())
+	assert.Equal(t, http.StatusInternalServerError, postProposal(t, url, "bkr-0", "hello"))
+	assert.Equal(t, http.StatusAccepted, postProposal(t, url, "bkr-0", "hello"))
+	assert.Equal(t, http.StatusConflict, postProposal(t, url, "bkr-0", "hello"))
+}
+
+func TestClientShouldCollectInstancesBelowWatermark(t *testing.T) {
+	bkr := &echoProposer{}
+	client, err := newClientServer("localhost:0", bkr, 0)
+	assert.NoError(t, err)
+	bkr.client = client
+	defer client.close()
+	url := fmt.Sprintf("http://%s", client.addr())
+	assert.Equal(t, http.StatusAccepted, postProposalAt(t, url, "bkr-0", 0, "first"))
+	assert.Eventually(t, func() bool {
+		return getJSON(t, url+"/decisions/bkr-0", &acsDecision{}) == http.StatusOK
+	}, time.Second, 10*time.Millisecond)
+	client.lock.Lock()
+	bkr.watermark = 1
+	client.lock.Unlock()
+	assert.Equal(t, http.StatusAccepted, postProposalAt(t, url, "bkr-1", 1, "second"))
+	assert.Eventually(t, func() bool {
+		return getJSON(t, url+"/decisions/bkr-1?sequence=1", &acsDecision{}) == http.StatusOK
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, http.StatusNotFound, getJSON(t, url+"/decisions/bkr-0", &map[string]string{}))
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	assert.Len(t, client.proposed, 1)
+	assert.Len(t, client.decisions, 1)
+	assert.Equal(t, []uuid.UUID{parseInstanceId("bkr-1", 1)}, client.order)
+}
+
+// watermarkRecorder records the highest low watermark it is set to.
+type watermarkRecorder struct {
+	watermark atomic.Uint64
+}
+
+func (r *watermarkRecorder) SetLowWatermark(seq uint64) {
+	for current := r.watermark.Load(); seq > current && !r.watermark.CompareAndSwap(current, seq); current = r.watermark.Load() {
+	}
+}
+
+func TestWatermarkShouldOnlyAdvancePastDecidedPrefix(t *testing.T) {
+	recorder := &watermarkRecorder{}
+	advancer := &watermarkAdvancer{bkr: recorder, retain: 2, decided: make(map[uint64]bool)}
+	output := func(seq uint64) { advancer.DeliverOutput(utils.NewInstanceId(seq, []byte("bkr")), nil) }
+	output(1 << 15)
+	output(0)
+	output(1)
+	output(2)
+	assert.Eventually(t, func() bool { return recorder.watermark.Load() == 1 }, time.Second, time.Millisecond)
+	output(4)
+	output(5)
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, uint64(1), recorder.watermark.Load())
+	output(3)
+	assert.Eventually(t, func() bool { return recorder.watermark.Load() == 4 }, time.Second, time.Millisecond)
+	assert.Equal(t, map[uint64]bool{1 << 15: true}, advancer.decided)
+}
+
+// certifyingProposer is an echoProposer whose node signs each output, as the only member of its cluster.
+type certifyingProposer struct {
+	echoProposer
+	certs *dc.CertificateChannel
+}
+
+func (p *certifyingProposer) Propose(id uuid.UUID, proposal []byte) (chan [][]byte, error) {
+	if err := p.certs.Certify(id, acs.OutputDigest([][]byte{proposal})); err != nil {
+		return nil, err
+	}
+	return p.echoProposer.Propose(id, proposal)
+}
+
+func (p *certifyingProposer) Certificate(id uuid.UUID) (<-chan *dc.Certificate, error) {
+	return p.certs.Certificate(id)
+}
+
+func TestClientShouldServeVerifiableCertificates(t *testing.T) {
+	node := on.GetTestNode(t, "localhost:6000", "localhost:6000")
+	nodeId, err := node.GetId()
+	assert.NoError(t, err)
+	certs, err := dc.NewCertificateChannel(1, 0, node, on.NewBEBChannel(node, 'x'), node.Logger())
+	assert.NoError(t, err)
+	on.InitializeNodes(t, []*on.Node{node})
+	bkr := &certifyingProposer{certs: certs}
+	client, err := newClientServer("localhost:0", bkr, 0)
+	assert.NoError(t, err)
+	bkr.client = client
+	defer client.close()
+	url := fmt.Sprintf("http://%s", client.addr())
+	assert.Equal(t, http.StatusAccepted, postProposal(t, url, "bkr-0", "hello"))
+	assert.Eventually(t, func() bool {
+		return getJSON(t, url+"/decisions/bkr-0", &acsDecision{}) == http.StatusOK
+	}, time.Second, 10*time.Millisecond)
+	decision := certifiedDecision{}
+	assert.Equal(t, http.StatusOK, getJSON(t, url+"/decisions/bkr-0/certificate", &decision))
+	m := membership{Members: []member{{Index: 1, Id: nodeId}}}
+	assert.NoError(t, verifyDecision(m, decision, 0))
+	decision.Proposals = [][]byte{[]byte("bye")}
+	assert.Error(t, verifyDecision(m, decision, 0))
+	assert.Error(t, verifyDecision(membership{Members: []member{{Index: 1, Id: uuid.New()}}}, decision, 0))
+	certs.Close()
+	assert.NoError(t, node.Close())
+}
+
+func TestClientShouldRejectCertificatesWithoutCertifier(t *testing.T) {
+	bkr := &echoProposer{}
+	client, err := newClientServer("localhost:0", bkr, 0)
+	assert.NoError(t, err)
+	bkr.client = client
+	defer client.close()
+	url := fmt.Sprintf("http://%s", client.addr())
+	assert.Equal(t, http.StatusAccepted, postProposal(t, url, "bkr-0", "hello"))
+	assert.Eventually(t, func() bool {
+		return getJSON(t, url+"/decisions/bkr-0", &acsDecision{}) == http.StatusOK
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, http.StatusNotImplemented, getJSON(t, url+"/decisions/bkr-0/certificate", &map[string]string{}))
+}
+
+func postProposal(t *testing.T, url, instance, proposal string) int {
+	return postProposalAt(t, url, instance, 0, proposal)
+}
+
+func postProposalAt(t *testing.T, url, instance string, seq uint64, proposal string) int {
+	body, err := json.Marshal(proposalRequest{Instance: instance, Sequence: seq, Proposal: []byte(proposal)})
+	assert.NoError(t, err)
+	resp, err := http.Post(url+"/proposals", "application/json", bytes.NewReader(body))
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	return resp.StatusCode
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	ct "bkr-acs/coinTosser"
+	"flag"
+	"fmt"
+	"github.com/magiconair/properties"
+	"os"
+	"path/filepath"
+)
+
+// dealCommand performs the trusted setup of the coin offline, writing one share file per node.
+// Nodes started with -share load their file instead of waiting for the contact to deal over the network.
+// The share files are those of the BLS coin if the configuration selects it, and of the threshold coin otherwise.
+func dealCommand(args []string) error {
+	flags := flag.NewFlagSet("deal", flag.ExitOnError)
+	propsPathname := flags.String("config", "config/config.properties", "pathname of the configuration file with num_nodes and faulty")
+	out := flags.String("out", "keys", "directory where the share files are written")
+	_ = flags.Parse(args)
+	props, err := properties.LoadFile(*propsPathname, properties.UTF8)
+	if err != nil {
+		return fmt.Errorf("unable to load configuration: %v", err)
+	}
+	numNodes := props.MustGetUint("num_nodes")
+	faulty := props.MustGetUint("faulty")
+	var deals [][]byte
+	if props.GetString("coin", "cks") == "bls" {
+		deals, err = ct.DealBLSOffline(2*faulty, numNodes)
+	} else {
+		deals, err = ct.DealOffline(ct.RandomScalar(), 2*faulty, numNodes)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to deal secret: %v", err)
+	}
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		return fmt.Errorf("unable to create output directory: %v", err)
+	}
+	for i, d := range deals {
+		pathname := filepath.Join(*out, fmt.Sprintf("share%d.bin", i+1))
+		if err := os.WriteFile(pathname, d, 0o600); err != nil {
+			return fmt.Errorf("unable to write share file: %v", err)
+		}
+	}
+	fmt.Printf("wrote %d share files with threshold %d to %s\n", len(deals), 2*faulty, *out)
+	return nil
+}
@@ -0,0 +1,140 @@
+package decisionCertificate
+
+import (
+	"bkr-acs/utils"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	. "github.com/google/uuid"
+	"io"
+)
+
+// Signature is the share of a node: its signature of the statement of a decision and the public key that checks it.
+type Signature struct {
+	PublicKey []byte
+	Sig       []byte
+}
+
+// Certificate proves that a quorum of nodes decided value in an instance, such as the decision of an ABA instance or the
+// digest of the output of a BKR instance. Since any two quorums share a correct node, and correct nodes sign a single
+// value per instance, no two values of an instance can be certified. The certificate can be checked by anyone that
+// knows the participants, without running a node.
+type Certificate struct {
+	Instance   UUID
+	Value      []byte
+	Signatures []Signature
+}
+
+// Quorum is the number of signatures in a certificate of a network with n nodes, f of which may be faulty.
+// At least f+1 of them are by correct nodes, so a correct node decided the value.
+func Quorum(n, f uint) uint {
+	return n - f
+}
+
+// statement is what the nodes sign when they decide value in an instance.
+func statement(instance UUID, value []byte) []byte {
+	buf := bytes.NewBuffer(make([]byte, 0, 3+len(UUID{})+len(value)))
+	buf.WriteString("dec")
+	buf.Write(instance[:])
+	buf.Write(value)
+	return buf.Bytes()
+}
+
+// Verify checks that the certificate holds a quorum of valid signatures by distinct participants.
+func (c *Certificate) Verify(participants []UUID, n, f uint) error {
+	members := make(map[UUID]bool, len(participants))
+	for _, id := range participants {
+		members[id] = true
+	}
+	signers := make(map[UUID]bool, len(c.Signatures))
+	stmt := statement(c.Instance, c.Value)
+	for _, sig := range c.Signatures {
+		pk, err := utils.ParsePublicKey(sig.PublicKey)
+		if err != nil {
+			return fmt.Errorf("unable to parse signer key: %v", err)
+		}
+		signer, err := utils.PkToUUID(pk)
+		if err != nil {
+			return fmt.Errorf("unable to compute signer id: %v", err)
+		} else if !members[signer] {
+			return fmt.Errorf("signer %s is not a participant", signer)
+		} else if signers[signer] {
+			return fmt.Errorf("signer %s appears twice", signer)
+		} else if !utils.VerifySignature(pk, stmt, sig.Sig) {
+			return fmt.Errorf("invalid signature by %s", signer)
+		}
+		signers[signer] = true
+	}
+	if uint(len(signers)) < Quorum(n, f) {
+		return fmt.Errorf("certificate has %d signatures, %d required", len(signers), Quorum(n, f))
+	}
+	return nil
+}
+
+func (c *Certificate) MarshalBinary() ([]byte, error) {
+	buf := bytes.NewBuffer([]byte{})
+	buf.Write(c.Instance[:])
+	if err := writeField(buf, c.Value); err != nil {
+		return nil, fmt.Errorf("unable to write value: %v", err)
+	} else if err := binary.Write(buf, binary.LittleEndian, uint16(len(c.Signatures))); err != nil {
+		return nil, fmt.Errorf("unable to write number of signatures: %v", err)
+	}
+	for _, sig := range c.Signatures {
+		for _, field := range [][]byte{sig.PublicKey, sig.Sig} {
+			if err := writeField(buf, field); err != nil {
+				return nil, fmt.Errorf("unable to write signature: %v", err)
+			}
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *Certificate) UnmarshalBinary(data []byte) error {
+	reader := bytes.NewReader(data)
+	var numSigs uint16
+	if _, err := io.ReadFull(reader, c.Instance[:]); err != nil {
+		return fmt.Errorf("unable to read instance: %v", err)
+	} else if c.Value, err = readField(reader); err != nil {
+		return fmt.Errorf("unable to read value: %v", err)
+	} else if err := binary.Read(reader, binary.LittleEndian, &numSigs); err != nil {
+		return fmt.Errorf("unable to read number of signatures: %v", err)
+	}
+	c.Signatures = make([]Signature, numSigs)
+	for i := range c.Signatures {
+		pk, err := readField(reader)
+		if err != nil {
+			return fmt.Errorf("unable to read public key: %v", err)
+		}
+		sig, err := readField(reader)
+		if err != nil {
+			return fmt.Errorf("unable to read signature: %v", err)
+		}
+		c.Signatures[i] = Signature{PublicKey: pk, Sig: sig}
+	}
+	if reader.Len() > 0 {
+		return fmt.Errorf("%d trailing bytes after the certificate", reader.Len())
+	}
+	return nil
+}
+
+func writeField(buf *bytes.Buffer, field []byte) error {
+	if len(field) > 0xffff {
+		return fmt.Errorf("field of %d bytes is too long", len(field))
+	} else if err := binary.Write(buf, binary.LittleEndian, uint16(len(field))); err != nil {
+		return err
+	}
+	buf.Write(field)
+	return nil
+}
+
+func readField(reader *bytes.Reader) ([]byte, error) {
+	var length uint16
+	if err := binary.Read(reader, binary.LittleEndian, &length); err != nil {
+		return nil, err
+	}
+	field := make([]byte, length)
+	if _, err := io.ReadFull(reader, field); err != nil {
+		return nil, err
+	}
+	return field, nil
+}
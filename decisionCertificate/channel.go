@@ -0,0 +1,245 @@
+package decisionCertificate
+
+import (
+	on "bkr-acs/overlayNetwork"
+	"bkr-acs/utils"
+	"fmt"
+	. "github.com/google/uuid"
+	"log/slog"
+)
+
+// instance gathers the signatures of the nodes over the values they decided in an instance, until a value has a quorum.
+type instance struct {
+	signed      bool
+	signers     map[UUID]bool
+	candidates  map[string]*Certificate
+	cert        *Certificate
+	subscribers []chan *Certificate
+}
+
+func newInstance() *instance {
+	return &instance{signers: make(map[UUID]bool), candidates: make(map[string]*Certificate)}
+}
+
+// CertificateChannel turns the decisions of this node into certificates that third parties can check.
+// Each node signs the value it decided in an instance and broadcasts the signature, and the certificate of the instance
+// is complete once n-f nodes signed the same value. Correct nodes that decide the same value thus all obtain a certificate.
+type CertificateChannel struct {
+	n             uint
+	f             uint
+	node          *on.Node
+	pkBytes       []byte
+	instances     map[UUID]*instance
+	watermark     uint64
+	admission     *utils.Admission
+	middleware    *certMiddleware
+	commands      chan func() error
+	closeCommands chan struct{}
+	closeDeliver  chan struct{}
+	logger        *slog.Logger
+}
+
+func NewCertificateChannel(n, f uint, node *on.Node, beb *on.BEBChannel, logger *slog.Logger) (*CertificateChannel, error) {
+	pkBytes, err := utils.SerializePublicKey(node.PublicKey())
+	if err != nil {
+		return nil, fmt.Errorf("unable to serialize public key: %v", err)
+	}
+	deliverChan := make(chan *share)
+	c := &CertificateChannel{
+		n:             n,
+		f:             f,
+		node:          node,
+		pkBytes:       pkBytes,
+		instances:     make(map[UUID]*instance),
+		admission:     utils.NewAdmission(),
+		middleware:    newCertMiddleware(beb, deliverChan, logger),
+		commands:      make(chan func() error),
+		closeCommands: make(chan struct{}, 1),
+		closeDeliver:  make(chan struct{}, 1),
+		logger:        utils.ComponentLogger(logger, "Certificate Channel", slog.LevelWarn),
+	}
+	go c.invoker()
+	go c.bebDeliver(deliverChan)
+	c.logger.Info("certificate channel created", "n", n, "f", f)
+	return c, nil
+}
+
+// Certify signs the value this node decided in an instance and sends the signature to the other nodes.
+// A node signs a single value per instance.
+func (c *CertificateChannel) Certify(id UUID, value []byte) error {
+	res := make(chan error, 1)
+	c.commands <- func() error {
+		inst, err := c.getInstance(id)
+		if err != nil {
+			res <- err
+			return nil
+		} else if inst.signed {
+			res <- fmt.Errorf("instance %s was already certified", id)
+			return nil
+		}
+		sig, err := c.node.Sign(statement(id, value))
+		if err != nil {
+			res <- fmt.Errorf("unable to sign decision: %v", err)
+			return nil
+		}
+		inst.signed = true
+		res <- nil
+		go func() {
+			if err := c.middleware.broadcastShare(id, value, sig); err != nil {
+				c.logger.Warn("unable to broadcast share", "id", id, "error", err)
+			}
+		}()
+		return nil
+	}
+	if err := <-res; err != nil {
+		return fmt.Errorf("unable to certify: %v", err)
+	}
+	return nil
+}
+
+// Certificate returns a channel that receives the certificate of an instance once it is complete.
+// The channel is closed if the instance is collected before.
+func (c *CertificateChannel) Certificate(id UUID) (<-chan *Certificate, error) {
+	res := make(chan error, 1)
+	sub := make(chan *Certificate, 1)
+	c.commands <- func() error {
+		inst, err := c.getInstance(id)
+		if err != nil {
+			res <- err
+		} else if inst.cert != nil {
+			sub <- inst.cert
+			res <- nil
+		} else {
+			inst.subscribers = append(inst.subscribers, sub)
+			res <- nil
+		}
+		return nil
+	}
+	if err := <-res; err != nil {
+		return nil, fmt.Errorf("unable to subscribe to certificate: %v", err)
+	}
+	return sub, nil
+}
+
+// SetLowWatermark drops the state of the instances with a sequence below seq, and ignores their signatures from then on.
+func (c *CertificateChannel) SetLowWatermark(seq uint64) {
+	c.commands <- func() error {
+		if seq <= c.watermark {
+			return nil
+		}
+		c.watermark = seq
+		c.admission.Collect(seq)
+		for id, inst := range c.instances {
+			if c.isCollected(id) {
+				delete(c.instances, id)
+				for _, sub := range inst.subscribers {
+					close(sub)
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// SetAdmissionPolicy limits the instances for which peers can have signatures stored before this node certifies them.
+// Signatures of instances that are not admitted are dropped, so the limits must leave room for the instances correct peers run concurrently.
+func (c *CertificateChannel) SetAdmissionPolicy(policy utils.AdmissionPolicy) {
+	c.commands <- func() error {
+		c.admission.SetPolicy(policy)
+		return nil
+	}
+}
+
+func (c *CertificateChannel) isCollected(id UUID) bool {
+	return utils.InstanceSequence(id) < c.watermark
+}
+
+// getInstance returns the instance id as requested by this node, which no longer charges it to the peer that named it.
+func (c *CertificateChannel) getInstance(id UUID) (*instance, error) {
+	if c.isCollected(id) {
+		return nil, fmt.Errorf("instance %s is below the low watermark", id)
+	}
+	c.admission.Release(id)
+	inst := c.instances[id]
+	if inst == nil {
+		inst = newInstance()
+		c.instances[id] = inst
+	}
+	return inst, nil
+}
+
+// processShare adds the signature of a node to the candidate certificate of its value, keeping one signature per node.
+func (c *CertificateChannel) processShare(sh *share) error {
+	if c.isCollected(sh.instance) {
+		c.logger.Debug("received share of collected instance", "id", sh.instance)
+		return nil
+	}
+	inst := c.instances[sh.instance]
+	if inst == nil {
+		if !c.admission.Admit(sh.instance, sh.sender, c.watermark) {
+			c.logger.Debug("rejected share of unadmitted instance", "id", sh.instance, "from", sh.sender)
+			return nil
+		}
+		inst = newInstance()
+		c.instances[sh.instance] = inst
+	}
+	if inst.cert != nil || inst.signers[sh.sender] {
+		return nil
+	} else if !utils.VerifySignature(sh.senderKey, statement(sh.instance, sh.value), sh.sig) {
+		return fmt.Errorf("invalid share signature from %s", sh.sender)
+	}
+	pkBytes, err := utils.SerializePublicKey(sh.senderKey)
+	if err != nil {
+		return fmt.Errorf("unable to serialize signer key: %v", err)
+	}
+	inst.signers[sh.sender] = true
+	cert := inst.candidates[string(sh.value)]
+	if cert == nil {
+		cert = &Certificate{Instance: sh.instance, Value: sh.value}
+		inst.candidates[string(sh.value)] = cert
+	}
+	cert.Signatures = append(cert.Signatures, Signature{PublicKey: pkBytes, Sig: sh.sig})
+	if uint(len(cert.Signatures)) == Quorum(c.n, c.f) {
+		c.logger.Info("certificate complete", "id", sh.instance)
+		inst.cert, inst.candidates = cert, nil
+		for _, sub := range inst.subscribers {
+			sub <- cert
+		}
+		inst.subscribers = nil
+	}
+	return nil
+}
+
+func (c *CertificateChannel) Close() {
+	c.closeCommands <- struct{}{}
+	c.closeDeliver <- struct{}{}
+	c.middleware.close()
+}
+
+func (c *CertificateChannel) bebDeliver(deliverChan <-chan *share) {
+	for {
+		select {
+		case sh := <-deliverChan:
+			c.commands <- func() error {
+				return c.processShare(sh)
+			}
+		case <-c.closeDeliver:
+			c.logger.Info("closing deliver executor")
+			return
+		}
+	}
+}
+
+func (c *CertificateChannel) invoker() {
+	for {
+		select {
+		case cmd := <-c.commands:
+			if err := cmd(); err != nil {
+				c.logger.Warn("error executing command", "error", err)
+			}
+		case <-c.closeCommands:
+			c.logger.Info("closing executor")
+			return
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package decisionCertificate
+
+import (
+	on "bkr-acs/overlayNetwork"
+	"bkr-acs/utils"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestChannelShouldCertifyCommonDecision(t *testing.T) {
+	nodes, channels := getChannels(t, 4, 1)
+	id := utils.NewInstanceId(1, []byte("aba"))
+	subs := lo.Map(channels, func(c *CertificateChannel, _ int) <-chan *Certificate {
+		sub, err := c.Certificate(id)
+		assert.NoError(t, err)
+		return sub
+	})
+	for _, c := range channels {
+		assert.NoError(t, c.Certify(id, []byte{1}))
+	}
+	assert.Error(t, channels[0].Certify(id, []byte{0}))
+	participants := getParticipants(t, nodes)
+	for _, sub := range subs {
+		cert := <-sub
+		assert.Equal(t, id, cert.Instance)
+		assert.Equal(t, []byte{1}, cert.Value)
+		assert.NoError(t, cert.Verify(participants, 4, 1))
+	}
+	late, err := channels[0].Certificate(id)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1}, (<-late).Value)
+	teardown(t, channels, nodes)
+}
+
+func TestChannelShouldCertifyValueOfQuorum(t *testing.T) {
+	nodes, channels := getChannels(t, 4, 1)
+	id := utils.NewInstanceId(1, []byte("aba"))
+	assert.NoError(t, channels[0].Certify(id, []byte{0}))
+	for _, c := range channels[1:] {
+		assert.NoError(t, c.Certify(id, []byte{1}))
+	}
+	for _, c := range channels {
+		sub, err := c.Certificate(id)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{1}, (<-sub).Value)
+	}
+	teardown(t, channels, nodes)
+}
+
+func TestCertificateShouldNotVerifyTamperedCopies(t *testing.T) {
+	nodes, channels := getChannels(t, 4, 1)
+	id := utils.NewInstanceId(1, []byte("bkr"))
+	for _, c := range channels {
+		assert.NoError(t, c.Certify(id, []byte("digest")))
+	}
+	sub, err := channels[1].Certificate(id)
+	assert.NoError(t, err)
+	cert := <-sub
+	participants := getParticipants(t, nodes)
+	pk, err := utils.ParsePublicKey(cert.Signatures[0].PublicKey)
+	assert.NoError(t, err)
+	signer, err := utils.PkToUUID(pk)
+	assert.NoError(t, err)
+	assert.Error(t, cert.Verify(lo.Without(participants, signer), 4, 1))
+	certBytes, err := cert.MarshalBinary()
+	assert.NoError(t, err)
+	transferred := &Certificate{}
+	assert.NoError(t, transferred.UnmarshalBinary(certBytes))
+	assert.NoError(t, transferred.Verify(participants, 4, 1))
+	assert.Error(t, transferred.UnmarshalBinary(append(certBytes, 0)))
+	transferred.Value = []byte("other")
+	assert.Error(t, transferred.Verify(participants, 4, 1))
+	transferred.Value = cert.Value
+	transferred.Signatures = append(transferred.Signatures[:Quorum(4, 1)-1], transferred.Signatures[0])
+	assert.Error(t, transferred.Verify(participants, 4, 1))
+	transferred.Signatures = transferred.Signatures[:Quorum(4, 1)-1]
+	assert.Error(t, transferred.Verify(participants, 4, 1))
+	teardown(t, channels, nodes)
+}
+
+func TestChannelShouldCloseSubscriptionsOfCollectedInstances(t *testing.T) {
+	nodes, channels := getChannels(t, 4, 1)
+	id := utils.NewInstanceId(1, []byte("aba"))
+	sub, err := channels[0].Certificate(id)
+	assert.NoError(t, err)
+	channels[0].SetLowWatermark(2)
+	_, ok := <-sub
+	assert.False(t, ok)
+	assert.Error(t, channels[0].Certify(id, []byte{1}))
+	_, err = channels[0].Certificate(id)
+	assert.Error(t, err)
+	teardown(t, channels, nodes)
+}
+
+func TestChannelShouldOnlyStoreSharesOfAdmittedInstances(t *testing.T) {
+	nodes, channels := getChannels(t, 1, 0)
+	c := channels[0]
+	c.SetAdmissionPolicy(utils.AdmissionPolicy{Window: 4, PeerQuota: 1})
+	peer := uuid.New()
+	known, pending := utils.NewInstanceId(1, []byte("known")), utils.NewInstanceId(2, []byte("pending"))
+	assert.Equal(t, 0, submitUnsignedShare(c, nodes[0], utils.NewInstanceId(10, []byte("far")), peer))
+	assert.Equal(t, 1, submitUnsignedShare(c, nodes[0], known, peer))
+	assert.Equal(t, 1, submitUnsignedShare(c, nodes[0], pending, peer))
+	_, err := c.Certificate(known)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, submitUnsignedShare(c, nodes[0], pending, peer))
+	teardown(t, channels, nodes)
+}
+
+// submitUnsignedShare hands a share with no signature to the channel, and returns the number of instances it then stores.
+func submitUnsignedShare(c *CertificateChannel, node *on.Node, id, sender uuid.UUID) int {
+	res := make(chan int, 1)
+	c.commands <- func() error {
+		_ = c.processShare(&share{instance: id, value: []byte{1}, sender: sender, senderKey: node.PublicKey()})
+		res <- len(c.instances)
+		return nil
+	}
+	return <-res
+}
+
+func TestQuorumShouldIntersectInACorrectNode(t *testing.T) {
+	for f := uint(0); f < 10; f++ {
+		n := 3*f + 1
+		q := Quorum(n, f)
+		assert.Greater(t, 2*q, n+f)
+		assert.Greater(t, q, 2*f)
+	}
+}
+
+func getChannels(t *testing.T, n, f uint) ([]*on.Node, []*CertificateChannel) {
+	nodes := lo.Map(lo.Range(int(n)), func(i int, _ int) *on.Node {
+		return on.GetTestNode(t, fmt.Sprintf("localhost:%d", 6000+i), "localhost:6000")
+	})
+	channels := lo.Map(nodes, func(node *on.Node, _ int) *CertificateChannel {
+		c, err := NewCertificateChannel(n, f, node, on.NewBEBChannel(node, 'x'), node.Logger())
+		assert.NoError(t, err)
+		return c
+	})
+	on.InitializeNodes(t, nodes)
+	return nodes, channels
+}
+
+func getParticipants(t *testing.T, nodes []*on.Node) []uuid.UUID {
+	return lo.Map(nodes, func(node *on.Node, _ int) uuid.UUID {
+		id, err := node.GetId()
+		assert.NoError(t, err)
+		return id
+	})
+}
+
+func teardown(t *testing.T, channels []*CertificateChannel, nodes []*on.Node) {
+	for _, c := range channels {
+		c.Close()
+	}
+	assert.True(t, lo.EveryBy(nodes, func(node *on.Node) bool { return node.Close() == nil }))
+}
@@ -0,0 +1,92 @@
+package decisionCertificate
+
+import (
+	on "bkr-acs/overlayNetwork"
+	"bkr-acs/utils"
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"fmt"
+	"github.com/google/uuid"
+	"io"
+	"log/slog"
+)
+
+// share is the signature of a node over the value it decided in an instance.
+type share struct {
+	instance  uuid.UUID
+	value     []byte
+	sig       []byte
+	sender    uuid.UUID
+	senderKey *ecdsa.PublicKey
+}
+
+type certMiddleware struct {
+	bebChannel  *on.BEBChannel
+	deliverChan chan<- *share
+	closeChan   chan struct{}
+	logger      *slog.Logger
+}
+
+func newCertMiddleware(bebChannel *on.BEBChannel, deliverChan chan<- *share, logger *slog.Logger) *certMiddleware {
+	m := &certMiddleware{
+		bebChannel:  bebChannel,
+		deliverChan: deliverChan,
+		closeChan:   make(chan struct{}, 1),
+		logger:      utils.ComponentLogger(logger, "Certificate Middleware", slog.LevelWarn),
+	}
+	go m.bebDeliver(bebChannel.GetBEBChan())
+	return m
+}
+
+func (m *certMiddleware) bebDeliver(bebChan <-chan on.BEBMsg) {
+	for {
+		select {
+		case bebMsg := <-bebChan:
+			if sh, err := m.parseShare(bebMsg.Content, bebMsg.Sender); err != nil {
+				m.logger.Warn("unable to process message during beb delivery", "error", err)
+			} else {
+				go func() { m.deliverChan <- sh }()
+			}
+		case <-m.closeChan:
+			m.logger.Info("closing certificate middleware")
+			return
+		}
+	}
+}
+
+// broadcastShare sends the signature of this node to every node, including itself.
+func (m *certMiddleware) broadcastShare(instance uuid.UUID, value, sig []byte) error {
+	buf := bytes.NewBuffer(make([]byte, 0, len(instance)+2+len(value)+len(sig)))
+	buf.Write(instance[:])
+	if err := writeField(buf, value); err != nil {
+		return fmt.Errorf("unable to write value: %v", err)
+	}
+	buf.Write(sig)
+	m.bebChannel.Transcript().RecordOutbound("cert", map[string]string{"instance": instance.String(), "value": hex.EncodeToString(value)})
+	if err := m.bebChannel.BEBroadcast(buf.Bytes()); err != nil {
+		return fmt.Errorf("unable to broadcast share: %v", err)
+	}
+	return nil
+}
+
+func (m *certMiddleware) parseShare(content []byte, sender *ecdsa.PublicKey) (*share, error) {
+	senderId, err := utils.PkToUUID(sender)
+	if err != nil {
+		return nil, fmt.Errorf("unable to convert sender public key to UUID: %v", err)
+	}
+	sh := &share{sender: senderId, senderKey: sender}
+	reader := bytes.NewReader(content)
+	if _, err := io.ReadFull(reader, sh.instance[:]); err != nil {
+		return nil, fmt.Errorf("unable to read instance: %v", err)
+	} else if sh.value, err = readField(reader); err != nil {
+		return nil, fmt.Errorf("unable to read value: %v", err)
+	}
+	sh.sig = content[len(content)-reader.Len():]
+	m.bebChannel.Transcript().RecordInbound("cert", senderId, map[string]string{"instance": sh.instance.String(), "value": hex.EncodeToString(sh.value)})
+	return sh, nil
+}
+
+func (m *certMiddleware) close() {
+	m.closeChan <- struct{}{}
+}
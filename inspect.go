@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+var inspectResources = []string{"peers", "config", "brb", "aba", "ct", "bkr", "log/levels"}
+
+// inspectCommand queries the admin API of a running node and prints the answer.
+func inspectCommand(args []string) error {
+	flags := flag.NewFlagSet("inspect", flag.ExitOnError)
+	admin := flags.String("admin", "", "admin address of the node")
+	membershipPathname := flags.String("membership", "", "membership file used to find the admin address of the node with -index")
+	idx := flags.Uint("index", 1, "index of the node in the membership file")
+	setLevels := flags.String("set_levels", "", "comma separated list of component=level pairs to apply instead of querying a resource")
+	timeout := flags.Duration("timeout", 10*time.Second, "timeout of the request")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: inspect [flags] [resource]\nResources: %v (default peers)\n", inspectResources)
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+	address := *admin
+	if address == "" && *membershipPathname != "" {
+		_, mem, err := getMember(*membershipPathname, *idx)
+		if err != nil {
+			return fmt.Errorf("unable to get member: %v", err)
+		}
+		address = mem.Admin
+	}
+	if address == "" {
+		return fmt.Errorf("either -admin or a membership entry with an admin address is required")
+	}
+	client := &http.Client{Timeout: *timeout}
+	var resp *http.Response
+	var err error
+	if *setLevels != "" {
+		resp, err = putLogLevels(client, address, *setLevels)
+	} else {
+		resource := flags.Arg(0)
+		if resource == "" {
+			resource = "peers"
+		}
+		resp, err = client.Get(fmt.Sprintf("http://%s/%s", address, resource))
+	}
+	if err != nil {
+		return fmt.Errorf("unable to query admin API: %v", err)
+	}
+	defer resp.Body.Close()
+	return printResponse(resp)
+}
+
+func putLogLevels(client *http.Client, address, spec string) (*http.Response, error) {
+	body, err := json.Marshal(spec)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal levels: %v", err)
+	}
+	req, err := http.NewRequest(http.MethodPut, fmt.Sprintf("http://%s/log/levels", address), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create request: %v", err)
+	}
+	return client.Do(req)
+}
+
+func printResponse(resp *http.Response) error {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("unable to read response: %v", err)
+	}
+	indented := bytes.NewBuffer([]byte{})
+	if json.Indent(indented, body, "", "  ") == nil {
+		body = indented.Bytes()
+	}
+	if _, err := os.Stdout.Write(body); err != nil {
+		return fmt.Errorf("unable to print response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("admin API answered %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bkr-acs/utils"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"github.com/google/uuid"
+	"os"
+	"path/filepath"
+)
+
+// member is the identity of one node and the addresses it serves.
+// The key path is relative to the membership file.
+type member struct {
+	Index   uint      `json:"index"`
+	Id      uuid.UUID `json:"id"`
+	Address string    `json:"address"`
+	Key     string    `json:"key"`
+	Admin   string    `json:"admin,omitempty"`
+	Daemon  string    `json:"daemon,omitempty"`
+}
+
+type membership struct {
+	Contact string   `json:"contact"`
+	Members []member `json:"members"`
+}
+
+// keygenCommand generates the identities of a cluster and the membership file describing it.
+// It replaces config/key_gen.sh and does not depend on openssl.
+func keygenCommand(args []string) error {
+	flags := flag.NewFlagSet("keygen", flag.ExitOnError)
+	numNodes := flags.Uint("n", 4, "number of identities to generate")
+	out := flags.String("out", "keys", "directory where the keys and the membership file are written")
+	host := flags.String("host", "localhost", "host of the generated addresses")
+	port := flags.Uint("port", 6000, "port of the first node; the others use the following ports")
+	adminPort := flags.Uint("admin_port", 7000, "admin port of the first node (no admin address if 0)")
+	daemonPort := flags.Uint("daemon_port", 8000, "client API port of the first node (no client address if 0)")
+	_ = flags.Parse(args)
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		return fmt.Errorf("unable to create output directory: %v", err)
+	}
+	m := membership{Members: make([]member, 0, *numNodes)}
+	for i := uint(1); i <= *numNodes; i++ {
+		id, err := writeIdentity(*out, i)
+		if err != nil {
+			return fmt.Errorf("unable to write identity %d: %v", i, err)
+		}
+		mem := member{
+			Index:   i,
+			Id:      id,
+			Address: fmt.Sprintf("%s:%d", *host, *port+i-1),
+			Key:     fmt.Sprintf("sk%d.pem", i),
+		}
+		if *adminPort != 0 {
+			mem.Admin = fmt.Sprintf("%s:%d", *host, *adminPort+i-1)
+		}
+		if *daemonPort != 0 {
+			mem.Daemon = fmt.Sprintf("%s:%d", *host, *daemonPort+i-1)
+		}
+		m.Members = append(m.Members, mem)
+	}
+	if len(m.Members) > 0 {
+		m.Contact = m.Members[0].Address
+	}
+	pathname := filepath.Join(*out, "membership.json")
+	if err := writeMembership(pathname, m); err != nil {
+		return fmt.Errorf("unable to write membership: %v", err)
+	}
+	fmt.Printf("wrote %d identities and %s\n", *numNodes, pathname)
+	return nil
+}
+
+func writeIdentity(dir string, idx uint) (uuid.UUID, error) {
+	sk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("unable to generate key: %v", err)
+	}
+	skBytes, err := x509.MarshalECPrivateKey(sk)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("unable to marshal secret key: %v", err)
+	}
+	pkBytes, err := utils.SerializePublicKey(&sk.PublicKey)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("unable to marshal public key: %v", err)
+	}
+	skPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: skBytes})
+	if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("sk%d.pem", idx)), skPem, 0o600); err != nil {
+		return uuid.Nil, fmt.Errorf("unable to write secret key: %v", err)
+	}
+	pkPem := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pkBytes})
+	if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("pk%d.pem", idx)), pkPem, 0o644); err != nil {
+		return uuid.Nil, fmt.Errorf("unable to write public key: %v", err)
+	}
+	return utils.PkToUUID(&sk.PublicKey)
+}
+
+func loadPrivateKey(pathname string) (*ecdsa.PrivateKey, error) {
+	data, err := os.ReadFile(pathname)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read key file: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no pem block in %s", pathname)
+	}
+	sk, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse key: %v", err)
+	} else if sk.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("key is not on curve P-256")
+	}
+	return sk, nil
+}
+
+func writeMembership(pathname string, m membership) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal membership: %v", err)
+	}
+	return os.WriteFile(pathname, data, 0o644)
+}
+
+func loadMembership(pathname string) (membership, error) {
+	data, err := os.ReadFile(pathname)
+	if err != nil {
+		return membership{}, fmt.Errorf("unable to read membership file: %v", err)
+	}
+	var m membership
+	if err := json.Unmarshal(data, &m); err != nil {
+		return membership{}, fmt.Errorf("unable to parse membership file: %v", err)
+	}
+	return m, nil
+}
+
+// getMember returns the member with the given 1-based index, with its key path resolved against the membership file.
+func getMember(pathname string, idx uint) (membership, member, error) {
+	m, err := loadMembership(pathname)
+	if err != nil {
+		return membership{}, member{}, err
+	} else if idx == 0 || idx > uint(len(m.Members)) {
+		return membership{}, member{}, fmt.Errorf("index %d is out of the membership range [1, %d]", idx, len(m.Members))
+	}
+	mem := m.Members[idx-1]
+	if !filepath.IsAbs(mem.Key) {
+		mem.Key = filepath.Join(filepath.Dir(pathname), mem.Key)
+	}
+	return m, mem, nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"bkr-acs/utils"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+func TestKeygenShouldWriteLoadableIdentities(t *testing.T) {
+	dir := t.TempDir()
+	err := keygenCommand([]string{"-n", "3", "-out", dir, "-port", "9000", "-daemon_port", "0"})
+	assert.NoError(t, err)
+	pathname := filepath.Join(dir, "membership.json")
+	for i := uint(1); i <= 3; i++ {
+		m, mem, err := getMember(pathname, i)
+		assert.NoError(t, err)
+		assert.Equal(t, "localhost:9000", m.Contact)
+		assert.Empty(t, mem.Daemon)
+		sk, err := loadPrivateKey(mem.Key)
+		assert.NoError(t, err)
+		id, err := utils.PkToUUID(&sk.PublicKey)
+		assert.NoError(t, err)
+		assert.Equal(t, mem.Id, id)
+	}
+	_, _, err = getMember(pathname, 4)
+	assert.Error(t, err)
+}
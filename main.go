@@ -5,38 +5,187 @@ import (
 	aba "bkr-acs/asynchronousBinaryAgreement"
 	brb "bkr-acs/byzantineReliableBroadcast"
 	ct "bkr-acs/coinTosser"
+	dc "bkr-acs/decisionCertificate"
 	on "bkr-acs/overlayNetwork"
+	"bkr-acs/transcript"
 	"bkr-acs/utils"
+	"context"
+	"encoding/hex"
 	"flag"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/magiconair/properties"
 	"github.com/samber/lo"
 	"log/slog"
+	"os"
+	"os/signal"
 	"slices"
+	"strings"
+	"syscall"
+	"time"
 )
 
 var logger = utils.GetLogger("Main", slog.LevelDebug)
 
+type command struct {
+	run         func(args []string) error
+	description string
+}
+
+var commands = map[string]command{
+	"keygen":  {keygenCommand, "generate the node identities and the membership file"},
+	"verify":  {verifyCommand, "check the certificate of a decision against the membership file"},
+	"deal":    {dealCommand, "deal the coin secret offline and write one share file per node"},
+	"run":     {runCommand, "start a node"},
+	"inspect": {inspectCommand, "query the admin API of a running node"},
+	"bench":   {benchCommand, "drive load through the client API of running nodes"},
+}
+
 func main() {
-	propsPathname := flag.String("config", "config/config.properties", "pathname of the configuration file")
-	address := flag.String("address", "localhost:6000", "address of the current node")
-	flag.Parse()
-	props := properties.MustLoadFile(*propsPathname, properties.UTF8)
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+	if err := cmd.run(os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags]\nCommands:\n", os.Args[0])
+	names := lo.Keys(commands)
+	slices.Sort(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", name, commands[name].description)
+	}
+}
+
+// runCommand starts a node, serving the client API unless -interactive is set.
+func runCommand(args []string) error {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	propsPathname := flags.String("config", "config/config.properties", "pathname of the configuration file")
+	address := flags.String("address", "localhost:6000", "address of the current node")
+	membershipPathname := flags.String("membership", "", "membership file produced by keygen; overrides -address, -key, -admin and -daemon with the entry of -index")
+	idx := flags.Uint("index", 1, "index of the node in the membership file")
+	keyPathname := flags.String("key", "", "pathname of the node's secret key (a fresh key is generated if empty); required by -replay")
+	sharePathname := flags.String("share", "", "pathname of the share file produced by deal (the contact deals over the network if empty)")
+	transcriptPathname := flags.String("transcript", "", "pathname of the file where the protocol transcript is recorded (disabled if empty)")
+	transcriptFormat := flags.String("transcript_format", string(transcript.JSONL), "format of the transcript file (jsonl or binary)")
+	replayPathname := flags.String("replay", "", "pathname of a recorded transcript to replay offline instead of joining the network")
+	replayTimeout := flags.Duration("replay_timeout", 30*time.Second, "time to wait for the replayed stack to reproduce the recorded decisions")
+	logFormat := flags.String("log_format", string(utils.ColorFormat), "format of the logs (color, text or json)")
+	logLevels := flags.String("log_levels", "", "comma separated list of component=level pairs overriding the default log levels")
+	adminAddress := flags.String("admin", "", "local address of the admin HTTP server, such as localhost:7000 (disabled if empty)")
+	adminTimeout := flags.Duration("admin_timeout", 5*time.Second, "time the admin server waits for a channel to report its state")
+	daemonAddress := flags.String("daemon", "localhost:8000", "address of the client API")
+	interactive := flags.Bool("interactive", false, "read the proposals from stdin instead of serving the client API")
+	retain := flags.Uint64("retain", 1024, "number of sequences whose instances are kept below the first sequence without output; older ones are collected (never if 0)")
+	window := flags.Uint64("admission_window", 1<<16, "number of sequences above the low watermark whose instances peers may create (unlimited if 0)")
+	peerQuota := flags.Uint("peer_quota", 4096, "number of instances each peer may create before this node knows them (unlimited if 0)")
+	_ = flags.Parse(args)
+	rootLogger, err := setupLogging(utils.LogFormat(*logFormat), *logLevels)
+	if err != nil {
+		return fmt.Errorf("unable to setup logging: %v", err)
+	}
+	if *replayPathname != "" {
+		return replayTranscript(*replayPathname, *keyPathname, transcript.Format(*transcriptFormat), *replayTimeout, rootLogger)
+	}
+	props, err := properties.LoadFile(*propsPathname, properties.UTF8)
+	if err != nil {
+		return fmt.Errorf("unable to load configuration: %v", err)
+	}
 	logger.Info("loaded properties", allPropertiesList(props)...)
 	contact := props.MustGetString("contact")
-	node, err := on.NewNode(*address, contact)
+	var shareIndices map[uuid.UUID]uint64
+	if *membershipPathname != "" {
+		m, mem, err := getMember(*membershipPathname, *idx)
+		if err != nil {
+			return fmt.Errorf("unable to get member: %v", err)
+		}
+		contact, *address, *keyPathname = m.Contact, mem.Address, mem.Key
+		*adminAddress, *daemonAddress = mem.Admin, mem.Daemon
+		shareIndices = lo.SliceToMap(m.Members, func(mem member) (uuid.UUID, uint64) { return mem.Id, uint64(mem.Index) })
+	}
+	if *transcriptPathname != "" && props.GetParsedDuration("coin_refresh_interval", 0) > 0 {
+		return fmt.Errorf("a transcript cannot be recorded with coin_refresh_interval, since it would keep the share that the refreshes erase")
+	}
+	var deal []byte
+	if *sharePathname != "" {
+		if deal, err = os.ReadFile(*sharePathname); err != nil {
+			return fmt.Errorf("unable to read share file: %v", err)
+		}
+	}
+	node, err := createNode(*address, contact, *keyPathname, rootLogger)
 	if err != nil {
-		panic(fmt.Errorf("unable to create node: %v", err))
+		return fmt.Errorf("unable to create node: %v", err)
+	}
+	if *transcriptPathname != "" {
+		recorder, err := openTranscript(*transcriptPathname, transcript.Format(*transcriptFormat))
+		if err != nil {
+			return fmt.Errorf("unable to open transcript: %v", err)
+		}
+		defer recorder.Close()
+		node.SetTranscript(recorder)
 	}
 	logger.Info("node created", "address", *address, "contact", contact)
-	bkrChannel, err := computeBkrChannel(props, node, *address == contact)
+	var admin *adminServer
+	if *adminAddress != "" {
+		if admin, err = newAdminServer(*adminAddress, node, props, *adminTimeout); err != nil {
+			return fmt.Errorf("unable to start admin server: %v", err)
+		}
+		defer admin.close()
+	}
+	bkrChannel, err := computeBkrChannel(props, node, *address == contact, deal, *sharePathname, shareIndices, admin)
+	clear(deal)
+	if err != nil {
+		return fmt.Errorf("unable to create bkr channel: %v", err)
+	}
+	bkrChannel.SetAdmissionPolicy(utils.AdmissionPolicy{Window: *window, PeerQuota: *peerQuota})
+	if *retain > 0 {
+		bkrChannel.AttachObserver(newWatermarkAdvancer(bkrChannel, *retain))
+	}
+	if *interactive || *daemonAddress == "" {
+		if err := participateBKR(bkrChannel); err != nil {
+			return fmt.Errorf("error while participating in bkr: %v", err)
+		}
+		return nil
+	} else if err := runDaemon(*daemonAddress, bkrChannel, *window); err != nil {
+		return fmt.Errorf("error while running daemon: %v", err)
+	}
+	return nil
+}
+
+func createNode(address, contact, keyPathname string, rootLogger *slog.Logger) (*on.Node, error) {
+	if keyPathname == "" {
+		return on.NewNode(address, contact, rootLogger)
+	}
+	sk, err := loadPrivateKey(keyPathname)
 	if err != nil {
-		panic(fmt.Errorf("unable to create bkr channel: %v", err))
+		return nil, fmt.Errorf("unable to load key: %v", err)
 	}
-	if participateBKR(bkrChannel) != nil {
-		panic(fmt.Errorf("error while participating in bkr: %v", err))
+	return on.NewNodeWithKey(address, contact, sk, rootLogger)
+}
+
+// runDaemon serves the client API until the process is interrupted.
+func runDaemon(address string, bkrChannel *acs.BKRChannel, window uint64) error {
+	client, err := newClientServer(address, bkrChannel, window)
+	if err != nil {
+		return fmt.Errorf("unable to start client server: %v", err)
 	}
+	defer client.close()
+	bkrChannel.AttachObserver(client)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	logger.Info("shutting down daemon")
+	return nil
 }
 
 func allPropertiesList(props *properties.Properties) []any {
@@ -48,7 +197,34 @@ func allPropertiesList(props *properties.Properties) []any {
 	return allProps
 }
 
-func computeBkrChannel(props *properties.Properties, node *on.Node, amContact bool) (*acs.BKRChannel, error) {
+// setupLogging creates the root logger of the process and applies the initial component levels.
+func setupLogging(format utils.LogFormat, levelsSpec string) (*slog.Logger, error) {
+	levels, err := utils.ParseComponentLevels(levelsSpec)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse log levels: %v", err)
+	}
+	for component, level := range levels {
+		utils.SetComponentLevel(component, level)
+	}
+	rootLogger := utils.NewLogger(os.Stdout, format)
+	logger = utils.ComponentLogger(rootLogger, "Main", slog.LevelDebug)
+	return rootLogger, nil
+}
+
+func openTranscript(pathname string, format transcript.Format) (*transcript.Recorder, error) {
+	file, err := os.Create(pathname)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create transcript file: %v", err)
+	}
+	recorder, err := transcript.NewRecorder(file, format)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create transcript recorder: %v", err)
+	}
+	logger.Info("recording transcript", "pathname", pathname, "format", format)
+	return recorder, nil
+}
+
+func computeBkrChannel(props *properties.Properties, node *on.Node, amContact bool, deal []byte, sharePathname string, shareIndices map[uuid.UUID]uint64, admin *adminServer) (*acs.BKRChannel, error) {
 	numNodes := props.MustGetUint("num_nodes")
 	faulty := props.MustGetUint("faulty")
 	dealCode := props.MustGetString("deal_code")[0]
@@ -61,27 +237,167 @@ func computeBkrChannel(props *properties.Properties, node *on.Node, amContact bo
 	tBeb := on.NewBEBChannel(node, tCode)
 	bkrCode := props.MustGetString("bkr_code")[0]
 	bkrBeb := on.NewBEBChannel(node, bkrCode)
-	bkrBrb := brb.NewBRBChannel(numNodes, faulty, bkrBeb)
+	bkrBrb, err := newBrbChannel(props.GetString("brb_algorithm", "bracha"), numNodes, faulty, bkrBeb, node.Logger())
+	if err != nil {
+		return nil, fmt.Errorf("unable to create brb channel: %v", err)
+	}
+	admin.setBRB(bkrBrb)
+	var certs *dc.CertificateChannel
+	if props.GetBool("certificates", false) {
+		certBeb := on.NewBEBChannel(node, props.MustGetString("cert_code")[0])
+		if certs, err = dc.NewCertificateChannel(numNodes, faulty, node, certBeb, node.Logger()); err != nil {
+			return nil, fmt.Errorf("unable to create certificate channel: %v", err)
+		}
+	}
+	refreshInterval := props.GetParsedDuration("coin_refresh_interval", 0)
+	var refreshChans *refreshChannels
+	if refreshInterval > 0 {
+		refreshChans = newRefreshChannels(props, node)
+	}
 	if node.Join() != nil {
 		return nil, fmt.Errorf("unable to join the network")
 	}
 	logger.Info("node joined the network and is waiting for peers", "numNodes", numNodes)
 	node.WaitForPeers(numNodes - 1)
 	logger.Info("network is stable")
-	if amContact {
-		if err := ct.DealSecret(dealSS, ct.RandomScalar(), 2*faulty); err != nil {
-			return nil, fmt.Errorf("unable to deal secret: %v", err)
-		}
-	}
-	abaChannel, err := aba.NewAbaChannel(numNodes, faulty, dealSS, ctBeb, abaBeb, tBeb)
+	options := abaOptions{algorithm: props.GetString("aba_algorithm", "mmr"), coin: props.GetString("coin", "cks"), beaconKey: props.GetString("coin_beacon_key", ""), shareIndices: shareIndices}
+	abaChannel, coin, err := computeAbaChannel(numNodes, faulty, options, dealSS, ctBeb, abaBeb, tBeb, amContact, deal, node.Logger())
 	if err != nil {
 		return nil, fmt.Errorf("unable to create aba channel: %v", err)
 	}
+	if props.GetBool("aba_fast_path", false) {
+		abaChannel.EnableFastPath()
+	}
+	admin.setABA(abaChannel)
 	participants, err := getParticipantIds(node)
 	if err != nil {
 		return nil, fmt.Errorf("unable to get participant ids: %v", err)
 	}
-	return acs.NewBKRChannel(faulty, abaChannel, bkrBrb, participants), nil
+	recordMeta(node, props, participants, deal)
+	bkrChannel := acs.NewBKRChannel(faulty, abaChannel, bkrBrb, participants, node.Logger())
+	if certs != nil {
+		bkrChannel.EnableCertificates(certs)
+	}
+	admin.setBKR(bkrChannel)
+	if refreshChans != nil {
+		if err := startRefresh(coin, refreshChans, node, participants, numNodes, faulty, deal, sharePathname, shareIndices, refreshInterval); err != nil {
+			return nil, fmt.Errorf("unable to start coin refresh: %v", err)
+		}
+	}
+	return bkrChannel, nil
+}
+
+// newBrbChannel creates the reliable broadcast used to disseminate the proposals.
+// Digest echoes hashes instead of whole proposals, and AVID sends erasure-coded fragments, which saves bandwidth with large proposals.
+func newBrbChannel(algorithm string, numNodes, faulty uint, beb *on.BEBChannel, nodeLogger *slog.Logger) (*brb.BRBChannel, error) {
+	switch algorithm {
+	case "", "bracha":
+		return brb.NewBRBChannel(numNodes, faulty, beb, nodeLogger), nil
+	case "digest":
+		return brb.NewDigestBRBChannel(numNodes, faulty, beb, nodeLogger), nil
+	case "avid":
+		return brb.NewAVIDChannel(numNodes, faulty, beb, nodeLogger)
+	default:
+		return nil, fmt.Errorf("unknown brb algorithm %q", algorithm)
+	}
+}
+
+// abaOptions select the algorithm run by the ABA instances and the coin they toss.
+type abaOptions struct {
+	algorithm string
+	coin      string
+	beaconKey string
+	// shareIndices are the membership indices of the nodes, which are also the indices of their share files.
+	shareIndices map[uuid.UUID]uint64
+}
+
+func computeAbaChannel(numNodes, faulty uint, options abaOptions, dealSS *on.SSChannel, ctBeb, abaBeb, tBeb *on.BEBChannel, amContact bool, deal []byte, nodeLogger *slog.Logger) (*aba.AbaChannel, ct.Coin, error) {
+	algorithm, err := newAbaAlgorithm(options.algorithm)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to select aba algorithm: %v", err)
+	}
+	coin, err := newCoin(options, faulty, dealSS, ctBeb, amContact, deal, nodeLogger)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to create coin: %v", err)
+	}
+	abaChannel, err := aba.NewAbaChannelWithCoin(numNodes, faulty, coin, algorithm, abaBeb, tBeb, nodeLogger)
+	return abaChannel, coin, err
+}
+
+func newAbaAlgorithm(name string) (aba.Algorithm, error) {
+	switch name {
+	case "", "mmr":
+		return aba.MMR(), nil
+	case "mmr_internal":
+		return aba.InternalValidityMMR(), nil
+	case "benor":
+		return aba.BenOr(), nil
+	default:
+		return nil, fmt.Errorf("unknown aba algorithm %q", name)
+	}
+}
+
+// newCoin creates the coin tossed by the ABA instances. The threshold coin uses the offline deal if there is one, and
+// otherwise has the contact deal the secret over the network. The BLS coin always needs an offline deal.
+// With an offline deal and a membership file, each node may only contribute the shares of its own share file.
+func newCoin(options abaOptions, faulty uint, dealSS *on.SSChannel, ctBeb *on.BEBChannel, amContact bool, deal []byte, nodeLogger *slog.Logger) (ct.Coin, error) {
+	switch options.coin {
+	case "", "cks":
+		if deal != nil {
+			coin, err := ct.NewCoinTosserChannelFromDeal(deal, ctBeb, 2*faulty, nodeLogger)
+			if err != nil {
+				return nil, err
+			} else if options.shareIndices != nil {
+				if err := coin.RegisterShareIndices(options.shareIndices); err != nil {
+					return nil, fmt.Errorf("unable to register share indices: %v", err)
+				}
+			}
+			return coin, nil
+		} else if amContact {
+			if err := ct.DealSecret(dealSS, ct.RandomScalar(), 2*faulty); err != nil {
+				return nil, fmt.Errorf("unable to deal secret: %v", err)
+			}
+		}
+		return ct.NewCoinTosserChannel(dealSS, ctBeb, 2*faulty, nodeLogger)
+	case "bls":
+		if deal == nil {
+			return nil, fmt.Errorf("the bls coin requires the share file of an offline deal")
+		}
+		coin, err := ct.NewBLSCoinChannel(deal, ctBeb, nodeLogger)
+		if err != nil {
+			return nil, err
+		} else if options.shareIndices != nil {
+			if err := coin.RegisterShareIndices(options.shareIndices); err != nil {
+				return nil, fmt.Errorf("unable to register share indices: %v", err)
+			}
+		}
+		return coin, nil
+	case "beacon":
+		return ct.NewBeaconCoin(ct.NewHashBeacon([]byte(options.beaconKey)), nodeLogger), nil
+	case "local":
+		return ct.NewLocalCoin(), nil
+	default:
+		return nil, fmt.Errorf("unknown coin %q", options.coin)
+	}
+}
+
+// recordMeta writes the information required to rebuild this node's stack during replay.
+// The offline deal is recorded because, unlike a deal over the network, it does not appear in the frames.
+// Nodes that refresh their shares do not record transcripts, so that the recorded share is never one they erased.
+func recordMeta(node *on.Node, props *properties.Properties, participants []uuid.UUID, deal []byte) {
+	recorder := node.Transcript()
+	if !recorder.IsEnabled() {
+		return
+	}
+	fields := props.Map()
+	fields["participants"] = strings.Join(lo.Map(participants, func(id uuid.UUID, _ int) string { return id.String() }), ",")
+	if id, err := node.GetId(); err == nil {
+		fields["id"] = id.String()
+	}
+	if deal != nil {
+		fields["deal"] = hex.EncodeToString(deal)
+	}
+	recorder.Record(transcript.Entry{Kind: transcript.Meta, Layer: "main", Fields: fields})
 }
 
 func getParticipantIds(node *on.Node) ([]uuid.UUID, error) {
@@ -112,7 +428,7 @@ func participateBKR(bkrChannel *acs.BKRChannel) error {
 		if err != nil {
 			return fmt.Errorf("unable to read user input: %v", err)
 		}
-		id := utils.BytesToUUID([]byte(fmt.Sprintf("bkr-%d", i)))
+		id := utils.NewInstanceId(uint64(i), []byte(fmt.Sprintf("bkr-%d", i)))
 		proposal := []byte(input)
 		outputChan, err := bkrChannel.Propose(id, proposal)
 		if err != nil {
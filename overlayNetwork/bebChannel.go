@@ -1,13 +1,15 @@
 package overlayNetwork
 
 import (
+	"bkr-acs/transcript"
 	"bkr-acs/utils"
 	"crypto/ecdsa"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/samber/lo"
 	"log/slog"
 )
 
-var bebLogger = utils.GetLogger("BEB Channel", slog.LevelWarn)
-
 type BEBMsg struct {
 	Content []byte
 	Sender  *ecdsa.PublicKey
@@ -17,6 +19,7 @@ type BEBChannel struct {
 	node        *Node
 	listenCode  byte
 	deliverChan chan BEBMsg
+	logger      *slog.Logger
 }
 
 func NewBEBChannel(node *Node, listenCode byte) *BEBChannel {
@@ -24,34 +27,85 @@ func NewBEBChannel(node *Node, listenCode byte) *BEBChannel {
 		node:        node,
 		listenCode:  listenCode,
 		deliverChan: make(chan BEBMsg),
+		logger:      utils.ComponentLogger(node.rootLogger, "BEB Channel", slog.LevelWarn),
 	}
 	node.attachMessageObserver(beb)
-	bebLogger.Info("beb channel created", "listenCode", listenCode)
+	beb.logger.Info("beb channel created", "listenCode", listenCode)
 	return beb
 }
 
 func (b *BEBChannel) BEBroadcast(msg []byte) error {
-	bebLogger.Debug("broadcasting message", "msg", string(msg))
+	b.logger.Debug("broadcasting message", "msg", string(msg))
 	wrappedMsg := append([]byte{b.listenCode}, msg...)
+	b.node.recorder.Record(transcript.Entry{Kind: transcript.Outbound, Layer: "net", Code: b.listenCode, Raw: wrappedMsg})
 	peers := b.node.getPeers()
 	if err := b.node.unicastSelf(wrappedMsg); err != nil {
 		return err
 	}
 	for _, peer := range peers {
-		err := b.node.unicast(wrappedMsg, peer.conn)
+		err := b.node.unicastPeer(wrappedMsg, peer)
 		if err != nil {
-			nodeLogger.Warn("error sending to connection", "peer name", peer.name, "error", err)
+			b.logger.Warn("error sending to connection", "peer name", peer.name, "error", err)
+		}
+	}
+	return nil
+}
+
+// Scatter sends a different message to each node: msgs[0] to itself and one of the others to each of its peers.
+// It fails if there are fewer messages than nodes.
+func (b *BEBChannel) Scatter(msgs [][]byte) error {
+	peers := b.node.getPeers()
+	if len(msgs) < len(peers)+1 {
+		return fmt.Errorf("unable to scatter %d messages to %d nodes", len(msgs), len(peers)+1)
+	}
+	wrappedMsgs := lo.Map(msgs, func(msg []byte, _ int) []byte { return append([]byte{b.listenCode}, msg...) })
+	for _, wrappedMsg := range wrappedMsgs[:len(peers)+1] {
+		b.node.recorder.Record(transcript.Entry{Kind: transcript.Outbound, Layer: "net", Code: b.listenCode, Raw: wrappedMsg})
+	}
+	if err := b.node.unicastSelf(wrappedMsgs[0]); err != nil {
+		return err
+	}
+	for _, tuple := range lo.Zip2(peers, wrappedMsgs[1:len(peers)+1]) {
+		peer, msg := tuple.Unpack()
+		if err := b.node.unicastPeer(msg, peer); err != nil {
+			b.logger.Warn("error sending to connection", "peer name", peer.name, "error", err)
 		}
 	}
 	return nil
 }
 
+// Unicast sends msg only to the node with the given id, which may be this node.
+func (b *BEBChannel) Unicast(msg []byte, to uuid.UUID) error {
+	wrappedMsg := append([]byte{b.listenCode}, msg...)
+	b.node.recorder.Record(transcript.Entry{Kind: transcript.Outbound, Layer: "net", Code: b.listenCode, Raw: wrappedMsg})
+	if id, err := b.node.GetId(); err != nil {
+		return fmt.Errorf("unable to get own id: %v", err)
+	} else if id == to {
+		return b.node.unicastSelf(wrappedMsg)
+	}
+	peer, ok := lo.Find(b.node.getPeers(), func(p *peer) bool { return p.pkId == to })
+	if !ok {
+		return fmt.Errorf("no connection to node %s", to)
+	}
+	return b.node.unicastPeer(wrappedMsg, peer)
+}
+
 func (b *BEBChannel) bebDeliver(msg []byte, sender *ecdsa.PublicKey) {
 	if msg[0] == b.listenCode {
 		b.deliverChan <- BEBMsg{Content: msg[1:], Sender: sender}
 	}
 }
 
+// PublicKey returns the key that identifies this node as the sender of its messages.
+func (b *BEBChannel) PublicKey() *ecdsa.PublicKey {
+	return b.node.PublicKey()
+}
+
+// Transcript returns the recorder of the underlying node, which is nil unless recording was enabled.
+func (b *BEBChannel) Transcript() *transcript.Recorder {
+	return b.node.recorder
+}
+
 func (b *BEBChannel) GetBEBChan() <-chan BEBMsg {
 	return b.deliverChan
 }
@@ -24,6 +24,13 @@ const (
 	generic
 )
 
+const lengthPrefixSize = 4
+
+// frameSize is the number of bytes send writes to the connection for msg.
+func frameSize(msg []byte) int {
+	return lengthPrefixSize + len(msg)
+}
+
 func send(conn net.Conn, msg []byte) error {
 	writer := bufio.NewWriterSize(conn, len(msg)+int(unsafe.Sizeof(len(msg))))
 	err := binary.Write(writer, binary.LittleEndian, uint32(len(msg)))
@@ -42,13 +42,16 @@ func auxTestShouldReceiveLongMessage(size int, t *testing.T) {
 
 func auxTestShouldReceiveWhatWasSent(messages [][]byte, t *testing.T) {
 	address := "localhost:6000"
-	listening := make(chan struct{})
+	listening, done := make(chan struct{}), make(chan struct{})
 	go func() {
+		defer close(done)
 		listener, err := net.Listen("tcp", address)
 		assert.NoError(t, err)
+		defer listener.Close()
 		listening <- struct{}{}
 		connSend, err := listener.Accept()
 		assert.NoError(t, err)
+		defer connSend.Close()
 		for _, msg := range messages {
 			assert.NoError(t, send(connSend, msg))
 		}
@@ -61,4 +64,6 @@ func auxTestShouldReceiveWhatWasSent(messages [][]byte, t *testing.T) {
 		assert.NoError(t, err)
 		assert.True(t, bytes.Equal(msg, received))
 	}
+	assert.NoError(t, connReceive.Close())
+	<-done
 }
@@ -1,6 +1,7 @@
 package overlayNetwork
 
 import (
+	"bkr-acs/utils"
 	"crypto/ecdsa"
 	"crypto/rand"
 	"crypto/tls"
@@ -14,13 +15,13 @@ import (
 	"time"
 )
 
-func GetTestNode(t *testing.T, address, contact string) *Node {
-	node, err := NewNode(address, contact)
+func GetTestNode(t testing.TB, address, contact string) *Node {
+	node, err := NewNode(address, contact, utils.DefaultLogger().With("address", address))
 	assert.NoError(t, err)
 	return node
 }
 
-func InitializeNodes(t *testing.T, nodes []*Node) {
+func InitializeNodes(t testing.TB, nodes []*Node) {
 	for _, n := range nodes {
 		err := n.Join()
 		assert.NoError(t, err)
@@ -1,6 +1,7 @@
 package overlayNetwork
 
 import (
+	"bkr-acs/transcript"
 	"bkr-acs/utils"
 	"crypto/ecdsa"
 	"crypto/elliptic"
@@ -13,10 +14,10 @@ import (
 	"log/slog"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
-var nodeLogger = utils.GetLogger("Network Node", slog.LevelWarn)
-
 type nodeMessageObserver interface {
 	bebDeliver(msg []byte, sender *ecdsa.PublicKey)
 }
@@ -33,13 +34,61 @@ type Node struct {
 	sk           *ecdsa.PrivateKey
 	listener     net.Listener
 	closeChan    chan struct{}
+	recorder     *transcript.Recorder
+	offline      bool
+	rootLogger   *slog.Logger
+	logger       *slog.Logger
+	traffic      trafficCounters
+	interceptor  Interceptor
+}
+
+// Interceptor decides what a node sends to a peer in place of a broadcast message, so that tests can make the node misbehave.
+// It calls send once for each message to send instead, possibly later, and not at all to drop the message.
+// Messages a node sends to itself are not intercepted.
+type Interceptor func(msg []byte, to uuid.UUID, send func([]byte))
+
+type trafficCounters struct {
+	bytesSent        atomic.Uint64
+	bytesReceived    atomic.Uint64
+	messagesSent     atomic.Uint64
+	messagesReceived atomic.Uint64
+}
+
+// TrafficStats counts the frames exchanged with the peers since the node was created.
+// Byte counts include the length prefix of each frame but not the TLS overhead, and messages sent to the node itself are not counted.
+type TrafficStats struct {
+	BytesSent        uint64 `json:"bytesSent"`
+	BytesReceived    uint64 `json:"bytesReceived"`
+	MessagesSent     uint64 `json:"messagesSent"`
+	MessagesReceived uint64 `json:"messagesReceived"`
+}
+
+func (t *trafficCounters) countSent(msg []byte) {
+	t.bytesSent.Add(uint64(frameSize(msg)))
+	t.messagesSent.Add(1)
+}
+
+func (t *trafficCounters) countReceived(msg []byte) {
+	t.bytesReceived.Add(uint64(frameSize(msg)))
+	t.messagesReceived.Add(1)
 }
 
-func NewNode(address, contact string) (*Node, error) {
+// NewNode creates a node listening on address with a freshly generated identity.
+// The logger is tagged with the node's id and is handed to every component built on top of the node through Logger.
+func NewNode(address, contact string, logger *slog.Logger) (*Node, error) {
 	sk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	if err != nil {
 		return nil, fmt.Errorf("unable to generate secret key: %v", err)
 	}
+	return NewNodeWithKey(address, contact, sk, logger)
+}
+
+// NewNodeWithKey creates a node whose identity is the given P-256 key, such as one produced by the keygen command.
+func NewNodeWithKey(address, contact string, sk *ecdsa.PrivateKey, logger *slog.Logger) (*Node, error) {
+	rootLogger, err := tagLogger(logger, sk)
+	if err != nil {
+		return nil, fmt.Errorf("unable to tag logger: %v", err)
+	}
 	cert, err := makeSelfSignedCert(sk)
 	if err != nil {
 		return nil, fmt.Errorf("unable to make self-signed certificate: %v", err)
@@ -57,26 +106,98 @@ func NewNode(address, contact string) (*Node, error) {
 		config:       config,
 		sk:           sk,
 		closeChan:    make(chan struct{}, 1),
+		rootLogger:   rootLogger,
+		logger:       utils.ComponentLogger(rootLogger, "Network Node", slog.LevelWarn),
 	}
 	node.listener = node.setupTLSListener(address)
 	go node.listenConnections(isContact)
 	return &node, nil
 }
 
+// NewOfflineNode creates a node that is not connected to any peer.
+// Messages sent through it are discarded and messages are only received through Inject.
+// It is used to replay recorded transcripts through a single node's stack.
+func NewOfflineNode(logger *slog.Logger) (*Node, error) {
+	sk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate secret key: %v", err)
+	}
+	return NewOfflineNodeWithKey(sk, logger)
+}
+
+// NewOfflineNodeWithKey creates an offline node identified by the given key.
+// A replay must use the key of the recorded node, since the protocols rely on the id of the node running them.
+func NewOfflineNodeWithKey(sk *ecdsa.PrivateKey, logger *slog.Logger) (*Node, error) {
+	rootLogger, err := tagLogger(logger, sk)
+	if err != nil {
+		return nil, fmt.Errorf("unable to tag logger: %v", err)
+	}
+	node := Node{
+		hasJoined:    true,
+		peersLock:    sync.RWMutex{},
+		peers:        make([]*peer, 0),
+		msgObservers: make([]nodeMessageObserver, 0),
+		memChan:      make(chan struct{}),
+		sk:           sk,
+		closeChan:    make(chan struct{}, 1),
+		offline:      true,
+		rootLogger:   rootLogger,
+		logger:       utils.ComponentLogger(rootLogger, "Network Node", slog.LevelWarn),
+	}
+	return &node, nil
+}
+
+func tagLogger(logger *slog.Logger, sk *ecdsa.PrivateKey) (*slog.Logger, error) {
+	id, err := utils.PkToUUID(&sk.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to extract ID from public key: %v", err)
+	}
+	return logger.With("node", id), nil
+}
+
+// Logger returns the logger tagged with the id of this node.
+// Components running on the node should derive their loggers from it.
+func (n *Node) Logger() *slog.Logger {
+	return n.rootLogger
+}
+
+// SetTranscript makes the node record every frame it sends and receives.
+// The recorded inbound frames include this node's share of the coin secret, so the transcript must be kept private.
+func (n *Node) SetTranscript(recorder *transcript.Recorder) {
+	n.recorder = recorder
+}
+
+func (n *Node) Transcript() *transcript.Recorder {
+	return n.recorder
+}
+
+// Inject delivers a message to the observers of the node as if it had been received from the network.
+// Unlike messages received from peers, it is handed to the observers on the calling goroutine,
+// so that messages injected one after the other are delivered in that order.
+func (n *Node) Inject(msg []byte, sender *ecdsa.PublicKey) {
+	if len(msg) == 0 {
+		return
+	}
+	n.recordInbound(msg, sender)
+	for _, observer := range n.msgObservers {
+		observer.bebDeliver(msg, sender)
+	}
+}
+
 // Join adds a new node to the overlayNetwork
 func (n *Node) Join() error {
 	if n.hasJoined {
 		return fmt.Errorf("node has already joined the overlayNetwork")
 	}
-	nodeLogger.Info("I am joining the overlayNetwork", "contact", n.contact)
+	n.logger.Info("I am joining the overlayNetwork", "contact", n.contact)
 	if !(n.address == n.contact) {
-		nodeLogger.Info("I am not the contact")
+		n.logger.Info("I am not the contact")
 		err := n.connectToContact()
 		if err != nil {
 			return fmt.Errorf("unable to connect to contact: %v", err)
 		}
 	} else {
-		nodeLogger.Info("I am the contact")
+		n.logger.Info("I am the contact")
 	}
 	n.hasJoined = true
 	return nil
@@ -89,19 +210,43 @@ func (n *Node) attachMessageObserver(observer nodeMessageObserver) {
 func (n *Node) unicast(msg []byte, c net.Conn) error {
 	if !n.hasJoined {
 		return fmt.Errorf("node has not joined the overlayNetwork")
+	} else if n.offline {
+		return nil
 	}
 	toSend := append([]byte{byte(generic)}, msg...)
-	nodeLogger.Debug("unicasting message to connection", "conn", c.RemoteAddr(), "message", string(msg), "myself", n.address)
+	n.logger.Debug("unicasting message to connection", "conn", c.RemoteAddr(), "message", string(msg), "myself", n.address)
 	err := send(c, toSend)
 	if err != nil {
-		nodeLogger.Warn("error sending to connection", "conn", c.RemoteAddr(), "error", err)
+		n.logger.Warn("error sending to connection", "conn", c.RemoteAddr(), "error", err)
+	} else {
+		n.traffic.countSent(toSend)
 	}
 	return nil
 }
 
+// Intercept routes the broadcast messages this node sends to its peers through interceptor. It must be called before the node joins.
+func (n *Node) Intercept(interceptor Interceptor) {
+	n.interceptor = interceptor
+}
+
+// unicastPeer sends a broadcast message to a peer, through the interceptor if the node has one.
+func (n *Node) unicastPeer(msg []byte, p *peer) error {
+	if n.interceptor == nil {
+		return n.unicast(msg, p.conn)
+	}
+	n.interceptor(msg, p.pkId, func(msg []byte) {
+		if err := n.unicast(msg, p.conn); err != nil {
+			n.logger.Warn("unable to send intercepted message", "peer", p.name, "error", err)
+		}
+	})
+	return nil
+}
+
 func (n *Node) unicastSelf(msg []byte) error {
 	if !n.hasJoined {
 		return fmt.Errorf("node has not joined the overlayNetwork")
+	} else if n.offline {
+		return nil
 	}
 	toSend := append([]byte{byte(generic)}, msg...)
 	go n.processMessage(toSend, &n.sk.PublicKey)
@@ -109,28 +254,28 @@ func (n *Node) unicastSelf(msg []byte) error {
 }
 
 func (n *Node) connectToContact() error {
-	peer, err := newOutbound(n.address, n.contact, n.config)
+	peer, err := newOutbound(n.address, n.contact, n.config, n.logger)
 	if err != nil {
 		return fmt.Errorf("unable to connect to contact: %v", err)
 	}
-	nodeLogger.Debug("establishing connection with peer", "peer name", peer.name, "peer key", *peer.pk)
+	n.logger.Debug("establishing connection with peer", "peer name", peer.name, "peer key", *peer.pk)
 	go n.maintainConnection(peer, false)
 	return nil
 }
 
 func (n *Node) listenConnections(amContact bool) {
 	for {
-		peer, err := getInbound(n.listener)
+		peer, err := getInbound(n.listener, n.logger)
 		if err != nil {
 			if isListenerClosed(err) {
-				nodeLogger.Info("closing listener")
+				n.logger.Info("closing listener")
 				break
 			} else {
-				nodeLogger.Warn("error accepting connection with peer", "peer name", peer.name, "error", err)
+				n.logger.Warn("error accepting connection with peer", "peer name", peer.name, "error", err)
 				continue
 			}
 		}
-		nodeLogger.Debug("received connection from peer", "peer name", peer.name, "peer key", *peer.pk)
+		n.logger.Debug("received connection from peer", "peer name", peer.name, "peer key", *peer.pk)
 		go n.maintainConnection(peer, amContact)
 	}
 	n.closeChan <- struct{}{}
@@ -144,7 +289,7 @@ func isListenerClosed(err error) bool {
 func (n *Node) setupTLSListener(address string) net.Listener {
 	listener, err := tls.Listen("tcp", address, n.config)
 	if err != nil {
-		nodeLogger.Error("error listening on address", "address", address, "error", err)
+		n.logger.Error("error listening on address", "address", address, "error", err)
 		panic(err)
 	}
 	return listener
@@ -161,12 +306,12 @@ func computeConfig(cert *tls.Certificate) *tls.Config {
 
 func (n *Node) maintainConnection(peer peer, amContact bool) {
 	defer n.closeConnection(peer)
-	nodeLogger.Debug("maintaining connection with peer", "peer name", peer.name)
+	n.logger.Debug("maintaining connection with peer", "peer name", peer.name)
 	n.updatePeers(peer)
 	if amContact {
 		err := n.sendMembership(peer)
 		if err != nil {
-			nodeLogger.Warn("unable to send membership to peer", "peer name", peer.name, "error", err)
+			n.logger.Warn("unable to send membership to peer", "peer name", peer.name, "error", err)
 			return
 		}
 	}
@@ -183,7 +328,7 @@ func (n *Node) updatePeers(peer peer) {
 func (n *Node) sendMembership(peer peer) error {
 	n.peersLock.RLock()
 	defer n.peersLock.RUnlock()
-	nodeLogger.Debug("sending membership to peer", "peer name", peer.name, "membership", n.peers)
+	n.logger.Debug("sending membership to peer", "peer name", peer.name, "membership", n.peers)
 	for _, p := range n.peers {
 		if p.name != peer.name {
 			toSend := append([]byte{byte(membership)}, []byte(p.name)...)
@@ -191,6 +336,7 @@ func (n *Node) sendMembership(peer peer) error {
 			if err != nil {
 				return fmt.Errorf("unable to send membership to peer: %v", err)
 			}
+			n.traffic.countSent(toSend)
 		}
 	}
 	return nil
@@ -199,7 +345,7 @@ func (n *Node) sendMembership(peer peer) error {
 func (n *Node) closeConnection(peer peer) {
 	err := peer.conn.Close()
 	if err != nil {
-		nodeLogger.Warn("error closing connection", "peer name", peer.name, "error", err)
+		n.logger.Warn("error closing connection", "peer name", peer.name, "error", err)
 	}
 	n.forgetPeer(peer)
 }
@@ -211,13 +357,13 @@ func (n *Node) forgetPeer(rem peer) {
 }
 
 func (n *Node) closeAllConnections() {
-	nodeLogger.Info("closing all connections")
+	n.logger.Info("closing all connections")
 	n.peersLock.Lock()
 	defer n.peersLock.Unlock()
 	for _, peer := range n.peers {
 		err := peer.conn.Close()
 		if err != nil {
-			nodeLogger.Warn("error closing connection", "peer name", peer.name, "error", err)
+			n.logger.Warn("error closing connection", "peer name", peer.name, "error", err)
 		}
 	}
 	n.peers = make([]*peer, 0)
@@ -228,14 +374,15 @@ func (n *Node) readFromConnection(peer peer) {
 		msg, err := receive(peer.conn)
 		if err != nil {
 			if isConnectionClosed(err) {
-				nodeLogger.Debug("connection closed", "peer name", peer.name)
+				n.logger.Debug("connection closed", "peer name", peer.name)
 				n.forgetPeer(peer)
 				return
 			} else {
-				nodeLogger.Warn("error reading from connection", "peer name", peer.name, "error", err)
+				n.logger.Warn("error reading from connection", "peer name", peer.name, "error", err)
 				continue
 			}
 		}
+		n.traffic.countReceived(msg)
 		go n.processMessage(msg, peer.pk)
 	}
 }
@@ -252,19 +399,39 @@ func (n *Node) processMessage(msg []byte, sender *ecdsa.PublicKey) {
 	case membership:
 		n.processMembershipMsg(content)
 	case generic:
+		n.recordInbound(content, sender)
 		for _, observer := range n.msgObservers {
 			go func() { observer.bebDeliver(content, sender) }()
 		}
 	default:
-		nodeLogger.Error("unhandled default case", "msg type", msgType, "msg content", string(content))
+		n.logger.Error("unhandled default case", "msg type", msgType, "msg content", string(content))
 	}
 }
 
+func (n *Node) recordInbound(content []byte, sender *ecdsa.PublicKey) {
+	if !n.recorder.IsEnabled() || len(content) == 0 {
+		return
+	}
+	senderKey, err := utils.SerializePublicKey(sender)
+	if err != nil {
+		n.logger.Warn("unable to serialize sender key for transcript", "error", err)
+		return
+	}
+	n.recorder.Record(transcript.Entry{
+		Kind:      transcript.Inbound,
+		Layer:     "net",
+		Code:      content[0],
+		Sender:    utils.BytesToUUID(senderKey),
+		SenderKey: senderKey,
+		Raw:       content,
+	})
+}
+
 func (n *Node) processMembershipMsg(msg []byte) {
 	address := string(msg)
-	outbound, err := newOutbound(n.address, address, n.config)
+	outbound, err := newOutbound(n.address, address, n.config, n.logger)
 	if err != nil {
-		nodeLogger.Warn("error connecting to peer", "error", err)
+		n.logger.Warn("error connecting to peer", "error", err)
 	}
 	n.maintainConnection(outbound, false)
 }
@@ -279,6 +446,40 @@ func (n *Node) getPeers() []*peer {
 	return peers
 }
 
+// PeerState describes an open connection between the node and one of its peers.
+type PeerState struct {
+	Id             uuid.UUID `json:"id"`
+	Address        string    `json:"address"`
+	RemoteAddress  string    `json:"remoteAddress"`
+	ConnectedSince time.Time `json:"connectedSince"`
+}
+
+// Peers returns the peers the node is currently connected to.
+func (n *Node) Peers() []PeerState {
+	return lo.Map(n.getPeers(), func(p *peer, _ int) PeerState {
+		return PeerState{
+			Id:             p.pkId,
+			Address:        p.name,
+			RemoteAddress:  p.conn.RemoteAddr().String(),
+			ConnectedSince: p.since,
+		}
+	})
+}
+
+// Traffic returns the amount of data the node has exchanged with its peers.
+func (n *Node) Traffic() TrafficStats {
+	return TrafficStats{
+		BytesSent:        n.traffic.bytesSent.Load(),
+		BytesReceived:    n.traffic.bytesReceived.Load(),
+		MessagesSent:     n.traffic.messagesSent.Load(),
+		MessagesReceived: n.traffic.messagesReceived.Load(),
+	}
+}
+
+func (n *Node) Address() string {
+	return n.address
+}
+
 func (n *Node) GetId() (uuid.UUID, error) {
 	pk := n.sk.PublicKey
 	id, err := utils.PkToUUID(&pk)
@@ -288,6 +489,16 @@ func (n *Node) GetId() (uuid.UUID, error) {
 	return id, nil
 }
 
+// PublicKey returns the key that identifies the node.
+func (n *Node) PublicKey() *ecdsa.PublicKey {
+	return &n.sk.PublicKey
+}
+
+// Sign signs data with the key that identifies the node, so that any node can check it with utils.VerifySignature.
+func (n *Node) Sign(data []byte) ([]byte, error) {
+	return utils.Sign(n.sk, data)
+}
+
 func (n *Node) GetPeerIds() ([]uuid.UUID, error) {
 	ids := make([]uuid.UUID, 0)
 	for address, p := range n.peers {
@@ -307,6 +518,9 @@ func (n *Node) WaitForPeers(numPeers uint) {
 }
 
 func (n *Node) Close() error {
+	if n.offline {
+		return nil
+	}
 	err := n.listener.Close()
 	n.closeAllConnections()
 	<-n.closeChan
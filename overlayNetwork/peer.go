@@ -8,10 +8,9 @@ import (
 	"github.com/google/uuid"
 	"log/slog"
 	"net"
+	"time"
 )
 
-var peerLogger = utils.GetLogger("Peer", slog.LevelWarn)
-
 type listenerCloseError struct {
 	err error
 }
@@ -21,13 +20,14 @@ func (l listenerCloseError) Error() string {
 }
 
 type peer struct {
-	conn net.Conn
-	name string
-	pk   *ecdsa.PublicKey
-	pkId uuid.UUID
+	conn  net.Conn
+	name  string
+	pk    *ecdsa.PublicKey
+	pkId  uuid.UUID
+	since time.Time
 }
 
-func newOutbound(myName, address string, config *tls.Config) (peer, error) {
+func newOutbound(myName, address string, config *tls.Config, logger *slog.Logger) (peer, error) {
 	conn, err := tls.Dial("tcp", address, config)
 	if err != nil {
 		return peer{}, fmt.Errorf("unable to dial while establishing peer connection: %v", err)
@@ -46,16 +46,17 @@ func newOutbound(myName, address string, config *tls.Config) (peer, error) {
 		return peer{}, fmt.Errorf("unable to convert public key to UUID: %v", err)
 	}
 	peer := peer{
-		conn: conn,
-		name: address,
-		pk:   pk,
-		pkId: pkId,
+		conn:  conn,
+		name:  address,
+		pk:    pk,
+		pkId:  pkId,
+		since: time.Now(),
 	}
-	peerLogger.Debug("new outbound peer created", "address", address, "id", pkId)
+	logger.Debug("new outbound peer created", "address", address, "id", pkId)
 	return peer, nil
 }
 
-func getInbound(listener net.Listener) (peer, error) {
+func getInbound(listener net.Listener, logger *slog.Logger) (peer, error) {
 	conn, err := listener.Accept()
 	if err != nil {
 		return peer{}, listenerCloseError{err: err}
@@ -75,12 +76,13 @@ func getInbound(listener net.Listener) (peer, error) {
 		return peer{}, fmt.Errorf("unable to convert public key to UUID: %v", err)
 	}
 	peer := peer{
-		conn: conn,
-		name: name,
-		pk:   pk,
-		pkId: pkId,
+		conn:  conn,
+		name:  name,
+		pk:    pk,
+		pkId:  pkId,
+		since: time.Now(),
 	}
-	peerLogger.Debug("new inbound peer created", "address", name, "id", pkId)
+	logger.Debug("new inbound peer created", "address", name, "id", pkId)
 	return peer, nil
 }
 
@@ -1,6 +1,7 @@
 package overlayNetwork
 
 import (
+	"bkr-acs/utils"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
@@ -18,21 +19,25 @@ func TestShouldEstablishCorrectConnection(t *testing.T) {
 	assert.NoError(t, err)
 	server := "localhost:6000"
 	client := "localhost:6001"
+	done := make(chan struct{})
 	go func() {
+		defer close(done)
 		listener, err := tls.Listen("tcp", server, serverConfig)
 		assert.NoError(t, err)
-		inboundPeer, err := getInbound(listener)
+		defer listener.Close()
+		inboundPeer, err := getInbound(listener, utils.DefaultLogger())
 		assert.NoError(t, err)
 		assert.Equal(t, inboundPeer.name, client)
 		assert.Equal(t, *inboundPeer.pk, clientSk.PublicKey)
 	}()
 	time.Sleep(1 * time.Second)
-	outboundPeer, err := newOutbound(client, server, clientConfig)
+	outboundPeer, err := newOutbound(client, server, clientConfig, utils.DefaultLogger())
 	if err != nil {
 		t.Fatalf("unable to create outbound peer: %v", err)
 	}
 	assert.Equal(t, outboundPeer.name, server)
 	assert.Equal(t, *outboundPeer.pk, serverSk.PublicKey)
+	<-done
 }
 
 func makeTLSConfig() (*tls.Config, *ecdsa.PrivateKey, error) {
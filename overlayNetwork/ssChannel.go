@@ -12,8 +12,6 @@ import (
 	"log/slog"
 )
 
-var ssLogger = utils.GetLogger("SSChannel", slog.LevelWarn)
-
 type SSMsg struct {
 	Share      ss.Share
 	Commitment []byte
@@ -25,6 +23,7 @@ type SSChannel struct {
 	node        *Node
 	listenCode  byte
 	deliverChan chan *SSMsg
+	logger      *slog.Logger
 }
 
 func NewSSChannel(node *Node, listenCode byte) *SSChannel {
@@ -32,14 +31,15 @@ func NewSSChannel(node *Node, listenCode byte) *SSChannel {
 		node:        node,
 		listenCode:  listenCode,
 		deliverChan: make(chan *SSMsg),
+		logger:      utils.ComponentLogger(node.rootLogger, "SSChannel", slog.LevelWarn),
 	}
 	node.attachMessageObserver(s)
-	ssLogger.Info("ss channel created", "listenCode", listenCode)
+	s.logger.Info("ss channel created", "listenCode", listenCode)
 	return s
 }
 
 func (s *SSChannel) SSBroadcast(secret group.Scalar, threshold uint, commitMaker func([]ss.Share) ([]byte, error)) error {
-	ssLogger.Debug("broadcasting secret shares", "secret", secret, "threshold", threshold)
+	s.logger.Debug("broadcasting secret shares", "secret", secret, "threshold", threshold)
 	secretSharing := ss.New(rand.Reader, threshold, secret)
 	peers := s.node.getPeers()
 	shares := secretSharing.Share(uint(len(peers) + 1))
@@ -55,13 +55,14 @@ func (s *SSChannel) SSBroadcast(secret group.Scalar, threshold uint, commitMaker
 		}
 		shareMsgs[i] = msg
 	}
+	s.node.recorder.RecordOutbound("ss", map[string]string{"shares": fmt.Sprint(len(shares)), "threshold": fmt.Sprint(threshold)})
 	if err := s.node.unicastSelf(shareMsgs[0]); err != nil {
 		return fmt.Errorf("unable to unicast self: %v", err)
 	}
 	for _, tuple := range lo.Zip2(peers, shareMsgs[1:]) {
 		peer, msg := tuple.Unpack()
 		if err := s.node.unicast(msg, peer.conn); err != nil {
-			nodeLogger.Warn("error sending ss to connection", "peer name", peer.name, "error", err)
+			s.logger.Warn("error sending ss to connection", "peer name", peer.name, "error", err)
 		}
 	}
 	return nil
@@ -86,7 +87,7 @@ func (s *SSChannel) wrapMsg(share ss.Share, commitment []byte) ([]byte, error) {
 
 func (s *SSChannel) bebDeliver(msg []byte, sender *ecdsa.PublicKey) {
 	if msg[0] == s.listenCode {
-		nodeLogger.Debug("bebDeliver in ss channel", "msg", msg, "sender", sender)
+		s.logger.Debug("bebDeliver in ss channel", "msg", msg, "sender", sender)
 		msg = msg[1:]
 		id := group.Ristretto255.NewScalar()
 		val := group.Ristretto255.NewScalar()
@@ -108,6 +109,11 @@ func (s *SSChannel) bebDeliver(msg []byte, sender *ecdsa.PublicKey) {
 	}
 }
 
+// Logger returns the logger of the node this channel runs on.
+func (s *SSChannel) Logger() *slog.Logger {
+	return s.node.rootLogger
+}
+
 func (s *SSChannel) GetSSChan() <-chan *SSMsg {
 	return s.deliverChan
 }
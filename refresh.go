@@ -0,0 +1,271 @@
+package main
+
+import (
+	acs "bkr-acs/agreementCommonSubset"
+	aba "bkr-acs/asynchronousBinaryAgreement"
+	brb "bkr-acs/byzantineReliableBroadcast"
+	ct "bkr-acs/coinTosser"
+	on "bkr-acs/overlayNetwork"
+	"bkr-acs/utils"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/magiconair/properties"
+	"github.com/samber/lo"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+const refreshInstanceName = "coin-refresh"
+
+// refreshRetain is the number of epochs, up to the current one, whose agreements are kept for the nodes that fall behind.
+const refreshRetain = ct.RefreshLookahead + 1
+
+// refreshChannels are the channels on which the nodes refresh the shares of the coin. They agree on the dealers of each
+// refresh with a BKR channel of their own, whose ABA instances toss a coin tosser of their own, so that the low watermark
+// of the client instances never collects the agreements of the refreshes and their outputs never reach the clients.
+type refreshChannels struct {
+	deal *on.BEBChannel
+	ct   *on.BEBChannel
+	aba  *on.BEBChannel
+	t    *on.BEBChannel
+	bkr  *on.BEBChannel
+}
+
+// newRefreshChannels creates the channels of the refreshes, which must exist before the node joins the network.
+func newRefreshChannels(props *properties.Properties, node *on.Node) *refreshChannels {
+	code := func(key string) byte { return props.MustGetString(key)[0] }
+	return &refreshChannels{
+		deal: on.NewBEBChannel(node, code("refresh_code")),
+		ct:   on.NewBEBChannel(node, code("refresh_ct_code")),
+		aba:  on.NewBEBChannel(node, code("refresh_aba_code")),
+		t:    on.NewBEBChannel(node, code("refresh_t_code")),
+		bkr:  on.NewBEBChannel(node, code("refresh_bkr_code")),
+	}
+}
+
+// coinRefresher refreshes the shares of the threshold coin to one epoch after the other.
+type coinRefresher struct {
+	channel *ct.CTChannel
+	bkr     *acs.BKRChannel
+	self    uuid.UUID
+	n, f    uint
+	outputs map[uint64]chan [][]byte
+	agreed  map[uint64]map[uuid.UUID][]byte
+}
+
+// startRefresh refreshes the shares of the threshold coin every interval, and overwrites the share file with each refreshed share.
+// It needs the share file of an offline deal and the membership file, whose indices tell the dealers where to send their deals.
+func startRefresh(coin ct.Coin, channels *refreshChannels, node *on.Node, participants []uuid.UUID, n, f uint, deal []byte, sharePathname string, shareIndices map[uuid.UUID]uint64, interval time.Duration) error {
+	channel, ok := coin.(*ct.CTChannel)
+	if !ok || deal == nil || sharePathname == "" || shareIndices == nil {
+		return fmt.Errorf("refreshing the coin requires the cks coin with a share file and a membership file")
+	}
+	self, err := node.GetId()
+	if err != nil {
+		return fmt.Errorf("unable to get own id: %v", err)
+	}
+	agreementCoin, err := ct.NewCoinTosserChannelFromDeal(deal, channels.ct, 2*f, node.Logger())
+	if err != nil {
+		return fmt.Errorf("unable to create coin of the refresh agreements: %v", err)
+	} else if err := agreementCoin.RegisterShareIndices(shareIndices); err != nil {
+		return fmt.Errorf("unable to register share indices: %v", err)
+	}
+	abaChannel, err := aba.NewAbaChannelWithCoin(n, f, agreementCoin, aba.MMR(), channels.aba, channels.t, node.Logger())
+	if err != nil {
+		return fmt.Errorf("unable to create aba channel of the refresh agreements: %v", err)
+	}
+	bkr := acs.NewBKRChannel(f, abaChannel, brb.NewBRBChannel(n, f, channels.bkr, node.Logger()), participants, node.Logger())
+	bkr.SetAdmissionPolicy(utils.AdmissionPolicy{Window: refreshRetain + ct.RefreshLookahead})
+	r := &coinRefresher{
+		channel: channel,
+		bkr:     bkr,
+		self:    self,
+		n:       n,
+		f:       f,
+		outputs: make(map[uint64]chan [][]byte),
+		agreed:  make(map[uint64]map[uuid.UUID][]byte),
+	}
+	bkr.SetValidator(r.validate)
+	channel.EnableRefresh(channels.deal, f, func(deal []byte) error {
+		if err := replaceShareFile(sharePathname, deal); err != nil {
+			return err
+		}
+		return agreementCoin.InstallRefreshedDeal(deal)
+	})
+	go r.loop(interval)
+	logger.Info("refreshing coin shares", "interval", interval, "epoch", channel.Epoch())
+	return nil
+}
+
+// loop refreshes the shares to the next epoch every interval, or as soon as f+1 dealers started to, so that a node that
+// fell behind catches up with the others. A refresh that fails is retried at the next interval from the step that failed.
+func (r *coinRefresher) loop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	failed := false
+	for {
+		epoch := r.channel.Epoch() + 1
+		if failed {
+			<-ticker.C
+		} else {
+			select {
+			case <-ticker.C:
+			case <-r.channel.RefreshStarted(epoch):
+			}
+		}
+		if err := r.refreshEpoch(epoch); err != nil {
+			logger.Error("unable to refresh coin shares, retrying at the next interval", "epoch", epoch, "error", err)
+			failed = true
+			continue
+		}
+		failed = false
+		logger.Info("refreshed coin shares", "epoch", epoch)
+		if epoch >= refreshRetain {
+			r.bkr.SetLowWatermark(epoch + 1 - refreshRetain)
+		}
+	}
+}
+
+// refreshEpoch deals a sharing of zero for the epoch, proposes the dealers whose sharings completed at this node to the
+// BKR instance of the epoch, and applies the sharings of all the dealers of the accepted proposals.
+func (r *coinRefresher) refreshEpoch(epoch uint64) error {
+	dealers, ok := r.agreed[epoch]
+	if !ok {
+		if _, err := r.channel.ContributeRefresh(epoch); err != nil {
+			return fmt.Errorf("unable to contribute: %v", err)
+		}
+		output, err := r.propose(epoch)
+		if err != nil {
+			return fmt.Errorf("unable to propose dealers: %v", err)
+		}
+		dealers = refreshDealers(<-output)
+		r.agreed[epoch] = dealers
+		delete(r.outputs, epoch)
+	}
+	if err := <-r.channel.ApplyRefresh(epoch, dealers); err != nil {
+		return fmt.Errorf("unable to apply refresh: %v", err)
+	}
+	delete(r.agreed, epoch)
+	return nil
+}
+
+func (r *coinRefresher) propose(epoch uint64) (chan [][]byte, error) {
+	if output, ok := r.outputs[epoch]; ok {
+		return output, nil
+	}
+	completed := <-r.channel.CompletedDealers(epoch, int(r.n-r.f))
+	if completed == nil {
+		return nil, fmt.Errorf("the shares already reached epoch %d", epoch)
+	}
+	output, err := r.bkr.Propose(refreshInstanceId(epoch), marshalRefreshProposal(r.self, completed))
+	if err != nil {
+		return nil, err
+	}
+	r.outputs[epoch] = output
+	return output, nil
+}
+
+// validate accepts the proposals of the dealers of an epoch that name their proposer, as sent by their broadcast, and at
+// least n-f dealers, once the sharings of all of them completed at this node.
+func (r *coinRefresher) validate(id, proposer uuid.UUID, proposal []byte) <-chan bool {
+	epoch := utils.InstanceSequence(id)
+	owner, dealers, err := unmarshalRefreshProposal(proposal)
+	if err != nil || owner != proposer || uint(len(dealers)) < r.n-r.f || id != refreshInstanceId(epoch) {
+		invalid := make(chan bool, 1)
+		invalid <- false
+		return invalid
+	}
+	return r.channel.AwaitCompletion(epoch, dealers)
+}
+
+func refreshInstanceId(epoch uint64) uuid.UUID {
+	return utils.NewInstanceId(epoch, []byte(refreshInstanceName))
+}
+
+// marshalRefreshProposal writes the id of the proposer followed by each dealer and the digest of its commitments.
+func marshalRefreshProposal(proposer uuid.UUID, dealers map[uuid.UUID][]byte) []byte {
+	proposal := slices.Clone(proposer[:])
+	for dealer, digest := range dealers {
+		proposal = append(append(proposal, dealer[:]...), digest...)
+	}
+	return proposal
+}
+
+func unmarshalRefreshProposal(proposal []byte) (uuid.UUID, map[uuid.UUID][]byte, error) {
+	idSize, itemSize := len(uuid.UUID{}), len(uuid.UUID{})+sha256.Size
+	if len(proposal) < idSize || (len(proposal)-idSize)%itemSize != 0 {
+		return uuid.Nil, nil, fmt.Errorf("proposal of %d bytes is not a list of dealers", len(proposal))
+	}
+	dealers := make(map[uuid.UUID][]byte)
+	for _, item := range lo.Chunk(proposal[idSize:], itemSize) {
+		dealer := uuid.UUID(item[:idSize])
+		if _, ok := dealers[dealer]; ok {
+			return uuid.Nil, nil, fmt.Errorf("proposal names dealer %s twice", dealer)
+		}
+		dealers[dealer] = item[idSize:]
+	}
+	return uuid.UUID(proposal[:idSize]), dealers, nil
+}
+
+// refreshDealers reads the dealers of the accepted proposals, each of which names dealers whose sharings completed at a
+// correct node. Two sharings of the same dealer cannot both complete, so a dealer named with two digests is left out.
+func refreshDealers(proposals [][]byte) map[uuid.UUID][]byte {
+	dealers := make(map[uuid.UUID][]byte)
+	conflicting := make(map[uuid.UUID]bool)
+	for _, proposal := range proposals {
+		_, named, err := unmarshalRefreshProposal(proposal)
+		if err != nil {
+			continue
+		}
+		for dealer, digest := range named {
+			if previous, ok := dealers[dealer]; ok && !bytes.Equal(previous, digest) {
+				conflicting[dealer] = true
+			}
+			dealers[dealer] = digest
+		}
+	}
+	for dealer := range conflicting {
+		delete(dealers, dealer)
+	}
+	return dealers
+}
+
+// replaceShareFile writes the refreshed share next to the share file, overwrites the share file with zeros, and then
+// moves the refreshed share in its place, so that the file keeps a share through a crash and the old share is erased.
+func replaceShareFile(pathname string, deal []byte) error {
+	tmp := filepath.Join(filepath.Dir(pathname), "."+filepath.Base(pathname)+".refresh")
+	if err := writeSynced(tmp, deal, os.O_WRONLY|os.O_CREATE|os.O_TRUNC); err != nil {
+		return fmt.Errorf("unable to write refreshed share: %v", err)
+	}
+	info, err := os.Stat(pathname)
+	if err != nil {
+		return fmt.Errorf("unable to stat share file: %v", err)
+	}
+	if err := writeSynced(pathname, make([]byte, info.Size()), os.O_WRONLY); err != nil {
+		return fmt.Errorf("unable to erase share file: %v", err)
+	}
+	if err := os.Rename(tmp, pathname); err != nil {
+		return fmt.Errorf("unable to replace share file: %v", err)
+	}
+	return nil
+}
+
+// writeSynced writes data at the start of the file opened with flags, and flushes it to the disk.
+func writeSynced(pathname string, data []byte, flags int) error {
+	file, err := os.OpenFile(pathname, flags, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		_ = file.Close()
+		return err
+	} else if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	ct "bkr-acs/coinTosser"
+	"bkr-acs/utils"
+	"bytes"
+	"crypto/sha256"
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRefreshDealersShouldJoinProposalsAndLeaveOutConflictingDigests(t *testing.T) {
+	first, second, conflicting := uuid.New(), uuid.New(), uuid.New()
+	digest, forged := bytes.Repeat([]byte{1}, sha256.Size), bytes.Repeat([]byte{2}, sha256.Size)
+	proposals := [][]byte{
+		marshalRefreshProposal(uuid.New(), map[uuid.UUID][]byte{first: digest, conflicting: digest}),
+		marshalRefreshProposal(uuid.New(), map[uuid.UUID][]byte{first: digest, second: digest, conflicting: forged}),
+		[]byte("short"),
+	}
+	assert.Equal(t, map[uuid.UUID][]byte{first: digest, second: digest}, refreshDealers(proposals))
+}
+
+func TestRefreshProposalShouldNameProposerAndDealers(t *testing.T) {
+	proposer, dealer := uuid.New(), uuid.New()
+	digest := bytes.Repeat([]byte{1}, sha256.Size)
+	owner, dealers, err := unmarshalRefreshProposal(marshalRefreshProposal(proposer, map[uuid.UUID][]byte{dealer: digest}))
+	assert.NoError(t, err)
+	assert.Equal(t, proposer, owner)
+	assert.Equal(t, map[uuid.UUID][]byte{dealer: digest}, dealers)
+	repeated := append(marshalRefreshProposal(proposer, map[uuid.UUID][]byte{dealer: digest}), append(dealer[:], digest...)...)
+	_, _, err = unmarshalRefreshProposal(repeated)
+	assert.Error(t, err)
+	_, _, err = unmarshalRefreshProposal(append(proposer[:], []byte("digest")...))
+	assert.Error(t, err)
+}
+
+func TestRefresherShouldRejectInvalidProposalsBeforeAwaitingDealers(t *testing.T) {
+	r := &coinRefresher{n: 4, f: 1}
+	proposer := uuid.New()
+	dealers := make(map[uuid.UUID][]byte)
+	for range 3 {
+		dealers[uuid.New()] = bytes.Repeat([]byte{1}, sha256.Size)
+	}
+	proposal := marshalRefreshProposal(proposer, dealers)
+	assert.False(t, <-r.validate(refreshInstanceId(1), uuid.New(), proposal))
+	assert.False(t, <-r.validate(utils.NewInstanceId(1, []byte("client")), proposer, proposal))
+	delete(dealers, lo.Keys(dealers)[0])
+	assert.False(t, <-r.validate(refreshInstanceId(1), proposer, marshalRefreshProposal(proposer, dealers)))
+	assert.False(t, <-r.validate(refreshInstanceId(1), proposer, []byte("short")))
+}
+
+func TestReplaceShareFileShouldKeepOnlyRefreshedShare(t *testing.T) {
+	deals, err := ct.DealOffline(ct.NewScalar(42), 1, 3)
+	assert.NoError(t, err)
+	dir := t.TempDir()
+	pathname := filepath.Join(dir, "share1.bin")
+	assert.NoError(t, os.WriteFile(pathname, deals[0], 0o600))
+	assert.NoError(t, replaceShareFile(pathname, deals[1]))
+	stored, err := os.ReadFile(pathname)
+	assert.NoError(t, err)
+	assert.Equal(t, deals[1], stored)
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestRunShouldRefuseTranscriptWithRefresh(t *testing.T) {
+	dir := t.TempDir()
+	config := filepath.Join(dir, "config.properties")
+	assert.NoError(t, os.WriteFile(config, []byte("contact=localhost:6000\ncoin_refresh_interval=1m\n"), 0o600))
+	err := runCommand([]string{"-config", config, "-transcript", filepath.Join(dir, "transcript.jsonl")})
+	assert.ErrorContains(t, err, "coin_refresh_interval")
+	_, err = os.Stat(filepath.Join(dir, "transcript.jsonl"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	acs "bkr-acs/agreementCommonSubset"
+	on "bkr-acs/overlayNetwork"
+	"bkr-acs/transcript"
+	"bkr-acs/utils"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+	"log/slog"
+	"maps"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// replayTranscript feeds the inbound frames of a recorded transcript through a fresh, offline copy of the node's stack.
+// The frames are injected one at a time in the recorded order, and the copy runs with the key of the recorded node.
+// The replay succeeds if the stack reproduces every decision found in the transcript.
+func replayTranscript(pathname, keyPathname string, format transcript.Format, timeout time.Duration, rootLogger *slog.Logger) error {
+	file, err := os.Open(pathname)
+	if err != nil {
+		return fmt.Errorf("unable to open transcript: %v", err)
+	}
+	defer file.Close()
+	entries, err := transcript.ReadAll(file, format)
+	if err != nil {
+		return fmt.Errorf("unable to read transcript: %v", err)
+	}
+	meta, ok := lo.Find(entries, func(e transcript.Entry) bool { return e.Kind == transcript.Meta })
+	if !ok {
+		return fmt.Errorf("transcript has no meta entry")
+	}
+	logger.Info("replaying transcript", "pathname", pathname, "entries", len(entries), "id", meta.Fields["id"])
+	if keyPathname == "" {
+		return fmt.Errorf("replay requires the key of the recorded node")
+	}
+	sk, err := loadPrivateKey(keyPathname)
+	if err != nil {
+		return fmt.Errorf("unable to load key: %v", err)
+	}
+	if id, err := utils.PkToUUID(&sk.PublicKey); err != nil {
+		return fmt.Errorf("unable to extract id from key: %v", err)
+	} else if id.String() != meta.Fields["id"] {
+		return fmt.Errorf("key belongs to node %s but the transcript was recorded by node %s", id, meta.Fields["id"])
+	}
+	node, err := on.NewOfflineNodeWithKey(sk, rootLogger)
+	if err != nil {
+		return fmt.Errorf("unable to create offline node: %v", err)
+	}
+	recorder := transcript.NewMemoryRecorder()
+	node.SetTranscript(recorder)
+	bkrChannel, err := computeReplayStack(meta.Fields, node)
+	if err != nil {
+		return fmt.Errorf("unable to rebuild stack: %v", err)
+	}
+	defer bkrChannel.Close()
+	for i, entry := range entries {
+		if entry.Kind != transcript.Inbound || entry.Layer != "net" {
+			continue
+		}
+		senderKey, err := x509.ParsePKIXPublicKey(entry.SenderKey)
+		if err != nil {
+			return fmt.Errorf("unable to parse sender key of %d-th entry: %v", i, err)
+		}
+		pk, ok := senderKey.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("sender key of %d-th entry is not an ecdsa key", i)
+		}
+		node.Inject(entry.Raw, pk)
+	}
+	expected := decisionsOf(entries)
+	return awaitDecisions(expected, recorder, timeout)
+}
+
+func computeReplayStack(fields map[string]string, node *on.Node) (*acs.BKRChannel, error) {
+	numNodes, err := strconv.ParseUint(fields["num_nodes"], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse num_nodes: %v", err)
+	}
+	faulty, err := strconv.ParseUint(fields["faulty"], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse faulty: %v", err)
+	}
+	participants, err := parseParticipants(fields["participants"])
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse participants: %v", err)
+	}
+	codes := lo.Map([]string{"deal_code", "ct_code", "aba_code", "t_code", "bkr_code"}, func(key string, _ int) byte {
+		return fields[key][0]
+	})
+	dealSS := on.NewSSChannel(node, codes[0])
+	ctBeb := on.NewBEBChannel(node, codes[1])
+	abaBeb := on.NewBEBChannel(node, codes[2])
+	tBeb := on.NewBEBChannel(node, codes[3])
+	bkrBeb := on.NewBEBChannel(node, codes[4])
+	bkrBrb, err := newBrbChannel(fields["brb_algorithm"], uint(numNodes), uint(faulty), bkrBeb, node.Logger())
+	if err != nil {
+		return nil, fmt.Errorf("unable to create brb channel: %v", err)
+	}
+	var deal []byte
+	if dealHex, ok := fields["deal"]; ok {
+		if deal, err = hex.DecodeString(dealHex); err != nil {
+			return nil, fmt.Errorf("unable to decode deal: %v", err)
+		}
+	}
+	options := abaOptions{algorithm: fields["aba_algorithm"], coin: fields["coin"], beaconKey: fields["coin_beacon_key"]}
+	abaChannel, _, err := computeAbaChannel(uint(numNodes), uint(faulty), options, dealSS, ctBeb, abaBeb, tBeb, false, deal, node.Logger())
+	if err != nil {
+		return nil, fmt.Errorf("unable to create aba channel: %v", err)
+	}
+	if fastPath, _ := strconv.ParseBool(fields["aba_fast_path"]); fastPath {
+		abaChannel.EnableFastPath()
+	}
+	return acs.NewBKRChannel(uint(faulty), abaChannel, bkrBrb, participants, node.Logger()), nil
+}
+
+func parseParticipants(joined string) ([]uuid.UUID, error) {
+	participants := make([]uuid.UUID, 0)
+	for _, idStr := range strings.Split(joined, ",") {
+		id, err := uuid.Parse(idStr)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse participant id %s: %v", idStr, err)
+		}
+		participants = append(participants, id)
+	}
+	return participants, nil
+}
+
+func decisionsOf(entries []transcript.Entry) map[string]map[string]string {
+	decisions := make(map[string]map[string]string)
+	for _, entry := range entries {
+		if entry.Kind == transcript.Decision {
+			decisions[entry.Layer+"/"+entry.Fields["instance"]] = entry.Fields
+		}
+	}
+	return decisions
+}
+
+func awaitDecisions(expected map[string]map[string]string, recorder *transcript.Recorder, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	var obtained map[string]map[string]string
+	for {
+		obtained = decisionsOf(recorder.Entries())
+		if len(obtained) >= len(expected) || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	mismatches := 0
+	for key, fields := range expected {
+		if replayed, ok := obtained[key]; !ok {
+			logger.Warn("decision was not reproduced", "decision", key)
+			mismatches++
+		} else if !maps.Equal(fields, replayed) {
+			logger.Warn("decision differs from the recorded one", "decision", key, "recorded", fields, "replayed", replayed)
+			mismatches++
+		}
+	}
+	logger.Info("replay finished", "recorded", len(expected), "replayed", len(obtained), "mismatches", mismatches)
+	if mismatches > 0 {
+		return fmt.Errorf("%d of %d recorded decisions were not reproduced", mismatches, len(expected))
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	acs "bkr-acs/agreementCommonSubset"
+	on "bkr-acs/overlayNetwork"
+	"bkr-acs/transcript"
+	"bkr-acs/utils"
+	"fmt"
+	"github.com/magiconair/properties"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReplayShouldReproduceRecordedDecisions(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, keygenCommand([]string{"-n", "4", "-out", dir, "-port", "6400", "-admin_port", "0", "-daemon_port", "0"}))
+	m, err := loadMembership(filepath.Join(dir, "membership.json"))
+	assert.NoError(t, err)
+	props, err := properties.LoadFile("config/config.properties", properties.UTF8)
+	assert.NoError(t, err)
+	props.MustSet("contact", m.Contact)
+	nodes := make([]*on.Node, len(m.Members))
+	recorders := make([]*transcript.Recorder, len(m.Members))
+	channels := make([]*acs.BKRChannel, len(m.Members))
+	for i, mem := range m.Members {
+		sk, err := loadPrivateKey(filepath.Join(dir, mem.Key))
+		assert.NoError(t, err)
+		nodes[i], err = on.NewNodeWithKey(mem.Address, m.Contact, sk, utils.DefaultLogger())
+		assert.NoError(t, err)
+		recorders[i], err = openTranscript(filepath.Join(dir, fmt.Sprintf("transcript%d.jsonl", mem.Index)), transcript.JSONL)
+		assert.NoError(t, err)
+		nodes[i].SetTranscript(recorders[i])
+	}
+	wg := sync.WaitGroup{}
+	for i, mem := range m.Members {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var err error
+			channels[i], err = computeBkrChannel(props, nodes[i], mem.Address == m.Contact, nil, "", nil, nil)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	id := utils.NewInstanceId(1, []byte("replay"))
+	outputs := make([]chan [][]byte, len(channels))
+	for i, channel := range channels {
+		outputs[i], err = channel.Propose(id, []byte(fmt.Sprintf("proposal %d", i)))
+		assert.NoError(t, err)
+	}
+	for _, output := range outputs {
+		assert.GreaterOrEqual(t, len(<-output), 3)
+	}
+	for i := range channels {
+		channels[i].Close()
+		assert.NoError(t, nodes[i].Close())
+		assert.NoError(t, recorders[i].Close())
+	}
+	pathname := filepath.Join(dir, "transcript1.jsonl")
+	keyPathname := filepath.Join(dir, m.Members[0].Key)
+	assert.NoError(t, replayTranscript(pathname, keyPathname, transcript.JSONL, 10*time.Second, utils.DefaultLogger()))
+	otherKey := filepath.Join(dir, m.Members[1].Key)
+	assert.Error(t, replayTranscript(pathname, otherKey, transcript.JSONL, time.Second, utils.DefaultLogger()))
+}
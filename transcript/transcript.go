@@ -0,0 +1,190 @@
+package transcript
+
+import (
+	"bkr-acs/utils"
+	"bufio"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+var transcriptLogger = utils.GetLogger("Transcript", slog.LevelWarn)
+
+type Kind string
+
+const (
+	Meta     Kind = "meta"
+	Inbound  Kind = "inbound"
+	Outbound Kind = "outbound"
+	Decision Kind = "decision"
+)
+
+type Format string
+
+const (
+	JSONL  Format = "jsonl"
+	Binary Format = "binary"
+)
+
+// Entry is a single line of the transcript.
+// Frames recorded at the network layer carry the raw bytes and the sender's serialized key, which is what replay feeds back into the stack.
+// Frames recorded by the protocol middlewares carry the decoded fields instead.
+type Entry struct {
+	Time      time.Time         `json:"time"`
+	Kind      Kind              `json:"kind"`
+	Layer     string            `json:"layer"`
+	Code      byte              `json:"code,omitempty"`
+	Sender    uuid.UUID         `json:"sender,omitempty"`
+	SenderKey []byte            `json:"senderKey,omitempty"`
+	Raw       []byte            `json:"raw,omitempty"`
+	Fields    map[string]string `json:"fields,omitempty"`
+}
+
+type sink interface {
+	write(entry Entry) error
+	flush() error
+}
+
+// Recorder writes entries to a transcript.
+// A nil *Recorder is valid and discards everything, so components can record unconditionally.
+type Recorder struct {
+	lock    sync.Mutex
+	sink    sink
+	entries []Entry
+	closer  io.Closer
+}
+
+func NewRecorder(w io.Writer, format Format) (*Recorder, error) {
+	buffered := bufio.NewWriter(w)
+	r := &Recorder{}
+	switch format {
+	case JSONL:
+		r.sink = &jsonSink{writer: buffered, encoder: json.NewEncoder(buffered)}
+	case Binary:
+		r.sink = &binarySink{writer: buffered, encoder: gob.NewEncoder(buffered)}
+	default:
+		return nil, fmt.Errorf("unknown transcript format %s", format)
+	}
+	if closer, ok := w.(io.Closer); ok {
+		r.closer = closer
+	}
+	transcriptLogger.Info("new transcript recorder", "format", format)
+	return r, nil
+}
+
+// NewMemoryRecorder keeps the entries in memory instead of writing them out.
+func NewMemoryRecorder() *Recorder {
+	return &Recorder{entries: make([]Entry, 0)}
+}
+
+func (r *Recorder) Record(entry Entry) {
+	if r == nil {
+		return
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.sink == nil {
+		r.entries = append(r.entries, entry)
+	} else if err := r.sink.write(entry); err != nil {
+		transcriptLogger.Warn("unable to record transcript entry", "kind", entry.Kind, "layer", entry.Layer, "error", err)
+	} else if err := r.sink.flush(); err != nil {
+		transcriptLogger.Warn("unable to flush transcript entry", "kind", entry.Kind, "layer", entry.Layer, "error", err)
+	}
+}
+
+func (r *Recorder) RecordInbound(layer string, sender uuid.UUID, fields map[string]string) {
+	r.Record(Entry{Kind: Inbound, Layer: layer, Sender: sender, Fields: fields})
+}
+
+func (r *Recorder) RecordOutbound(layer string, fields map[string]string) {
+	r.Record(Entry{Kind: Outbound, Layer: layer, Fields: fields})
+}
+
+func (r *Recorder) RecordDecision(layer string, fields map[string]string) {
+	r.Record(Entry{Kind: Decision, Layer: layer, Fields: fields})
+}
+
+func (r *Recorder) IsEnabled() bool {
+	return r != nil
+}
+
+// Entries returns a copy of the entries held by a memory recorder.
+func (r *Recorder) Entries() []Entry {
+	if r == nil {
+		return nil
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]Entry{}, r.entries...)
+}
+
+func (r *Recorder) Close() error {
+	if r == nil || r.sink == nil {
+		return nil
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if err := r.sink.flush(); err != nil {
+		return fmt.Errorf("unable to flush transcript: %v", err)
+	} else if r.closer != nil {
+		return r.closer.Close()
+	}
+	return nil
+}
+
+type jsonSink struct {
+	writer  *bufio.Writer
+	encoder *json.Encoder
+}
+
+func (s *jsonSink) write(entry Entry) error {
+	return s.encoder.Encode(entry)
+}
+
+func (s *jsonSink) flush() error {
+	return s.writer.Flush()
+}
+
+type binarySink struct {
+	writer  *bufio.Writer
+	encoder *gob.Encoder
+}
+
+func (s *binarySink) write(entry Entry) error {
+	return s.encoder.Encode(entry)
+}
+
+func (s *binarySink) flush() error {
+	return s.writer.Flush()
+}
+
+// ReadAll parses a whole transcript previously written with the given format.
+func ReadAll(r io.Reader, format Format) ([]Entry, error) {
+	entries := make([]Entry, 0)
+	var decode func(any) error
+	switch format {
+	case JSONL:
+		decode = json.NewDecoder(bufio.NewReader(r)).Decode
+	case Binary:
+		decode = gob.NewDecoder(bufio.NewReader(r)).Decode
+	default:
+		return nil, fmt.Errorf("unknown transcript format %s", format)
+	}
+	for {
+		var entry Entry
+		if err := decode(&entry); err == io.EOF {
+			return entries, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("unable to decode %d-th transcript entry: %v", len(entries), err)
+		}
+		entries = append(entries, entry)
+	}
+}
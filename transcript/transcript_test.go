@@ -0,0 +1,56 @@
+package transcript
+
+import (
+	"bytes"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestShouldReadWhatWasRecordedJSONL(t *testing.T) {
+	testShouldReadWhatWasRecorded(t, JSONL)
+}
+
+func TestShouldReadWhatWasRecordedBinary(t *testing.T) {
+	testShouldReadWhatWasRecorded(t, Binary)
+}
+
+func testShouldReadWhatWasRecorded(t *testing.T, format Format) {
+	buf := bytes.NewBuffer([]byte{})
+	recorder, err := NewRecorder(buf, format)
+	assert.NoError(t, err)
+	sender := uuid.New()
+	recorder.Record(Entry{Kind: Inbound, Layer: "net", Code: 'B', Sender: sender, SenderKey: []byte("key"), Raw: []byte("raw")})
+	recorder.RecordInbound("aba", sender, map[string]string{"round": "1", "val": "0"})
+	recorder.RecordOutbound("term", map[string]string{"decision": "0"})
+	recorder.RecordDecision("aba", map[string]string{"decision": "0"})
+	assert.NoError(t, recorder.Close())
+	entries, err := ReadAll(buf, format)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, len(entries))
+	assert.Equal(t, Inbound, entries[0].Kind)
+	assert.Equal(t, byte('B'), entries[0].Code)
+	assert.Equal(t, sender, entries[0].Sender)
+	assert.Equal(t, []byte("raw"), entries[0].Raw)
+	assert.Equal(t, "1", entries[1].Fields["round"])
+	assert.Equal(t, Outbound, entries[2].Kind)
+	assert.Equal(t, Decision, entries[3].Kind)
+	assert.Equal(t, "0", entries[3].Fields["decision"])
+}
+
+func TestNilRecorderShouldDiscardEntries(t *testing.T) {
+	var recorder *Recorder
+	assert.False(t, recorder.IsEnabled())
+	recorder.RecordDecision("aba", map[string]string{"decision": "1"})
+	assert.Nil(t, recorder.Entries())
+	assert.NoError(t, recorder.Close())
+}
+
+func TestMemoryRecorderShouldKeepEntries(t *testing.T) {
+	recorder := NewMemoryRecorder()
+	recorder.RecordDecision("ct", map[string]string{"coin": "true"})
+	entries := recorder.Entries()
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, "ct", entries[0].Layer)
+	assert.False(t, entries[0].Time.IsZero())
+}
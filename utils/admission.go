@@ -0,0 +1,93 @@
+package utils
+
+import (
+	. "github.com/google/uuid"
+)
+
+// AdmissionPolicy bounds the instances a channel creates on behalf of its peers.
+// Window is the number of sequences above the low watermark whose instances are accepted, and PeerQuota the number of
+// instances each peer may name before this node knows them locally. Zero disables the corresponding limit.
+type AdmissionPolicy struct {
+	Window    uint64 `json:"window"`
+	PeerQuota uint   `json:"peerQuota"`
+}
+
+// AdmissionState reports the policy of a channel, the unknown instances charged to each peer and how many were rejected.
+type AdmissionState struct {
+	Policy           AdmissionPolicy `json:"policy"`
+	Pending          map[UUID]uint   `json:"pending"`
+	RejectedByWindow uint64          `json:"rejectedByWindow"`
+	RejectedByQuota  uint64          `json:"rejectedByQuota"`
+}
+
+// Admission applies an AdmissionPolicy to the instances of a channel.
+// It is not safe for concurrent use and is meant to be called from the invoker of the channel.
+type Admission struct {
+	policy           AdmissionPolicy
+	pending          map[UUID]UUID
+	perPeer          map[UUID]uint
+	rejectedByWindow uint64
+	rejectedByQuota  uint64
+}
+
+func NewAdmission() *Admission {
+	return &Admission{
+		pending: make(map[UUID]UUID),
+		perPeer: make(map[UUID]uint),
+	}
+}
+
+func (a *Admission) SetPolicy(policy AdmissionPolicy) {
+	a.policy = policy
+}
+
+// Admit decides whether peer may create the instance id, which this node does not know locally.
+// An admitted instance is charged to peer until it is released or collected.
+func (a *Admission) Admit(id, peer UUID, watermark uint64) bool {
+	if _, ok := a.pending[id]; ok {
+		return true
+	} else if a.policy.Window > 0 && InstanceSequence(id)-watermark >= a.policy.Window {
+		a.rejectedByWindow++
+		return false
+	} else if a.policy.PeerQuota > 0 && a.perPeer[peer] >= a.policy.PeerQuota {
+		a.rejectedByQuota++
+		return false
+	}
+	a.pending[id] = peer
+	a.perPeer[peer]++
+	return true
+}
+
+// Release stops charging the instance to the peer that named it, because this node now knows it or has finished it.
+func (a *Admission) Release(id UUID) {
+	peer, ok := a.pending[id]
+	if !ok {
+		return
+	}
+	delete(a.pending, id)
+	if a.perPeer[peer]--; a.perPeer[peer] == 0 {
+		delete(a.perPeer, peer)
+	}
+}
+
+// Collect releases the instances with a sequence below watermark.
+func (a *Admission) Collect(watermark uint64) {
+	for id := range a.pending {
+		if InstanceSequence(id) < watermark {
+			a.Release(id)
+		}
+	}
+}
+
+func (a *Admission) State() AdmissionState {
+	pending := make(map[UUID]uint, len(a.perPeer))
+	for peer, count := range a.perPeer {
+		pending[peer] = count
+	}
+	return AdmissionState{
+		Policy:           a.policy,
+		Pending:          pending,
+		RejectedByWindow: a.rejectedByWindow,
+		RejectedByQuota:  a.rejectedByQuota,
+	}
+}
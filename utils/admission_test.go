@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestAdmissionShouldRejectInstancesOutsideWindow(t *testing.T) {
+	a := NewAdmission()
+	a.SetPolicy(AdmissionPolicy{Window: 10})
+	peer := uuid.New()
+	assert.True(t, a.Admit(NewInstanceId(14, nil), peer, 5))
+	assert.False(t, a.Admit(NewInstanceId(15, nil), peer, 5))
+	assert.Equal(t, uint64(1), a.State().RejectedByWindow)
+}
+
+func TestAdmissionShouldEnforcePeerQuota(t *testing.T) {
+	a := NewAdmission()
+	a.SetPolicy(AdmissionPolicy{PeerQuota: 2})
+	peer, other := uuid.New(), uuid.New()
+	first, second, third := NewInstanceId(1, []byte{1}), NewInstanceId(1, []byte{2}), NewInstanceId(2, []byte{3})
+	assert.True(t, a.Admit(first, peer, 0))
+	assert.True(t, a.Admit(second, peer, 0))
+	assert.True(t, a.Admit(first, peer, 0))
+	assert.False(t, a.Admit(third, peer, 0))
+	assert.True(t, a.Admit(third, other, 0))
+	assert.Equal(t, uint64(1), a.State().RejectedByQuota)
+	a.Release(first)
+	assert.True(t, a.Admit(NewInstanceId(3, nil), peer, 0))
+	a.Collect(3)
+	assert.Equal(t, map[uuid.UUID]uint{peer: 1}, a.State().Pending)
+}
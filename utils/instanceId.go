@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	. "github.com/google/uuid"
+)
+
+const sequenceSize = 8
+
+// NewInstanceId computes the id of an instance with the given sequence number.
+// The first 8 bytes of the id hold the sequence, so that the channels can collect the state of old instances,
+// and the remaining ones a hash of the name, which tells apart instances with the same sequence.
+func NewInstanceId(seq uint64, name []byte) UUID {
+	hashVal := sha256.Sum256(name)
+	var id UUID
+	binary.BigEndian.PutUint64(id[:sequenceSize], seq)
+	copy(id[sequenceSize:], hashVal[:])
+	return id
+}
+
+// DeriveInstanceId computes the id of an instance running on behalf of parent, such as the ABA instances of a BKR instance.
+// The derived id has the same sequence as its parent.
+func DeriveInstanceId(parent UUID, data []byte) UUID {
+	return NewInstanceId(InstanceSequence(parent), append(parent[:], data...))
+}
+
+// InstanceSequence returns the sequence number carried by an instance id.
+func InstanceSequence(id UUID) uint64 {
+	return binary.BigEndian.Uint64(id[:sequenceSize])
+}
@@ -0,0 +1,20 @@
+package utils
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestShouldRecoverSequenceFromInstanceId(t *testing.T) {
+	id := NewInstanceId(42, []byte("bkr-42"))
+	assert.Equal(t, uint64(42), InstanceSequence(id))
+	assert.NotEqual(t, id, NewInstanceId(42, []byte("bkr-43")))
+}
+
+func TestDerivedInstanceIdShouldKeepSequence(t *testing.T) {
+	parent := NewInstanceId(7, []byte("parent"))
+	derived := DeriveInstanceId(parent, []byte{1})
+	assert.Equal(t, uint64(7), InstanceSequence(derived))
+	assert.NotEqual(t, parent, derived)
+	assert.NotEqual(t, derived, DeriveInstanceId(parent, []byte{2}))
+}
@@ -0,0 +1,176 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"github.com/lmittmann/tint"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	cyan  = "\033[0;36m"
+	white = "\033[1;37m"
+)
+
+type LogFormat string
+
+const (
+	ColorFormat LogFormat = "color"
+	TextFormat  LogFormat = "text"
+	JSONFormat  LogFormat = "json"
+)
+
+// componentLevels holds the level of every component that has created a logger.
+// Levels are shared by all the nodes in the process and may be changed at runtime.
+var componentLevels = struct {
+	lock   sync.RWMutex
+	levels map[string]*slog.LevelVar
+}{levels: make(map[string]*slog.LevelVar)}
+
+var defaultLogger = NewLogger(os.Stdout, ColorFormat)
+
+// NewLogger creates a root logger that writes every record to w.
+// The filtering is done by the component loggers derived from it.
+func NewLogger(w io.Writer, format LogFormat) *slog.Logger {
+	var handler slog.Handler
+	switch format {
+	case JSONFormat:
+		handler = slog.NewJSONHandler(w, &slog.HandlerOptions{Level: slog.LevelDebug})
+	case TextFormat:
+		handler = slog.NewTextHandler(w, &slog.HandlerOptions{Level: slog.LevelDebug})
+	default:
+		handler = tint.NewHandler(w, &tint.Options{Level: slog.LevelDebug, TimeFormat: time.StampNano})
+	}
+	return slog.New(&rootHandler{colored: format == ColorFormat || format == "", inner: handler})
+}
+
+// DefaultLogger returns the coloured stdout logger used when no other logger is provided.
+func DefaultLogger() *slog.Logger {
+	return defaultLogger
+}
+
+// ComponentLogger derives the logger of a component from the logger of the node it belongs to.
+// The first logger created for a component sets its initial level.
+func ComponentLogger(logger *slog.Logger, component string, level slog.Level) *slog.Logger {
+	return slog.New(&componentHandler{
+		component: component,
+		level:     registerComponent(component, level),
+		inner:     logger.Handler(),
+	})
+}
+
+// GetLogger returns a component logger writing to the default logger.
+func GetLogger(prefix string, level slog.Level) *slog.Logger {
+	return ComponentLogger(defaultLogger, prefix, level)
+}
+
+func registerComponent(component string, level slog.Level) *slog.LevelVar {
+	componentLevels.lock.Lock()
+	defer componentLevels.lock.Unlock()
+	levelVar, ok := componentLevels.levels[component]
+	if !ok {
+		levelVar = &slog.LevelVar{}
+		levelVar.Set(level)
+		componentLevels.levels[component] = levelVar
+	}
+	return levelVar
+}
+
+// SetComponentLevel changes the level of a component in every node of the process.
+func SetComponentLevel(component string, level slog.Level) {
+	registerComponent(component, level).Set(level)
+}
+
+// SetAllComponentLevels changes the level of every component that has been registered.
+func SetAllComponentLevels(level slog.Level) {
+	componentLevels.lock.RLock()
+	defer componentLevels.lock.RUnlock()
+	for _, levelVar := range componentLevels.levels {
+		levelVar.Set(level)
+	}
+}
+
+func ComponentLevels() map[string]slog.Level {
+	componentLevels.lock.RLock()
+	defer componentLevels.lock.RUnlock()
+	levels := make(map[string]slog.Level, len(componentLevels.levels))
+	for component, levelVar := range componentLevels.levels {
+		levels[component] = levelVar.Level()
+	}
+	return levels
+}
+
+// ParseComponentLevels parses a comma separated list of component=level pairs, such as "BRB Channel=debug,ABA Channel=info".
+func ParseComponentLevels(spec string) (map[string]slog.Level, error) {
+	levels := make(map[string]slog.Level)
+	for _, pair := range strings.Split(spec, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		component, levelStr, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("missing level in %s", pair)
+		}
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(strings.TrimSpace(levelStr))); err != nil {
+			return nil, fmt.Errorf("unable to parse level of %s: %v", component, err)
+		}
+		levels[strings.TrimSpace(component)] = level
+	}
+	return levels, nil
+}
+
+type rootHandler struct {
+	colored bool
+	inner   slog.Handler
+}
+
+func (h *rootHandler) Enabled(ctx context.Context, lv slog.Level) bool {
+	return h.inner.Enabled(ctx, lv)
+}
+
+func (h *rootHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.inner.Handle(ctx, r)
+}
+
+func (h *rootHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &rootHandler{colored: h.colored, inner: h.inner.WithAttrs(attrs)}
+}
+
+func (h *rootHandler) WithGroup(name string) slog.Handler {
+	return &rootHandler{colored: h.colored, inner: h.inner.WithGroup(name)}
+}
+
+// componentHandler filters records with the level of its component.
+// In coloured output the component is prefixed to the message, otherwise it is added as an attribute.
+type componentHandler struct {
+	component string
+	level     *slog.LevelVar
+	inner     slog.Handler
+}
+
+func (h *componentHandler) Enabled(ctx context.Context, lv slog.Level) bool {
+	return lv >= h.level.Level() && h.inner.Enabled(ctx, lv)
+}
+
+func (h *componentHandler) Handle(ctx context.Context, r slog.Record) error {
+	if root, ok := h.inner.(*rootHandler); ok && root.colored {
+		r.Message = fmt.Sprintf("%s[%s]%s %s", cyan, h.component, white, r.Message)
+	} else {
+		r.AddAttrs(slog.String("component", h.component))
+	}
+	return h.inner.Handle(ctx, r)
+}
+
+func (h *componentHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &componentHandler{component: h.component, level: h.level, inner: h.inner.WithAttrs(attrs)}
+}
+
+func (h *componentHandler) WithGroup(name string) slog.Handler {
+	return &componentHandler{component: h.component, level: h.level, inner: h.inner.WithGroup(name)}
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"log/slog"
+	"testing"
+)
+
+func TestComponentLevelShouldBeAdjustableAtRuntime(t *testing.T) {
+	buf := bytes.NewBuffer([]byte{})
+	logger := ComponentLogger(NewLogger(buf, TextFormat), "Test Runtime Level", slog.LevelWarn)
+	logger.Info("hidden")
+	assert.Equal(t, 0, buf.Len())
+	SetComponentLevel("Test Runtime Level", slog.LevelInfo)
+	logger.Info("shown")
+	assert.Contains(t, buf.String(), "shown")
+	assert.Equal(t, slog.LevelInfo, ComponentLevels()["Test Runtime Level"])
+}
+
+func TestJSONLogsShouldCarryComponentAndNode(t *testing.T) {
+	buf := bytes.NewBuffer([]byte{})
+	nodeLogger := NewLogger(buf, JSONFormat).With("node", "n1")
+	ComponentLogger(nodeLogger, "Test JSON", slog.LevelDebug).Debug("hello")
+	record := make(map[string]any)
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "hello", record["msg"])
+	assert.Equal(t, "Test JSON", record["component"])
+	assert.Equal(t, "n1", record["node"])
+}
+
+func TestShouldParseComponentLevels(t *testing.T) {
+	levels, err := ParseComponentLevels("BRB Channel=debug, ABA Channel=info")
+	assert.NoError(t, err)
+	assert.Equal(t, slog.LevelDebug, levels["BRB Channel"])
+	assert.Equal(t, slog.LevelInfo, levels["ABA Channel"])
+	_, err = ParseComponentLevels("BRB Channel")
+	assert.Error(t, err)
+}
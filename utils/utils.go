@@ -3,15 +3,12 @@ package utils
 import (
 	"bytes"
 	"crypto/ecdsa"
+	"crypto/rand"
 	"crypto/sha256"
 	"crypto/x509"
 	"fmt"
 	"github.com/cloudflare/circl/group"
 	. "github.com/google/uuid"
-	"github.com/lmittmann/tint"
-	"log/slog"
-	"os"
-	"time"
 	"unsafe"
 )
 
@@ -40,6 +37,31 @@ func SerializePublicKey(pk *ecdsa.PublicKey) ([]byte, error) {
 	return x509.MarshalPKIXPublicKey(pk)
 }
 
+// ParsePublicKey decodes a key encoded by SerializePublicKey.
+func ParsePublicKey(pkBytes []byte) (*ecdsa.PublicKey, error) {
+	key, err := x509.ParsePKIXPublicKey(pkBytes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse public key: %v", err)
+	}
+	pk, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key is not an ecdsa key")
+	}
+	return pk, nil
+}
+
+// Sign signs the SHA-256 hash of data with sk.
+func Sign(sk *ecdsa.PrivateKey, data []byte) ([]byte, error) {
+	hash := sha256.Sum256(data)
+	return ecdsa.SignASN1(rand.Reader, sk, hash[:])
+}
+
+// VerifySignature checks a signature produced by Sign.
+func VerifySignature(pk *ecdsa.PublicKey, data, sig []byte) bool {
+	hash := sha256.Sum256(data)
+	return ecdsa.VerifyASN1(pk, hash[:], sig)
+}
+
 func PkToUUID(pk *ecdsa.PublicKey) (UUID, error) {
 	pkBytes, err := SerializePublicKey(pk)
 	if err != nil {
@@ -48,15 +70,6 @@ func PkToUUID(pk *ecdsa.PublicKey) (UUID, error) {
 	return BytesToUUID(pkBytes), nil
 }
 
-func GetLogger(prefix string, level slog.Level) *slog.Logger {
-	coloredHandler := tint.NewHandler(os.Stdout, &tint.Options{
-		Level:      level,
-		TimeFormat: time.StampNano,
-	})
-	prefixedHandler := NewPrefixedHandler(prefix, coloredHandler)
-	return slog.New(prefixedHandler)
-}
-
 func GetScalarSize() (int, error) {
 	scalar := group.Ristretto255.NewScalar()
 	scalarBytes, err := scalar.MarshalBinary()
@@ -0,0 +1,201 @@
+package validatedAgreement
+
+import (
+	aba "bkr-acs/asynchronousBinaryAgreement"
+	ct "bkr-acs/coinTosser"
+	"bkr-acs/utils"
+	"encoding/binary"
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+	"log/slog"
+	"sync"
+)
+
+// mvba decides on one of the valid proposals broadcast in an instance.
+// Once it holds n-f valid proposals, it broadcasts a commit naming their senders, and waits for n-f commits whose
+// proposals it holds, as in the protocol of Cachin, Kursawe, Petzold and Shoup. Only then does it reveal the leader of
+// each round with the coin and run an ABA on whether to decide the proposal of the leader, voting 1 if it holds that
+// proposal. Since the commits are fixed before any leader is known, the adversary cannot withhold the proposal of the
+// leader from the correct nodes, and each round decides 1 with constant probability.
+// A decision of 1 means that a correct node delivered the proposal, so every correct node eventually delivers it too,
+// and the predicate accepts it at every node.
+type mvba struct {
+	id           uuid.UUID
+	n            uint
+	f            uint
+	participants []uuid.UUID
+	abaChannel   *aba.AbaChannel
+	ctChannel    *ct.CTChannel
+	lock         sync.Mutex
+	proposals    map[uuid.UUID][]byte
+	commits      map[uuid.UUID][]uuid.UUID
+	arrived      chan struct{}
+	output       chan []byte
+	done         chan struct{}
+	onCommit     func(id uuid.UUID, held []uuid.UUID)
+	onOutput     func(id uuid.UUID, value []byte)
+	logger       *slog.Logger
+}
+
+func newMVBA(id uuid.UUID, n, f uint, participants []uuid.UUID, abaChannel *aba.AbaChannel, ctChannel *ct.CTChannel, onCommit func(uuid.UUID, []uuid.UUID), onOutput func(uuid.UUID, []byte), logger *slog.Logger) *mvba {
+	m := &mvba{
+		id:           id,
+		n:            n,
+		f:            f,
+		participants: participants,
+		abaChannel:   abaChannel,
+		ctChannel:    ctChannel,
+		proposals:    make(map[uuid.UUID][]byte),
+		commits:      make(map[uuid.UUID][]uuid.UUID),
+		arrived:      make(chan struct{}, 1),
+		output:       make(chan []byte, 1),
+		done:         make(chan struct{}),
+		onCommit:     onCommit,
+		onOutput:     onOutput,
+		logger:       utils.ComponentLogger(logger, "MVBA Instance", slog.LevelWarn),
+	}
+	m.logger.Info("initializing mvba", "id", id, "n", n, "f", f)
+	go m.run()
+	return m
+}
+
+// receiveProposal stores the first valid proposal delivered from each participant.
+func (m *mvba) receiveProposal(proposal []byte, sender uuid.UUID) {
+	m.lock.Lock()
+	if _, ok := m.proposals[sender]; !ok {
+		m.proposals[sender] = proposal
+	}
+	m.lock.Unlock()
+	m.notify()
+}
+
+// receiveCommit stores the first commit delivered from each participant, which names the senders of n-f proposals.
+func (m *mvba) receiveCommit(held []uuid.UUID, sender uuid.UUID) {
+	m.lock.Lock()
+	if _, ok := m.commits[sender]; !ok {
+		m.commits[sender] = held
+	}
+	m.lock.Unlock()
+	m.notify()
+}
+
+func (m *mvba) notify() {
+	select {
+	case m.arrived <- struct{}{}:
+	default:
+	}
+}
+
+func (m *mvba) heldSenders() []uuid.UUID {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return lo.Keys(m.proposals)
+}
+
+// numCommits counts the commits whose proposals this node holds, so that it can vote for any leader they name.
+func (m *mvba) numCommits() uint {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return uint(lo.CountBy(lo.Values(m.commits), func(held []uuid.UUID) bool {
+		return lo.EveryBy(held, func(sender uuid.UUID) bool { _, ok := m.proposals[sender]; return ok })
+	}))
+}
+
+func (m *mvba) numProposals() uint {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return uint(len(m.proposals))
+}
+
+func (m *mvba) getProposal(sender uuid.UUID) ([]byte, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	proposal, ok := m.proposals[sender]
+	return proposal, ok
+}
+
+// waitFor blocks until the condition holds, and returns false if the instance is closed first.
+func (m *mvba) waitFor(condition func() bool) bool {
+	for !condition() {
+		select {
+		case <-m.arrived:
+		case <-m.done:
+			return false
+		}
+	}
+	return true
+}
+
+func (m *mvba) run() {
+	if !m.waitFor(func() bool { return m.numProposals() >= m.n-m.f }) {
+		return
+	}
+	m.onCommit(m.id, m.heldSenders())
+	if !m.waitFor(func() bool { return m.numCommits() >= m.n-m.f }) {
+		return
+	}
+	for round := uint16(0); ; round++ {
+		leader, ok := m.electLeader(round)
+		if !ok {
+			return
+		}
+		_, held := m.getProposal(leader)
+		decision, ok := m.agree(round, held)
+		if !ok {
+			return
+		} else if decision == 0 {
+			m.logger.Info("leader rejected", "round", round, "leader", leader)
+			continue
+		}
+		m.logger.Info("leader accepted", "round", round, "leader", leader)
+		if !m.waitFor(func() bool { _, ok := m.getProposal(leader); return ok }) {
+			return
+		}
+		value, _ := m.getProposal(leader)
+		m.onOutput(m.id, value)
+		m.output <- value
+		return
+	}
+}
+
+// electLeader draws the leader of the round from the index given by a single toss of the coin.
+func (m *mvba) electLeader(round uint16) (uuid.UUID, bool) {
+	idx := make(chan uint, 1)
+	seed := binary.LittleEndian.AppendUint16(append(m.id[:], "leader"...), round)
+	m.ctChannel.TossIndex(seed, uint(len(m.participants)), idx)
+	select {
+	case i := <-idx:
+		return m.participants[i], true
+	case <-m.done:
+		return uuid.Nil, false
+	}
+}
+
+// agree runs the ABA of the round on whether to decide the proposal of its leader.
+func (m *mvba) agree(round uint16, held bool) (byte, bool) {
+	abaId := utils.DeriveInstanceId(m.id, binary.LittleEndian.AppendUint16([]byte("round"), round))
+	instance := m.abaChannel.NewAbaInstance(abaId)
+	if instance == nil {
+		return 0, false
+	}
+	vote := byte(0)
+	if held {
+		vote = 1
+	}
+	if err := instance.Propose(vote); err != nil {
+		m.logger.Warn("unable to propose to aba", "round", round, "error", err)
+		return 0, false
+	}
+	decision := make(chan byte, 1)
+	go func() { decision <- instance.GetOutput() }()
+	select {
+	case d := <-decision:
+		return d, true
+	case <-m.done:
+		return 0, false
+	}
+}
+
+func (m *mvba) close() {
+	close(m.done)
+}
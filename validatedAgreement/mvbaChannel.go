@@ -0,0 +1,264 @@
+package validatedAgreement
+
+import (
+	aba "bkr-acs/asynchronousBinaryAgreement"
+	brb "bkr-acs/byzantineReliableBroadcast"
+	ct "bkr-acs/coinTosser"
+	"bkr-acs/utils"
+	"encoding/hex"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+	"log/slog"
+	"slices"
+)
+
+const commitTag = "commit"
+
+// Predicate tells whether a value is a valid decision of an instance. It must give the same answer at every correct node.
+type Predicate func(id uuid.UUID, value []byte) bool
+
+// MVBAChannel agrees on a single value that satisfies the predicate, among the values proposed by the participants.
+type MVBAChannel struct {
+	n             uint
+	f             uint
+	abaChannel    *aba.AbaChannel
+	ctChannel     *ct.CTChannel
+	brbChannel    *brb.BRBChannel
+	participants  []uuid.UUID
+	predicate     Predicate
+	instances     map[uuid.UUID]*mvba
+	finished      map[uuid.UUID]bool
+	watermark     uint64
+	policy        utils.AdmissionPolicy
+	commands      chan func() error
+	closeChan     chan struct{}
+	closeListener chan struct{}
+	logger        *slog.Logger
+}
+
+// NewMVBAChannel creates a channel whose proposals are disseminated with brbChannel and whose leaders are elected with ctChannel.
+// The channel consumes every delivery of brbChannel, which must not be shared, while abaChannel and ctChannel may be.
+func NewMVBAChannel(n, f uint, abaChannel *aba.AbaChannel, ctChannel *ct.CTChannel, brbChannel *brb.BRBChannel, participants []uuid.UUID, predicate Predicate, logger *slog.Logger) *MVBAChannel {
+	c := &MVBAChannel{
+		n:             n,
+		f:             f,
+		abaChannel:    abaChannel,
+		ctChannel:     ctChannel,
+		brbChannel:    brbChannel,
+		participants:  participants,
+		predicate:     predicate,
+		instances:     make(map[uuid.UUID]*mvba),
+		finished:      make(map[uuid.UUID]bool),
+		commands:      make(chan func() error),
+		closeChan:     make(chan struct{}, 1),
+		closeListener: make(chan struct{}, 1),
+		logger:        utils.ComponentLogger(logger, "MVBA Channel", slog.LevelWarn),
+	}
+	c.logger.Info("initializing channel", "n", n, "f", f, "participants", participants)
+	go c.listenBroadcasts()
+	go c.invoker()
+	return c
+}
+
+// Propose submits this node's value to the instance with the given id, and returns a channel that receives the decision.
+func (c *MVBAChannel) Propose(id uuid.UUID, value []byte) (chan []byte, error) {
+	if !c.predicate(id, value) {
+		return nil, fmt.Errorf("proposal to mvba instance %s is not valid", id)
+	}
+	res := make(chan error, 1)
+	var output chan []byte
+	c.commands <- func() error {
+		if instance, err := c.getInstance(id); err != nil {
+			res <- err
+		} else {
+			output = instance.output
+			res <- nil
+		}
+		return nil
+	}
+	if err := <-res; err != nil {
+		return nil, fmt.Errorf("unable to propose: %v", err)
+	}
+	c.logger.Debug("broadcasting proposal", "id", id)
+	if _, err := c.brbChannel.BRBroadcastWithTag(utils.InstanceSequence(id), id[:], value); err != nil {
+		return nil, fmt.Errorf("unable to broadcast proposal: %v", err)
+	}
+	return output, nil
+}
+
+// SetLowWatermark drops the state of the instances with a sequence below seq, along with the state of their broadcasts and agreements.
+func (c *MVBAChannel) SetLowWatermark(seq uint64) {
+	c.commands <- func() error {
+		if seq <= c.watermark {
+			return nil
+		}
+		c.watermark = seq
+		for id := range c.finished {
+			if c.isCollected(id) {
+				delete(c.finished, id)
+			}
+		}
+		for id, instance := range c.instances {
+			if c.isCollected(id) {
+				delete(c.instances, id)
+				instance.close()
+			}
+		}
+		return nil
+	}
+	c.brbChannel.SetLowWatermark(seq)
+	c.abaChannel.SetLowWatermark(seq)
+}
+
+// SetAdmissionPolicy limits the instances, broadcasts and agreements that peers can create on this node.
+// Proposals to instances beyond the window are rejected, since the nodes applying the same policy would ignore them.
+func (c *MVBAChannel) SetAdmissionPolicy(policy utils.AdmissionPolicy) {
+	c.commands <- func() error {
+		c.policy = policy
+		return nil
+	}
+	c.brbChannel.SetAdmissionPolicy(policy)
+	c.abaChannel.SetAdmissionPolicy(policy)
+}
+
+func (c *MVBAChannel) isCollected(id uuid.UUID) bool {
+	return utils.InstanceSequence(id) < c.watermark
+}
+
+func (c *MVBAChannel) inWindow(id uuid.UUID) bool {
+	return c.policy.Window == 0 || utils.InstanceSequence(id)-c.watermark < c.policy.Window
+}
+
+func (c *MVBAChannel) getInstance(id uuid.UUID) (*mvba, error) {
+	if c.isCollected(id) {
+		return nil, fmt.Errorf("mvba instance %s is below the low watermark", id)
+	} else if !c.inWindow(id) {
+		return nil, fmt.Errorf("mvba instance %s is beyond the admission window", id)
+	} else if c.finished[id] {
+		return nil, fmt.Errorf("mvba instance %s is already finished", id)
+	} else if instance, ok := c.instances[id]; ok {
+		return instance, nil
+	}
+	instance := newMVBA(id, c.n, c.f, c.participants, c.abaChannel, c.ctChannel, c.broadcastCommit, c.finishInstance, c.logger)
+	c.instances[id] = instance
+	return instance, nil
+}
+
+// broadcastCommit broadcasts the senders of the proposals held by this node, with the id of the instance and the commit
+// tag as the tag of the broadcast.
+func (c *MVBAChannel) broadcastCommit(id uuid.UUID, held []uuid.UUID) {
+	content := make([]byte, 0, len(held)*len(uuid.UUID{}))
+	for _, sender := range held {
+		content = append(content, sender[:]...)
+	}
+	if _, err := c.brbChannel.BRBroadcastWithTag(utils.InstanceSequence(id), append(id[:], commitTag...), content); err != nil {
+		c.logger.Warn("unable to broadcast commit", "id", id, "error", err)
+	}
+}
+
+func (c *MVBAChannel) finishInstance(id uuid.UUID, value []byte) {
+	c.brbChannel.Transcript().RecordDecision("mvba", map[string]string{"instance": id.String(), "value": hex.EncodeToString(value)})
+	c.commands <- func() error {
+		if instance, ok := c.instances[id]; ok {
+			delete(c.instances, id)
+			c.finished[id] = true
+			instance.close()
+		}
+		return nil
+	}
+}
+
+func (c *MVBAChannel) listenBroadcasts() {
+	for {
+		select {
+		case msg := <-c.brbChannel.BrbDeliver:
+			c.commands <- func() error {
+				return c.processBroadcast(msg)
+			}
+		case <-c.closeListener:
+			c.logger.Info("closing listener")
+			return
+		}
+	}
+}
+
+// processBroadcast hands a proposal or a commit to its instance, discarding those of non-participants, the proposals
+// the predicate rejects and the commits that do not name n-f participants.
+// A broadcast must have the sequence of the instance it names, so that each participant has a single broadcast of each
+// kind per instance, which all correct nodes deliver, rather than one per sequence delivered in different orders.
+func (c *MVBAChannel) processBroadcast(msg brb.BRBMsg) error {
+	isCommit := len(msg.Tag) == len(uuid.UUID{})+len(commitTag) && string(msg.Tag[len(uuid.UUID{}):]) == commitTag
+	if len(msg.Tag) != len(uuid.UUID{}) && !isCommit {
+		return fmt.Errorf("tag of %d bytes is not the id of an instance", len(msg.Tag))
+	}
+	id := uuid.UUID(msg.Tag[:len(uuid.UUID{})])
+	if !slices.Contains(c.participants, msg.Sender) {
+		return fmt.Errorf("broadcast from non participant %s", msg.Sender)
+	} else if seq := utils.InstanceSequence(msg.Id); utils.InstanceSequence(id) != seq {
+		return fmt.Errorf("broadcast to mvba instance %s from %s with sequence %d", id, msg.Sender, seq)
+	} else if c.isCollected(id) || c.finished[id] {
+		return nil
+	} else if !c.inWindow(id) {
+		return fmt.Errorf("broadcast to mvba instance %s from %s beyond the admission window", id, msg.Sender)
+	} else if isCommit {
+		return c.processCommit(id, msg.Content, msg.Sender)
+	} else if !c.predicate(id, msg.Content) {
+		c.logger.Warn("discarding invalid proposal", "id", id, "sender", msg.Sender)
+		return nil
+	}
+	instance, err := c.getInstance(id)
+	if err != nil {
+		return fmt.Errorf("unable to get instance: %v", err)
+	}
+	instance.receiveProposal(msg.Content, msg.Sender)
+	return nil
+}
+
+func (c *MVBAChannel) processCommit(id uuid.UUID, content []byte, sender uuid.UUID) error {
+	held, err := c.parseCommit(content)
+	if err != nil {
+		return fmt.Errorf("invalid commit from %s: %v", sender, err)
+	}
+	instance, err := c.getInstance(id)
+	if err != nil {
+		return fmt.Errorf("unable to get instance: %v", err)
+	}
+	instance.receiveCommit(held, sender)
+	return nil
+}
+
+// parseCommit reads the senders named by a commit, which must be n-f distinct participants.
+func (c *MVBAChannel) parseCommit(content []byte) ([]uuid.UUID, error) {
+	if len(content)%len(uuid.UUID{}) != 0 {
+		return nil, fmt.Errorf("commit of %d bytes is not a list of ids", len(content))
+	}
+	held := lo.Map(lo.Chunk(content, len(uuid.UUID{})), func(id []byte, _ int) uuid.UUID { return uuid.UUID(id) })
+	if len(lo.Uniq(held)) != len(held) {
+		return nil, fmt.Errorf("commit names a sender twice")
+	} else if uint(len(held)) < c.n-c.f {
+		return nil, fmt.Errorf("commit names %d senders instead of at least %d", len(held), c.n-c.f)
+	} else if sender, ok := lo.Find(held, func(id uuid.UUID) bool { return !slices.Contains(c.participants, id) }); ok {
+		return nil, fmt.Errorf("commit names non participant %s", sender)
+	}
+	return held, nil
+}
+
+func (c *MVBAChannel) invoker() {
+	for {
+		select {
+		case cmd := <-c.commands:
+			if err := cmd(); err != nil {
+				c.logger.Warn("error executing command", "error", err)
+			}
+		case <-c.closeChan:
+			c.logger.Info("closing invoker")
+			return
+		}
+	}
+}
+
+func (c *MVBAChannel) Close() {
+	c.closeListener <- struct{}{}
+	c.closeChan <- struct{}{}
+}
@@ -0,0 +1,120 @@
+package validatedAgreement
+
+import (
+	aba "bkr-acs/asynchronousBinaryAgreement"
+	brb "bkr-acs/byzantineReliableBroadcast"
+	ct "bkr-acs/coinTosser"
+	on "bkr-acs/overlayNetwork"
+	"bkr-acs/utils"
+	"bytes"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func notBad(_ uuid.UUID, value []byte) bool {
+	return !bytes.HasPrefix(value, []byte("bad"))
+}
+
+func TestChannelShouldDecideOwnProposal(t *testing.T) {
+	testChannelShouldDecideValidProposal(t, 1, 0, 0)
+}
+
+func TestChannelShouldDecideValidProposalNoFaults(t *testing.T) {
+	testChannelShouldDecideValidProposal(t, 4, 1, 0)
+}
+
+func TestChannelShouldDecideValidProposalWithInvalidProposers(t *testing.T) {
+	testChannelShouldDecideValidProposal(t, 4, 1, 1)
+}
+
+func TestChannelShouldDecideValidProposalManyNodes(t *testing.T) {
+	testChannelShouldDecideValidProposal(t, 7, 2, 2)
+}
+
+func testChannelShouldDecideValidProposal(t *testing.T, n, f, invalid uint) {
+	nodes := lo.Map(lo.Range(int(n)), func(i int, _ int) *on.Node {
+		return on.GetTestNode(t, fmt.Sprintf("localhost:%d", 6000+i), "localhost:6000")
+	})
+	channels := getChannels(t, n, f, nodes)
+	id := uuid.New()
+	for i, c := range channels[:invalid] {
+		proposal := []byte(fmt.Sprintf("bad proposal %d", i))
+		_, err := c.Propose(id, proposal)
+		assert.Error(t, err)
+		_, err = c.brbChannel.BRBroadcastWithTag(utils.InstanceSequence(id), id[:], proposal)
+		assert.NoError(t, err)
+	}
+	outputs := lo.Map(channels[invalid:], func(c *MVBAChannel, i int) chan []byte {
+		output, err := c.Propose(id, []byte(fmt.Sprintf("proposal %d", i)))
+		assert.NoError(t, err)
+		return output
+	})
+	decisions := lo.Map(outputs, func(output chan []byte, _ int) []byte { return <-output })
+	assert.True(t, notBad(id, decisions[0]))
+	assert.True(t, lo.EveryBy(decisions, func(decision []byte) bool { return bytes.Equal(decision, decisions[0]) }))
+	for _, c := range channels {
+		c.Close()
+	}
+	assert.True(t, lo.EveryBy(nodes, func(node *on.Node) bool { return node.Close() == nil }))
+}
+
+func getChannels(t *testing.T, n, f uint, nodes []*on.Node) []*MVBAChannel {
+	participants := lo.Map(nodes, func(node *on.Node, _ int) uuid.UUID {
+		id, err := node.GetId()
+		assert.NoError(t, err)
+		return id
+	})
+	dealSSs := lo.Map(nodes, func(node *on.Node, _ int) *on.SSChannel { return on.NewSSChannel(node, 'd') })
+	ctBebs := lo.Map(nodes, func(node *on.Node, _ int) *on.BEBChannel { return on.NewBEBChannel(node, 'c') })
+	mBebs := lo.Map(nodes, func(node *on.Node, _ int) *on.BEBChannel { return on.NewBEBChannel(node, 'm') })
+	tBebs := lo.Map(nodes, func(node *on.Node, _ int) *on.BEBChannel { return on.NewBEBChannel(node, 't') })
+	brbBebs := lo.Map(nodes, func(node *on.Node, _ int) *on.BEBChannel { return on.NewBEBChannel(node, 'v') })
+	on.InitializeNodes(t, nodes)
+	ctChannels := lo.Map(dealSSs, func(dealSS *on.SSChannel, i int) *ct.CTChannel {
+		c, err := ct.NewCoinTosserChannel(dealSS, ctBebs[i], 2*f, nodes[i].Logger())
+		assert.NoError(t, err)
+		return c
+	})
+	assert.NoError(t, ct.DealSecret(dealSSs[0], ct.NewScalar(42), 2*f))
+	return lo.Map(nodes, func(node *on.Node, i int) *MVBAChannel {
+		abaChannel := aba.NewAbaChannelWithCoinTosser(n, f, ctChannels[i], mBebs[i], tBebs[i], node.Logger())
+		brbChannel := brb.NewBRBChannel(n, f, brbBebs[i], node.Logger())
+		return NewMVBAChannel(n, f, abaChannel, ctChannels[i], brbChannel, participants, notBad, node.Logger())
+	})
+}
+
+func TestChannelShouldRejectBroadcastsOfOtherSequences(t *testing.T) {
+	participants := lo.Times(4, func(_ int) uuid.UUID { return uuid.New() })
+	c := &MVBAChannel{n: 4, f: 1, participants: participants, predicate: notBad, policy: utils.AdmissionPolicy{Window: 4}}
+	id, beyond := utils.NewInstanceId(1, []byte("mvba")), utils.NewInstanceId(4, []byte("mvba"))
+	proposal := func(seq uint64, id uuid.UUID) brb.BRBMsg {
+		return brb.BRBMsg{Id: brb.InstanceId(participants[0], seq, id[:]), Tag: id[:], Content: []byte("proposal"), Sender: participants[0]}
+	}
+	assert.ErrorContains(t, c.processBroadcast(proposal(2, id)), "sequence 2")
+	assert.ErrorContains(t, c.processBroadcast(proposal(4, beyond)), "admission window")
+	commit := proposal(2, id)
+	commit.Tag = append(id[:], commitTag...)
+	assert.ErrorContains(t, c.processBroadcast(commit), "sequence 2")
+}
+
+func TestChannelShouldRejectMalformedCommits(t *testing.T) {
+	participants := lo.Times(4, func(_ int) uuid.UUID { return uuid.New() })
+	c := &MVBAChannel{n: 4, f: 1, participants: participants}
+	commit := func(ids ...uuid.UUID) []byte {
+		return lo.Flatten(lo.Map(ids, func(id uuid.UUID, _ int) []byte { return id[:] }))
+	}
+	held, err := c.parseCommit(commit(participants[:3]...))
+	assert.NoError(t, err)
+	assert.Equal(t, participants[:3], held)
+	_, err = c.parseCommit(commit(participants[:2]...))
+	assert.Error(t, err)
+	_, err = c.parseCommit(commit(participants[0], participants[1], participants[1]))
+	assert.Error(t, err)
+	_, err = c.parseCommit(commit(participants[0], participants[1], uuid.New()))
+	assert.Error(t, err)
+	_, err = c.parseCommit(commit(participants[:3]...)[1:])
+	assert.Error(t, err)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	acs "bkr-acs/agreementCommonSubset"
+	dc "bkr-acs/decisionCertificate"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+	"os"
+)
+
+// verifyCommand checks a certified decision, as served by the client API of a node, against the membership file.
+// It trusts neither the node that served it nor any other node, only the keys of the membership.
+func verifyCommand(args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	membershipPathname := flags.String("membership", "keys/membership.json", "membership file produced by keygen")
+	decisionPathname := flags.String("decision", "", "file with the answer of GET /decisions/{instance}/certificate")
+	faulty := flags.Int("faulty", -1, "number of faulty nodes tolerated by the cluster (the most the membership tolerates if negative)")
+	_ = flags.Parse(args)
+	m, err := loadMembership(*membershipPathname)
+	if err != nil {
+		return fmt.Errorf("unable to load membership: %v", err)
+	}
+	data, err := os.ReadFile(*decisionPathname)
+	if err != nil {
+		return fmt.Errorf("unable to read decision: %v", err)
+	}
+	var decision certifiedDecision
+	if err := json.Unmarshal(data, &decision); err != nil {
+		return fmt.Errorf("unable to parse decision: %v", err)
+	}
+	n := uint(len(m.Members))
+	f := (n - 1) / 3
+	if *faulty >= 0 {
+		f = uint(*faulty)
+	}
+	if n <= 3*f {
+		return fmt.Errorf("%d members cannot tolerate %d faults", n, f)
+	}
+	if err := verifyDecision(m, decision, f); err != nil {
+		return fmt.Errorf("decision of instance %s is not proven: %v", decision.Instance, err)
+	}
+	fmt.Printf("decision of instance %s with %d proposals is certified by %d of %d members\n", decision.Instance, len(decision.Proposals), dc.Quorum(n, f), n)
+	return nil
+}
+
+func verifyDecision(m membership, decision certifiedDecision, f uint) error {
+	cert := &dc.Certificate{}
+	if err := cert.UnmarshalBinary(decision.Certificate); err != nil {
+		return fmt.Errorf("unable to parse certificate: %v", err)
+	}
+	participants := lo.Map(m.Members, func(mem member, _ int) uuid.UUID { return mem.Id })
+	return acs.VerifyOutput(cert, decision.Instance, decision.Proposals, participants, uint(len(participants)), f)
+}